@@ -26,68 +26,146 @@ var helpText = func(colors logger.Colors) string {
 
 ` + colors.Bold + `Simple options:` + colors.Default + `
 Options:
-  --analyse             Collect metadata about the source modules
+  --analyse             Collect metadata about the source modules (can be
+                        spelled --analyze too)
   --bundle              Bundle all dependencies into the output files
+                        (--bundle=false turns it off again)
   --define:K=V          Substitute K with V while parsing
   --external:M          Exclude module M from the bundle (can use * wildcards)
-  --format=...          Output format (iife | cjs | umd | esm, no default when
+  --format=...          Output format (iife | cjs | umd | system | esm, no default when
 		                    not bundling, otherwise default is iife when platform
-                        is browser and cjs when platform is node)
+                        is browser and cjs when platform is node; "esm,cjs"
+                        builds both with .mjs and .cjs extensions)
   --loader:X=L          Use loader L to load file extension X, where L is
-                        one of: js | jsx | ts | tsx | json | text | base64 |
-                        file | dataurl | binary
-  --minify              Minify the output (sets all --minify-* flags)
+                        one of: js | jsx | ts | tsx | json | json5 | text |
+                        base64 | file | asset | dataurl | binary
+  --minify              Minify the output (sets all --minify-* flags,
+                        --minify=false turns them off again)
   --outdir=...          The output directory (for multiple entry points)
   --outfile=...         The output file (for one entry point)
   --platform=...        Platform target (browser | node | neutral,
                         default browser)
   --serve=...           Start a local HTTP server on this host:port for outputs
   --sourcemap           Emit a source map
-  --splitting           Enable code splitting (currently only for esm)
+  --splitting           Enable code splitting (currently only for esm and cjs)
   --summary             Print some helpful information at the end of a build
   --target=...          Environment target (e.g. es2017, chrome58, firefox57,
                         safari11, edge16, node10, default esnext)
+  --transform           Transform a single file without bundling and print
+                        the output to stdout (or to --outfile, can be used
+                        with --watch)
   --watch               Watch mode: rebuild on file system changes
 
 ` + colors.Bold + `Advanced options:` + colors.Default + `
+  --allow-overwrite         Allow output files to overwrite input files
   --amdconfig=...           Use this amdconfig.json to resolve module paths
+                            (repeat to merge more files, later ones override)
+  --amd-validate            Check the file from --amdconfig and exit without
+                            building
+  --asset-inline-limit=...  Inline files smaller than this many bytes by the
+                            "asset" loader, copy the larger ones (default 0)
+  --asset-names=...         Path template for "file" loader files relative to
+                            --outdir (default "[name].[hash]", can also use
+                            [dir])
+  --auto-extension          Use ".mjs" for --format=esm and ".cjs" for
+                            --format=cjs instead of ".js" by default
   --banner=...              Text to be prepended to each output file
+                            (same as --banner:js=..., use --banner:css=...
+                            for CSS output files)
   --charset=utf8            Do not escape UTF-8 code points
+  --check-dev-dependencies  Warn about bundled packages listed only in
+                            "devDependencies" in package.json
+  --chmod=...               Octal permissions of entry point output files
+                            (default 755 with a hashbang, 644 otherwise)
+  --chunk-names=...         Path template for shared chunks relative to
+                            --outdir (default "[name].[hash]")
   --color=...               Force use of color terminal escapes (true | false)
+  --comments=...            Which comments to keep (all | none | legal,
+                            independent of --minify)
+  --conditions=...          Custom conditions to match in the "exports" and
+                            "imports" fields of package.json (in addition to
+                            import, require, default and the platform)
+  --config=...              Read build options from this JSON file before the
+                            flags (bundle, define, entryPoints, external,
+                            format, loader, outdir, target)
+  --drop:...                Remove calls to console methods (console or
+                            console.METHOD) or debugger statements
+  --entry-banner:E=T        Add text T after --banner to the entry point E
+  --entry-footer:E=T        Add text T after --footer to the entry point E
+  --entry-format:E=F        Use format F for the entry point E instead of the
+                            one from --format
+  --entry-names=...         Path template for entry points relative to --outdir
+                            (default "[dir]/[name]", can also use [hash])
   --error-limit=...         Maximum error count or 0 to disable (default 10)
+  --external-file=...       Read modules to exclude from the bundle from a file,
+                            one per line (same as --external:M for each line)
   --footer=...              Text to be appended to each output file
+                            (same as --footer:js=..., use --footer:css=...
+                            for CSS output files)
+  --glob-root=...           Where relative entry points with "*" and "**"
+                            wildcards are matched (default current directory)
+  --global-external:M=G     Read the external module M from the global G in
+                            the UMD format (default root["M"])
   --global-name=...         The name of the global for the IIFE or UMD formats
+  --include-define-stats    Add how many times each define was substituted to
+                            the metafile (analyse only)
+  --include-hashes          Add a hash of the original source of each input
+                            to the metafile
   --inject:F                Import the file F into all input files and
                             automatically replace matching globals with imports
+  --jsx=...                 Set to "preserve" to keep JSX syntax in the output
+                            (default "transform")
   --jsx-factory=...         What to use for JSX instead of React.createElement
   --jsx-fragment=...        What to use for JSX instead of React.Fragment
   --keep-names              Preserve "name" on functions and classes
+                            (files with "// @esbuild-keep-names off" opt out)
+  --legal-comments=...      Where to put legal comments (none | inline | eof |
+                            linked | external, default eof when bundling
+                            and minifying, inline otherwise)
   --log-level=...           Disable logging (info | warning | error | silent,
                             default info)
+  --log-override:X=Y        Use log level Y for the message with id X
+                            (info | warning | error | silent)
   --main-fields=...         Override the main file order in package.json
                             (default "browser,module,main" when platform is
                             browser and "main,module" when platform is node)
+  --mangle-keyframes        Rename CSS @keyframes and their uses in animations
+                            consistently within the bundle (kept by default)
   --metafile=...            Write metadata about the build to a JSON file
+  --metafile-pretty         Indent the metafile instead of writing compact JSON
+  --metrics                 Print how long the build phases took to stderr
   --minify-whitespace       Remove whitespace in output files
   --minify-identifiers      Shorten identifiers in output files
   --minify-syntax           Use equivalent but shorter syntax in output files
+  --no-side-effects:M       Remove unused imports of module M like if it had
+                            "sideEffects": false in package.json
   --out-extension:.js=.mjs  Use a custom output extension instead of ".js"
   --outbase=...             The base path used to determine entry point output
                             paths (for multiple entry points)
+  --package-exports         Write the "exports" field for package.json to
+                            package-exports.json in the output directory
+  --polyfills               Prepend polyfills of runtime APIs missing in the
+                            target (Object.assign, Object.entries, ...)
   --preserve-symlinks       Disable symlink resolution for module lookup
   --public-path=...         Set the base URL for the "file" loader
   --pure:N                  Mark the name N as a pure function for tree shaking
+  --report-type-elision     Log the TypeScript imports removed as type-only
   --resolve-extensions=...  A comma-separated list of implicit extensions
                             (default ".tsx,.ts,.jsx,.mjs,.cjs,.js,.css,.json")
+  --restrict-imports=...    A comma-separated list of directories; importing
+                            files outside of them is an error
   --servedir=...            What to serve in addition to generated output files
   --sourcefile=...          Set the source file for the source map (for stdin)
   --sourcemap=external      Do not link to the source map with a comment
   --sourcemap=inline        Emit the source map with an inline data URL
   --sources-content=false   Omit "sourcesContent" in generated source maps
+  --trace=...               Write the time spent in the build to a JSON file
+                            in the Chrome trace format
   --tree-shaking=...        Set to "ignore-annotations" to work with packages
                             that have incorrect tree-shaking annotations
   --tsconfig=...            Use this tsconfig.json file instead of other ones
   --version                 Print the current version (` + esbuildVersion + `) and exit
+  --wasm-module             Import .wasm files as modules with named exports
 
 ` + colors.Bold + `Examples:` + colors.Default + `
   ` + colors.Dim + `# Produces dist/entry_point.js and dist/entry_point.js.map` + colors.Default + `
@@ -102,6 +180,9 @@ Options:
   ` + colors.Dim + `# Provide input via stdin, get output via stdout` + colors.Default + `
   esbuild --minify --loader=ts < input.ts > output.js
 
+  ` + colors.Dim + `# Transform a single file, get output via stdout` + colors.Default + `
+  esbuild input.ts --transform --sourcemap=inline
+
   ` + colors.Dim + `# Automatically rebuild when input files are changed` + colors.Default + `
   esbuild app.ts --bundle --watch
 
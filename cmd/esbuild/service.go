@@ -622,6 +622,11 @@ func (service *serviceType) convertPlugins(key int, jsPlugins interface{}) ([]ap
 					return result, nil
 				}
 
+				with := make(map[string]interface{}, len(args.With))
+				for name, value := range args.With {
+					with[name] = value
+				}
+
 				response := service.sendRequest(map[string]interface{}{
 					"command":    "resolve",
 					"key":        key,
@@ -631,6 +636,7 @@ func (service *serviceType) convertPlugins(key int, jsPlugins interface{}) ([]ap
 					"namespace":  args.Namespace,
 					"resolveDir": args.ResolveDir,
 					"pluginData": args.PluginData,
+					"with":       with,
 				}).(map[string]interface{})
 
 				if value, ok := response["id"]; ok {
@@ -657,9 +663,22 @@ func (service *serviceType) convertPlugins(key int, jsPlugins interface{}) ([]ap
 				if value, ok := response["external"]; ok {
 					result.External = value.(bool)
 				}
+				if value, ok := response["loader"]; ok {
+					loader, err := cli_helpers.ParseLoader(value.(string))
+					if err != nil {
+						return api.OnResolveResult{}, err
+					}
+					result.Loader = loader
+				}
 				if value, ok := response["pluginData"]; ok {
 					result.PluginData = value.(int)
 				}
+				if value, ok := response["watchFiles"]; ok {
+					result.WatchFiles = decodeStringArray(value.([]interface{}))
+				}
+				if value, ok := response["watchDirs"]; ok {
+					result.WatchDirs = decodeStringArray(value.([]interface{}))
+				}
 				if value, ok := response["errors"]; ok {
 					result.Errors = decodeMessages(value.([]interface{}))
 				}
@@ -88,5 +88,39 @@ type ImportRecord struct {
 	// If true, this was originally written as a bare "import 'file'" statement
 	WasOriginallyBareImport bool
 
+	// The import path as written in the source code. This is only set if it
+	// differs from "Path", like for AMD plugin expressions ("text!./foo.html").
+	OriginalPath string
+
+	// The attributes from the "with { type: 'json' }" clause or from the older
+	// "assert { type: 'json' }" clause if "AttributesUseAssert" is true
+	Attributes          []ImportAttribute
+	AttributesUseAssert bool
+
 	Kind ImportKind
 }
+
+type ImportAttribute struct {
+	Key   string
+	Value string
+}
+
+// This returns the import attributes for plugins or nil if there are none
+func (record *ImportRecord) AttributesMap() map[string]string {
+	if len(record.Attributes) == 0 {
+		return nil
+	}
+	attributes := make(map[string]string, len(record.Attributes))
+	for _, attribute := range record.Attributes {
+		attributes[attribute.Key] = attribute.Value
+	}
+	return attributes
+}
+
+// This returns the import path as written in the source code
+func (record *ImportRecord) PathAsWritten() string {
+	if record.OriginalPath != "" {
+		return record.OriginalPath
+	}
+	return record.Path.Text
+}
@@ -5,9 +5,12 @@ import (
 	"crypto/sha1"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"mime"
 	"net/http"
+	"path"
 	"sort"
 	"strings"
 	"sync"
@@ -81,6 +84,10 @@ type reprJS struct {
 	ast  js_ast.AST
 	meta fileMeta
 
+	// These are the options the file was parsed with. They are used to parse
+	// the file again if its AST depends on the output format.
+	parserOptions js_parser.Options
+
 	// If present, this is the CSS file that this JavaScript stub corresponds to.
 	// A JavaScript stub is automatically generated for a CSS file when it's
 	// imported from a JavaScript file.
@@ -147,6 +154,7 @@ type parseArgs struct {
 	ignoreIfUnusedData *resolver.IgnoreIfUnusedData
 	importPathRange    logger.Range
 	pluginData         interface{}
+	loader             config.Loader
 	options            config.Options
 	results            chan parseResult
 	inject             chan config.InjectedFile
@@ -168,6 +176,21 @@ func parseFile(args parseArgs) {
 		IdentifierName: js_ast.GenerateNonUniqueNameFromPath(args.keyPath.Text),
 	}
 
+	if args.options.Tracer != nil {
+		defer args.options.Tracer.Begin("scan", "parse", map[string]string{"path": args.prettyPath})()
+	}
+
+	// Don't bother loading and parsing the file if the build was cancelled
+	if args.options.IsCancelled() {
+		if args.inject != nil {
+			args.inject <- config.InjectedFile{
+				SourceIndex: source.Index,
+			}
+		}
+		args.results <- parseResult{}
+		return
+	}
+
 	var loader config.Loader
 	var absResolveDir string
 	var pluginName string
@@ -181,6 +204,21 @@ func parseFile(args parseArgs) {
 			loader = config.LoaderJS
 		}
 		absResolveDir = args.options.Stdin.AbsResolveDir
+
+		// Plugins can replace the contents of stdin
+		result, ok := runOnLoadPluginsForStdin(args.options.Plugins, args.res, args.log, &source)
+		if !ok {
+			args.results <- parseResult{}
+			return
+		}
+		if result.loader != config.LoaderNone {
+			loader = result.loader
+		}
+		if result.absResolveDir != "" {
+			absResolveDir = result.absResolveDir
+		}
+		pluginName = result.pluginName
+		pluginData = result.pluginData
 	} else {
 		result, ok := runOnLoadPlugins(
 			args.options.Plugins,
@@ -211,11 +249,36 @@ func parseFile(args parseArgs) {
 
 	_, base, ext := logger.PlatformIndependentPathDirBaseExt(source.KeyPath.Text)
 
+	// A loader forced by a resolve plugin takes precedence over the file path
+	if loader == config.LoaderDefault && args.loader != config.LoaderNone {
+		loader = args.loader
+	}
+
 	// The special "default" loader determines the loader from the file path
 	if loader == config.LoaderDefault {
 		loader = loaderFromFileExtension(args.options.ExtensionToLoader, base+ext)
 	}
 
+	// The "asset" loader inlines small files and copies large files
+	if loader == config.LoaderAsset {
+		if len(source.Contents) < args.options.AssetInlineLimit {
+			loader = config.LoaderDataURL
+		} else {
+			loader = config.LoaderFile
+		}
+	}
+
+	// Text is parsed as UTF-8, so the byte order mark is removed and files
+	// encoded in UTF-16 are converted to UTF-8 first
+	if loader.IsText() {
+		contents, encoding := decodeTextContents(source.Contents)
+		source.Contents = contents
+		if encoding != "" {
+			args.log.AddWarning(&source, logger.Loc{},
+				fmt.Sprintf("The file was converted from %s to UTF-8", encoding))
+		}
+	}
+
 	result := parseResult{
 		file: file{
 			source:     source,
@@ -230,27 +293,31 @@ func parseFile(args parseArgs) {
 
 	switch loader {
 	case config.LoaderJS:
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
-		result.file.repr = &reprJS{ast: ast}
+		options := js_parser.OptionsFromConfig(&args.options)
+		ast, ok := args.caches.JSCache.Parse(args.log, source, options)
+		result.file.repr = &reprJS{ast: ast, parserOptions: options}
 		result.ok = ok
 
 	case config.LoaderJSX:
 		args.options.JSX.Parse = true
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
-		result.file.repr = &reprJS{ast: ast}
+		options := js_parser.OptionsFromConfig(&args.options)
+		ast, ok := args.caches.JSCache.Parse(args.log, source, options)
+		result.file.repr = &reprJS{ast: ast, parserOptions: options}
 		result.ok = ok
 
 	case config.LoaderTS:
 		args.options.TS.Parse = true
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
-		result.file.repr = &reprJS{ast: ast}
+		options := js_parser.OptionsFromConfig(&args.options)
+		ast, ok := args.caches.JSCache.Parse(args.log, source, options)
+		result.file.repr = &reprJS{ast: ast, parserOptions: options}
 		result.ok = ok
 
 	case config.LoaderTSX:
 		args.options.TS.Parse = true
 		args.options.JSX.Parse = true
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
-		result.file.repr = &reprJS{ast: ast}
+		options := js_parser.OptionsFromConfig(&args.options)
+		ast, ok := args.caches.JSCache.Parse(args.log, source, options)
+		result.file.repr = &reprJS{ast: ast, parserOptions: options}
 		result.ok = ok
 
 	case config.LoaderCSS:
@@ -262,8 +329,10 @@ func parseFile(args parseArgs) {
 		result.file.repr = &reprCSS{ast: ast}
 		result.ok = true
 
-	case config.LoaderJSON:
-		expr, ok := args.caches.JSONCache.Parse(args.log, source, js_parser.JSONOptions{})
+	case config.LoaderJSON, config.LoaderJSON5:
+		expr, ok := args.caches.JSONCache.Parse(args.log, source, js_parser.JSONOptions{
+			JSON5: loader == config.LoaderJSON5,
+		})
 		ast := js_parser.LazyExportAST(args.log, source, js_parser.OptionsFromConfig(&args.options), expr, "")
 		result.file.ignoreIfUnused = true
 		result.file.repr = &reprJS{ast: ast}
@@ -297,6 +366,24 @@ func parseFile(args parseArgs) {
 		result.file.repr = &reprJS{ast: ast}
 		result.ok = true
 
+	case config.LoaderWasmModule:
+		module, err := parseWasmModule(source.Contents)
+		if err != nil {
+			args.log.AddRangeError(args.importSource, args.importPathRange,
+				fmt.Sprintf("Invalid WebAssembly module %s: %s", source.PrettyPath, err.Error()))
+			break
+		}
+		jsSource := source
+		async := wasmUsesTopLevelAwait(&args.options)
+		jsSource.Contents = wasmModuleToJS(module, source.Contents, async)
+		options := js_parser.OptionsFromConfig(&args.options)
+		if async {
+			options.AllowTopLevelAwait()
+		}
+		ast, ok := js_parser.Parse(args.log, jsSource, options)
+		result.file.repr = &reprJS{ast: ast}
+		result.ok = ok
+
 	case config.LoaderDataURL:
 		mimeType := guessMimeType(ext, source.Contents)
 		encoded := base64.StdEncoding.EncodeToString([]byte(source.Contents))
@@ -312,7 +399,11 @@ func parseFile(args parseArgs) {
 		// Add a hash to the file name to prevent multiple files with the same name
 		// but different contents from colliding
 		hash := hashForFileName([]byte(source.Contents))
-		additionalFileName := base + "." + hash + ext
+		additionalFileName := config.PathTemplate{
+			Dir:  assetRelDir(args.fs, &args.options, source.KeyPath),
+			Name: base,
+			Hash: hash,
+		}.Apply(args.options.AssetPathTemplate) + ext
 		publicPath := args.options.PublicPath + additionalFileName
 
 		// Determine the destination folder
@@ -386,7 +477,7 @@ func parseFile(args parseArgs) {
 		result.resolveResults = make([]*resolver.ResolveResult, len(records))
 
 		if len(records) > 0 {
-			resolverCache := make(map[ast.ImportKind]map[string]*resolver.ResolveResult)
+			resolverCache := make(map[ast.ImportKind]map[resolverCacheKey]*resolver.ResolveResult)
 
 			for importRecordIndex := range records {
 				// Don't try to resolve imports that are already resolved
@@ -401,13 +492,17 @@ func parseFile(args parseArgs) {
 					continue
 				}
 
-				// Cache the path in case it's imported multiple times in this file
+				// Cache the path in case it's imported multiple times in this file. The
+				// "type" import attribute forces the loader, so the same path imported
+				// with and without it is resolved separately.
+				forcedLoader := loaderFromImportAttributes(record.Attributes)
+				cacheKey := resolverCacheKey{path: record.Path.Text, loader: forcedLoader}
 				cache, ok := resolverCache[record.Kind]
 				if !ok {
-					cache = make(map[string]*resolver.ResolveResult)
+					cache = make(map[resolverCacheKey]*resolver.ResolveResult)
 					resolverCache[record.Kind] = cache
 				}
-				if resolveResult, ok := cache[record.Path.Text]; ok {
+				if resolveResult, ok := cache[cacheKey]; ok {
 					result.resolveResults[importRecordIndex] = resolveResult
 					continue
 				}
@@ -424,8 +519,23 @@ func parseFile(args parseArgs) {
 					record.Kind,
 					absResolveDir,
 					pluginData,
+					record.AttributesMap(),
 				)
-				cache[record.Path.Text] = resolveResult
+
+				if resolveResult != nil && !resolveResult.IsExternal && forcedLoader != config.LoaderNone {
+					forced := *resolveResult
+					forced.Loader = forcedLoader
+					resolveResult = &forced
+				}
+
+				// Modules can be marked as having no side effects by the user
+				if resolveResult != nil && !resolveResult.IsExternal && resolveResult.IgnorePrimaryIfUnused == nil &&
+					isNoSideEffectsModule(args.options.NoSideEffectsModules, record.Path.Text, resolveResult) {
+					withoutSideEffects := *resolveResult
+					withoutSideEffects.IgnorePrimaryIfUnused = &resolver.IgnoreIfUnusedData{IsNoSideEffectsOption: true}
+					resolveResult = &withoutSideEffects
+				}
+				cache[cacheKey] = resolveResult
 
 				// All "require.resolve()" imports should be external because we don't
 				// want to waste effort traversing into them
@@ -437,6 +547,19 @@ func parseFile(args parseArgs) {
 					continue
 				}
 
+				// Imports of files outside of the allowed directories are errors
+				if resolveResult != nil && !isImportAllowed(args.fs, args.options.RestrictImports, resolveResult) {
+					args.log.AddRangeError(&source, record.Range,
+						fmt.Sprintf("Cannot import %q because it is outside of the allowed directories",
+							args.res.PrettyPath(resolveResult.PathPair.Primary)))
+					continue
+				}
+
+				// Packages needed only for development shouldn't end up in the bundle
+				if resolveResult != nil && args.options.CheckDevDependencies {
+					checkDevDependency(args.res, args.log, args.fs, &source, record, resolveResult, absResolveDir)
+				}
+
 				if resolveResult == nil {
 					// Failed imports inside a try/catch are silently turned into
 					// external imports instead of causing errors. This matches a common
@@ -497,6 +620,33 @@ func isASCIIOnly(text string) bool {
 	return true
 }
 
+// Removes the byte order mark from the start of the text. If the mark is in
+// UTF-16, the rest of the text is converted to UTF-8 and the name of the
+// original encoding is returned too.
+func decodeTextContents(contents string) (string, string) {
+	if strings.HasPrefix(contents, "\xEF\xBB\xBF") {
+		return contents[3:], ""
+	}
+
+	var encoding string
+	var high, low int
+	switch {
+	case strings.HasPrefix(contents, "\xFF\xFE"):
+		encoding, high, low = "UTF-16LE", 1, 0
+	case strings.HasPrefix(contents, "\xFE\xFF"):
+		encoding, high, low = "UTF-16BE", 0, 1
+	default:
+		return contents, ""
+	}
+
+	// A trailing odd byte is not a complete code unit and is dropped
+	text := make([]uint16, 0, len(contents)/2-1)
+	for i := 2; i+1 < len(contents); i += 2 {
+		text = append(text, uint16(contents[i+high])<<8|uint16(contents[i+low]))
+	}
+	return js_lexer.UTF16ToString(text), encoding
+}
+
 func guessMimeType(extension string, contents string) string {
 	mimeType := mime.TypeByExtension(extension)
 	if mimeType == "" {
@@ -627,6 +777,112 @@ func logPluginMessages(
 	return didLogError
 }
 
+type resolverCacheKey struct {
+	path   string
+	loader config.Loader
+}
+
+// The "type" import attribute selects the loader regardless of the extension
+var importAttributeTypeToLoader = map[string]config.Loader{
+	"json": config.LoaderJSON,
+	"css":  config.LoaderCSS,
+}
+
+// This returns the loader selected by the "type" import attribute, if any
+func loaderFromImportAttributes(attributes []ast.ImportAttribute) config.Loader {
+	loader := config.LoaderNone
+	for _, attribute := range attributes {
+		if forced, ok := importAttributeTypeToLoader[attribute.Value]; ok && attribute.Key == "type" {
+			loader = forced
+		}
+	}
+	return loader
+}
+
+// Checks if the resolved file, the import path or a parent of the import path
+// like the package name was marked as having no side effects
+func isNoSideEffectsModule(modules map[string]bool, importPath string, resolveResult *resolver.ResolveResult) bool {
+	if len(modules) == 0 {
+		return false
+	}
+	if path := resolveResult.PathPair.Primary; path.Namespace == "file" && modules[path.Text] {
+		return true
+	}
+	if resolver.IsPackagePath(importPath) {
+		query := importPath
+		for {
+			if modules[query] {
+				return true
+			}
+			slash := strings.LastIndexByte(query, '/')
+			if slash == -1 {
+				break
+			}
+			query = query[:slash]
+		}
+	}
+	return false
+}
+
+// Warns if a package bundled into the output is listed only in "devDependencies"
+// of the "package.json" nearest to the importing file. Imports from inside
+// "node_modules" are not checked because they refer to other packages.
+func checkDevDependency(
+	res resolver.Resolver,
+	log logger.Log,
+	fs fs.FS,
+	source *logger.Source,
+	record *ast.ImportRecord,
+	resolveResult *resolver.ResolveResult,
+	absResolveDir string,
+) {
+	path := resolveResult.PathPair.Primary
+	if resolveResult.IsExternal || path.Namespace != "file" || !resolver.IsInsideNodeModules(fs, path.Text) ||
+		!resolver.IsPackagePath(record.Path.Text) || fs.IsAbs(record.Path.Text) || absResolveDir == "" ||
+		source.KeyPath.Namespace != "file" || resolver.IsInsideNodeModules(fs, source.KeyPath.Text) {
+		return
+	}
+
+	// The package name is the first path segment, or two of them if scoped
+	name := record.Path.Text
+	if slash := strings.IndexByte(name, '/'); slash != -1 {
+		if strings.HasPrefix(name, "@") {
+			if next := strings.IndexByte(name[slash+1:], '/'); next != -1 {
+				name = name[:slash+1+next]
+			}
+		} else {
+			name = name[:slash]
+		}
+	}
+
+	if dev := res.DevOnlyDependency(absResolveDir, name); dev != nil {
+		log.AddRangeWarningWithNotes(source, record.Range,
+			fmt.Sprintf("The package %q is bundled, but it is listed only in \"devDependencies\"", name),
+			[]logger.MsgData{logger.RangeData(dev.Source, dev.Range,
+				fmt.Sprintf("Move %q to \"dependencies\" or mark it as external", name))})
+	}
+}
+
+// Checks that a resolved file is inside one of the allowed directories. The
+// files that are external, inside "node_modules" or in a namespace other than
+// "file" are not restricted.
+func isImportAllowed(fs fs.FS, roots []string, resolveResult *resolver.ResolveResult) bool {
+	path := resolveResult.PathPair.Primary
+	if len(roots) == 0 || resolveResult.IsExternal || path.Namespace != "file" ||
+		resolver.IsInsideNodeModules(fs, path.Text) {
+		return true
+	}
+	for _, root := range roots {
+		if relPath, ok := fs.Rel(root, path.Text); ok {
+			relPath = strings.ReplaceAll(relPath, "\\", "/") // Fix paths on Windows
+			if relPath != ".." && !strings.HasPrefix(relPath, "../") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func runOnResolvePlugins(
 	plugins []config.Plugin,
 	res resolver.Resolver,
@@ -638,11 +894,13 @@ func runOnResolvePlugins(
 	kind ast.ImportKind,
 	absResolveDir string,
 	pluginData interface{},
+	with map[string]string,
 ) (*resolver.ResolveResult, bool) {
 	resolverArgs := config.OnResolveArgs{
 		Path:       path,
 		ResolveDir: absResolveDir,
 		PluginData: pluginData,
+		With:       with,
 	}
 	applyPath := logger.Path{Text: path}
 	if importSource != nil {
@@ -669,6 +927,16 @@ func runOnResolvePlugins(
 				return nil, true
 			}
 
+			// Read the files and directories the plugin depends on through the
+			// file system so that they end up in the watch data. The resolution
+			// is redone from scratch in the rebuild when any of them change.
+			for _, absPath := range result.AbsWatchFiles {
+				fs.ReadFile(absPath)
+			}
+			for _, absPath := range result.AbsWatchDirs {
+				fs.ReadDirectory(absPath)
+			}
+
 			// The "file" namespace is the default for non-external paths, but not
 			// for external paths. External paths must explicitly specify the "file"
 			// namespace.
@@ -702,6 +970,7 @@ func runOnResolvePlugins(
 				PathPair:   resolver.PathPair{Primary: result.Path},
 				IsExternal: result.External,
 				PluginData: result.PluginData,
+				Loader:     result.Loader,
 			}, false
 		}
 	}
@@ -727,6 +996,50 @@ type loaderPluginResult struct {
 	pluginData    interface{}
 }
 
+// Stdin is loaded in the "stdin" namespace and its contents are passed to the
+// plugins in "PluginData". The contents are kept if no plugin returns any.
+func runOnLoadPluginsForStdin(
+	plugins []config.Plugin,
+	res resolver.Resolver,
+	log logger.Log,
+	source *logger.Source,
+) (loaderPluginResult, bool) {
+	loaderArgs := config.OnLoadArgs{
+		Path:       logger.Path{Text: source.KeyPath.Text, Namespace: "stdin"},
+		PluginData: source.Contents,
+	}
+
+	// Apply loader plugins in order until one succeeds
+	for _, plugin := range plugins {
+		for _, onLoad := range plugin.OnLoad {
+			if onLoad.Namespace != "stdin" || !config.PluginAppliesToPath(loaderArgs.Path, onLoad.Filter, onLoad.Namespace) {
+				continue
+			}
+
+			result := onLoad.Callback(loaderArgs)
+			pluginName := result.PluginName
+			if pluginName == "" {
+				pluginName = plugin.Name
+			}
+			if logPluginMessages(res, log, pluginName, result.Msgs, result.ThrownError, nil, logger.Range{}) {
+				return loaderPluginResult{}, false
+			}
+			if result.Contents == nil {
+				continue
+			}
+
+			source.Contents = *result.Contents
+			return loaderPluginResult{
+				loader:        result.Loader,
+				absResolveDir: result.AbsResolveDir,
+				pluginName:    pluginName,
+				pluginData:    result.PluginData,
+			}, true
+		}
+	}
+	return loaderPluginResult{}, true
+}
+
 func runOnLoadPlugins(
 	plugins []config.Plugin,
 	res resolver.Resolver,
@@ -843,11 +1156,116 @@ func lowerCaseAbsPathForWindows(absPath string) string {
 	return strings.ToLower(absPath)
 }
 
+// The output base isn't known until all files have been parsed, so the "[dir]"
+// placeholder for assets is relative to "outbase" only if it was set explicitly
+// and to the current working directory otherwise
+func assetRelDir(fs fs.FS, options *config.Options, path logger.Path) string {
+	if path.Namespace != "file" {
+		return ""
+	}
+	base := options.AbsOutputBase
+	if base == "" {
+		base = fs.Cwd()
+	}
+	if relDir, ok := fs.Rel(base, fs.Dir(path.Text)); ok && relDir != "." {
+		return outputRelDir(relDir)
+	}
+	return ""
+}
+
+// Entry points named using a "[hash]" placeholder are generated with this
+// placeholder in their paths, which has the same length as the hash to keep
+// source map columns valid, and which is unique for each entry point. The CSS
+// file of an entry point has its own placeholder since it has its own hash.
+func entryPointHashPlaceholder(sourceIndex uint32, isCSS bool) string {
+	if isCSS {
+		return fmt.Sprintf("#C%06d", sourceIndex)
+	}
+	return fmt.Sprintf("#H%06d", sourceIndex)
+}
+
+// Replaces the placeholders in the paths of entry points with the hashes of
+// their contents. This updates the paths of the output files and references
+// to them from other output files, like imports, source maps and metadata.
+//
+// A file is hashed after the placeholders of the files it references have
+// been substituted, so changing an entry point changes the names of the entry
+// points importing it too. Placeholders of files referencing each other in a
+// cycle can't be substituted first, so they are hashed as they are instead.
+func substituteEntryPointHashes(outputFiles []OutputFile) {
+	// Find the file named using each placeholder
+	var placeholders []string
+	owners := make(map[string]int)
+	for i, outputFile := range outputFiles {
+		if outputFile.Kind != OutputKindEntryPoint || outputFile.entryPointSourceIndex == nil {
+			continue
+		}
+		for _, isCSS := range []bool{false, true} {
+			placeholder := entryPointHashPlaceholder(*outputFile.entryPointSourceIndex, isCSS)
+			if _, ok := owners[placeholder]; !ok && strings.Contains(outputFile.AbsPath, placeholder) {
+				placeholders = append(placeholders, placeholder)
+				owners[placeholder] = i
+			}
+		}
+	}
+	if len(placeholders) == 0 {
+		return
+	}
+
+	// Hash the referenced files before the files referencing them
+	hashes := make(map[string]string)
+	visited := make(map[string]bool)
+	var visit func(placeholder string)
+	visit = func(placeholder string) {
+		if visited[placeholder] {
+			return
+		}
+		visited[placeholder] = true
+		contents := string(outputFiles[owners[placeholder]].Contents)
+		var replacements []string
+		for _, other := range placeholders {
+			if other != placeholder && strings.Contains(contents, other) {
+				visit(other)
+				if hash, ok := hashes[other]; ok {
+					replacements = append(replacements, other, hash)
+				}
+			}
+		}
+		if len(replacements) > 0 {
+			contents = strings.NewReplacer(replacements...).Replace(contents)
+		}
+		hashes[placeholder] = hashForFileName([]byte(contents))
+	}
+	var replacements []string
+	for _, placeholder := range placeholders {
+		visit(placeholder)
+		replacements = append(replacements, placeholder, hashes[placeholder])
+	}
+
+	replacer := strings.NewReplacer(replacements...)
+	for i, outputFile := range outputFiles {
+		outputFiles[i].AbsPath = replacer.Replace(outputFile.AbsPath)
+		if outputFile.Kind != OutputKindAsset {
+			outputFiles[i].Contents = []byte(replacer.Replace(string(outputFile.Contents)))
+		}
+		if outputFile.jsonMetadataChunk != nil {
+			outputFiles[i].jsonMetadataChunk = []byte(replacer.Replace(string(outputFile.jsonMetadataChunk)))
+		}
+	}
+}
+
 func hashForFileName(bytes []byte) string {
 	hashBytes := sha1.Sum(bytes)
 	return base32.StdEncoding.EncodeToString(hashBytes[:])[:8]
 }
 
+// This is a hash of the whole original source of an input file. Unlike the
+// hash in file names, it is not truncated so that it can identify the source.
+func hashForMetafile(bytes []byte) string {
+	hashBytes := sha1.Sum(bytes)
+	return hex.EncodeToString(hashBytes[:])
+}
+
 type scanner struct {
 	log     logger.Log
 	fs      fs.FS
@@ -862,6 +1280,10 @@ type scanner struct {
 	visited       map[logger.Path]uint32
 	resultChannel chan parseResult
 	remaining     int
+
+	// A file is parsed only once, so all of its imports must use the loader it
+	// was parsed with, which the "type" import attribute could change
+	loaders map[logger.Path]config.Loader
 }
 
 func ScanBundle(log logger.Log, fs fs.FS, res resolver.Resolver, caches *cache.CacheSet, entryPoints []string, options config.Options) Bundle {
@@ -878,6 +1300,7 @@ func ScanBundle(log logger.Log, fs fs.FS, res resolver.Resolver, caches *cache.C
 		results:       make([]parseResult, 0, caches.SourceIndexCache.LenHint()),
 		visited:       make(map[logger.Path]uint32),
 		resultChannel: make(chan parseResult),
+		loaders:       make(map[logger.Path]config.Loader),
 	}
 
 	// Always start by parsing the runtime file
@@ -891,6 +1314,7 @@ func ScanBundle(log logger.Log, fs fs.FS, res resolver.Resolver, caches *cache.C
 	s.preprocessInjectedFiles()
 	entryPointIndices := s.addEntryPoints(entryPoints)
 	s.scanAllDependencies()
+	s.assignAMDModuleNames(entryPointIndices)
 	files := s.processScannedFiles()
 
 	return Bundle{
@@ -928,11 +1352,16 @@ func (s *scanner) maybeParseFile(
 	// Only parse a given file path once
 	sourceIndex, ok := s.visited[visitedKey]
 	if ok {
+		if s.loaders[visitedKey] != resolveResult.Loader {
+			s.log.AddRangeError(importSource, importPathRange,
+				fmt.Sprintf("Cannot import %q with a different \"type\" attribute than its other imports, because it's only loaded once", prettyPath))
+		}
 		return sourceIndex
 	}
 
 	sourceIndex = s.allocateSourceIndex(visitedKey, cache.SourceIndexNormal)
 	s.visited[visitedKey] = sourceIndex
+	s.loaders[visitedKey] = resolveResult.Loader
 	s.remaining++
 	optionsClone := s.options
 	if kind != inputKindStdin {
@@ -957,6 +1386,9 @@ func (s *scanner) maybeParseFile(
 	if resolveResult.PreserveUnusedImportsTS {
 		optionsClone.PreserveUnusedImportsTS = true
 	}
+	if resolveResult.IsolatedModulesTS {
+		optionsClone.IsolatedModulesTS = true
+	}
 
 	// Enable bundling for injected files so we always do tree shaking. We
 	// never want to include unnecessary code from injected files since they
@@ -982,6 +1414,7 @@ func (s *scanner) maybeParseFile(
 		ignoreIfUnusedData: resolveResult.IgnorePrimaryIfUnused,
 		importPathRange:    importPathRange,
 		pluginData:         pluginData,
+		loader:             resolveResult.Loader,
 		options:            optionsClone,
 		results:            s.resultChannel,
 		inject:             inject,
@@ -1012,51 +1445,10 @@ func (s *scanner) allocateSourceIndex(path logger.Path, kind cache.SourceIndexKi
 }
 
 func (s *scanner) preprocessInjectedFiles() {
-	injectedFiles := make([]config.InjectedFile, 0, len(s.options.InjectedDefines)+len(s.options.InjectAbsPaths))
+	injectedFiles := make([]config.InjectedFile, 0, len(s.options.InjectAbsPaths))
 	duplicateInjectedFiles := make(map[string]bool)
 	injectWaitGroup := sync.WaitGroup{}
 
-	// These are virtual paths that are generated for compound "--define" values.
-	// They are special-cased and are not available for plugins to intercept.
-	for _, define := range s.options.InjectedDefines {
-		// These should be unique by construction so no need to check for collisions
-		visitedKey := logger.Path{Text: fmt.Sprintf("<define:%s>", define.Name)}
-		sourceIndex := s.allocateSourceIndex(visitedKey, cache.SourceIndexNormal)
-		s.visited[visitedKey] = sourceIndex
-		source := logger.Source{
-			Index:          sourceIndex,
-			KeyPath:        visitedKey,
-			PrettyPath:     s.res.PrettyPath(visitedKey),
-			IdentifierName: js_ast.EnsureValidIdentifier(visitedKey.Text),
-		}
-
-		// The first "len(InjectedDefine)" injected files intentionally line up
-		// with the injected defines by index. The index will be used to import
-		// references to them in the parser.
-		injectedFiles = append(injectedFiles, config.InjectedFile{
-			Path:        visitedKey.Text,
-			SourceIndex: sourceIndex,
-			IsDefine:    true,
-		})
-
-		// Generate the file inline here since it has already been parsed
-		expr := js_ast.Expr{Data: define.Data}
-		ast := js_parser.LazyExportAST(s.log, source, js_parser.OptionsFromConfig(&s.options), expr, "")
-		result := parseResult{
-			ok: true,
-			file: file{
-				source:         source,
-				loader:         config.LoaderJSON,
-				repr:           &reprJS{ast: ast},
-				ignoreIfUnused: true,
-			},
-		}
-
-		// Append to the channel on a goroutine in case it blocks due to capacity
-		s.remaining++
-		go func() { s.resultChannel <- result }()
-	}
-
 	for _, absPath := range s.options.InjectAbsPaths {
 		prettyPath := s.res.PrettyPath(logger.Path{Text: absPath, Namespace: "file"})
 		lowerAbsPath := lowerCaseAbsPathForWindows(absPath)
@@ -1158,6 +1550,7 @@ func (s *scanner) addEntryPoints(entryPoints []string) []uint32 {
 				ast.ImportEntryPoint,
 				entryPointAbsResolveDir,
 				nil,
+				nil,
 			)
 			if resolveResult != nil {
 				if resolveResult.IsExternal {
@@ -1186,7 +1579,7 @@ func (s *scanner) addEntryPoints(entryPoints []string) []uint32 {
 			prettyPath := s.res.PrettyPath(resolveResult.PathPair.Primary)
 			sourceIndex := s.maybeParseFile(*resolveResult, prettyPath, nil, logger.Range{}, resolveResult.PluginData, inputKindEntryPoint, nil)
 			if duplicateEntryPoints[sourceIndex] {
-				s.log.AddError(nil, logger.Loc{}, fmt.Sprintf("Duplicate entry point %q", prettyPath))
+				s.log.AddWarning(nil, logger.Loc{}, fmt.Sprintf("Ignoring duplicate entry point %q", prettyPath))
 				continue
 			}
 			duplicateEntryPoints[sourceIndex] = true
@@ -1206,8 +1599,9 @@ func (s *scanner) scanAllDependencies() {
 			continue
 		}
 
-		// Don't try to resolve paths if we're not bundling
-		if s.options.Mode == config.ModeBundle {
+		// Don't try to resolve paths if we're not bundling. Don't discover more
+		// files if the build was cancelled, but wait for the pending ones.
+		if s.options.Mode == config.ModeBundle && !s.options.IsCancelled() {
 			records := *result.file.repr.importRecords()
 			for importRecordIndex := range records {
 				record := &records[importRecordIndex]
@@ -1249,6 +1643,55 @@ func (s *scanner) scanAllDependencies() {
 	}
 }
 
+// The names of AMD modules are assigned after all files have been parsed in
+// parallel. Otherwise the name of a module imported from several files would
+// depend on which one was parsed first. The source indices are allocated in
+// the order the files finish parsing, so the files are visited in the order
+// of their imports from the entry points instead.
+func (s *scanner) assignAMDModuleNames(entryPointIndices []uint32) {
+	if !s.options.AMD.Parse {
+		return
+	}
+
+	order := make([]uint32, 0, len(s.results))
+	visited := make(map[uint32]bool)
+	var visit func(uint32)
+	visit = func(sourceIndex uint32) {
+		if visited[sourceIndex] {
+			return
+		}
+		visited[sourceIndex] = true
+		result := &s.results[sourceIndex]
+		if !result.ok {
+			return
+		}
+		order = append(order, sourceIndex)
+		for _, record := range *result.file.repr.importRecords() {
+			if record.SourceIndex != nil {
+				visit(*record.SourceIndex)
+			}
+		}
+	}
+	for _, sourceIndex := range entryPointIndices {
+		visit(sourceIndex)
+	}
+	for sourceIndex := range s.results {
+		visit(uint32(sourceIndex))
+	}
+
+	for _, sourceIndex := range order {
+		result := &s.results[sourceIndex]
+		if repr, ok := result.file.repr.(*reprJS); ok {
+			js_parser.AssignAMDDependencyNames(&s.options.AMD, result.file.source.KeyPath.Text, repr.ast.AMDModuleNames)
+		}
+	}
+	for _, sourceIndex := range order {
+		if repr, ok := s.results[sourceIndex].file.repr.(*reprJS); ok {
+			js_parser.AssignAMDDefineNames(&s.options.AMD, repr.ast.AMDModuleNames)
+		}
+	}
+}
+
 func (s *scanner) processScannedFiles() []file {
 	// Now that all files have been scanned, process the final file import records
 	for i, result := range s.results {
@@ -1269,7 +1712,11 @@ func (s *scanner) processScannedFiles() []file {
 				modulePath = result.file.source.PrettyPath
 			}
 			j.AddBytes(js_printer.QuoteForJSON(modulePath, s.options.ASCIIOnly))
-			j.AddString(fmt.Sprintf(": {\n      \"bytes\": %d,\n      \"imports\": [", len(result.file.source.Contents)))
+			j.AddString(fmt.Sprintf(": {\n      \"bytes\": %d,", len(result.file.source.Contents)))
+			if s.options.IncludeHashes {
+				j.AddString(fmt.Sprintf("\n      \"hash\": %q,", hashForMetafile([]byte(result.file.source.Contents))))
+			}
+			j.AddString("\n      \"imports\": [")
 		}
 
 		// Don't try to resolve paths if we're not bundling
@@ -1318,9 +1765,10 @@ func (s *scanner) processScannedFiles() []file {
 					if modulePath == "" {
 						modulePath = s.results[*record.SourceIndex].file.source.PrettyPath
 					}
-					j.AddString(fmt.Sprintf("{\n          \"path\": %s,\n          \"kind\": %s\n        }",
+					j.AddString(fmt.Sprintf("{\n          \"path\": %s,\n          \"kind\": %s,\n          \"original\": %s\n        }",
 						js_printer.QuoteForJSON(modulePath, s.options.ASCIIOnly),
-						js_printer.QuoteForJSON(record.Kind.StringForMetafile(), s.options.ASCIIOnly)))
+						js_printer.QuoteForJSON(record.Kind.StringForMetafile(), s.options.ASCIIOnly),
+						js_printer.QuoteForJSON(record.PathAsWritten(), s.options.ASCIIOnly)))
 				}
 
 				// Importing a JavaScript file from a CSS file is not allowed.
@@ -1393,7 +1841,9 @@ func (s *scanner) processScannedFiles() []file {
 						var notes []logger.MsgData
 						if otherFile.ignoreIfUnusedData != nil {
 							var text string
-							if otherFile.ignoreIfUnusedData.IsSideEffectsArrayInJSON {
+							if otherFile.ignoreIfUnusedData.IsNoSideEffectsOption {
+								text = "It was listed in the \"noSideEffects\" option"
+							} else if otherFile.ignoreIfUnusedData.IsSideEffectsArrayInJSON {
 								text = "It was excluded from the \"sideEffects\" array in the enclosing \"package.json\" file"
 							} else {
 								text = "\"sideEffects\" is false in the enclosing \"package.json\" file"
@@ -1419,8 +1869,10 @@ func (s *scanner) processScannedFiles() []file {
 						} else {
 							j.AddString(",\n        ")
 						}
-						j.AddString(fmt.Sprintf("{\n          \"path\": %s\n        }",
-							js_printer.QuoteForJSON(record.Path.Text, s.options.ASCIIOnly)))
+						j.AddString(fmt.Sprintf("{\n          \"path\": %s,\n          \"kind\": %s,\n          \"original\": %s\n        }",
+							js_printer.QuoteForJSON(record.Path.Text, s.options.ASCIIOnly),
+							js_printer.QuoteForJSON(record.Kind.StringForMetafile(), s.options.ASCIIOnly),
+							js_printer.QuoteForJSON(record.PathAsWritten(), s.options.ASCIIOnly)))
 					}
 				}
 			}
@@ -1463,25 +1915,73 @@ func DefaultExtensionToLoaderMap() map[string]config.Loader {
 	}
 }
 
+type OutputKind uint8
+
+const (
+	OutputKindAsset OutputKind = iota // A file copied by the "file" loader
+	OutputKindEntryPoint
+	OutputKindChunk
+	OutputKindSourceMap
+	OutputKindLegalComments
+	OutputKindMetadata
+)
+
 type OutputFile struct {
 	AbsPath  string
 	Contents []byte
+	Kind     OutputKind
+
+	// This is the index into the entry points of the bundle if this file is
+	// the output of an entry point or its source map, otherwise it's -1
+	EntryPointIndex int
 
 	// If "AbsMetadataFile" is present, this will be filled out with information
 	// about this file in JSON format. This is a partial JSON file that will be
 	// fully assembled later.
 	jsonMetadataChunk []byte
 
+	// This is the source index of the entry point if "EntryPointIndex" is set
+	entryPointSourceIndex *uint32
+
 	IsExecutable bool
 }
 
+// This is the number of files that were scanned into the bundle, not counting
+// the runtime code that is always present
+func (b *Bundle) FileCount() int {
+	if len(b.files) == 0 {
+		return 0
+	}
+	return len(b.files) - 1
+}
+
+// These are the syntax features lowered in the scanned files, not counting
+// the runtime code that is always present
+func (b *Bundle) LoweredFeatures() (features compat.JSFeature) {
+	for sourceIndex, file := range b.files {
+		if repr, ok := file.repr.(*reprJS); ok && uint32(sourceIndex) != runtime.SourceIndex {
+			features |= repr.ast.LoweredFeatures
+		}
+	}
+	return
+}
+
+// This is true if an entry point uses the ES6 import or export syntax, which
+// makes it a module instead of a script. Files that aren't JavaScript are not
+// modules.
+func (b *Bundle) HasES6ImportsOrExports() bool {
+	for _, sourceIndex := range b.entryPoints {
+		if repr, ok := b.files[sourceIndex].repr.(*reprJS); ok && repr.ast.HasES6ImportsOrExports() {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *Bundle) Compile(log logger.Log, options config.Options) []OutputFile {
 	if options.ExtensionToLoader == nil {
 		options.ExtensionToLoader = DefaultExtensionToLoaderMap()
 	}
-	if options.OutputExtensionJS == "" {
-		options.OutputExtensionJS = ".js"
-	}
 	if options.OutputExtensionCSS == "" {
 		options.OutputExtensionCSS = ".css"
 	}
@@ -1491,65 +1991,98 @@ func (b *Bundle) Compile(log logger.Log, options config.Options) []OutputFile {
 		options.OutputFormat = config.FormatESModule
 	}
 
+	// The extension can depend on the format, which must be known at this point.
+	// An explicit extension turns off choosing it for other formats later.
+	if options.OutputExtensionJS != "" {
+		options.AutoExtension = false
+	} else if options.AutoExtension {
+		options.OutputExtensionJS = autoOutputExtensionJS(options.OutputFormat)
+	} else {
+		options.OutputExtensionJS = ".js"
+	}
+
 	// Get the base path from the options or choose the lowest common ancestor of all entry points
 	allReachableFiles := findReachableFiles(b.files, b.entryPoints)
 	if options.AbsOutputBase == "" {
 		options.AbsOutputBase = b.lowestCommonAncestorDirectory(options.CodeSplitting, allReachableFiles)
 	}
-
+	if options.MangleKeyframes {
+		options.KeyframeNames = b.mangleKeyframeNames(allReachableFiles)
+	}
 	// Compute source map data in parallel with linking
 	dataForSourceMaps := b.computeDataForSourceMapsInParallel(&options, allReachableFiles)
 
-	var resultGroups [][]OutputFile
-	if options.CodeSplitting {
-		// If code splitting is enabled, link all entry points together
-		c := newLinkerContext(&options, log, b.fs, b.res, b.files, b.entryPoints, allReachableFiles, dataForSourceMaps)
-		resultGroups = [][]OutputFile{c.link()}
+	var outputFiles []OutputFile
+	var packageExports []packageExport
+	if len(options.OutputFormats) > 0 {
+		// Link the bundle once for each format. Each format gets its own
+		// extension because otherwise the outputs would overwrite each other.
+		for _, format := range options.OutputFormats {
+			formatOptions := optionsForFormat(&options, format)
+			formatOptions.OutputFormats = nil
+			if ext := autoOutputExtensionJS(format); ext != ".js" {
+				formatOptions.OutputExtensionJS = ext
+			}
+			formatBundle, ok := b.bundleForFormat(log, format, options.OutputFormat)
+			if !ok {
+				return nil
+			}
+			results, ok := formatBundle.link(log, formatOptions, allReachableFiles, dataForSourceMaps)
+			if !ok {
+				return nil
+			}
+			outputFiles = append(outputFiles, results...)
+			if options.PackageExports {
+				packageExports = b.appendPackageExports(packageExports, formatOptions, results)
+			}
+		}
 	} else {
-		// Otherwise, link each entry point with the runtime file separately
-		waitGroup := sync.WaitGroup{}
-		resultGroups = make([][]OutputFile, len(b.entryPoints))
-		for i, entryPoint := range b.entryPoints {
-			waitGroup.Add(1)
-			go func(i int, entryPoint uint32) {
-				entryPoints := []uint32{entryPoint}
-				reachableFiles := findReachableFiles(b.files, entryPoints)
-				c := newLinkerContext(&options, log, b.fs, b.res, b.files, entryPoints, reachableFiles, dataForSourceMaps)
-				resultGroups[i] = c.link()
-				waitGroup.Done()
-			}(i, entryPoint)
+		results, ok := b.link(log, &options, allReachableFiles, dataForSourceMaps)
+		if !ok {
+			return nil
+		}
+		outputFiles = results
+		if options.PackageExports {
+			packageExports = b.appendPackageExports(packageExports, &options, results)
 		}
-		waitGroup.Wait()
-	}
-
-	// Join the results in entry point order for determinism
-	var outputFiles []OutputFile
-	for _, group := range resultGroups {
-		outputFiles = append(outputFiles, group...)
 	}
 
 	// Also generate the metadata file if necessary
 	if options.AbsMetadataFile != "" {
 		outputFiles = append(outputFiles, OutputFile{
-			AbsPath:  options.AbsMetadataFile,
-			Contents: b.generateMetadataJSON(outputFiles, allReachableFiles, &options),
+			AbsPath:         options.AbsMetadataFile,
+			Contents:        compactMetadataJSON(b.generateMetadataJSON(outputFiles, allReachableFiles, &options), &options),
+			Kind:            OutputKindMetadata,
+			EntryPointIndex: -1,
+		})
+	}
+	if options.PackageExports {
+		outputFiles = append(outputFiles, OutputFile{
+			AbsPath:         b.fs.Join(options.AbsOutputDir, "package-exports.json"),
+			Contents:        b.generatePackageExportsJSON(packageExports, &options),
+			Kind:            OutputKindMetadata,
+			EntryPointIndex: -1,
 		})
 	}
 
 	if !options.WriteToStdout {
-		// Make sure an output file never overwrites an input file
-		sourceAbsPaths := make(map[string]uint32)
-		for _, sourceIndex := range allReachableFiles {
-			keyPath := b.files[sourceIndex].source.KeyPath
-			if keyPath.Namespace == "file" {
-				lowerAbsPath := lowerCaseAbsPathForWindows(keyPath.Text)
-				sourceAbsPaths[lowerAbsPath] = sourceIndex
+		// Make sure an output file never overwrites an input file unless this
+		// was explicitly allowed
+		if !options.AllowOverwrite {
+			sourceAbsPaths := make(map[string]uint32)
+			for _, sourceIndex := range allReachableFiles {
+				keyPath := b.files[sourceIndex].source.KeyPath
+				if keyPath.Namespace == "file" {
+					lowerAbsPath := lowerCaseAbsPathForWindows(keyPath.Text)
+					sourceAbsPaths[lowerAbsPath] = sourceIndex
+				}
 			}
-		}
-		for _, outputFile := range outputFiles {
-			lowerAbsPath := lowerCaseAbsPathForWindows(outputFile.AbsPath)
-			if sourceIndex, ok := sourceAbsPaths[lowerAbsPath]; ok {
-				log.AddError(nil, logger.Loc{}, "Refusing to overwrite input file: "+b.files[sourceIndex].source.PrettyPath)
+			for _, outputFile := range outputFiles {
+				lowerAbsPath := lowerCaseAbsPathForWindows(outputFile.AbsPath)
+				if sourceIndex, ok := sourceAbsPaths[lowerAbsPath]; ok {
+					log.AddError(nil, logger.Loc{}, "Refusing to overwrite input file: "+b.files[sourceIndex].source.PrettyPath+
+						" (use \"allowOverwrite\" to allow this)")
+				}
 			}
 		}
 
@@ -1591,6 +2124,336 @@ func (b *Bundle) Compile(log logger.Log, options config.Options) []OutputFile {
 	return outputFiles
 }
 
+// This links the scanned files into output files using one set of options.
+// It returns false if the entry points couldn't be linked with these options.
+func (b *Bundle) link(
+	log logger.Log,
+	options *config.Options,
+	allReachableFiles []uint32,
+	dataForSourceMaps func() []dataForSourceMap,
+) ([]OutputFile, bool) {
+	if !b.checkEntryPointOutputPaths(log, options) {
+		return nil, false
+	}
+
+	var resultGroups [][]OutputFile
+	if options.CodeSplitting && len(options.EntryPointFormats) == 0 {
+		// If code splitting is enabled, link all entry points together
+		c := newLinkerContext(options, log, b.fs, b.res, b.files, b.entryPoints, allReachableFiles, dataForSourceMaps)
+		resultGroups = [][]OutputFile{c.link()}
+	} else if options.CodeSplitting {
+		// Entry points with a different format are linked apart from the others
+		formatGroups := b.entryPointsByFormat(options)
+		if !b.checkEntryPointFormatGroups(log, formatGroups) {
+			return nil, false
+		}
+		for _, group := range formatGroups {
+			if group.options.OutputFormat == config.FormatESModule || group.options.OutputFormat == config.FormatCommonJS {
+				reachableFiles := findReachableFiles(b.files, group.entryPoints)
+				c := newLinkerContext(group.options, log, b.fs, b.res, b.files, group.entryPoints, reachableFiles, dataForSourceMaps)
+				resultGroups = append(resultGroups, c.link())
+				continue
+			}
+
+			// Code splitting only works with the "esm" and "cjs" formats, so entry
+			// points of other formats are linked with the runtime file separately
+			noSplittingOptions := *group.options
+			noSplittingOptions.CodeSplitting = false
+			for _, entryPoint := range group.entryPoints {
+				entryPoints := []uint32{entryPoint}
+				reachableFiles := findReachableFiles(b.files, entryPoints)
+				c := newLinkerContext(&noSplittingOptions, log, b.fs, b.res, b.files, entryPoints, reachableFiles, dataForSourceMaps)
+				resultGroups = append(resultGroups, c.link())
+			}
+		}
+	} else {
+		// Otherwise, link each entry point with the runtime file separately
+		waitGroup := sync.WaitGroup{}
+		resultGroups = make([][]OutputFile, len(b.entryPoints))
+		for i, entryPoint := range b.entryPoints {
+			waitGroup.Add(1)
+			go func(i int, entryPoint uint32) {
+				entryPoints := []uint32{entryPoint}
+				reachableFiles := findReachableFiles(b.files, entryPoints)
+				entryOptions := b.optionsForEntryPoint(options, entryPoint)
+				c := newLinkerContext(entryOptions, log, b.fs, b.res, b.files, entryPoints, reachableFiles, dataForSourceMaps)
+				resultGroups[i] = c.link()
+				waitGroup.Done()
+			}(i, entryPoint)
+		}
+		waitGroup.Wait()
+	}
+
+	// The output of a cancelled build is incomplete, so it is dropped
+	if options.IsCancelled() {
+		return nil, false
+	}
+
+	// Join the results in entry point order for determinism
+	var outputFiles []OutputFile
+	for _, group := range resultGroups {
+		outputFiles = append(outputFiles, group...)
+	}
+
+	if options.EntryPathTemplate != "" {
+		substituteEntryPointHashes(outputFiles)
+	}
+
+	// Translate the source indices of entry points to their order
+	entryPointIndices := make(map[uint32]int)
+	for i, entryPoint := range b.entryPoints {
+		entryPointIndices[entryPoint] = i
+	}
+	for i := range outputFiles {
+		outputFiles[i].EntryPointIndex = -1
+		if sourceIndex := outputFiles[i].entryPointSourceIndex; sourceIndex != nil {
+			if index, ok := entryPointIndices[*sourceIndex]; ok {
+				outputFiles[i].EntryPointIndex = index
+			}
+		}
+	}
+
+	return outputFiles, true
+}
+
+// The names of "@keyframes" are global in the page, so they are renamed the
+// same way in all CSS files of the bundle. Names used by animations without
+// being defined in the bundle may be defined elsewhere, so they are kept and
+// no keyframes are renamed to them.
+func (b *Bundle) mangleKeyframeNames(reachableFiles []uint32) map[string]string {
+	defined := make(map[string]bool)
+	used := make(map[string]bool)
+	var visit func(rules []css_ast.Rule)
+	visit = func(rules []css_ast.Rule) {
+		for _, rule := range rules {
+			switch r := rule.Data.(type) {
+			case *css_ast.RAtKeyframes:
+				if r.Name != "" {
+					defined[r.Name] = true
+				}
+			case *css_ast.RKnownAt:
+				visit(r.Rules)
+			case *css_ast.RSelector:
+				visit(r.Rules)
+			case *css_ast.RQualified:
+				visit(r.Rules)
+			case *css_ast.RDeclaration:
+				for _, i := range r.KeyframeNameIndices() {
+					used[r.Value[i].Text] = true
+				}
+			}
+		}
+	}
+	for _, sourceIndex := range reachableFiles {
+		if repr, ok := b.files[sourceIndex].repr.(*reprCSS); ok {
+			visit(repr.ast.Rules)
+		}
+	}
+	if len(defined) == 0 {
+		return nil
+	}
+
+	// Sort the names for determinism
+	names := make([]string, 0, len(defined))
+	for name := range defined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keyframeNames := make(map[string]string, len(names))
+	next := 0
+	for _, name := range names {
+		for {
+			shortName := keyframeShortName(next)
+			next++
+			if (!used[shortName] || defined[shortName]) && !cssWideKeywords[shortName] {
+				keyframeNames[name] = shortName
+				break
+			}
+		}
+	}
+	return keyframeNames
+}
+
+var cssWideKeywords = map[string]bool{
+	"default": true,
+	"inherit": true,
+	"initial": true,
+	"none":    true,
+	"revert":  true,
+	"unset":   true,
+}
+
+func keyframeShortName(i int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	name := chars[i%len(chars) : i%len(chars)+1]
+	for i /= len(chars); i > 0; i /= len(chars) {
+		i--
+		name += chars[i%len(chars) : i%len(chars)+1]
+	}
+	return name
+}
+
+// This returns the options to link the entry point with. They are the same
+// options unless the format of the entry point has been overridden.
+func (b *Bundle) optionsForEntryPoint(options *config.Options, entryPoint uint32) *config.Options {
+	keyPath := b.files[entryPoint].source.KeyPath
+	if keyPath.Namespace == "file" {
+		if format, ok := options.EntryPointFormats[keyPath.Text]; ok && format != options.OutputFormat {
+			return optionsForFormat(options, format)
+		}
+	}
+	return options
+}
+
+// This returns a copy of the options with another format. The automatic
+// extension follows the format, so that each output file gets the extension
+// of the format it's generated in.
+func optionsForFormat(options *config.Options, format config.Format) *config.Options {
+	formatOptions := *options
+	formatOptions.OutputFormat = format
+	if options.AutoExtension {
+		formatOptions.OutputExtensionJS = autoOutputExtensionJS(format)
+	}
+	return &formatOptions
+}
+
+// The files were scanned and parsed once, for the format of the scan. Most of
+// them can be linked for any format, but the ones whose AST depends on the
+// output format, like with "import.meta", are parsed again for another format.
+// Their import records keep what the scan resolved, because the format can
+// only add or remove the import of the runtime, which is the last one.
+func (b *Bundle) bundleForFormat(log logger.Log, format config.Format, scannedFormat config.Format) (*Bundle, bool) {
+	if format == scannedFormat {
+		return b, true
+	}
+	formatBundle := *b
+	formatBundle.files = append([]file{}, b.files...)
+	ok := true
+
+	// The warnings were reported by the scan already, but the errors can be
+	// specific to the format, like the ones for strict mode in "esm"
+	formatLog := logger.NewDeferLog()
+	for sourceIndex, f := range b.files {
+		repr, isJS := f.repr.(*reprJS)
+		if !isJS || !repr.ast.DependsOnOutputFormat {
+			continue
+		}
+		options := repr.parserOptions
+		options.SetOutputFormat(format)
+		formatAST, parsed := js_parser.Parse(formatLog, f.source, options)
+		if !parsed {
+			ok = false
+			continue
+		}
+		copy(formatAST.ImportRecords, repr.ast.ImportRecords)
+		formatAST.ExternalImportRecords = repr.ast.ExternalImportRecords
+		formatRepr := *repr
+		formatRepr.ast = formatAST
+		formatBundle.files[sourceIndex].repr = &formatRepr
+	}
+	for _, msg := range formatLog.Done() {
+		if msg.Kind == logger.Error {
+			log.AddMsg(msg)
+		}
+	}
+	return &formatBundle, ok
+}
+
+// The ".mjs" and ".cjs" extensions tell node which format the file is in
+func autoOutputExtensionJS(format config.Format) string {
+	switch format {
+	case config.FormatESModule:
+		return ".mjs"
+	case config.FormatCommonJS:
+		return ".cjs"
+	}
+	return ".js"
+}
+
+type entryPointFormatGroup struct {
+	options     *config.Options
+	entryPoints []uint32
+}
+
+// This groups the entry points by their format in the order in which the
+// formats first appear, so that each group can be linked together.
+func (b *Bundle) entryPointsByFormat(options *config.Options) []entryPointFormatGroup {
+	var groups []entryPointFormatGroup
+	indices := make(map[config.Format]int)
+	for _, entryPoint := range b.entryPoints {
+		entryOptions := b.optionsForEntryPoint(options, entryPoint)
+		index, ok := indices[entryOptions.OutputFormat]
+		if !ok {
+			index = len(groups)
+			indices[entryOptions.OutputFormat] = index
+			groups = append(groups, entryPointFormatGroup{options: entryOptions})
+		}
+		groups[index].entryPoints = append(groups[index].entryPoints, entryPoint)
+	}
+	return groups
+}
+
+// Different entry points can end up with the same output path, for example
+// "a.ts" and "a.js" both turn into "a.js". One would silently overwrite the
+// other, so this is reported as an error.
+func (b *Bundle) checkEntryPointOutputPaths(log logger.Log, options *config.Options) bool {
+	owners := make(map[string]uint32)
+	ok := true
+	for _, entryPoint := range b.entryPoints {
+		var repr chunkRepr
+		switch b.files[entryPoint].repr.(type) {
+		case *reprJS:
+			repr = &chunkReprJS{}
+		case *reprCSS:
+			repr = &chunkReprCSS{}
+		}
+		relDir, baseName := entryPointOutputPath(b.fs, b.optionsForEntryPoint(options, entryPoint), b.files[entryPoint].source, repr)
+		relPath := path.Join(relDir, baseName)
+		key := lowerCaseAbsPathForWindows(relPath)
+		if other, found := owners[key]; found {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("The entry points %s and %s would both be written to %s",
+				b.files[other].source.PrettyPath, b.files[entryPoint].source.PrettyPath, relPath))
+			ok = false
+		} else {
+			owners[key] = entryPoint
+		}
+	}
+	return ok
+}
+
+// Code shared by entry points of different formats would have to be put into
+// a chunk written in both formats at once, so this is reported as an error.
+func (b *Bundle) checkEntryPointFormatGroups(log logger.Log, groups []entryPointFormatGroup) bool {
+	type owner struct {
+		entryPoint uint32
+		format     config.Format
+	}
+	owners := make(map[uint32]owner)
+	ok := true
+	for _, group := range groups {
+		for _, entryPoint := range group.entryPoints {
+			for _, sourceIndex := range findReachableFiles(b.files, []uint32{entryPoint}) {
+				if sourceIndex == runtime.SourceIndex {
+					continue
+				}
+				if other, found := owners[sourceIndex]; !found {
+					owners[sourceIndex] = owner{entryPoint: entryPoint, format: group.options.OutputFormat}
+				} else if other.format != group.options.OutputFormat {
+					log.AddError(nil, logger.Loc{}, fmt.Sprintf(
+						"Cannot use the %q format for %s and the %q format for %s because they share %s with code splitting",
+						other.format.String(), b.files[other.entryPoint].source.PrettyPath,
+						group.options.OutputFormat.String(), b.files[entryPoint].source.PrettyPath,
+						b.files[sourceIndex].source.PrettyPath))
+					ok = false
+					break
+				}
+			}
+		}
+	}
+	return ok
+}
+
 // This is done in parallel with linking because linking is a mostly serial
 // phase and there are extra resources for parallelism. This could also be done
 // during parsing but that would slow down parsing and delay the start of the
@@ -1647,6 +2510,17 @@ func (b *Bundle) computeDataForSourceMapsInParallel(options *config.Options, rea
 					}
 					waitGroup.Done()
 				}(sourceIndex, f, repr)
+			} else if _, ok := f.repr.(*reprCSS); ok {
+				waitGroup.Add(1)
+				go func(sourceIndex uint32, f *file) {
+					// CSS files never have a nested source map
+					result := &results[sourceIndex]
+					result.lineOffsetTables = js_printer.GenerateLineOffsetTables(f.source.Contents, 0)
+					if !options.ExcludeSourcesContent {
+						result.quotedContents = [][]byte{js_printer.QuoteForJSON(f.source.Contents, options.ASCIIOnly)}
+					}
+					waitGroup.Done()
+				}(sourceIndex, f)
 			}
 		}
 	}
@@ -1919,8 +2793,139 @@ type analysedModule struct {
 	jsonMetadataChunk []byte
 }
 
-func (b *Bundle) Analyse() []byte {
-	return generateMetadataJSON(collectModules(b.files, &b.res), &b.res)
+type packageExport struct {
+	entryPointIndex int
+	format          config.Format
+	absPath         string
+}
+
+// This remembers the JavaScript outputs of the entry points together with
+// their formats, which decide the conditions in the "exports" field
+func (b *Bundle) appendPackageExports(exports []packageExport, options *config.Options, results []OutputFile) []packageExport {
+	for _, result := range results {
+		if result.Kind != OutputKindEntryPoint || result.EntryPointIndex == -1 {
+			continue
+		}
+		entryPoint := b.entryPoints[result.EntryPointIndex]
+		if _, ok := b.files[entryPoint].repr.(*reprJS); !ok {
+			continue
+		}
+		exports = append(exports, packageExport{
+			entryPointIndex: result.EntryPointIndex,
+			format:          b.optionsForEntryPoint(options, entryPoint).OutputFormat,
+			absPath:         result.AbsPath,
+		})
+	}
+	return exports
+}
+
+// The paths are relative to the current directory, which is expected to be
+// the directory with "package.json". The entry point "index" is exported as
+// "." and the others as subpaths with their names. TypeScript entry points
+// get a "types" condition pointing at the declarations next to the outputs.
+func (b *Bundle) generatePackageExportsJSON(exports []packageExport, options *config.Options) []byte {
+	sort.SliceStable(exports, func(i, j int) bool {
+		return exports[i].entryPointIndex < exports[j].entryPointIndex
+	})
+
+	relPath := func(absPath string) string {
+		if rel, ok := b.fs.Rel(b.fs.Cwd(), absPath); ok {
+			absPath = rel
+		}
+		absPath = strings.ReplaceAll(absPath, "\\", "/")
+		if !strings.HasPrefix(absPath, "../") {
+			absPath = "./" + absPath
+		}
+		return string(js_printer.QuoteForJSON(absPath, options.ASCIIOnly))
+	}
+
+	j := js_printer.Joiner{}
+	j.AddString("{\n  \"exports\": {")
+	for i := 0; i < len(exports); {
+		// Each entry point is exported once with the outputs of all formats
+		end := i + 1
+		for end < len(exports) && exports[end].entryPointIndex == exports[i].entryPointIndex {
+			end++
+		}
+		stem := exports[i].absPath[:len(exports[i].absPath)-len(b.fs.Ext(exports[i].absPath))]
+		subpath := "."
+		if rel, ok := b.fs.Rel(options.AbsOutputDir, stem); ok && rel != "index" {
+			subpath = "./" + strings.ReplaceAll(rel, "\\", "/")
+		}
+		if i > 0 {
+			j.AddString(",")
+		}
+		j.AddString(fmt.Sprintf("\n    %s: {", js_printer.QuoteForJSON(subpath, options.ASCIIOnly)))
+
+		// The "types" condition must come first and the "default" one last
+		var conditions []string
+		keyPath := b.files[b.entryPoints[exports[i].entryPointIndex]].source.KeyPath
+		switch b.fs.Ext(keyPath.Text) {
+		case ".ts", ".tsx", ".mts", ".cts":
+			conditions = append(conditions, fmt.Sprintf("\"types\": %s", relPath(stem+".d.ts")))
+		}
+		for _, condition := range []string{"import", "require", "default"} {
+			for _, export := range exports[i:end] {
+				name := "default"
+				switch export.format {
+				case config.FormatESModule:
+					name = "import"
+				case config.FormatCommonJS:
+					name = "require"
+				}
+				if name == condition {
+					conditions = append(conditions, fmt.Sprintf("\"%s\": %s", name, relPath(export.absPath)))
+					break
+				}
+			}
+		}
+		j.AddString("\n      " + strings.Join(conditions, ",\n      ") + "\n    }")
+		i = end
+	}
+	if len(exports) > 0 {
+		j.AddString("\n  ")
+	}
+	j.AddString("}\n}\n")
+	return j.Done()
+}
+
+func (b *Bundle) Analyse(options config.Options) []byte {
+	var defineUses map[string]uint32
+	if options.IncludeDefineStats {
+		defineUses = collectDefineUses(b.files, options.DefineKeys)
+	}
+	return compactMetadataJSON(generateMetadataJSON(collectModules(b.files, &b.res), defineUses, &b.res, options.ASCIIOnly), &options)
+}
+
+// The metadata is generated indented. Unless it should stay that way, the
+// whitespace between the tokens is removed.
+func compactMetadataJSON(contents []byte, options *config.Options) []byte {
+	if options.MetafilePretty {
+		return contents
+	}
+	buffer := bytes.Buffer{}
+	if err := json.Compact(&buffer, contents); err != nil {
+		panic("Internal error")
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes()
+}
+
+func collectDefineUses(files []file, keys []string) map[string]uint32 {
+	defineUses := make(map[string]uint32, len(keys))
+	for _, key := range keys {
+		defineUses[key] = 0
+	}
+	for _, file := range files {
+		if repr, ok := file.repr.(*reprJS); ok {
+			for key, count := range repr.ast.DefineUses {
+				if _, ok := defineUses[key]; ok {
+					defineUses[key] += count
+				}
+			}
+		}
+	}
+	return defineUses
 }
 
 func collectModules(files []file, res *resolver.Resolver) []analysedModule {
@@ -1936,7 +2941,7 @@ func collectModules(files []file, res *resolver.Resolver) []analysedModule {
 	return analysedModules
 }
 
-func generateMetadataJSON(analysedModules []analysedModule, res *resolver.Resolver) []byte {
+func generateMetadataJSON(analysedModules []analysedModule, defineUses map[string]uint32, res *resolver.Resolver, asciiOnly bool) []byte {
 	j := js_printer.Joiner{}
 	j.AddString("{\n  \"inputs\": {")
 
@@ -1949,7 +2954,30 @@ func generateMetadataJSON(analysedModules []analysedModule, res *resolver.Resolv
 		}
 		j.AddBytes(analysedModule.jsonMetadataChunk)
 	}
+	j.AddString("\n  }")
 
-	j.AddString("\n  }\n}\n")
+	// Write the number of substitutions of each define
+	if defineUses != nil {
+		keys := make([]string, 0, len(defineUses))
+		for key := range defineUses {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		j.AddString(",\n  \"defines\": {")
+		for i, key := range keys {
+			if i > 0 {
+				j.AddString(",")
+			}
+			j.AddString(fmt.Sprintf("\n    %s: %d", js_printer.QuoteForJSON(key, asciiOnly), defineUses[key]))
+		}
+		j.AddString("\n  }")
+	}
+
+	// Write the charset, which tells if non-ASCII characters were escaped
+	charset := "utf8"
+	if asciiOnly {
+		charset = "ascii"
+	}
+	j.AddString(fmt.Sprintf(",\n  \"charset\": %q\n}\n", charset))
 	return j.Done()
 }
@@ -0,0 +1,367 @@
+package bundler
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/evanw/esbuild/internal/cache"
+	"github.com/evanw/esbuild/internal/config"
+	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/logger"
+	"github.com/evanw/esbuild/internal/resolver"
+)
+
+var amd_suite = suite{
+	name: "amd",
+}
+
+func amdOptions(baseUrl string) config.AMDOptions {
+	amd := config.AMDOptions{}
+	amd.Init(baseUrl)
+	amd.Parse = true
+	return amd
+}
+
+func TestAMDMappedPaths(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Paths["lib"] = "vendor/lib"
+	amd.MappedModuleNames = true
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				define(['./foo/bar', 'lib/baz'], function (bar, baz) {
+					return bar + baz
+				})
+			`,
+			"/src/foo/bar.js":        `define(function () { return 1 })`,
+			"/src/vendor/lib/baz.js": `define([], function () { return 2 })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDNamespacedModuleNames(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Namespace = "ns"
+	amd.Paths["lib"] = "vendor/lib"
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				define(['foo/bar', './foo/baz/qux', 'lib/util'], function (bar, qux, util) {
+					return bar + qux + util
+				})
+			`,
+			"/src/foo/bar.js":         `define(['../foo/baz/qux'], function (qux) { return qux })`,
+			"/src/foo/baz/qux.js":     `define(function () { return 1 })`,
+			"/src/vendor/lib/util.js": `define(function () { return 2 })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+// This is meant to be run with "go test -race". Two builds running at the same
+// time share one AMD config, which the builds must not change.
+func TestAMDConcurrentBuilds(t *testing.T) {
+	files := map[string]string{
+		"/src/entry.js": `
+			define(['lib/foo', 'text!./data.txt'], function (foo, data) {
+				return foo + data
+			})
+		`,
+		"/src/vendor/lib/foo.js": `define(['./bar'], function (bar) { return bar })`,
+		"/src/vendor/lib/bar.js": `define(function () { return 1 })`,
+		"/src/data.txt":          `text`,
+	}
+
+	amd := amdOptions("/src")
+	amd.Paths["lib"] = "vendor/lib"
+	amd.MappedModuleNames = true
+
+	build := func() (string, []logger.Msg) {
+		options := config.Options{
+			Mode:              config.ModeBundle,
+			OutputFormat:      config.FormatJoin,
+			AbsOutputFile:     "/out.js",
+			AbsOutputDir:      "/",
+			ExtensionOrder:    []string{".js"},
+			ExtensionToLoader: map[string]config.Loader{".js": config.LoaderJS, ".txt": config.LoaderText},
+			AMD:               amd,
+		}
+		fs := fs.MockFS(files)
+		log := logger.NewDeferLog()
+		caches := cache.MakeCacheSet()
+		resolver := resolver.NewResolver(fs, log, caches, options)
+		bundle := ScanBundle(log, fs, resolver, caches, []string{"/src/entry.js"}, options)
+		if log.HasErrors() {
+			return "", log.Done()
+		}
+		options.OmitRuntimeForTests = true
+		generated := ""
+		for _, result := range bundle.Compile(log, options) {
+			generated += fmt.Sprintf("---------- %s ----------\n%s", result.AbsPath, string(result.Contents))
+		}
+		return generated, log.Done()
+	}
+
+	var results [2]string
+	var msgs [2][]logger.Msg
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(len(results))
+	for i := range results {
+		go func(i int) {
+			results[i], msgs[i] = build()
+			waitGroup.Done()
+		}(i)
+	}
+	waitGroup.Wait()
+
+	for i := range results {
+		assertLog(t, msgs[i], "")
+	}
+	assertEqual(t, results[0], results[1])
+	amd_suite.compareSnapshot(t, t.Name(), results[0])
+}
+
+// A file imported by a relative path from two mapped modules is named by the
+// one imported first, no matter which of them finishes parsing first, and
+// both of them use that name
+func TestAMDModuleNamesInImportOrder(t *testing.T) {
+	files := map[string]string{
+		"/src/entry.js": `
+			define(['one/foo', 'two/bar'], function (foo, bar) {
+				return foo + bar
+			})
+		`,
+		"/src/vendor/lib/foo.js":    `define(['./shared'], function (shared) { return shared })`,
+		"/src/vendor/lib/bar.js":    `define(['./shared'], function (shared) { return shared })`,
+		"/src/vendor/lib/shared.js": `define(function () { return 1 })`,
+	}
+
+	build := func() (string, []logger.Msg) {
+		amd := amdOptions("/src")
+		amd.Paths["one"] = "vendor/lib"
+		amd.Paths["two"] = "vendor/lib"
+		options := config.Options{
+			Mode:              config.ModeBundle,
+			OutputFormat:      config.FormatJoin,
+			AbsOutputFile:     "/out.js",
+			AbsOutputDir:      "/",
+			ExtensionOrder:    []string{".js"},
+			ExtensionToLoader: map[string]config.Loader{".js": config.LoaderJS},
+			AMD:               amd,
+		}
+		fs := fs.MockFS(files)
+		log := logger.NewDeferLog()
+		caches := cache.MakeCacheSet()
+		resolver := resolver.NewResolver(fs, log, caches, options)
+		bundle := ScanBundle(log, fs, resolver, caches, []string{"/src/entry.js"}, options)
+		if log.HasErrors() {
+			return "", log.Done()
+		}
+		options.OmitRuntimeForTests = true
+		generated := ""
+		for _, result := range bundle.Compile(log, options) {
+			generated += fmt.Sprintf("---------- %s ----------\n%s", result.AbsPath, string(result.Contents))
+		}
+		return generated, log.Done()
+	}
+
+	first, msgs := build()
+	assertLog(t, msgs, "")
+	for i := 0; i < 20; i++ {
+		generated, _ := build()
+		assertEqual(t, generated, first)
+	}
+	amd_suite.compareSnapshot(t, t.Name(), first)
+}
+
+func TestAMDConfigUrlArgs(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.UrlArgs = "v=1.0"
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `define(['./foo'], function (foo) { return foo })`,
+			"/src/foo.js":   `define(function () { return 1 })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDConfigUrlArgsFunction(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Namespace = "ns"
+	amd.UrlArgs = `function (id, url) { return "v=" + id }`
+	amd.UrlArgsIsFunction = true
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `define(function () { return 1 })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDConfigDeps(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Deps = []string{"entry", "foo"}
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `define(['./foo'], function (foo) { return foo })`,
+			"/src/foo.js":   `define(function () { return 1 })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDConfigDepsCallbackFunction(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Deps = []string{"entry"}
+	amd.Callback = `function (entry) { entry.start() }`
+	amd.CallbackIsFunction = true
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `define(function () { return { start() {} } })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDConfigDepsCallbackModule(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Namespace = "ns"
+	amd.Deps = []string{"entry"}
+	amd.Callback = "main"
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `define(['./main'], function () { return {} })`,
+			"/src/main.js":  `define(function () { return function (entry) {} })`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDAnalysePluginImports(t *testing.T) {
+	files := map[string]string{
+		"/src/entry.js": `
+			define(['lib/foo', 'text!./data.txt'], function (foo, data) {
+				return foo + data
+			})
+		`,
+		"/src/vendor/lib/foo.js": `define(['./bar'], function (bar) { return bar })`,
+		"/src/vendor/lib/bar.js": `define(function () { return 1 })`,
+		"/src/data.txt":          `text`,
+	}
+	amd := amdOptions("/src")
+	amd.Paths["lib"] = "vendor/lib"
+	options := config.Options{
+		Mode:              config.ModeBundle,
+		OutputFormat:      config.FormatJoin,
+		AbsMetadataFile:   "/meta.json",
+		MetafilePretty:    true,
+		AbsOutputDir:      "/",
+		ExtensionOrder:    []string{".js"},
+		ExtensionToLoader: map[string]config.Loader{".js": config.LoaderJS, ".txt": config.LoaderText},
+		AMD:               amd,
+	}
+	fs := fs.MockFS(files)
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	resolver := resolver.NewResolver(fs, log, caches, options)
+	bundle := ScanBundle(log, fs, resolver, caches, []string{"/src/entry.js"}, options)
+	assertLog(t, log.Done(), "")
+	amd_suite.compareSnapshot(t, t.Name(), string(bundle.Analyse(options)))
+}
+
+func TestAMDShim(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Shim = map[string]config.AMDShim{
+		"vendor/backbone":   {Deps: []string{"vendor/underscore"}, Exports: "Backbone"},
+		"vendor/underscore": {Exports: "_"},
+		"vendor/plugin":     {Deps: []string{"vendor/backbone"}},
+	}
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				define(['vendor/backbone', 'vendor/plugin'], function (Backbone) {
+					return Backbone.VERSION
+				})
+			`,
+			"/src/vendor/backbone.js":   `window.Backbone = { VERSION: '1.0', _: window._ }`,
+			"/src/vendor/underscore.js": `window._ = { each: function () {} }`,
+			"/src/vendor/plugin.js":     `Backbone.plugin = true`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
+
+func TestAMDShimFunctionExports(t *testing.T) {
+	amd := amdOptions("/src")
+	amd.Shim = map[string]config.AMDShim{
+		"vendor/jquery": {Exports: "jQuery"},
+	}
+	amd_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				define(['vendor/jquery'], function ($) {
+					return $('body')
+				})
+			`,
+			"/src/vendor/jquery.js": `window.jQuery = function (selector) { return [selector] }`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatJoin,
+			AbsOutputFile: "/out.js",
+			AMD:           amd,
+		},
+	})
+}
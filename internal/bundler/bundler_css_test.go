@@ -150,6 +150,54 @@ func TestCSSFromJSMissingStarImport(t *testing.T) {
 	})
 }
 
+func TestCSSBannerAfterCharset(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.css": `
+				@import "./external.css";
+				@import "./charset.css";
+			`,
+			"/charset.css": `
+				@charset "UTF-8";
+				.middle { color: green }
+			`,
+		},
+		entryPaths: []string{"/entry.css"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.css",
+			Banner:        config.OutputText{JS: "// js banner", CSS: "/* css banner */"},
+			Footer:        config.OutputText{JS: "// js footer", CSS: "/* css footer */"},
+			ExternalModules: config.ExternalModules{
+				AbsPaths: map[string]bool{
+					"/external.css": true,
+				},
+			},
+		},
+	})
+}
+
+func TestBannerAndFooterForJSAndCSS(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import "./entry.css"
+				console.log('entry')
+			`,
+			"/entry.css": `
+				.entry { color: red }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			AbsOutputDir: "/out",
+			Banner:       config.OutputText{JS: "\"use strict\";", CSS: "/* license */"},
+			Footer:       config.OutputText{JS: "// js footer", CSS: "/* css footer */"},
+		},
+	})
+}
+
 func TestImportCSSFromJS(t *testing.T) {
 	css_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -521,3 +569,85 @@ func TestCSSAtImportExtensionOrderCollisionUnsupported(t *testing.T) {
 `,
 	})
 }
+
+func TestCSSSourceMap(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.css": `
+				@import "./a.css";
+				.entry { color: red }
+			`,
+			"/a.css": `
+				.a {
+					color: blue;
+				}
+			`,
+		},
+		entryPaths: []string{"/entry.css"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			SourceMap:     config.SourceMapLinkedWithComment,
+			AbsOutputFile: "/out.css",
+		},
+	})
+}
+
+func TestCSSKeyframesKeepNames(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.css": `
+				@keyframes spin { from { transform: rotate(0) } to { transform: rotate(360deg) } }
+				.spinner { animation: 1s linear infinite spin }
+			`,
+		},
+		entryPaths: []string{"/entry.css"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.css",
+		},
+	})
+}
+
+func TestCSSKeyframesMangle(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.css": `
+				@import "./fade.css";
+				@keyframes spin { from { transform: rotate(0) } to { transform: rotate(360deg) } }
+				.spinner { animation: 1s linear infinite spin }
+				.fader { animation-name: fade, external }
+			`,
+			"/fade.css": `
+				@media screen {
+					@keyframes fade { from { opacity: 0 } to { opacity: 1 } }
+				}
+				.fade { animation: fade 2s, spin 1s }
+			`,
+		},
+		entryPaths: []string{"/entry.css"},
+		options: config.Options{
+			Mode:            config.ModeBundle,
+			MangleKeyframes: true,
+			AbsOutputFile:   "/out.css",
+		},
+	})
+}
+
+func TestCSSKeyframesMangleShorthand(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.css": `
+				@keyframes spin { from { transform: rotate(0) } to { transform: rotate(360deg) } }
+				@keyframes linear { from { left: 0 } to { left: 100% } }
+				.spinner { -webkit-animation: spin 1s linear infinite; animation: spin 1s linear infinite }
+				.slider { -moz-animation-name: linear; animation: linear 2s linear, 1s ease-in spin }
+			`,
+		},
+		entryPaths: []string{"/entry.css"},
+		options: config.Options{
+			Mode:            config.ModeBundle,
+			MangleKeyframes: true,
+			AbsOutputFile:   "/out.css",
+		},
+	})
+}
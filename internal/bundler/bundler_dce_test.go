@@ -779,6 +779,89 @@ func TestPackageJsonSideEffectsKeepExportDefaultExpr(t *testing.T) {
 	})
 }
 
+func TestPackageJsonSideEffectsFalseBarrelReexports(t *testing.T) {
+	dce_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import {button} from "demo-pkg"
+				console.log(button)
+			`,
+			"/Users/user/project/node_modules/demo-pkg/package.json": `
+				{
+					"sideEffects": false
+				}
+			`,
+			"/Users/user/project/node_modules/demo-pkg/index.js": `
+				export * from './forms'
+				export {dialog} from './dialog'
+			`,
+			"/Users/user/project/node_modules/demo-pkg/forms/index.js": `
+				export {button} from './button'
+				export * from './input'
+			`,
+			"/Users/user/project/node_modules/demo-pkg/forms/button.js": `
+				export const button = 'button'
+				console.log('button')
+			`,
+			"/Users/user/project/node_modules/demo-pkg/forms/input.js": `
+				export const input = 'input'
+				console.log('input')
+			`,
+			"/Users/user/project/node_modules/demo-pkg/dialog.js": `
+				export const dialog = 'dialog'
+				console.log('dialog')
+			`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestPackageJsonSideEffectsFalseBarrelReexportsIgnoreAnnotations(t *testing.T) {
+	dce_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import {button} from "demo-pkg"
+				console.log(button)
+			`,
+			"/Users/user/project/node_modules/demo-pkg/package.json": `
+				{
+					"sideEffects": false
+				}
+			`,
+			"/Users/user/project/node_modules/demo-pkg/index.js": `
+				export * from './forms'
+				export {dialog} from './dialog'
+			`,
+			"/Users/user/project/node_modules/demo-pkg/forms/index.js": `
+				export {button} from './button'
+				export * from './input'
+			`,
+			"/Users/user/project/node_modules/demo-pkg/forms/button.js": `
+				export const button = 'button'
+				console.log('button')
+			`,
+			"/Users/user/project/node_modules/demo-pkg/forms/input.js": `
+				export const input = 'input'
+				console.log('input')
+			`,
+			"/Users/user/project/node_modules/demo-pkg/dialog.js": `
+				export const dialog = 'dialog'
+				console.log('dialog')
+			`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:                 config.ModeBundle,
+			AbsOutputFile:        "/out.js",
+			IgnoreDCEAnnotations: true,
+		},
+	})
+}
+
 func TestJSONLoaderRemoveUnused(t *testing.T) {
 	dce_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -991,6 +1074,45 @@ func TestTreeShakingReactElements(t *testing.T) {
 	})
 }
 
+func TestTreeShakingPureImportedMemberCalls(t *testing.T) {
+	defines := config.ProcessDefines(map[string]config.DefineData{
+		"React.createElement": {CallCanBeUnwrappedIfUnused: true},
+		"R.createElement":     {CallCanBeUnwrappedIfUnused: true},
+		"h":                   {CallCanBeUnwrappedIfUnused: true},
+	})
+	dce_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.jsx": `
+				import React from 'react'
+				import * as R from 'react'
+				import {h} from './h'
+				React.createElement('div', null)
+				R.createElement('span', null, sideEffect())
+				h('p')
+				let keep = React.createElement(Foo, null)
+				function Foo() {}
+				export {keep}
+			`,
+			"/h.js": `
+				export function h() { console.log('side effects') }
+			`,
+		},
+		entryPaths: []string{"/entry.jsx"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			OutputFormat:  config.FormatESModule,
+			MangleSyntax:  true,
+			Defines:       &defines,
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"react": true,
+				},
+			},
+		},
+	})
+}
+
 func TestDisableTreeShaking(t *testing.T) {
 	defines := config.ProcessDefines(map[string]config.DefineData{
 		"pure":    {CallCanBeUnwrappedIfUnused: true},
@@ -1366,3 +1488,37 @@ func TestTreeShakingNoBundleIIFE(t *testing.T) {
 		},
 	})
 }
+
+func TestNoSideEffectsModules(t *testing.T) {
+	dce_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import {foo} from "demo-pkg/lib/foo"
+				import {bar} from "./bar"
+				import {baz} from "./baz"
+				console.log(baz)
+			`,
+			"/Users/user/project/node_modules/demo-pkg/lib/foo.js": `
+				export const foo = 123
+				console.log('foo')
+			`,
+			"/Users/user/project/src/bar.js": `
+				export const bar = 456
+				console.log('bar')
+			`,
+			"/Users/user/project/src/baz.js": `
+				export const baz = 789
+				console.log('baz')
+			`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			NoSideEffectsModules: map[string]bool{
+				"demo-pkg":                       true,
+				"/Users/user/project/src/bar.js": true,
+			},
+		},
+	})
+}
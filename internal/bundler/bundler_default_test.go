@@ -7,6 +7,7 @@ import (
 
 	"github.com/evanw/esbuild/internal/config"
 	"github.com/evanw/esbuild/internal/js_ast"
+	"github.com/evanw/esbuild/internal/js_lexer"
 	"github.com/evanw/esbuild/internal/logger"
 )
 
@@ -1325,6 +1326,52 @@ func TestHashbangBundle(t *testing.T) {
 	})
 }
 
+func TestComponentDirectivesBundle(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				'use strict'
+				'use client'
+				import {Button} from './button'
+				import {action} from './action'
+				export default () => [Button, action]
+			`,
+			"/button.js": `
+				'use client'
+				export const Button = 'button'
+			`,
+			"/action.js": `
+				// Directives after comments are still in the prologue
+				'use server'
+				export const action = 'action'
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestComponentDirectivesNoBundle(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				'use client'
+				export const Button = 'button'
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeConvertFormat,
+			OutputFormat:  config.FormatCommonJS,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
 func TestHashbangNoBundle(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -2176,6 +2223,36 @@ index.js: error: Could not resolve "@c1/c2/c3-c4" (mark it as external to exclud
 	})
 }
 
+func TestExternalWildcardPatterns(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/index.js": `
+				import './foo-prefix'
+				import './bar-prefix'
+				import './image.png'
+				import './image.svg'
+				import 'a-middle-b'
+				import 'a-middle-c'
+			`,
+			"/bar-prefix.js":                    `console.log('bar-prefix')`,
+			"/image.svg.js":                     `console.log('image.svg')`,
+			"/node_modules/a-middle-c/index.js": `console.log('a-middle-c')`,
+		},
+		entryPaths: []string{"/index.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ExternalModules: config.ExternalModules{
+				Patterns: []config.WildcardPattern{
+					{Prefix: "./foo"},
+					{Suffix: ".png"},
+					{Prefix: "a-", Suffix: "-b"},
+				},
+			},
+		},
+	})
+}
+
 func TestScopedExternalModuleExclusion(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -2607,11 +2684,27 @@ func TestNoOverwriteInputFileError(t *testing.T) {
 			Mode:         config.ModeBundle,
 			AbsOutputDir: "/",
 		},
-		expectedCompileLog: "error: Refusing to overwrite input file: entry.js\n",
+		expectedCompileLog: "error: Refusing to overwrite input file: entry.js (use \"allowOverwrite\" to allow this)\n",
+	})
+}
+
+func TestAllowOverwriteInputFile(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				console.log(123)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:           config.ModeBundle,
+			AbsOutputDir:   "/",
+			AllowOverwrite: true,
+		},
 	})
 }
 
-func TestDuplicateEntryPointError(t *testing.T) {
+func TestDuplicateEntryPointWarning(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
 			"/entry.js": `
@@ -2621,9 +2714,29 @@ func TestDuplicateEntryPointError(t *testing.T) {
 		entryPaths: []string{"/entry.js", "/entry.js"},
 		options: config.Options{
 			Mode:         config.ModeBundle,
-			AbsOutputDir: "/out.js",
+			AbsOutputDir: "/out",
 		},
-		expectedScanLog: `error: Duplicate entry point "entry.js"
+		expectedScanLog: `warning: Ignoring duplicate entry point "entry.js"
+`,
+	})
+}
+
+func TestEntryPointOutputPathCollisionError(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				console.log(123)
+			`,
+			"/entry.ts": `
+				console.log(123)
+			`,
+		},
+		entryPaths: []string{"/entry.js", "/entry.ts"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			AbsOutputDir: "/out",
+		},
+		expectedCompileLog: `error: The entry points entry.js and entry.ts would both be written to entry.js
 `,
 	})
 }
@@ -2660,6 +2773,25 @@ func TestMultipleEntryPointsSameNameCollision(t *testing.T) {
 	})
 }
 
+func TestMultipleEntryPointsFormatOverride(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/lib.js":    `import {foo} from './common.js'; export default foo`,
+			"/cli.js":    `import {foo} from './common.js'; export default foo`,
+			"/common.js": `export let foo = 123`,
+		},
+		entryPaths: []string{"/lib.js", "/cli.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			OutputFormat: config.FormatESModule,
+			AbsOutputDir: "/out",
+			EntryPointFormats: map[string]config.Format{
+				"/cli.js": config.FormatCommonJS,
+			},
+		},
+	})
+}
+
 func TestReExportCommonJSAsES6(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -2868,6 +3000,125 @@ func TestDeduplicateCommentsInBundle(t *testing.T) {
 	})
 }
 
+func TestLegalCommentsNone(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './a'
+				import './b'
+				console.log('in entry') // Not a legal comment
+			`,
+			"/a.js": `console.log('in a') //! Copyright notice 1`,
+			"/b.js": `
+				/* @license Copyright notice 2 */
+				console.log('in b')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			RemoveWhitespace: true,
+			AbsOutputFile:    "/out.js",
+			LegalComments:    config.LegalCommentsNone,
+		},
+	})
+}
+
+func TestLegalCommentsInline(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './a'
+				import './b'
+				console.log('in entry') // Not a legal comment
+			`,
+			"/a.js": `console.log('in a') //! Copyright notice 1`,
+			"/b.js": `
+				/* @license Copyright notice 2 */
+				console.log('in b')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			RemoveWhitespace: true,
+			AbsOutputFile:    "/out.js",
+			LegalComments:    config.LegalCommentsInline,
+		},
+	})
+}
+
+func TestLegalCommentsEndOfFile(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './a'
+				import './b'
+				console.log('in entry') // Not a legal comment
+			`,
+			"/a.js": `console.log('in a') //! Copyright notice 1`,
+			"/b.js": `
+				/* @license Copyright notice 2 */
+				console.log('in b')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			LegalComments: config.LegalCommentsEndOfFile,
+		},
+	})
+}
+
+func TestLegalCommentsLinked(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './a'
+				import './b'
+				console.log('in entry') // Not a legal comment
+			`,
+			"/a.js": `console.log('in a') //! Copyright notice 1`,
+			"/b.js": `
+				/* @license Copyright notice 2 */
+				console.log('in b')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			RemoveWhitespace: true,
+			AbsOutputFile:    "/out.js",
+			LegalComments:    config.LegalCommentsLinkedWithComment,
+		},
+	})
+}
+
+func TestLegalCommentsExternal(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './a'
+				import './b'
+				console.log('in entry') // Not a legal comment
+			`,
+			"/a.js": `console.log('in a') //! Copyright notice 1`,
+			"/b.js": `
+				/* @license Copyright notice 2 */
+				console.log('in b')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			RemoveWhitespace: true,
+			AbsOutputFile:    "/out.js",
+			LegalComments:    config.LegalCommentsExternalWithoutComment,
+		},
+	})
+}
+
 // The IIFE should not be an arrow function when targeting ES5
 func TestIIFE_ES5(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
@@ -3047,6 +3298,42 @@ entry.js: error: Top-level await is currently not supported with the "umd" outpu
 	})
 }
 
+func TestUMDExternals(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import React from "react"
+				import {map} from "lodash/fp"
+				import "./other.js"
+				export default React.createElement(map)
+			`,
+			"/other.js": `
+				const dom = require("react-dom")
+				const {x} = require("lodash/fp")
+				console.log(dom, x)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatUMD,
+			GlobalName:    []string{"Lib"},
+			AbsOutputFile: "/out.js",
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"react":     true,
+					"react-dom": true,
+					"lodash/fp": true,
+				},
+			},
+			GlobalExternals: map[string][]string{
+				"react":     {"React"},
+				"lodash/fp": {"_", "fp"},
+			},
+		},
+	})
+}
+
 func TestAssignToImport(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -3730,6 +4017,66 @@ func TestKeepNamesTreeShaking(t *testing.T) {
 	})
 }
 
+func TestKeepNamesClassExpressions(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				registerComponent(class Component {})
+				registerComponent(class Lowered { static foo = 1 })
+				registerComponent(class {})
+				registerComponents({
+					Property: class {},
+					LoweredProperty: class { static bar = 2 },
+					'quoted-property': class {},
+					fn: function() {},
+					arrow: () => {},
+					method() {},
+					named: class Named {},
+					[computed]: class {},
+				})
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			AbsOutputFile:         "/out.js",
+			KeepNames:             true,
+			MinifyIdentifiers:     true,
+			UnsupportedJSFeatures: es(2020),
+		},
+	})
+}
+
+func TestKeepNamesPragmaOff(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {hot} from './hot'
+				function keep() {}
+				console.log(keep, hot)
+			`,
+			"/hot.js": `
+				// @esbuild-keep-names off
+				function hotFn() {}
+				class HotClass {}
+				export const hot = [hotFn, HotClass, function() {}]
+			`,
+			"/invalid.js": `
+				/* @esbuild-keep-names maybe */
+				export function invalid() {}
+			`,
+		},
+		entryPaths: []string{"/entry.js", "/invalid.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			AbsOutputDir: "/out",
+			KeepNames:    true,
+		},
+		expectedScanLog: `invalid.js: warning: Invalid keep names pragma: maybe (valid: off)
+`,
+	})
+}
+
 func TestCharFreqIgnoreComments(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -4098,3 +4445,272 @@ func TestVarRelocatingNoBundle(t *testing.T) {
 		},
 	})
 }
+
+func TestMetadataImportKinds(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {a} from './a'
+				import './style.css'
+				console.log(a, require('./b'), import('./c'))
+			`,
+			"/a.js":      `export let a = 1`,
+			"/b.js":      `module.exports = 2`,
+			"/c.js":      `export default 3`,
+			"/style.css": `@import "./base.css"; a { background: url(./logo.png) }`,
+			"/base.css":  `a { color: red }`,
+			"/logo.png":  `PNG`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:            config.ModeBundle,
+			AbsOutputDir:    "/out",
+			AbsMetadataFile: "/out/meta.json",
+			MetafilePretty:  true,
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".css": config.LoaderCSS,
+				".png": config.LoaderDataURL,
+			},
+		},
+	})
+}
+
+func TestRestrictImports(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import './nested/inside'
+				import 'pkg'
+				import '../outside'
+			`,
+			"/Users/user/project/src/nested/inside.js":      `console.log('inside')`,
+			"/Users/user/project/node_modules/pkg/index.js": `console.log('pkg')`,
+			"/Users/user/project/outside.js":                `console.log('outside')`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:            config.ModeBundle,
+			AbsOutputFile:   "/out.js",
+			RestrictImports: []string{"/Users/user/project/src"},
+		},
+		expectedScanLog: `Users/user/project/src/entry.js: error: Cannot import "Users/user/project/outside.js" because it is outside of the allowed directories
+`,
+	})
+}
+
+func TestCheckDevDependencies(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import "dev-pkg"
+				import "@scope/dev-pkg/lib/util"
+				import "prod-pkg"
+				import "peer-pkg"
+			`,
+			"/Users/user/project/package.json": `
+				{
+					"dependencies": { "prod-pkg": "1.0.0" },
+					"peerDependencies": { "peer-pkg": "1.0.0" },
+					"devDependencies": {
+						"dev-pkg": "1.0.0",
+						"@scope/dev-pkg": "1.0.0",
+						"prod-pkg": "1.0.0",
+						"peer-pkg": "1.0.0"
+					}
+				}
+			`,
+			"/Users/user/project/node_modules/dev-pkg/index.js":           `console.log('dev')`,
+			"/Users/user/project/node_modules/@scope/dev-pkg/lib/util.js": `console.log('scoped dev')`,
+			"/Users/user/project/node_modules/prod-pkg/index.js":          `import "dev-pkg"; console.log('prod')`,
+			"/Users/user/project/node_modules/peer-pkg/index.js":          `console.log('peer')`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:                 config.ModeBundle,
+			AbsOutputFile:        "/out.js",
+			CheckDevDependencies: true,
+		},
+		expectedScanLog: `Users/user/project/src/entry.js: warning: The package "dev-pkg" is bundled, but it is listed only in "devDependencies"
+Users/user/project/package.json: note: Move "dev-pkg" to "dependencies" or mark it as external
+Users/user/project/src/entry.js: warning: The package "@scope/dev-pkg" is bundled, but it is listed only in "devDependencies"
+Users/user/project/package.json: note: Move "@scope/dev-pkg" to "dependencies" or mark it as external
+`,
+	})
+}
+
+func TestExternalDynamicImportESM(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {value} from 'external'
+				console.log(value)
+				import('external').then(ns => console.log(ns.value))
+				export const load = () => import('other-external')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"external":       true,
+					"other-external": true,
+				},
+			},
+		},
+	})
+}
+
+func TestAutoExtensionESM(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js":      `import {shared} from './shared'; console.log(shared, import('./lazy'))`,
+			"/b.js":      `import {shared} from './shared'; console.log(shared)`,
+			"/shared.js": `export let shared = 1`,
+			"/lazy.js":   `export default 2`,
+		},
+		entryPaths: []string{"/a.js", "/b.js"},
+		options: config.Options{
+			Mode:            config.ModeBundle,
+			OutputFormat:    config.FormatESModule,
+			CodeSplitting:   true,
+			AbsOutputDir:    "/out",
+			AbsMetadataFile: "/out/meta.json",
+			MetafilePretty:  true,
+			AutoExtension:   true,
+		},
+	})
+}
+
+func TestAutoExtensionCommonJS(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `console.log('entry')`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatCommonJS,
+			AbsOutputDir:  "/out",
+			AutoExtension: true,
+		},
+	})
+}
+
+func TestAutoExtensionOverridden(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `console.log('entry')`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			OutputFormat:      config.FormatESModule,
+			AbsOutputDir:      "/out",
+			OutputExtensionJS: ".js",
+			AutoExtension:     true,
+		},
+	})
+}
+
+func TestAutoExtensionEntryPointFormat(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/lib.js": `export let lib = 1`,
+			"/cli.js": `console.log(process.argv)`,
+			"/web.js": `console.log(location.href)`,
+		},
+		entryPaths: []string{"/lib.js", "/cli.js", "/web.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			AutoExtension: true,
+			EntryPointFormats: map[string]config.Format{
+				"/cli.js": config.FormatCommonJS,
+				"/web.js": config.FormatIIFE,
+			},
+		},
+	})
+}
+
+func TestAutoExtensionEntryPointFormatSameName(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `console.log('js')`,
+			"/a.ts": `console.log('ts')`,
+		},
+		entryPaths: []string{"/a.js", "/a.ts"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			AutoExtension: true,
+			EntryPointFormats: map[string]config.Format{
+				"/a.ts": config.FormatCommonJS,
+			},
+		},
+	})
+}
+
+func TestAutoExtensionSameName(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `console.log('js')`,
+			"/a.ts": `console.log('ts')`,
+		},
+		entryPaths: []string{"/a.js", "/a.ts"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			AutoExtension: true,
+		},
+		expectedCompileLog: `error: The entry points a.js and a.ts would both be written to a.mjs
+`,
+	})
+}
+
+func encodeUTF16(text string, bigEndian bool) string {
+	bytes := []byte{0xFF, 0xFE}
+	if bigEndian {
+		bytes = []byte{0xFE, 0xFF}
+	}
+	for _, c := range js_lexer.StringToUTF16(text) {
+		if bigEndian {
+			bytes = append(bytes, byte(c>>8), byte(c))
+		} else {
+			bytes = append(bytes, byte(c), byte(c>>8))
+		}
+	}
+	return string(bytes)
+}
+
+func TestByteOrderMarks(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {utf8} from './utf8'
+				import {utf16le} from './utf16le'
+				import utf16be from './utf16be.txt'
+				import text from './utf8.txt'
+				console.log(utf8, utf16le, utf16be, text)
+			`,
+			"/utf8.js":     "\xEF\xBB\xBFexport let utf8 = 'ä'",
+			"/utf16le.js":  encodeUTF16("export let utf16le = 'ä 😀'", false),
+			"/utf16be.txt": encodeUTF16("big ä 😀", true),
+			"/utf8.txt":    "\xEF\xBB\xBFsmall ä",
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+		},
+		expectedScanLog: `utf16be.txt: warning: The file was converted from UTF-16BE to UTF-8
+utf16le.js: warning: The file was converted from UTF-16LE to UTF-8
+`,
+	})
+}
@@ -1703,3 +1703,33 @@ entry-prop.js: warning: Import "default" will always be undefined because there
 `,
 	})
 }
+
+func TestImportDefaultCommonJSNonObject(t *testing.T) {
+	importstar_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import fn from './fn'
+				import Cls from './cls'
+				import obj from './obj'
+				import marked from './marked'
+				import esm from './esm'
+				console.log(fn(), new Cls, obj, marked, esm)
+			`,
+			"/fn.js":     `module.exports = function() { return 123 }`,
+			"/cls.js":    `class Cls {}; module.exports = Cls`,
+			"/obj.js":    `module.exports = { foo: 123 }`,
+			"/marked.js": `module.exports = () => 123; module.exports.__esModule = true`,
+			"/esm.js":    `export default 123; module.exports = () => 123`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+		},
+		expectedCompileLog: `entry.js: warning: The default import of the CommonJS module "fn.js" may differ across environments because its "module.exports" is not an object
+fn.js: note: The value of "module.exports" is assigned here
+entry.js: warning: The default import of the CommonJS module "cls.js" may differ across environments because its "module.exports" is not an object
+cls.js: note: The value of "module.exports" is assigned here
+`,
+	})
+}
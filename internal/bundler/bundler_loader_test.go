@@ -3,6 +3,7 @@ package bundler
 import (
 	"testing"
 
+	"github.com/evanw/esbuild/internal/compat"
 	"github.com/evanw/esbuild/internal/config"
 )
 
@@ -30,6 +31,30 @@ func TestLoaderFile(t *testing.T) {
 	})
 }
 
+func TestLoaderAsset(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import small from './small.svg'
+				import large from './large.svg'
+				console.log(small, large)
+			`,
+			"/small.svg": "<svg></svg>",
+			"/large.svg": "<svg><rect width='100' height='100'/></svg>",
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			AbsOutputDir:     "/out/",
+			AssetInlineLimit: 16,
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".svg": config.LoaderAsset,
+			},
+		},
+	})
+}
+
 func TestLoaderFileMultipleNoCollision(t *testing.T) {
 	loader_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -56,6 +81,32 @@ func TestLoaderFileMultipleNoCollision(t *testing.T) {
 	})
 }
 
+func TestLoaderFileAssetPathTemplate(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				console.log(
+					require('./images/a.svg'),
+					require('./b.svg'),
+				)
+			`,
+			"/src/images/a.svg": "<svg>a</svg>",
+			"/src/b.svg":        "<svg>b</svg>",
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			AbsOutputDir:      "/out",
+			AbsOutputBase:     "/src",
+			AssetPathTemplate: "assets/[dir]/[name]-[hash]",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".svg": config.LoaderFile,
+			},
+		},
+	})
+}
+
 func TestJSXSyntaxInJSWithJSXLoader(t *testing.T) {
 	loader_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -201,6 +252,159 @@ func TestLoaderJSONCommonJSAndES6(t *testing.T) {
 	})
 }
 
+func TestLoaderJSON5(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import config from './config.json5'
+				console.log(config)
+			`,
+			"/config.json5": `{
+				// Comments are allowed
+				name: 'example',
+				'quoted': "keys",
+				port: 0x1F90,
+				ratio: .5,
+				limits: [Infinity, -1,],
+			}`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":    config.LoaderJS,
+				".json5": config.LoaderJSON5,
+			},
+		},
+	})
+}
+
+// A module that imports "log" from "env" and exports "add"
+const wasmAddModule = "\x00asm\x01\x00\x00\x00" +
+	"\x01\x0b\x02\x60\x02\x7f\x7f\x01\x7f\x60\x01\x7f\x00" +
+	"\x02\x0b\x01\x03env\x03log\x00\x01" +
+	"\x03\x02\x01\x00" +
+	"\x07\x07\x01\x03add\x00\x01" +
+	"\x0a\x09\x01\x07\x00\x20\x00\x20\x01\x6a\x0b"
+
+func TestLoaderWasmModule(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {add} from './add.wasm'
+				console.log(add(1, 2))
+			`,
+			"/add.wasm":                  wasmAddModule,
+			"/node_modules/env/index.js": `export function log(x) { console.log(x) }`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":   config.LoaderJS,
+				".wasm": config.LoaderWasmModule,
+			},
+		},
+	})
+}
+
+func TestLoaderWasmModuleESM(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {add} from './add.wasm'
+				console.log(add(1, 2))
+			`,
+			"/add.wasm":                  wasmAddModule,
+			"/node_modules/env/index.js": `export function log(x) { console.log(x) }`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":   config.LoaderJS,
+				".wasm": config.LoaderWasmModule,
+			},
+		},
+	})
+}
+
+func TestLoaderWasmModuleESMNoTopLevelAwait(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {add} from './add.wasm'
+				console.log(add(1, 2))
+			`,
+			"/add.wasm":                  wasmAddModule,
+			"/node_modules/env/index.js": `export function log(x) { console.log(x) }`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			OutputFormat:          config.FormatESModule,
+			AbsOutputFile:         "/out.js",
+			UnsupportedJSFeatures: compat.TopLevelAwait,
+			ExtensionToLoader: map[string]config.Loader{
+				".js":   config.LoaderJS,
+				".wasm": config.LoaderWasmModule,
+			},
+		},
+	})
+}
+
+func TestLoaderWasmModuleESMRequire(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				const {add} = require('./add.wasm')
+				console.log(add(1, 2))
+			`,
+			"/add.wasm":                  wasmAddModule,
+			"/node_modules/env/index.js": `export function log(x) { console.log(x) }`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":   config.LoaderJS,
+				".wasm": config.LoaderWasmModule,
+			},
+		},
+		expectedCompileLog: `error: Cannot use "require()" or "import()" with the WebAssembly module add.wasm, which is instantiated using top-level await
+`,
+	})
+}
+
+func TestLoaderWasmModuleInvalid(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {add} from './add.wasm'
+				console.log(add(1, 2))
+			`,
+			"/add.wasm": "\x00asm\x01\x00\x00\x00\x07\x07\x01\x03add",
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":   config.LoaderJS,
+				".wasm": config.LoaderWasmModule,
+			},
+		},
+		expectedScanLog: `entry.js: error: Invalid WebAssembly module add.wasm: Unexpected end of file
+`,
+	})
+}
+
 func TestLoaderJSONInvalidIdentifierES6(t *testing.T) {
 	loader_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -415,3 +619,65 @@ func TestLoaderJSONSharedWithMultipleEntriesIssue413(t *testing.T) {
 		},
 	})
 }
+
+func TestLoaderFromImportAttributes(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import data from './data.json' with { type: 'json' }
+				import config from './config.txt' with { type: 'json' }
+				import text from './other.txt'
+				import external from 'pkg/data.json' assert { type: 'json' }
+				console.log(data, config, text, external)
+			`,
+			"/data.json":  `{"a": 1}`,
+			"/config.txt": `{"b": 2}`,
+			"/other.txt":  `{"c": 3}`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":   config.LoaderJS,
+				".json": config.LoaderJSON,
+				".txt":  config.LoaderText,
+			},
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"pkg": true,
+				},
+			},
+		},
+	})
+}
+
+func TestLoaderFromImportAttributesConflict(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import config from './config.txt' with { type: 'json' }
+				import './other.js'
+				console.log(config)
+			`,
+			"/other.js": `
+				import text from './config.txt'
+				console.log(text)
+			`,
+			"/config.txt": `{"b": 2}`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".txt": config.LoaderText,
+			},
+		},
+		expectedScanLog: `other.js: error: Cannot import "config.txt" with a different "type" attribute than its other imports, because it's only loaded once
+`,
+	})
+}
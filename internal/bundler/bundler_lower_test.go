@@ -1333,3 +1333,50 @@ with.js: error: With statements cannot be used with the "esm" output format due
 `,
 	})
 }
+
+func TestLowerPolyfills(t *testing.T) {
+	lower_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/used.js": `
+				import {merge} from './merge'
+				console.log(merge({a: 1}, {b: 2}))
+			`,
+			"/merge.js": `
+				export function merge(a, b) {
+					return Object.assign({}, a, b)
+				}
+			`,
+			"/unused.js": `
+				console.log(Object.keys({a: 1}))
+			`,
+			"/shadowed.js": `
+				var Object = {assign: function() {}}
+				console.log(Object.assign({}, {a: 1}))
+			`,
+		},
+		entryPaths: []string{"/used.js", "/unused.js", "/shadowed.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			UnsupportedJSFeatures: es(5),
+			Polyfills:             true,
+			AbsOutputDir:          "/out",
+		},
+	})
+}
+
+func TestLowerPolyfillsSupported(t *testing.T) {
+	lower_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				console.log(Object.assign({}, {a: 1}), Object.values({b: 2}))
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			UnsupportedJSFeatures: es(2015),
+			Polyfills:             true,
+			AbsOutputFile:         "/out.js",
+		},
+	})
+}
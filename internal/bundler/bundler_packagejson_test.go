@@ -1125,3 +1125,160 @@ func TestPackageJsonNeutralExplicitMainFields(t *testing.T) {
 		},
 	})
 }
+
+func TestPackageJsonExportsConditions(t *testing.T) {
+	packagejson_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import pkg from 'pkg'
+				import feature from 'pkg/features/a'
+				import legacy from 'pkg/legacy/b.js'
+				const required = require('pkg')
+				console.log(pkg, feature, legacy, required)
+			`,
+			"/Users/user/project/node_modules/pkg/package.json": `
+				{
+					"main": "./main.js",
+					"exports": {
+						".": {
+							"worker": "./worker.js",
+							"import": "./import.js",
+							"default": "./require.js"
+						},
+						"./features/*": {
+							"development": "./src/features/*.js",
+							"default": "./dist/features/*.js"
+						},
+						"./legacy/": "./lib/",
+						"./internal/*": null
+					}
+				}
+			`,
+			"/Users/user/project/node_modules/pkg/main.js":                `module.exports = 'main'`,
+			"/Users/user/project/node_modules/pkg/worker.js":              `export default 'worker'`,
+			"/Users/user/project/node_modules/pkg/import.js":              `export default 'import'`,
+			"/Users/user/project/node_modules/pkg/require.js":             `module.exports = 'require'`,
+			"/Users/user/project/node_modules/pkg/src/features/a.js":      `export default 'src/a'`,
+			"/Users/user/project/node_modules/pkg/dist/features/a.js":     `export default 'dist/a'`,
+			"/Users/user/project/node_modules/pkg/lib/b.js":               `export default 'lib/b'`,
+			"/Users/user/project/node_modules/pkg/internal/c.js":          `export default 'internal/c'`,
+			"/Users/user/project/node_modules/pkg/features/unexported.js": `export default 'unexported'`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/Users/user/project/out.js",
+		},
+	})
+}
+
+func TestPackageJsonExportsCustomConditions(t *testing.T) {
+	packagejson_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import pkg from 'pkg'
+				import feature from 'pkg/features/a'
+				console.log(pkg, feature)
+			`,
+			"/Users/user/project/node_modules/pkg/package.json": `
+				{
+					"exports": {
+						".": {
+							"worker": "./worker.js",
+							"import": "./import.js"
+						},
+						"./features/*": {
+							"development": "./src/features/*.js",
+							"default": "./dist/features/*.js"
+						}
+					}
+				}
+			`,
+			"/Users/user/project/node_modules/pkg/worker.js":          `export default 'worker'`,
+			"/Users/user/project/node_modules/pkg/import.js":          `export default 'import'`,
+			"/Users/user/project/node_modules/pkg/src/features/a.js":  `export default 'src/a'`,
+			"/Users/user/project/node_modules/pkg/dist/features/a.js": `export default 'dist/a'`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/Users/user/project/out.js",
+			Conditions:    []string{"worker", "development"},
+		},
+	})
+}
+
+func TestPackageJsonExportsNotExported(t *testing.T) {
+	packagejson_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import a from 'pkg/internal/a'
+				import b from 'pkg/b'
+				import c from '@scope/pkg/c'
+				console.log(a, b, c)
+			`,
+			"/Users/user/project/node_modules/pkg/package.json": `
+				{
+					"exports": {
+						".": "./index.js",
+						"./*": "./*.js",
+						"./internal/*": null
+					}
+				}
+			`,
+			"/Users/user/project/node_modules/pkg/index.js":      `export default 'index'`,
+			"/Users/user/project/node_modules/pkg/b.js":          `export default 'b'`,
+			"/Users/user/project/node_modules/pkg/internal/a.js": `export default 'a'`,
+			"/Users/user/project/node_modules/@scope/pkg/package.json": `
+				{
+					"exports": "./index.js"
+				}
+			`,
+			"/Users/user/project/node_modules/@scope/pkg/index.js": `export default 'index'`,
+			"/Users/user/project/node_modules/@scope/pkg/c.js":     `export default 'c'`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/Users/user/project/out.js",
+		},
+		expectedScanLog: `Users/user/project/src/entry.js: error: Could not resolve "pkg/internal/a" (mark it as external to exclude it from the bundle)
+Users/user/project/src/entry.js: error: Could not resolve "@scope/pkg/c" (mark it as external to exclude it from the bundle)
+`,
+	})
+}
+
+func TestPackageJsonImports(t *testing.T) {
+	packagejson_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/src/entry.js": `
+				import env from '#env'
+				import util from '#utils/format'
+				import dep from '#dep'
+				console.log(env, util, dep)
+			`,
+			"/Users/user/project/package.json": `
+				{
+					"imports": {
+						"#env": {
+							"worker": "./src/env-worker.js",
+							"default": "./src/env.js"
+						},
+						"#utils/*": "./src/utils/*.js",
+						"#dep": "dep"
+					}
+				}
+			`,
+			"/Users/user/project/src/env.js":                `export default 'env'`,
+			"/Users/user/project/src/env-worker.js":         `export default 'env-worker'`,
+			"/Users/user/project/src/utils/format.js":       `export default 'format'`,
+			"/Users/user/project/node_modules/dep/index.js": `export default 'dep'`,
+		},
+		entryPaths: []string{"/Users/user/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/Users/user/project/out.js",
+			Conditions:    []string{"worker"},
+		},
+	})
+}
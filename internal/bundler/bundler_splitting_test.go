@@ -3,7 +3,11 @@ package bundler
 import (
 	"testing"
 
+	"github.com/evanw/esbuild/internal/cache"
 	"github.com/evanw/esbuild/internal/config"
+	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/logger"
+	"github.com/evanw/esbuild/internal/resolver"
 )
 
 var splitting_suite = suite{
@@ -33,6 +37,56 @@ func TestSplittingSharedES6IntoES6(t *testing.T) {
 	})
 }
 
+func TestSplittingChunkPathTemplate(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {foo} from "./shared.js"
+				console.log(foo)
+			`,
+			"/b.js": `
+				import {foo} from "./shared.js"
+				console.log(foo)
+			`,
+			"/shared.js": `export let foo = 123`,
+		},
+		entryPaths: []string{"/a.js", "/b.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			CodeSplitting:     true,
+			OutputFormat:      config.FormatESModule,
+			AbsOutputDir:      "/out",
+			ChunkPathTemplate: "chunks/[name]-[hash]",
+		},
+	})
+}
+
+func TestSplittingEntryPathTemplateHash(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/a.js": `
+				import {foo} from "./shared.js"
+				console.log(foo, import("./pages/b.js"))
+			`,
+			"/src/pages/b.js": `
+				import {foo} from "../shared.js"
+				console.log(foo)
+			`,
+			"/src/shared.js": `export let foo = 123`,
+		},
+		entryPaths: []string{"/src/a.js", "/src/pages/b.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			CodeSplitting:     true,
+			OutputFormat:      config.FormatESModule,
+			AbsOutputDir:      "/out",
+			AbsOutputBase:     "/src",
+			EntryPathTemplate: "[dir]/[name]-[hash]",
+			SourceMap:         config.SourceMapLinkedWithComment,
+		},
+	})
+}
+
 func TestSplittingSharedCommonJSIntoES6(t *testing.T) {
 	splitting_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -56,6 +110,57 @@ func TestSplittingSharedCommonJSIntoES6(t *testing.T) {
 	})
 }
 
+func TestSplittingSharedES6IntoCommonJS(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {foo, getFoo} from "./shared.js"
+				export let a = getFoo() + foo
+			`,
+			"/b.js": `
+				import {foo} from "./shared.js"
+				console.log(foo)
+			`,
+			"/shared.js": `
+				export let foo = 123
+				export function getFoo() { return foo }
+			`,
+		},
+		entryPaths: []string{"/a.js", "/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatCommonJS,
+			AbsOutputDir:  "/out",
+		},
+	})
+}
+
+func TestSplittingDynamicES6IntoCommonJS(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {foo} from "./foo.js"
+				import("./bar.js").then(({bar}) => console.log(foo, bar))
+			`,
+			"/foo.js": `
+				export let foo = 123
+			`,
+			"/bar.js": `
+				import {foo} from "./foo.js"
+				export let bar = foo + 1
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatCommonJS,
+			AbsOutputDir:  "/out",
+		},
+	})
+}
+
 func TestSplittingDynamicES6IntoES6(t *testing.T) {
 	splitting_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -525,3 +630,164 @@ func TestSplittingHybridCJSAndESMIssue617(t *testing.T) {
 		},
 	})
 }
+
+func TestSplittingEntryPointFormatOverride(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {shared} from './shared'
+				export let a = shared
+			`,
+			"/b.js": `
+				import {shared} from './shared'
+				export let b = shared
+			`,
+			"/cli.js": `
+				console.log(process.argv)
+			`,
+			"/shared.js": `
+				export let shared = 123
+			`,
+		},
+		entryPaths: []string{"/a.js", "/b.js", "/cli.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			EntryPointFormats: map[string]config.Format{
+				"/cli.js": config.FormatCommonJS,
+			},
+		},
+	})
+}
+
+func TestSplittingEntryPointFormatAutoExtension(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/a.js": `
+				import {shared} from './shared'
+				export let a = shared
+			`,
+			"/src/b.js": `
+				import {shared} from './shared'
+				export let b = shared
+			`,
+			"/src/shared.js": `
+				export let shared = 123
+			`,
+			"/src/cli/build.js": `
+				import {run} from './run'
+				run('build')
+			`,
+			"/src/cli/serve.js": `
+				import {run} from './run'
+				run('serve')
+			`,
+			"/src/cli/run.js": `
+				export let run = command => console.log(command, process.argv)
+			`,
+		},
+		entryPaths: []string{"/src/a.js", "/src/b.js", "/src/cli/build.js", "/src/cli/serve.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			AutoExtension: true,
+			EntryPointFormats: map[string]config.Format{
+				"/src/cli/build.js": config.FormatCommonJS,
+				"/src/cli/serve.js": config.FormatCommonJS,
+			},
+		},
+	})
+}
+
+func TestSplittingEntryPointBanner(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/main.js": `
+				import {shared} from './shared'
+				console.log(shared)
+			`,
+			"/worker.js": `
+				import {shared} from './shared'
+				postMessage(shared)
+			`,
+			"/shared.js": `
+				export let shared = 123
+			`,
+		},
+		entryPaths: []string{"/main.js", "/worker.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			CodeSplitting:     true,
+			OutputFormat:      config.FormatESModule,
+			AbsOutputDir:      "/out",
+			Banner:            config.OutputText{JS: "// banner"},
+			Footer:            config.OutputText{JS: "// footer"},
+			EntryPointBanners: map[string]string{"/worker.js": "// worker banner"},
+			EntryPointFooters: map[string]string{"/worker.js": "// worker footer"},
+		},
+	})
+}
+
+func TestSplittingEntryPointFormatSharedChunk(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {shared} from './shared'
+				export let a = shared
+			`,
+			"/cli.js": `
+				import {shared} from './shared'
+				console.log(shared)
+			`,
+			"/shared.js": `
+				export let shared = 123
+			`,
+		},
+		entryPaths: []string{"/a.js", "/cli.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			EntryPointFormats: map[string]config.Format{
+				"/cli.js": config.FormatCommonJS,
+			},
+		},
+		expectedCompileLog: `error: Cannot use the "esm" format for a.js and the "cjs" format for cli.js because they share shared.js with code splitting
+`,
+	})
+}
+
+func TestSplittingCancelledCompile(t *testing.T) {
+	files := map[string]string{
+		"/a.js":      `import {foo} from './shared.js'; console.log(foo)`,
+		"/b.js":      `import {foo} from './shared.js'; console.log(foo)`,
+		"/shared.js": `export let foo = 123`,
+	}
+	options := config.Options{
+		Mode:          config.ModeBundle,
+		CodeSplitting: true,
+		OutputFormat:  config.FormatESModule,
+		AbsOutputDir:  "/out",
+	}
+	fs := fs.MockFS(files)
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	resolver := resolver.NewResolver(fs, log, caches, options)
+	bundle := ScanBundle(log, fs, resolver, caches, []string{"/a.js", "/b.js"}, options)
+	assertLog(t, log.Done(), "")
+
+	// The build is cancelled after the scan, so linking produces no files
+	cancel := make(chan struct{})
+	close(cancel)
+	options.Cancel = cancel
+	log = logger.NewDeferLog()
+	if results := bundle.Compile(log, options); len(results) != 0 {
+		t.Fatalf("Unexpected output files: %d", len(results))
+	}
+	assertLog(t, log.Done(), "")
+}
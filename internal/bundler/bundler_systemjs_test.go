@@ -0,0 +1,177 @@
+package bundler
+
+import (
+	"testing"
+
+	"github.com/evanw/esbuild/internal/config"
+)
+
+var systemjs_suite = suite{
+	name: "systemjs",
+}
+
+func TestSystemJSRegisterDeps(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {a} from 'a'
+				import './foo'
+				import * as b from 'b'
+				console.log(a, b.b)
+			`,
+			"/foo.js": `
+				import c from 'c'
+				import {a2} from 'a'
+				console.log(c, a2)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystemJS,
+			AbsOutputFile: "/out.js",
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"a": true,
+					"b": true,
+					"c": true,
+				},
+			},
+		},
+	})
+}
+
+func TestSystemJSExports(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				export let count = 0
+				export function inc() { count++ }
+				export function reset() { count = 0 }
+				export default function() { return count }
+				export {foo as bar} from './foo'
+			`,
+			"/foo.js": `
+				export const foo = 123
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystemJS,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemJSExportsPostfixUpdate(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				export let big = 1n
+				export let str = '1'
+				export function incBig() { return big++ }
+				export function decStr() { return str-- }
+				export function incStr() { return ++str }
+				export let _tmp = 0, _export = 1
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystemJS,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemJSExportStar(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				export * from 'ext'
+				export * from './foo'
+			`,
+			"/foo.js": `
+				export let foo = 123
+				export function setFoo(value) { foo = value }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystemJS,
+			AbsOutputFile: "/out.js",
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"ext": true,
+				},
+			},
+		},
+	})
+}
+
+func TestSystemJSDynamicImport(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import('ext').then(console.log)
+				import('./foo').then(console.log)
+			`,
+			"/foo.js": `
+				export default 123
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystemJS,
+			AbsOutputFile: "/out.js",
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"ext": true,
+				},
+			},
+		},
+	})
+}
+
+func TestSystemJSCommonJSEntry(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				module.exports = 123
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystemJS,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemJSMinifyWhitespace(t *testing.T) {
+	systemjs_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {a} from 'a'
+				export let b = a
+				export function update() { b++ }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			OutputFormat:     config.FormatSystemJS,
+			RemoveWhitespace: true,
+			AbsOutputFile:    "/out.js",
+			ExternalModules: config.ExternalModules{
+				NodeModules: map[string]bool{
+					"a": true,
+				},
+			},
+		},
+	})
+}
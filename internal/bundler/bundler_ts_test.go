@@ -289,6 +289,34 @@ func TestTSImportTypeOnlyFile(t *testing.T) {
 	})
 }
 
+func TestTSReportTypeElision(t *testing.T) {
+	ts_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.ts": `
+				import type {Type1} from './types1'
+				import type * as types2 from './types2'
+				import {Type3} from './types3'
+				import {value} from './values'
+				let foo: Type1 | types2.Type2 | Type3 = value
+				console.log(foo)
+			`,
+			"/values.ts": `
+				export let value = 123
+			`,
+		},
+		entryPaths: []string{"/entry.ts"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			AbsOutputFile:     "/out.js",
+			ReportTypeElision: true,
+		},
+		expectedScanLog: `entry.ts: info: Removed the type-only import of "./types1"
+entry.ts: info: Removed the type-only import of "./types2"
+entry.ts: info: Removed the import of "./types3" because none of its imports are used as values
+`,
+	})
+}
+
 func TestTSExportEquals(t *testing.T) {
 	ts_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -477,6 +477,9 @@ func TestTsconfigJsonBaseUrl(t *testing.T) {
 			Mode:          config.ModeBundle,
 			AbsOutputFile: "/Users/user/project/out.js",
 		},
+		expectedCompileLog: `Users/user/project/src/app/entry.js: warning: The default import of the CommonJS module "Users/user/project/src/lib/util.js" may differ across environments because its "module.exports" is not an object
+Users/user/project/src/lib/util.js: note: The value of "module.exports" is assigned here
+`,
 	})
 }
 
@@ -505,6 +508,9 @@ func TestJsconfigJsonBaseUrl(t *testing.T) {
 			Mode:          config.ModeBundle,
 			AbsOutputFile: "/Users/user/project/out.js",
 		},
+		expectedCompileLog: `Users/user/project/src/app/entry.js: warning: The default import of the CommonJS module "Users/user/project/src/lib/util.js" may differ across environments because its "module.exports" is not an object
+Users/user/project/src/lib/util.js: note: The value of "module.exports" is assigned here
+`,
 	})
 }
 
@@ -533,6 +539,9 @@ func TestTsconfigJsonAbsoluteBaseUrl(t *testing.T) {
 			Mode:          config.ModeBundle,
 			AbsOutputFile: "/Users/user/project/out.js",
 		},
+		expectedCompileLog: `Users/user/project/src/app/entry.js: warning: The default import of the CommonJS module "Users/user/project/src/lib/util.js" may differ across environments because its "module.exports" is not an object
+Users/user/project/src/lib/util.js: note: The value of "module.exports" is assigned here
+`,
 	})
 }
 
@@ -562,6 +571,9 @@ func TestTsconfigJsonCommentAllowed(t *testing.T) {
 			Mode:          config.ModeBundle,
 			AbsOutputFile: "/Users/user/project/out.js",
 		},
+		expectedCompileLog: `Users/user/project/src/app/entry.js: warning: The default import of the CommonJS module "Users/user/project/src/lib/util.js" may differ across environments because its "module.exports" is not an object
+Users/user/project/src/lib/util.js: note: The value of "module.exports" is assigned here
+`,
 	})
 }
 
@@ -590,6 +602,9 @@ func TestTsconfigJsonTrailingCommaAllowed(t *testing.T) {
 			Mode:          config.ModeBundle,
 			AbsOutputFile: "/Users/user/project/out.js",
 		},
+		expectedCompileLog: `Users/user/project/src/app/entry.js: warning: The default import of the CommonJS module "Users/user/project/src/lib/util.js" may differ across environments because its "module.exports" is not an object
+Users/user/project/src/lib/util.js: note: The value of "module.exports" is assigned here
+`,
 	})
 }
 
@@ -840,6 +855,45 @@ func TestTsconfigJsonOverrideNodeModules(t *testing.T) {
 	})
 }
 
+func TestTsconfigJsonOverridePathsScopedAlias(t *testing.T) {
+	tsconfig_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/Users/user/project/entry.ts": `
+				import x from "@app/foo"
+				import y from "@app/bar"
+				import z from "@app/baz"
+				console.log(x, y, z)
+			`,
+			"/Users/user/project/src/foo.ts": `
+				export default 'foo'
+			`,
+			"/Users/user/project/src/bar.ts": `
+				export default 'bar'
+			`,
+			"/Users/user/project/lib/baz.ts": `
+				export default 'baz'
+			`,
+			"/Users/user/project/config/tsconfig.json": `
+				{
+					"compilerOptions": {
+						"baseUrl": "..",
+						"paths": {
+							"@app/foo": ["./missing/foo", "./src/foo"],
+							"@app/*": ["./src/*", "./lib/*"]
+						}
+					}
+				}
+			`,
+		},
+		entryPaths: []string{"/Users/user/project/entry.ts"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			AbsOutputFile:    "/Users/user/project/out.js",
+			TsConfigOverride: "/Users/user/project/config/tsconfig.json",
+		},
+	})
+}
+
 func TestTsconfigJsonOverrideInvalid(t *testing.T) {
 	tsconfig_suite.expectBundled(t, bundled{
 		files: map[string]string{
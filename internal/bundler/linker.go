@@ -88,6 +88,15 @@ type linkerContext struct {
 	// We may need a RequireJS namespace for the define calls
 	amdNamespaceRef js_ast.Ref
 
+	// We may need the variables of the "System.register" wrapper
+	systemJSExportRef  js_ast.Ref
+	systemJSContextRef js_ast.Ref
+	systemJSDepsRef    js_ast.Ref
+	systemJSTempRef    js_ast.Ref
+
+	// We may need the parameters of the factory function of the UMD wrapper
+	umdDepRefs map[string]js_ast.Ref
+
 	// This represents the parallel computation of source map related data.
 	// Calling this will block until the computation is done. The resulting value
 	// is shared between threads and must be treated as immutable.
@@ -317,11 +326,32 @@ type chunkReprJS struct {
 	crossChunkSuffixStmts  []js_ast.Stmt
 	exportsToOtherChunks   map[js_ast.Ref]string
 	importsFromOtherChunks map[uint32]crossChunkImportItemArray
+
+	// In the CommonJS format, the symbols imported from other chunks are read
+	// from the objects returned by "require()" instead of being copied
+	crossChunkImportAliases map[js_ast.Ref]js_ast.NamespaceAlias
 }
 
 type chunkReprCSS struct {
 }
 
+// This returns the kind of the output file for this chunk and the source index
+// of the entry point, which is only present for entry point chunks
+func (chunk *chunkInfo) outputKind() (OutputKind, *uint32) {
+	if chunk.isEntryPoint {
+		sourceIndex := chunk.sourceIndex
+		return OutputKindEntryPoint, &sourceIndex
+	}
+	return OutputKindChunk, nil
+}
+
+// Shared chunks are named using "ChunkPathTemplate" without an extension
+func (c *linkerContext) sharedChunkRelPath(hash string) (relDir string, baseName string) {
+	relDir, baseName = path.Split(config.PathTemplate{Name: "chunk", Hash: hash}.Apply(c.options.ChunkPathTemplate))
+	relDir = strings.TrimSuffix(relDir, "/")
+	return
+}
+
 // Returns the path of this chunk relative to the output directory. Note:
 // this must have OS-independent path separators (i.e. '/' not '\').
 func (chunk *chunkInfo) relPath() string {
@@ -503,6 +533,69 @@ func newLinkerContext(
 		})
 	}
 
+	// Allocate new unbound symbols for the "System.register" wrapper, so that
+	// no other symbol is renamed to collide with them
+	if c.options.OutputFormat == config.FormatSystemJS {
+		runtimeSymbols := &c.symbols.Outer[runtime.SourceIndex]
+		runtimeScope := c.files[runtime.SourceIndex].repr.(*reprJS).ast.ModuleScope
+		newUnboundRef := func(name string) js_ast.Ref {
+			ref := js_ast.Ref{OuterIndex: runtime.SourceIndex, InnerIndex: uint32(len(*runtimeSymbols))}
+			runtimeScope.Generated = append(runtimeScope.Generated, ref)
+			*runtimeSymbols = append(*runtimeSymbols, js_ast.Symbol{
+				Kind:         js_ast.SymbolUnbound,
+				OriginalName: name,
+				Link:         js_ast.InvalidRef,
+			})
+			return ref
+		}
+		c.systemJSExportRef = newUnboundRef("_export")
+		c.systemJSContextRef = newUnboundRef("_context")
+		c.systemJSDepsRef = newUnboundRef("_deps")
+		c.systemJSTempRef = newUnboundRef("_tmp")
+	} else {
+		c.systemJSExportRef = js_ast.InvalidRef
+		c.systemJSContextRef = js_ast.InvalidRef
+		c.systemJSDepsRef = js_ast.InvalidRef
+		c.systemJSTempRef = js_ast.InvalidRef
+	}
+
+	// Allocate new unbound symbols for the parameters of the UMD factory, one
+	// for each external module, so that no other symbol collides with them
+	if c.options.OutputFormat == config.FormatUMD {
+		runtimeSymbols := &c.symbols.Outer[runtime.SourceIndex]
+		runtimeScope := c.files[runtime.SourceIndex].repr.(*reprJS).ast.ModuleScope
+		usedNames := make(map[string]bool)
+		c.umdDepRefs = make(map[string]js_ast.Ref)
+		for _, sourceIndex := range c.reachableFiles {
+			repr, ok := c.files[sourceIndex].repr.(*reprJS)
+			if !ok {
+				continue
+			}
+			for _, record := range repr.ast.ImportRecords {
+				if !isUMDDep(record) {
+					continue
+				}
+				if _, ok := c.umdDepRefs[record.Path.Text]; ok {
+					continue
+				}
+				base := "_" + js_ast.GenerateNonUniqueNameFromPath(record.Path.Text)
+				name := base
+				for i := 2; usedNames[name]; i++ {
+					name = fmt.Sprintf("%s%d", base, i)
+				}
+				usedNames[name] = true
+				ref := js_ast.Ref{OuterIndex: runtime.SourceIndex, InnerIndex: uint32(len(*runtimeSymbols))}
+				runtimeScope.Generated = append(runtimeScope.Generated, ref)
+				*runtimeSymbols = append(*runtimeSymbols, js_ast.Symbol{
+					Kind:         js_ast.SymbolUnbound,
+					OriginalName: name,
+					Link:         js_ast.InvalidRef,
+				})
+				c.umdDepRefs[record.Path.Text] = ref
+			}
+		}
+	}
+
 	return c
 }
 
@@ -575,15 +668,21 @@ func (c *linkerContext) addPartToFile(sourceIndex uint32, part js_ast.Part, part
 }
 
 func (c *linkerContext) link() []OutputFile {
+	endLink := c.options.Tracer.Begin("link", "link", nil)
 	c.scanImportsAndExports()
 
-	// Stop now if there were errors
-	if c.hasErrors {
+	// Stop now if there were errors or if the build was cancelled
+	if c.hasErrors || c.options.IsCancelled() {
+		endLink()
 		return []OutputFile{}
 	}
 
 	c.markPartsReachableFromEntryPoints()
 	c.handleCrossChunkAssignments()
+	if c.options.IsCancelled() {
+		endLink()
+		return []OutputFile{}
+	}
 
 	if c.options.Mode == config.ModePassThrough {
 		for _, entryPoint := range c.entryPoints {
@@ -593,10 +692,15 @@ func (c *linkerContext) link() []OutputFile {
 
 	chunks := c.computeChunks()
 	c.computeCrossChunkDependencies(chunks)
+	if c.options.IsCancelled() {
+		endLink()
+		return []OutputFile{}
+	}
 
 	// Make sure calls to "js_ast.FollowSymbols()" in parallel goroutines after this
 	// won't hit concurrent map mutation hazards
 	js_ast.FollowAllSymbols(c.symbols)
+	endLink()
 
 	return c.generateChunksInParallel(chunks)
 }
@@ -623,13 +727,22 @@ func (c *linkerContext) generateChunksInParallel(chunks []chunkInfo) []OutputFil
 						}
 						baseNameOrEmpty += c.options.OutputExtensionCSS
 					}
+
+					// The CSS file is hashed separately from the JS file it's named after
+					relDir := chunk.relDir
+					if chunk.isEntryPoint && c.options.EntryPathTemplate != "" {
+						js := entryPointHashPlaceholder(chunk.sourceIndex, false)
+						css := entryPointHashPlaceholder(chunk.sourceIndex, true)
+						relDir = strings.ReplaceAll(relDir, js, css)
+						baseNameOrEmpty = strings.ReplaceAll(baseNameOrEmpty, js, css)
+					}
 					chunks = append(chunks, chunkInfo{
 						filesInChunkInOrder:   css,
 						entryBits:             chunk.entryBits,
 						isEntryPoint:          chunk.isEntryPoint,
 						sourceIndex:           chunk.sourceIndex,
 						entryPointBit:         chunk.entryPointBit,
-						relDir:                chunk.relDir,
+						relDir:                relDir,
 						baseNameOrEmpty:       baseNameOrEmpty,
 						filesWithPartsInChunk: make(map[uint32]bool),
 						repr:                  &chunkReprCSS{},
@@ -687,37 +800,64 @@ func (c *linkerContext) generateChunksInParallel(chunks []chunkInfo) []OutputFil
 			chunk := &chunks[i]
 			order := &chunkOrdering[i]
 
+			// A cancelled chunk produces no files, but its dependents are still
+			// woken up, because they would wait for it forever otherwise
+			done := func() {
+				for _, chunkIndex := range order.dependents {
+					chunkOrdering[chunkIndex].dependencies.Done()
+				}
+				resultsWaitGroup.Done()
+			}
+			if c.options.IsCancelled() {
+				done()
+				return
+			}
+
+			var traceArgs map[string]string
+			if c.options.Tracer != nil && chunk.isEntryPoint {
+				traceArgs = map[string]string{"entryPoint": c.files[chunk.sourceIndex].source.PrettyPath}
+			}
+
 			// Start generating the chunk without dependencies, but stop when
 			// dependencies are needed. This returns a callback that is called
 			// later to resume generating the chunk once dependencies are known.
+			endPrint := c.options.Tracer.Begin("link", "print", traceArgs)
 			resume := chunk.repr.generate(c, chunk)
+			endPrint()
 
 			// Wait for all dependencies to be resolved first
 			order.dependencies.Wait()
+			if c.options.IsCancelled() {
+				done()
+				return
+			}
 
 			// Fill in the cross-chunk import records now that the paths are known
+			crossChunkImportKind := ast.ImportStmt
+			if c.options.OutputFormat == config.FormatCommonJS {
+				crossChunkImportKind = ast.ImportRequire
+			}
 			crossChunkImportRecords := make([]ast.ImportRecord, len(chunk.crossChunkImports))
 			crossChunkAbsPaths := make([]string, len(chunk.crossChunkImports))
 			for i, otherChunkIndex := range chunk.crossChunkImports {
 				relPath := chunks[otherChunkIndex].relPath()
 				crossChunkAbsPaths[i] = c.fs.Join(c.options.AbsOutputDir, relPath)
 				crossChunkImportRecords[i] = ast.ImportRecord{
-					Kind: ast.ImportStmt,
+					Kind: crossChunkImportKind,
 					Path: logger.Path{Text: c.pathBetweenChunks(chunk.relDir, relPath)},
 				}
 			}
 
 			// Generate the chunk
+			endJoin := c.options.Tracer.Begin("link", "join", traceArgs)
 			results[i] = resume(generateContinue{
 				crossChunkAbsPaths:      crossChunkAbsPaths,
 				crossChunkImportRecords: crossChunkImportRecords,
 			})
+			endJoin()
 
 			// Wake up any dependents now that we're done
-			for _, chunkIndex := range order.dependents {
-				chunkOrdering[chunkIndex].dependencies.Done()
-			}
-			resultsWaitGroup.Done()
+			done()
 		}(i)
 	}
 
@@ -893,6 +1033,23 @@ func (c *linkerContext) computeCrossChunkDependencies(chunks []chunkInfo) {
 		}
 	}
 
+	// Cross-chunk exports in the CommonJS format are getters defined by the
+	// "__export" runtime helper, which may have to be imported itself
+	if c.options.OutputFormat == config.FormatCommonJS {
+		exportRef := c.files[runtime.SourceIndex].repr.(*reprJS).ast.ModuleScope.Members["__export"].Ref
+		exportChunkIndex := ^c.symbols.Get(exportRef).ChunkIndex
+		for chunkIndex := range chunks {
+			if len(chunkMetas[chunkIndex].exports) > 0 && exportChunkIndex != ^uint32(0) &&
+				exportChunkIndex != uint32(chunkIndex) && !chunkMetas[chunkIndex].imports[exportRef] {
+				repr := chunks[chunkIndex].repr.(*chunkReprJS)
+				repr.importsFromOtherChunks[exportChunkIndex] =
+					append(repr.importsFromOtherChunks[exportChunkIndex], crossChunkImportItem{ref: exportRef})
+				chunkMetas[chunkIndex].imports[exportRef] = true
+				chunkMetas[exportChunkIndex].exports[exportRef] = true
+			}
+		}
+	}
+
 	// Generate cross-chunk exports. These must be computed before cross-chunk
 	// imports because of export alias renaming, which must consider all export
 	// aliases simultaneously to avoid collisions.
@@ -924,6 +1081,58 @@ func (c *linkerContext) computeCrossChunkDependencies(chunks []chunkInfo) {
 				}}}
 			}
 
+		case config.FormatCommonJS:
+			// The exports of an entry point are defined on the same object, so the
+			// aliases must not collide with them
+			r := renamer.ExportRenamer{}
+			reserved := make(map[string]bool)
+			if chunk.isEntryPoint {
+				for _, alias := range c.files[chunk.sourceIndex].repr.(*reprJS).meta.sortedAndFilteredExportAliases {
+					reserved[alias] = true
+					r.NextRenamedName(alias)
+				}
+			}
+			var properties []js_ast.Property
+			for _, export := range c.sortedCrossChunkExportItems(chunkMetas[chunkIndex].exports) {
+				var alias string
+				if c.options.MinifyIdentifiers {
+					for alias = r.NextMinifiedName(); reserved[alias]; alias = r.NextMinifiedName() {
+					}
+				} else {
+					alias = r.NextRenamedName(c.symbols.Get(export.ref).OriginalName)
+				}
+
+				// Getters keep the exports live like ES6 exports are
+				value := js_ast.Expr{Data: &js_ast.EIdentifier{Ref: export.ref}}
+				body := js_ast.FnBody{Stmts: []js_ast.Stmt{{Data: &js_ast.SReturn{Value: &value}}}}
+				var getter js_ast.Expr
+				if c.options.UnsupportedJSFeatures.Has(compat.Arrow) {
+					getter = js_ast.Expr{Data: &js_ast.EFunction{Fn: js_ast.Fn{Body: body}}}
+				} else {
+					getter = js_ast.Expr{Data: &js_ast.EArrow{PreferExpr: true, Body: body}}
+				}
+				properties = append(properties, js_ast.Property{
+					Key:   js_ast.Expr{Data: &js_ast.EString{Value: js_lexer.StringToUTF16(alias)}},
+					Value: &getter,
+				})
+				repr.exportsToOtherChunks[export.ref] = alias
+			}
+
+			// "__export(module.exports, { foo: () => foo });"
+			if len(properties) > 0 {
+				exportRef := c.files[runtime.SourceIndex].repr.(*reprJS).ast.ModuleScope.Members["__export"].Ref
+				repr.crossChunkSuffixStmts = []js_ast.Stmt{{Data: &js_ast.SExpr{Value: js_ast.Expr{Data: &js_ast.ECall{
+					Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: exportRef}},
+					Args: []js_ast.Expr{
+						{Data: &js_ast.EDot{
+							Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: c.unboundModuleRef}},
+							Name:   "exports",
+						}},
+						{Data: &js_ast.EObject{Properties: properties}},
+					},
+				}}}}}
+			}
+
 		default:
 			panic("Internal error")
 		}
@@ -941,6 +1150,7 @@ func (c *linkerContext) computeCrossChunkDependencies(chunks []chunkInfo) {
 
 		var crossChunkImports []uint32
 		var crossChunkPrefixStmts []js_ast.Stmt
+		repr.crossChunkImportAliases = nil
 
 		for _, crossChunkImport := range c.sortedCrossChunkImports(chunks, repr.importsFromOtherChunks) {
 			switch c.options.OutputFormat {
@@ -964,6 +1174,33 @@ func (c *linkerContext) computeCrossChunkDependencies(chunks []chunkInfo) {
 					}})
 				}
 
+			case config.FormatCommonJS:
+				// The imported symbols are read from the exports of the other chunk
+				// whenever they are used, so that they are live bindings
+				importRecordIndex := uint32(len(crossChunkImports))
+				crossChunkImports = append(crossChunkImports, crossChunkImport.chunkIndex)
+				require := js_ast.Expr{Data: &js_ast.ERequire{ImportRecordIndex: importRecordIndex}}
+				if len(crossChunkImport.sortedImportItems) > 0 {
+					// "var chunk = require('./chunk.js');"
+					namespaceRef := c.newCrossChunkNamespaceRef()
+					if repr.crossChunkImportAliases == nil {
+						repr.crossChunkImportAliases = make(map[js_ast.Ref]js_ast.NamespaceAlias)
+					}
+					for _, item := range crossChunkImport.sortedImportItems {
+						repr.crossChunkImportAliases[item.ref] = js_ast.NamespaceAlias{
+							NamespaceRef: namespaceRef,
+							Alias:        item.exportAlias,
+						}
+					}
+					crossChunkPrefixStmts = append(crossChunkPrefixStmts, js_ast.Stmt{Data: &js_ast.SLocal{Decls: []js_ast.Decl{{
+						Binding: js_ast.Binding{Data: &js_ast.BIdentifier{Ref: namespaceRef}},
+						Value:   &require,
+					}}}})
+				} else {
+					// "require('./chunk.js');"
+					crossChunkPrefixStmts = append(crossChunkPrefixStmts, js_ast.Stmt{Data: &js_ast.SExpr{Value: require}})
+				}
+
 			default:
 				panic("Internal error")
 			}
@@ -974,6 +1211,19 @@ func (c *linkerContext) computeCrossChunkDependencies(chunks []chunkInfo) {
 	}
 }
 
+// Allocates a symbol for the object returned by "require()" for another chunk.
+// It is generated in the runtime like the other symbols that the linker adds.
+func (c *linkerContext) newCrossChunkNamespaceRef() js_ast.Ref {
+	runtimeSymbols := &c.symbols.Outer[runtime.SourceIndex]
+	ref := js_ast.Ref{OuterIndex: runtime.SourceIndex, InnerIndex: uint32(len(*runtimeSymbols))}
+	*runtimeSymbols = append(*runtimeSymbols, js_ast.Symbol{
+		Kind:         js_ast.SymbolOther,
+		OriginalName: "chunk",
+		Link:         js_ast.InvalidRef,
+	})
+	return ref
+}
+
 type crossChunkImport struct {
 	chunkIndex        uint32
 	sortingKey        string
@@ -1135,6 +1385,12 @@ func (c *linkerContext) scanImportsAndExports() {
 						if !otherFile.isEntryPoint {
 							c.entryPoints = append(c.entryPoints, *record.SourceIndex)
 							otherFile.isEntryPoint = true
+
+							// CommonJS entry points need an exports object like above
+							if otherRepr.ast.HasES6Exports && c.options.OutputFormat == config.FormatCommonJS {
+								otherRepr.ast.UsesExportsRef = true
+								otherRepr.meta.forceIncludeExportsForEntryPoint = true
+							}
 						}
 					} else {
 						// If we're not splitting, then import() is just a require() that
@@ -1181,6 +1437,7 @@ func (c *linkerContext) scanImportsAndExports() {
 		if repr.meta.cjsStyleExports &&
 			(c.options.OutputFormat == config.FormatIIFE ||
 				c.options.OutputFormat == config.FormatUMD ||
+				c.options.OutputFormat == config.FormatSystemJS ||
 				c.options.OutputFormat == config.FormatESModule) {
 			repr.meta.cjsWrap = true
 		}
@@ -1234,6 +1491,14 @@ func (c *linkerContext) scanImportsAndExports() {
 			c.matchImportsWithExportsForFile(uint32(sourceIndex))
 		}
 
+		// A WebAssembly module instantiated using top-level await can't be
+		// wrapped in a function, which "require()" and "import()" would need
+		if file.loader == config.LoaderWasmModule && repr.meta.cjsWrap && wasmUsesTopLevelAwait(c.options) {
+			c.log.AddError(nil, logger.Loc{}, fmt.Sprintf(
+				"Cannot use \"require()\" or \"import()\" with the WebAssembly module %s, which is instantiated using top-level await",
+				file.source.PrettyPath))
+		}
+
 		// If we're exporting as CommonJS and this file doesn't need a wrapper,
 		// then we'll be using the actual CommonJS "exports" and/or "module"
 		// symbols. In that case make sure to mark them as such so they don't
@@ -1491,6 +1756,12 @@ func (c *linkerContext) createExportsForFile(sourceIndex uint32) {
 	needsEntryPointES6ExportPart := file.isEntryPoint && !repr.meta.cjsWrap &&
 		c.options.OutputFormat == config.FormatESModule && len(repr.meta.sortedAndFilteredExportAliases) > 0
 
+	// If the output format is SystemJS and we're an entry point, pass all
+	// exports to the "_export" function of the "System.register" wrapper.
+	needsEntryPointSystemJSExportPart := file.isEntryPoint && !repr.meta.cjsWrap &&
+		c.options.OutputFormat == config.FormatSystemJS && len(repr.meta.sortedAndFilteredExportAliases) > 0
+	var entryPointSystemJSExports []js_ast.Property
+
 	// Generate a getter per export
 	properties := []js_ast.Property{}
 	nsExportNonLocalDependencies := []partRef{}
@@ -1613,6 +1884,13 @@ func (c *linkerContext) createExportsForFile(sourceIndex uint32) {
 			}
 		}
 
+		if needsEntryPointSystemJSExportPart {
+			entryPointSystemJSExports = append(entryPointSystemJSExports, js_ast.Property{
+				Key:   js_ast.Expr{Data: &js_ast.EString{Value: js_lexer.StringToUTF16(alias)}},
+				Value: &value,
+			})
+		}
+
 		// Add a getter property
 		var getter js_ast.Expr
 		body := js_ast.FnBody{Stmts: []js_ast.Stmt{{Loc: value.Loc, Data: &js_ast.SReturn{Value: &value}}}}
@@ -1737,6 +2015,14 @@ func (c *linkerContext) createExportsForFile(sourceIndex uint32) {
 			js_ast.Stmt{Data: &js_ast.SExportClause{Items: entryPointES6ExportItems}})
 	}
 
+	// "_export({ foo: foo })"
+	if len(entryPointSystemJSExports) > 0 {
+		entryPointExportStmts = append(entryPointExportStmts, js_ast.Stmt{Data: &js_ast.SExpr{Value: js_ast.Expr{Data: &js_ast.ECall{
+			Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: c.systemJSExportRef}},
+			Args:   []js_ast.Expr{{Data: &js_ast.EObject{Properties: entryPointSystemJSExports}}},
+		}}}})
+	}
+
 	// If we're an entry point, call the require function at the end of the
 	// bundle right before bundle evaluation ends
 	var cjsWrapStmt js_ast.Stmt
@@ -1780,6 +2066,16 @@ func (c *linkerContext) createExportsForFile(sourceIndex uint32) {
 					}},
 				)
 
+			case config.FormatSystemJS:
+				// "_export("default", require_foo());"
+				cjsWrapStmt = js_ast.Stmt{Data: &js_ast.SExpr{Value: js_ast.Expr{Data: &js_ast.ECall{
+					Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: c.systemJSExportRef}},
+					Args: []js_ast.Expr{
+						{Data: &js_ast.EString{Value: js_lexer.StringToUTF16("default")}},
+						{Data: &js_ast.ECall{Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: repr.ast.WrapperRef}}}},
+					},
+				}}}}
+
 			case config.FormatESModule:
 				// "export default require_foo();"
 				cjsWrapStmt = js_ast.Stmt{Data: &js_ast.SExportDefault{Value: js_ast.ExprOrStmt{Expr: &js_ast.Expr{Data: &js_ast.ECall{
@@ -1997,6 +2293,26 @@ loop:
 						namedImport.Alias, c.files[nextTracker.sourceIndex].source.PrettyPath))
 			}
 
+			// Warn about a default import of a CommonJS module exporting a function
+			// or a class, since environments disagree on what the default export is.
+			// Don't bother people with warnings about code in "node_modules". Also
+			// packages are usually imported this way on purpose and work in node.
+			if status == importCommonJS && namedImport.Alias == "default" {
+				otherFile := &c.files[nextTracker.sourceIndex]
+				otherRepr := otherFile.repr.(*reprJS)
+				if loc := otherRepr.ast.NonObjectModuleExports; loc != nil && !otherRepr.ast.HasES6ImportsOrExports() &&
+					!resolver.IsInsideNodeModules(c.fs, trackerFile.source.KeyPath.Text) &&
+					!resolver.IsInsideNodeModules(c.fs, otherFile.source.KeyPath.Text) {
+					source := trackerFile.source
+					other := otherFile.source
+					c.log.AddRangeWarningWithNotes(&source, js_lexer.RangeOfIdentifier(source, namedImport.AliasLoc),
+						fmt.Sprintf("The default import of the CommonJS module %q may differ across environments "+
+							"because its \"module.exports\" is not an object", other.PrettyPath),
+						[]logger.MsgData{logger.RangeData(&other, js_lexer.RangeOfIdentifier(other, *loc),
+							"The value of \"module.exports\" is assigned here")})
+				}
+			}
+
 		case importNoMatch:
 			symbol := c.symbols.Get(tracker.importRef)
 			trackerFile := &c.files[tracker.sourceIndex]
@@ -2110,8 +2426,10 @@ func (c *linkerContext) isCommonJSDueToExportStar(sourceIndex uint32, visited ma
 
 		// This file is CommonJS if the exported imports are from a file that is
 		// either CommonJS directly or transitively by itself having an export star
-		// from a CommonJS file.
-		if (record.SourceIndex == nil && (!c.files[sourceIndex].isEntryPoint || !c.options.OutputFormat.KeepES6ImportExportSyntax())) ||
+		// from a CommonJS file. SystemJS re-exports external modules from the
+		// entry point itself.
+		if (record.SourceIndex == nil && (!c.files[sourceIndex].isEntryPoint || (!c.options.OutputFormat.KeepES6ImportExportSyntax() &&
+			c.options.OutputFormat != config.FormatSystemJS))) ||
 			(record.SourceIndex != nil && *record.SourceIndex != sourceIndex && c.isCommonJSDueToExportStar(*record.SourceIndex, visited)) {
 			repr.meta.cjsStyleExports = true
 			return true
@@ -2353,6 +2671,18 @@ func (c *linkerContext) markPartsReachableFromEntryPoints() {
 	for i, entryPoint := range c.entryPoints {
 		c.includeFile(entryPoint, uint(i), 0)
 	}
+
+	// Chunks in the CommonJS format export symbols to other chunks using the
+	// "__export" runtime helper. Which chunks will need it is not known yet.
+	if c.options.CodeSplitting && c.options.OutputFormat == config.FormatCommonJS && len(c.entryPoints) > 1 {
+		runtimeRepr := c.files[runtime.SourceIndex].repr.(*reprJS)
+		exportRef := runtimeRepr.ast.ModuleScope.Members["__export"].Ref
+		for i := range c.entryPoints {
+			for _, partIndex := range runtimeRepr.ast.TopLevelSymbolToParts[exportRef] {
+				c.includePart(runtime.SourceIndex, partIndex, uint(i), 1)
+			}
+		}
+	}
 }
 
 // Code splitting may cause an assignment to a local variable to end up in a
@@ -2589,8 +2919,10 @@ func (c *linkerContext) includePart(sourceIndex uint32, partIndex uint32, entryP
 		// Don't follow external imports (this includes import() expressions)
 		if record.SourceIndex == nil || c.isExternalDynamicImport(record) {
 			// This is an external import, so it needs the "__toModule" wrapper as
-			// long as it's not a bare "require()"
-			if record.Kind != ast.ImportRequire && !c.options.OutputFormat.KeepES6ImportExportSyntax() {
+			// long as it's not a bare "require()". SystemJS passes ES6 modules to
+			// the bundle, which need no wrapper.
+			if record.Kind != ast.ImportRequire && !c.options.OutputFormat.KeepES6ImportExportSyntax() &&
+				c.options.OutputFormat != config.FormatSystemJS {
 				record.WrapWithToModule = true
 				toModuleUses++
 			}
@@ -2629,8 +2961,10 @@ func (c *linkerContext) includePart(sourceIndex uint32, partIndex uint32, entryP
 	for _, importRecordIndex := range repr.ast.ExportStarImportRecords {
 		record := &repr.ast.ImportRecords[importRecordIndex]
 
-		// Is this export star evaluated at run time?
-		if (record.SourceIndex == nil && (!file.isEntryPoint || !c.options.OutputFormat.KeepES6ImportExportSyntax())) ||
+		// Is this export star evaluated at run time? SystemJS re-exports external
+		// modules from the entry point in the setters of the wrapper.
+		if (record.SourceIndex == nil && (!file.isEntryPoint || (!c.options.OutputFormat.KeepES6ImportExportSyntax() &&
+			c.options.OutputFormat != config.FormatSystemJS))) ||
 			(record.SourceIndex != nil && *record.SourceIndex != sourceIndex && c.files[*record.SourceIndex].repr.(*reprJS).meta.cjsStyleExports) {
 			record.CallsRunTimeExportStarFn = true
 			repr.ast.UsesExportsRef = true
@@ -2685,14 +3019,80 @@ func baseFileNameForVirtualModulePath(path string) string {
 	return sb.String()
 }
 
+// This computes the directory relative to the output directory and the file
+// name that the output file of an entry point is written to
+// Converts a directory relative to the output base to a directory relative to
+// the output directory
+func outputRelDir(relDir string) string {
+	relDir = strings.ReplaceAll(relDir, "\\", "/")
+
+	// Replace leading "../" so we don't try to write outside of the output
+	// directory. This normally can't happen because "AbsOutputBase" is
+	// automatically computed to contain all entry point files, but it can
+	// happen if someone sets it manually via the "outbase" API option.
+	//
+	// Note that we can't just strip any leading "../" because that could
+	// cause two separate entry point paths to collide. For example, there
+	// could be both "src/index.js" and "../src/index.js" as entry points.
+	dotDotCount := 0
+	for strings.HasPrefix(relDir[dotDotCount*3:], "../") {
+		dotDotCount++
+	}
+	if dotDotCount > 0 {
+		// The use of "_.._" here is somewhat arbitrary but it is unlikely to
+		// collide with a folder named by a human and it works on Windows
+		// (Windows doesn't like names that end with a "."). And not starting
+		// with a "." means that it will not be hidden on Unix.
+		relDir = strings.Repeat("_.._/", dotDotCount) + relDir[dotDotCount*3:]
+	}
+	return relDir
+}
+
+func entryPointOutputPath(fs fs.FS, options *config.Options, source logger.Source, repr chunkRepr) (relDir string, baseName string) {
+	if options.AbsOutputFile != "" {
+		baseName = fs.Base(options.AbsOutputFile)
+	} else {
+		if source.KeyPath.Namespace != "file" {
+			baseName = baseFileNameForVirtualModulePath(source.KeyPath.Text)
+		} else if relPath, ok := fs.Rel(options.AbsOutputBase, source.KeyPath.Text); ok {
+			relDir = outputRelDir(fs.Dir(relPath))
+			baseName = fs.Base(relPath)
+		} else {
+			baseName = fs.Base(source.KeyPath.Text)
+		}
+
+		// Swap the extension for the standard one
+		ext := fs.Ext(baseName)
+		baseName = baseName[:len(baseName)-len(ext)]
+
+		// The content hash isn't known until all output files have been
+		// generated, so a placeholder is substituted for it at the very end
+		if options.EntryPathTemplate != "" {
+			_, isCSS := repr.(*chunkReprCSS)
+			relDir, baseName = path.Split(config.PathTemplate{
+				Dir:  relDir,
+				Name: baseName,
+				Hash: entryPointHashPlaceholder(source.Index, isCSS),
+			}.Apply(options.EntryPathTemplate))
+			relDir = strings.TrimSuffix(relDir, "/")
+		}
+
+		switch repr.(type) {
+		case *chunkReprJS:
+			baseName += options.OutputExtensionJS
+		case *chunkReprCSS:
+			baseName += options.OutputExtensionCSS
+		}
+	}
+	return
+}
+
 func (c *linkerContext) computeChunks() []chunkInfo {
 	chunks := make(map[string]chunkInfo)
 	neverReachedKey := string(newBitSet(uint(len(c.entryPoints))).entries)
 
 	// Compute entry point names
 	for i, entryPoint := range c.entryPoints {
-		var relDir string
-		var baseName string
 		var repr chunkRepr
 		file := &c.files[entryPoint]
 
@@ -2703,50 +3103,7 @@ func (c *linkerContext) computeChunks() []chunkInfo {
 			repr = &chunkReprCSS{}
 		}
 
-		if c.options.AbsOutputFile != "" {
-			baseName = c.fs.Base(c.options.AbsOutputFile)
-		} else {
-			source := file.source
-			if source.KeyPath.Namespace != "file" {
-				baseName = baseFileNameForVirtualModulePath(source.KeyPath.Text)
-			} else if relPath, ok := c.fs.Rel(c.options.AbsOutputBase, source.KeyPath.Text); ok {
-				relDir = c.fs.Dir(relPath)
-				baseName = c.fs.Base(relPath)
-				relDir = strings.ReplaceAll(relDir, "\\", "/")
-
-				// Replace leading "../" so we don't try to write outside of the output
-				// directory. This normally can't happen because "AbsOutputBase" is
-				// automatically computed to contain all entry point files, but it can
-				// happen if someone sets it manually via the "outbase" API option.
-				//
-				// Note that we can't just strip any leading "../" because that could
-				// cause two separate entry point paths to collide. For example, there
-				// could be both "src/index.js" and "../src/index.js" as entry points.
-				dotDotCount := 0
-				for strings.HasPrefix(relDir[dotDotCount*3:], "../") {
-					dotDotCount++
-				}
-				if dotDotCount > 0 {
-					// The use of "_.._" here is somewhat arbitrary but it is unlikely to
-					// collide with a folder named by a human and it works on Windows
-					// (Windows doesn't like names that end with a "."). And not starting
-					// with a "." means that it will not be hidden on Unix.
-					relDir = strings.Repeat("_.._/", dotDotCount) + relDir[dotDotCount*3:]
-				}
-			} else {
-				baseName = c.fs.Base(source.KeyPath.Text)
-			}
-
-			// Swap the extension for the standard one
-			ext := c.fs.Ext(baseName)
-			baseName = baseName[:len(baseName)-len(ext)]
-			switch repr.(type) {
-			case *chunkReprJS:
-				baseName += c.options.OutputExtensionJS
-			case *chunkReprCSS:
-				baseName += c.options.OutputExtensionCSS
-			}
-		}
+		relDir, baseName := entryPointOutputPath(c.fs, c.options, file.source, repr)
 
 		// Always use cross-platform path separators to avoid problems with Windows
 		file.entryPointRelPath = path.Join(relDir, baseName)
@@ -2816,6 +3173,13 @@ func (c *linkerContext) computeChunks() []chunkInfo {
 	sortedChunks := make([]chunkInfo, len(chunks))
 	for i, key := range sortedKeys {
 		sortedChunks[i] = chunks[key]
+
+		// The directory of a shared chunk must be known before it's generated
+		// because imports between chunks are relative. The hash isn't known yet,
+		// but the template only allows it in the base name.
+		if !sortedChunks[i].isEntryPoint {
+			sortedChunks[i].relDir, _ = c.sharedChunkRelPath("[hash]")
+		}
 	}
 	return sortedChunks
 }
@@ -3299,6 +3663,9 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 	chunkAbsDir string,
 	commonJSRef js_ast.Ref,
 	toModuleRef js_ast.Ref,
+	systemJS *js_printer.SystemJSOptions,
+	umd *js_printer.UMDOptions,
+	crossChunkImportAliases map[js_ast.Ref]js_ast.NamespaceAlias,
 	result *compileResultJS,
 	dataForSourceMaps []dataForSourceMap,
 ) {
@@ -3429,6 +3796,8 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 	indent := 0
 	if c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat == config.FormatUMD {
 		indent++
+	} else if c.options.OutputFormat == config.FormatSystemJS {
+		indent += 3
 	}
 
 	// Convert the AST to JavaScript code
@@ -3439,17 +3808,22 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 		MangleSyntax:        c.options.MangleSyntax,
 		ASCIIOnly:           c.options.ASCIIOnly,
 		ToModuleRef:         toModuleRef,
-		ExtractComments:     c.options.Mode == config.ModeBundle && c.options.RemoveWhitespace,
+		ExtractComments:     c.shouldExtractLegalComments(),
+		Comments:            c.options.Comments,
+		LegalComments:       c.options.LegalComments,
 		UnsupportedFeatures: c.options.UnsupportedJSFeatures,
 		AddSourceMappings:   addSourceMappings,
 		InputSourceMap:      inputSourceMap,
 		LineOffsetTables:    lineOffsetTables,
+		SystemJS:            systemJS,
+		UMD:                 umd,
+		CrossChunkImports:   crossChunkImportAliases,
 		WrapperRefForSource: func(sourceIndex uint32) js_ast.Ref {
 			return c.files[sourceIndex].repr.(*reprJS).ast.WrapperRef
 		},
 	}
 	tree := repr.ast
-	tree.Directive = "" // This is handled elsewhere
+	tree.Directives = nil // This is handled elsewhere
 	tree.Parts = []js_ast.Part{{Stmts: stmts}}
 	*result = compileResultJS{
 		PrintResult: js_printer.Print(tree, c.symbols, r, printOptions),
@@ -3460,7 +3834,6 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 	// from the main entry point code. This is sometimes required to deal with
 	// CommonJS import cycles.
 	if len(stmtList.entryPointTail) > 0 {
-		tree := repr.ast
 		tree.Parts = []js_ast.Part{{Stmts: stmtList.entryPointTail}}
 		entryPointTail := js_printer.Print(tree, c.symbols, r, printOptions)
 		result.entryPointTail = &entryPointTail
@@ -3469,6 +3842,40 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 	waitGroup.Done()
 }
 
+// The banner or the footer of an entry point is appended to the global one
+func (c *linkerContext) entryPointText(chunk *chunkInfo, global string, texts map[string]string) string {
+	if !chunk.isEntryPoint {
+		return global
+	}
+	keyPath := c.files[chunk.sourceIndex].source.KeyPath
+	if text, ok := texts[keyPath.Text]; ok && keyPath.Namespace == "file" && len(text) > 0 {
+		if len(global) > 0 {
+			return global + "\n" + text
+		}
+		return text
+	}
+	return global
+}
+
+// Returns the symbols of the objects returned by "require()" for other chunks
+// in the order of the cross-chunk imports
+func (c *linkerContext) crossChunkNamespaceRefs(chunk *chunkInfo) (refs []js_ast.Ref) {
+	repr, ok := chunk.repr.(*chunkReprJS)
+	if !ok || len(repr.crossChunkImportAliases) == 0 {
+		return
+	}
+	for _, stmt := range repr.crossChunkPrefixStmts {
+		if local, ok := stmt.Data.(*js_ast.SLocal); ok {
+			for _, decl := range local.Decls {
+				if id, ok := decl.Binding.Data.(*js_ast.BIdentifier); ok {
+					refs = append(refs, id.Ref)
+				}
+			}
+		}
+	}
+	return
+}
+
 func (c *linkerContext) renameSymbolsInChunk(chunk *chunkInfo, filesInOrder []uint32) renamer.Renamer {
 	// Determine the reserved names (e.g. can't generate the name "if")
 	moduleScopes := make([]*js_ast.Scope, len(filesInOrder))
@@ -3483,6 +3890,19 @@ func (c *linkerContext) renameSymbolsInChunk(chunk *chunkInfo, filesInOrder []ui
 		reservedNames["Promise"] = 1
 	}
 
+	// The code uses the variables of the "System.register" wrapper, which are
+	// not declared in any file of the chunk
+	if c.options.OutputFormat == config.FormatSystemJS {
+		for _, ref := range []js_ast.Ref{c.systemJSExportRef, c.systemJSContextRef, c.systemJSDepsRef, c.systemJSTempRef} {
+			reservedNames[c.symbols.Get(ref).OriginalName] = 1
+		}
+	}
+
+	// Cross-chunk exports in CommonJS are assigned to "module.exports"
+	if repr, ok := chunk.repr.(*chunkReprJS); ok && c.options.OutputFormat == config.FormatCommonJS && len(repr.crossChunkSuffixStmts) > 0 {
+		reservedNames["module"] = 1
+	}
+
 	// Minification uses frequency analysis to give shorter names to more frequent symbols
 	if c.options.MinifyIdentifiers {
 		// Determine the first top-level slot (i.e. not in a nested scope)
@@ -3494,6 +3914,9 @@ func (c *linkerContext) renameSymbolsInChunk(chunk *chunkInfo, filesInOrder []ui
 
 		// Accumulate symbol usage counts into their slots
 		freq := js_ast.CharFreq{}
+		for _, ref := range c.crossChunkNamespaceRefs(chunk) {
+			r.AccumulateSymbolCount(ref, 1)
+		}
 		for _, sourceIndex := range filesInOrder {
 			repr := c.files[sourceIndex].repr.(*reprJS)
 			if repr.ast.CharFreq != nil {
@@ -3551,6 +3974,9 @@ func (c *linkerContext) renameSymbolsInChunk(chunk *chunkInfo, filesInOrder []ui
 	for _, stable := range sorted {
 		r.AddTopLevelSymbol(stable.Ref)
 	}
+	for _, ref := range c.crossChunkNamespaceRefs(chunk) {
+		r.AddTopLevelSymbol(ref)
+	}
 
 	for _, sourceIndex := range filesInOrder {
 		repr := c.files[sourceIndex].repr.(*reprJS)
@@ -3647,6 +4073,20 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 	chunkAbsDir := c.fs.Join(c.options.AbsOutputDir, chunk.relDir)
 	dataForSourceMaps := c.dataForSourceMaps()
 
+	// The "System.register" wrapper passes external modules to the code
+	var systemJS *js_printer.SystemJSOptions
+	var systemJSDeps []systemJSDep
+	if c.options.OutputFormat == config.FormatSystemJS {
+		systemJS, systemJSDeps = c.systemJSOptionsForChunk(chunk)
+	}
+
+	// The UMD wrapper passes external modules to the factory function
+	var umd *js_printer.UMDOptions
+	var umdDeps []umdDep
+	if c.options.OutputFormat == config.FormatUMD {
+		umd, umdDeps = c.umdOptionsForChunk(chunk)
+	}
+
 	// Generate JavaScript for each file in parallel
 	waitGroup := sync.WaitGroup{}
 	for _, partRange := range chunk.partsInChunkInOrder {
@@ -3667,6 +4107,9 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 			chunkAbsDir,
 			commonJSRef,
 			toModuleRef,
+			systemJS,
+			umd,
+			repr.crossChunkImportAliases,
 			compileResult,
 			dataForSourceMaps,
 		)
@@ -3688,12 +4131,15 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 			indent := 0
 			if c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat == config.FormatUMD {
 				indent++
+			} else if c.options.OutputFormat == config.FormatSystemJS {
+				indent += 3
 			}
 			printOptions := js_printer.Options{
-				Indent:           indent,
-				OutputFormat:     c.options.OutputFormat,
-				RemoveWhitespace: c.options.RemoveWhitespace,
-				MangleSyntax:     c.options.MangleSyntax,
+				Indent:            indent,
+				OutputFormat:      c.options.OutputFormat,
+				RemoveWhitespace:  c.options.RemoveWhitespace,
+				MangleSyntax:      c.options.MangleSyntax,
+				CrossChunkImports: repr.crossChunkImportAliases,
 			}
 			crossChunkPrefix = js_printer.Print(js_ast.AST{
 				ImportRecords: continueData.crossChunkImportRecords,
@@ -3732,22 +4178,55 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 				isExecutable = true
 			}
 
-			// Add the top-level directive if present
-			if repr.ast.Directive != "" {
-				quoted := string(js_printer.QuoteForJSON(repr.ast.Directive, c.options.ASCIIOnly)) + ";" + newline
+		}
+
+		// Add the top-level directives if present. The "use client" and "use
+		// server" directives of the other modules in this chunk are hoisted here
+		// too since they have no effect anywhere else.
+		printedDirectives := make(map[string]bool)
+		for _, sourceIndex := range chunk.filesInChunkInOrder {
+			repr, ok := c.files[sourceIndex].repr.(*reprJS)
+			if !ok {
+				continue
+			}
+			isEntryPoint := chunk.isEntryPoint && sourceIndex == chunk.sourceIndex
+			for _, directive := range repr.ast.Directives {
+				if printedDirectives[directive] || (!isEntryPoint && !js_ast.IsComponentDirective(directive)) {
+					continue
+				}
+				printedDirectives[directive] = true
+				quoted := string(js_printer.QuoteForJSON(directive, c.options.ASCIIOnly)) + ";" + newline
 				prevOffset.advanceString(quoted)
 				j.AddString(quoted)
 				newlineBeforeComment = true
 			}
 		}
 
-		if len(c.options.Banner) > 0 {
-			prevOffset.advanceString(c.options.Banner)
+		if banner := c.entryPointText(chunk, c.options.Banner.JS, c.options.EntryPointBanners); len(banner) > 0 {
+			prevOffset.advanceString(banner)
 			prevOffset.advanceString("\n")
-			j.AddString(c.options.Banner)
+			j.AddString(banner)
 			j.AddString("\n")
 		}
 
+		// Define the runtime APIs used in this chunk, which the target lacks
+		if c.options.Polyfills {
+			if text := c.generatePolyfills(chunk); text != "" {
+				prevOffset.advanceString(text)
+				j.AddString(text)
+				newlineBeforeComment = true
+			}
+		}
+
+		// Configure the AMD loader before any of the modules is defined
+		if c.options.OutputFormat == config.FormatJoin && chunk.isEntryPoint {
+			if text := generateAMDConfigCall(c.options); text != "" {
+				prevOffset.advanceString(text)
+				j.AddString(text)
+				newlineBeforeComment = true
+			}
+		}
+
 		// Optionally wrap with an IIFE
 		if c.options.OutputFormat == config.FormatIIFE {
 			var text string
@@ -3765,33 +4244,21 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 			newlineBeforeComment = false
 			// Optionally wrap with an UMD
 		} else if c.options.OutputFormat == config.FormatUMD {
-			var text string
-			var prefix string
 			indent = "  "
-			if len(c.options.GlobalName) > 0 {
-				prefix = generateModuleNameAssignment(c.options)
-			}
-			if c.options.UnsupportedJSFeatures.Has(compat.Arrow) {
-				text = "(function(root," + space + "factory)" + space + "{" + newline +
-					space + space + "if" + space + "(typeof define" + space + "===" + space + "\"function\"" + space + "&&" + space + "define.amd)" + space + "{" + newline +
-					space + space + space + space + "define(factory);" + newline +
-					space + space + "}" + space + "else if" + space + "(typeof module" + space + "===" + space + "\"object\"" + space + "&&" + space + "module.exports)" + space + "{" + newline +
-					space + space + space + space + "module.exports" + space + "=" + space + "factory();" + newline +
-					space + space + "}" + space + "else" + space + "{" + newline +
-					space + space + space + space + prefix + "factory();" + newline +
-					space + space + "}" + newline +
-					"}(typeof self" + space + "!==" + space + "\"undefined\"" + space + "?" + space + "self" + space + ":" + space + "this," + space + "function()" + space + "{" + newline
-			} else {
-				text = "(function(root," + space + "factory)" + space + "{" + newline +
-					space + space + "if" + space + "(typeof define" + space + "===" + space + "\"function\"" + space + "&&" + space + "define.amd)" + space + "{" + newline +
-					space + space + space + space + "define(factory);" + newline +
-					space + space + "}" + space + "else if" + space + "(typeof module" + space + "===" + space + "\"object\"" + space + "&&" + space + "module.exports)" + space + "{" + newline +
-					space + space + space + space + "module.exports" + space + "=" + space + "factory();" + newline +
-					space + space + "}" + space + "else" + space + "{" + newline +
-					space + space + space + space + prefix + "factory();" + newline +
-					space + space + "}" + newline +
-					"}(typeof self" + space + "!==" + space + "\"undefined\"" + space + "?" + space + "self" + space + ":" + space + "this," + space + "()" + space + "=>" + space + "{" + newline
+			text := generateUMDPrefix(c.options, umdDeps)
+			prevOffset.advanceString(text)
+			j.AddString(text)
+			newlineBeforeComment = false
+			// Optionally wrap with a SystemJS registration
+		} else if c.options.OutputFormat == config.FormatSystemJS {
+			indent = "      "
+			usesTemp := false
+			for _, compileResult := range compileResults {
+				if compileResult.UsesSystemJSTemp || (compileResult.entryPointTail != nil && compileResult.entryPointTail.UsesSystemJSTemp) {
+					usesTemp = true
+				}
 			}
+			text := generateSystemJSPrefix(c.options, systemJSDeps, usesTemp)
 			prevOffset.advanceString(text)
 			j.AddString(text)
 			newlineBeforeComment = false
@@ -3872,7 +4339,7 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 		}
 
 		// Concatenate the generated JavaScript chunks together
-		var compileResultsForSourceMap []compileResultJS
+		var compileResultsForSourceMap []sourceMapResult
 		var entryPointTail *js_printer.PrintResult
 		var commentList []string
 		var metaOrder []string
@@ -3938,7 +4405,11 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 
 					// Include this file in the source map
 					if c.options.SourceMap != config.SourceMapNone {
-						compileResultsForSourceMap = append(compileResultsForSourceMap, compileResult)
+						compileResultsForSourceMap = append(compileResultsForSourceMap, sourceMapResult{
+							sourceMapChunk:  compileResult.SourceMapChunk,
+							sourceIndex:     compileResult.sourceIndex,
+							generatedOffset: compileResult.generatedOffset,
+						})
 					}
 				}
 
@@ -3988,6 +4459,19 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 			// Optionally wrap with an UMD
 		} else if c.options.OutputFormat == config.FormatUMD {
 			j.AddString("}));" + newline)
+			// Optionally wrap with a SystemJS registration
+		} else if c.options.OutputFormat == config.FormatSystemJS {
+			j.AddString(generateSystemJSSuffix(c.options))
+		}
+
+		// Start the application once all of the modules have been defined
+		if c.options.OutputFormat == config.FormatJoin && chunk.isEntryPoint {
+			if text := generateAMDBootstrapCall(c.options); text != "" {
+				if newlineBeforeComment {
+					j.AddString(newline)
+				}
+				j.AddString(text)
+			}
 		}
 
 		// Make sure the file ends with a newline
@@ -4000,67 +4484,27 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 		// comment. The comment must be preserved in the output for legal reasons but
 		// at the same time we want to generate a small bundle when minifying.
 		sort.Strings(commentList)
-		for _, text := range commentList {
-			j.AddString(text)
-			j.AddString("\n")
+		switch c.options.LegalComments {
+		case config.LegalCommentsLinkedWithComment, config.LegalCommentsExternalWithoutComment:
+			if len(commentList) > 0 {
+				results = append(results, c.appendLegalCommentsFile(&j, chunk, commentList, c.options.OutputExtensionJS))
+			}
+		default:
+			for _, text := range commentList {
+				j.AddString(text)
+				j.AddString("\n")
+			}
 		}
 
-		if len(c.options.Footer) > 0 {
-			j.AddString(c.options.Footer)
+		if footer := c.entryPointText(chunk, c.options.Footer.JS, c.options.EntryPointFooters); len(footer) > 0 {
+			j.AddString(footer)
 			j.AddString("\n")
 		}
 
 		if c.options.SourceMap != config.SourceMapNone {
 			sourceMap := c.generateSourceMapForChunk(compileResultsForSourceMap, chunkAbsDir, dataForSourceMaps)
-			var writeDataURL bool
-			var writeFile bool
-			switch c.options.SourceMap {
-			case config.SourceMapInline:
-				writeDataURL = true
-			case config.SourceMapLinkedWithComment, config.SourceMapExternalWithoutComment:
-				writeFile = true
-			case config.SourceMapInlineAndExternal:
-				writeDataURL = true
-				writeFile = true
-			}
-
-			// Write the generated source map as an inline comment
-			if writeDataURL {
-				j.AddString("//# sourceMappingURL=data:application/json;base64,")
-				j.AddString(base64.StdEncoding.EncodeToString(sourceMap))
-				j.AddString("\n")
-			}
-
-			// Write the generated source map as an external file
-			if writeFile {
-				// Optionally add metadata about the file
-				var jsonMetadataChunk []byte
-				if c.options.AbsMetadataFile != "" {
-					jsonMetadataChunk = []byte(fmt.Sprintf(
-						"{\n      \"imports\": [],\n      \"exports\": [],\n      \"inputs\": {},\n      \"bytes\": %d\n    }", len(sourceMap)))
-				}
-
-				// Figure out the base name for the source map which may include the content hash
-				var sourceMapBaseName string
-				if chunk.baseNameOrEmpty == "" {
-					hash := hashForFileName(sourceMap)
-					sourceMapBaseName = "chunk." + hash + c.options.OutputExtensionJS + ".map"
-				} else {
-					sourceMapBaseName = chunk.baseNameOrEmpty + ".map"
-				}
-
-				// Add a comment linking the source to its map
-				if c.options.SourceMap == config.SourceMapLinkedWithComment {
-					j.AddString("//# sourceMappingURL=")
-					j.AddString(sourceMapBaseName)
-					j.AddString("\n")
-				}
-
-				results = append(results, OutputFile{
-					AbsPath:           c.fs.Join(c.options.AbsOutputDir, chunk.relDir, sourceMapBaseName),
-					Contents:          sourceMap,
-					jsonMetadataChunk: jsonMetadataChunk,
-				})
+			if result := c.appendSourceMapComment(&j, chunk, sourceMap, c.options.OutputExtensionJS, "//# ", "\n"); result != nil {
+				results = append(results, *result)
 			}
 		}
 
@@ -4069,8 +4513,8 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 
 		// Figure out the base name for this chunk now that the content hash is known
 		if chunk.baseNameOrEmpty == "" {
-			hash := hashForFileName(jsContents)
-			chunk.baseNameOrEmpty = "chunk." + hash + c.options.OutputExtensionJS
+			_, baseName := c.sharedChunkRelPath(hashForFileName(jsContents))
+			chunk.baseNameOrEmpty = baseName + c.options.OutputExtensionJS
 		}
 
 		// End the metadata
@@ -4093,11 +4537,14 @@ func (repr *chunkReprJS) generate(c *linkerContext, chunk *chunkInfo) func(gener
 			jsonMetadataChunk = jMeta.Done()
 		}
 
+		kind, entryPointSourceIndex := chunk.outputKind()
 		results = append(results, OutputFile{
-			AbsPath:           c.fs.Join(c.options.AbsOutputDir, chunk.relPath()),
-			Contents:          jsContents,
-			jsonMetadataChunk: jsonMetadataChunk,
-			IsExecutable:      isExecutable,
+			AbsPath:               c.fs.Join(c.options.AbsOutputDir, chunk.relPath()),
+			Contents:              jsContents,
+			Kind:                  kind,
+			jsonMetadataChunk:     jsonMetadataChunk,
+			entryPointSourceIndex: entryPointSourceIndex,
+			IsExecutable:          isExecutable,
 		})
 		return results
 	}
@@ -4142,7 +4589,6 @@ func (c *linkerContext) generateGlobalNamePrefix() string {
 
 func generateModuleNameAssignment(options *config.Options) string {
 	var text string
-	prefix := options.GlobalName[0]
 	space := " "
 	join := ";\n"
 
@@ -4151,35 +4597,364 @@ func generateModuleNameAssignment(options *config.Options) string {
 		join = ";"
 	}
 
-	if js_printer.CanQuoteIdentifier(prefix, options.UnsupportedJSFeatures, options.ASCIIOnly) {
+	prefix := generatePropertyAccess(options, "root", options.GlobalName[0])
+	text = fmt.Sprintf("%s%s=%s", prefix, space, space)
+
+	for _, name := range options.GlobalName[1:] {
+		oldPrefix := prefix
+		prefix = generatePropertyAccess(options, prefix, name)
+		text += fmt.Sprintf("%s%s||%s{}%s%s%s%s%s%s%s=%s", oldPrefix, space, space, join, space, space, space, space, prefix, space, space)
+	}
+
+	return text
+}
+
+func generatePropertyAccess(options *config.Options, target string, name string) string {
+	if js_printer.CanQuoteIdentifier(name, options.UnsupportedJSFeatures, options.ASCIIOnly) {
 		if options.ASCIIOnly {
-			prefix = string(js_printer.QuoteIdentifier(nil, prefix, options.UnsupportedJSFeatures))
+			name = string(js_printer.QuoteIdentifier(nil, name, options.UnsupportedJSFeatures))
 		}
-		prefix = "root." + prefix
-		text = fmt.Sprintf("%s%s=%s", prefix, space, space)
-	} else {
-		prefix = fmt.Sprintf("root[%s]", js_printer.QuoteForJSON(prefix, options.ASCIIOnly))
-		text = fmt.Sprintf("%s%s=%s", prefix, space, space)
+		return fmt.Sprintf("%s.%s", target, name)
 	}
+	return fmt.Sprintf("%s[%s]", target, js_printer.QuoteForJSON(name, options.ASCIIOnly))
+}
 
-	for _, name := range options.GlobalName[1:] {
-		oldPrefix := prefix
-		if js_printer.CanQuoteIdentifier(name, options.UnsupportedJSFeatures, options.ASCIIOnly) {
-			if options.ASCIIOnly {
-				name = string(js_printer.QuoteIdentifier(nil, name, options.UnsupportedJSFeatures))
+type umdDep struct {
+	path string
+	name string
+}
+
+func isUMDDep(record ast.ImportRecord) bool {
+	return record.SourceIndex == nil && !record.IsUnused &&
+		(record.Kind == ast.ImportStmt || record.Kind == ast.ImportRequire)
+}
+
+// External modules imported by files in the chunk become parameters of the
+// factory function of the UMD wrapper, in the order of the files in the chunk.
+func (c *linkerContext) umdOptionsForChunk(chunk *chunkInfo) (*js_printer.UMDOptions, []umdDep) {
+	options := &js_printer.UMDOptions{DepRefs: make(map[string]js_ast.Ref)}
+	var deps []umdDep
+
+	for _, sourceIndex := range chunk.filesInChunkInOrder {
+		repr, ok := c.files[sourceIndex].repr.(*reprJS)
+		if !ok {
+			continue
+		}
+		for _, record := range repr.ast.ImportRecords {
+			if !isUMDDep(record) {
+				continue
 			}
-			prefix = fmt.Sprintf("%s.%s", prefix, name)
+			if _, ok := options.DepRefs[record.Path.Text]; ok {
+				continue
+			}
+			if ref, ok := c.umdDepRefs[record.Path.Text]; ok {
+				options.DepRefs[record.Path.Text] = ref
+				deps = append(deps, umdDep{path: record.Path.Text, name: c.symbols.Get(ref).OriginalName})
+			}
+		}
+	}
+
+	return options, deps
+}
+
+func generateUMDPrefix(options *config.Options, deps []umdDep) string {
+	space := " "
+	newline := "\n"
+	if options.RemoveWhitespace {
+		space = ""
+		newline = ""
+	}
+	indent := func(depth int) string {
+		return strings.Repeat(space+space, depth)
+	}
+
+	var prefix string
+	if len(options.GlobalName) > 0 {
+		prefix = generateModuleNameAssignment(options)
+	}
+
+	var paths, requires, globals, params []string
+	for _, dep := range deps {
+		paths = append(paths, string(js_printer.QuoteForJSON(dep.path, options.ASCIIOnly)))
+		requires = append(requires, fmt.Sprintf("require(%s)", js_printer.QuoteForJSON(dep.path, options.ASCIIOnly)))
+		if names, ok := options.GlobalExternals[dep.path]; ok {
+			global := "root"
+			for _, name := range names {
+				global = generatePropertyAccess(options, global, name)
+			}
+			globals = append(globals, global)
 		} else {
-			prefix = fmt.Sprintf("%s[%s]", prefix, js_printer.QuoteForJSON(name, options.ASCIIOnly))
+			globals = append(globals, fmt.Sprintf("root[%s]", js_printer.QuoteForJSON(dep.path, options.ASCIIOnly)))
 		}
-		text += fmt.Sprintf("%s%s||%s{}%s%s%s%s%s%s%s=%s", oldPrefix, space, space, join, space, space, space, space, prefix, space, space)
+		params = append(params, dep.name)
 	}
+	separator := "," + space
 
-	return text
+	define := "define(factory);"
+	if len(deps) > 0 {
+		define = fmt.Sprintf("define([%s],%sfactory);", strings.Join(paths, separator), space)
+	}
+
+	var factory string
+	if options.UnsupportedJSFeatures.Has(compat.Arrow) {
+		factory = fmt.Sprintf("function(%s)%s{", strings.Join(params, separator), space)
+	} else {
+		factory = fmt.Sprintf("(%s)%s=>%s{", strings.Join(params, separator), space, space)
+	}
+
+	return "(function(root," + space + "factory)" + space + "{" + newline +
+		indent(1) + "if" + space + "(typeof define" + space + "===" + space + "\"function\"" + space + "&&" + space + "define.amd)" + space + "{" + newline +
+		indent(2) + define + newline +
+		indent(1) + "}" + space + "else if" + space + "(typeof module" + space + "===" + space + "\"object\"" + space + "&&" + space + "module.exports)" + space + "{" + newline +
+		indent(2) + "module.exports" + space + "=" + space + "factory(" + strings.Join(requires, separator) + ");" + newline +
+		indent(1) + "}" + space + "else" + space + "{" + newline +
+		indent(2) + prefix + "factory(" + strings.Join(globals, separator) + ");" + newline +
+		indent(1) + "}" + newline +
+		"}(typeof self" + space + "!==" + space + "\"undefined\"" + space + "?" + space + "self" + space + ":" + space + "this," + space + factory + newline
+}
+
+// The polyfills of the runtime APIs used by the files in the chunk are
+// prepended to the chunk
+func (c *linkerContext) generatePolyfills(chunk *chunkInfo) string {
+	used := make(map[string]bool)
+	for _, sourceIndex := range chunk.filesInChunkInOrder {
+		if repr, ok := c.files[sourceIndex].repr.(*reprJS); ok {
+			for key := range repr.ast.PolyfillUses {
+				used[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(used))
+	for key := range used {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sb := strings.Builder{}
+	for _, key := range keys {
+		sb.WriteString(runtime.Polyfills[key].Code)
+	}
+	return sb.String()
+}
+
+// The AMD loader settings, which affect loading modules at run-time, are
+// passed to the loader at the top of the bundle:
+//
+//   require.config({ urlArgs: "v=1" });
+//
+func generateAMDConfigCall(options *config.Options) string {
+	amd := &options.AMD
+	if amd.UrlArgs == "" {
+		return ""
+	}
+	space := " "
+	newline := "\n"
+	if options.RemoveWhitespace {
+		space = ""
+		newline = ""
+	}
+
+	require := "require"
+	if amd.Namespace != "" {
+		require = amd.Namespace + ".require"
+	}
+	urlArgs := amd.UrlArgs
+	if !amd.UrlArgsIsFunction {
+		urlArgs = string(js_printer.QuoteForJSON(urlArgs, options.ASCIIOnly))
+	}
+	return fmt.Sprintf("%s.config({%surlArgs:%s%s%s});%s", require, space, space, urlArgs, space, newline)
+}
+
+// The modules from "deps" in the AMD config are required at the end of the
+// bundle. A callback given as a module name is loaded first:
+//
+//   require(["app"], function(callback) { require(["main"], callback); });
+//
+func generateAMDBootstrapCall(options *config.Options) string {
+	amd := &options.AMD
+	if len(amd.Deps) == 0 && amd.Callback == "" {
+		return ""
+	}
+	space := " "
+	newline := "\n"
+	if options.RemoveWhitespace {
+		space = ""
+		newline = ""
+	}
+
+	require := "require"
+	if amd.Namespace != "" {
+		require = amd.Namespace + ".require"
+	}
+	quoteArray := func(items []string) string {
+		sb := strings.Builder{}
+		sb.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				sb.WriteString("," + space)
+			}
+			// Bundled modules are defined with the namespace prefix
+			if !amd.IsSpecialModule(item) && !amd.IsExternalModule(item) && !amd.IsMappedModule(item, "") {
+				item = amd.PrefixModuleName(item)
+			}
+			sb.Write(js_printer.QuoteForJSON(item, options.ASCIIOnly))
+		}
+		sb.WriteByte(']')
+		return sb.String()
+	}
+	deps := quoteArray(amd.Deps)
+
+	switch {
+	case amd.Callback == "":
+		return fmt.Sprintf("%s(%s);%s", require, deps, newline)
+	case amd.CallbackIsFunction:
+		return fmt.Sprintf("%s(%s,%s%s);%s", require, deps, space, amd.Callback, newline)
+	default:
+		return fmt.Sprintf("%s(%s,%sfunction(callback)%s{%s%s(%s,%scallback);%s});%s",
+			require, quoteArray([]string{amd.Callback}), space, space, space, require, deps, space, space, newline)
+	}
+}
+
+type systemJSDep struct {
+	path         string
+	isExportStar bool
+}
+
+// External modules imported by files in the chunk become dependencies of the
+// "System.register" wrapper. Assignments to variables exported from the entry
+// point have to update the exports of the wrapper.
+func (c *linkerContext) systemJSOptionsForChunk(chunk *chunkInfo) (*js_printer.SystemJSOptions, []systemJSDep) {
+	options := &js_printer.SystemJSOptions{
+		ExportRef:     c.systemJSExportRef,
+		ContextRef:    c.systemJSContextRef,
+		DepsRef:       c.systemJSDepsRef,
+		TempRef:       c.systemJSTempRef,
+		DepIndices:    make(map[string]uint32),
+		ExportAliases: make(map[js_ast.Ref][]string),
+	}
+	var deps []systemJSDep
+
+	// Follow the imports depth-first to order the dependencies in the order,
+	// in which they would be evaluated as ES6 modules
+	visited := make(map[uint32]bool)
+	var visit func(uint32)
+	visit = func(sourceIndex uint32) {
+		if visited[sourceIndex] {
+			return
+		}
+		visited[sourceIndex] = true
+		repr, ok := c.files[sourceIndex].repr.(*reprJS)
+		if !ok {
+			return
+		}
+		for _, record := range repr.ast.ImportRecords {
+			if record.SourceIndex != nil {
+				visit(*record.SourceIndex)
+			} else if record.Kind == ast.ImportStmt && !record.IsUnused {
+				if _, ok := options.DepIndices[record.Path.Text]; !ok {
+					options.DepIndices[record.Path.Text] = uint32(len(deps))
+					deps = append(deps, systemJSDep{path: record.Path.Text})
+				}
+			}
+		}
+	}
+	if chunk.isEntryPoint {
+		visit(chunk.sourceIndex)
+	}
+	for _, sourceIndex := range chunk.filesInChunkInOrder {
+		visit(sourceIndex)
+	}
+
+	if chunk.isEntryPoint {
+		repr := c.files[chunk.sourceIndex].repr.(*reprJS)
+
+		// External modules re-exported from the entry point are exported from
+		// the setters of the wrapper, because their exports are not known
+		for _, importRecordIndex := range repr.ast.ExportStarImportRecords {
+			record := &repr.ast.ImportRecords[importRecordIndex]
+			if record.SourceIndex == nil {
+				if i, ok := options.DepIndices[record.Path.Text]; ok {
+					deps[i].isExportStar = true
+				}
+			}
+		}
+
+		if !repr.meta.cjsWrap {
+			for _, alias := range repr.meta.sortedAndFilteredExportAliases {
+				export := repr.meta.resolvedExports[alias]
+				if importToBind, ok := c.files[export.sourceIndex].repr.(*reprJS).meta.importsToBind[export.ref]; ok {
+					export.ref = importToBind.ref
+				}
+				if c.symbols.Get(export.ref).NamespaceAlias == nil {
+					ref := js_ast.FollowSymbols(c.symbols, export.ref)
+					options.ExportAliases[ref] = append(options.ExportAliases[ref], alias)
+				}
+			}
+		}
+	}
+
+	return options, deps
+}
+
+func generateSystemJSPrefix(options *config.Options, deps []systemJSDep, usesTemp bool) string {
+	space := " "
+	newline := "\n"
+	if options.RemoveWhitespace {
+		space = ""
+		newline = ""
+	}
+	indent := func(depth int) string {
+		return strings.Repeat(space+space, depth)
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("System.register([")
+	for i, dep := range deps {
+		if i > 0 {
+			sb.WriteString("," + space)
+		}
+		sb.Write(js_printer.QuoteForJSON(dep.path, options.ASCIIOnly))
+	}
+	sb.WriteString("]," + space + "function(_export," + space + "_context)" + space + "{" + newline)
+	if len(deps) > 0 {
+		sb.WriteString(indent(1) + "var _deps" + space + "=" + space + "[];" + newline)
+	}
+	if usesTemp {
+		sb.WriteString(indent(1) + "var _tmp;" + newline)
+	}
+	sb.WriteString(indent(1) + "return" + space + "{" + newline)
+	sb.WriteString(indent(2) + "setters:" + space + "[")
+	for i, dep := range deps {
+		if i > 0 {
+			sb.WriteString("," + space)
+		}
+		sb.WriteString("function(m)" + space + "{" + newline)
+		sb.WriteString(fmt.Sprintf("%s_deps[%d]%s=%sm;%s", indent(3), i, space, space, newline))
+		if dep.isExportStar {
+			sb.WriteString(indent(3) + "for" + space + "(var k in m)" + space + "if" + space + "(k" + space + "!==" + space +
+				"\"default\")" + space + "_export(k," + space + "m[k]);" + newline)
+		}
+		sb.WriteString(indent(2) + "}")
+	}
+	sb.WriteString("]," + newline)
+	sb.WriteString(indent(2) + "execute:" + space + "function()" + space + "{" + newline)
+	return sb.String()
+}
+
+func generateSystemJSSuffix(options *config.Options) string {
+	space := " "
+	newline := "\n"
+	if options.RemoveWhitespace {
+		space = ""
+		newline = ""
+	}
+	return space + space + space + space + "}" + newline +
+		space + space + "};" + newline +
+		"});" + newline
 }
 
 type compileResultCSS struct {
 	printedCSS            string
+	sourceMapChunk        js_printer.SourceMapChunk
 	sourceIndex           uint32
 	hasCharset            bool
 	externalImportRecords []ast.ImportRecord
@@ -4188,6 +4963,8 @@ type compileResultCSS struct {
 func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(generateContinue) []OutputFile {
 	var results []OutputFile
 	compileResults := make([]compileResultCSS, 0, len(chunk.filesInChunkInOrder))
+	chunkAbsDir := c.fs.Join(c.options.AbsOutputDir, chunk.relDir)
+	dataForSourceMaps := c.dataForSourceMaps()
 
 	// Generate CSS for each file in parallel
 	waitGroup := sync.WaitGroup{}
@@ -4205,9 +4982,9 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 			ast := file.repr.(*reprCSS).ast
 
 			// Filter out "@import" rules
-			rules := make([]css_ast.R, 0, len(ast.Rules))
+			rules := make([]css_ast.Rule, 0, len(ast.Rules))
 			for _, rule := range ast.Rules {
-				switch r := rule.(type) {
+				switch r := rule.Data.(type) {
 				case *css_ast.RAtCharset:
 					compileResult.hasCharset = true
 					continue
@@ -4221,10 +4998,23 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 			}
 			ast.Rules = rules
 
-			compileResult.printedCSS = css_printer.Print(ast, css_printer.Options{
-				RemoveWhitespace: c.options.RemoveWhitespace,
-				ASCIIOnly:        c.options.ASCIIOnly,
+			// Only generate a source map if needed
+			var addSourceMappings bool
+			var lineOffsetTables []js_printer.LineOffsetTable
+			if file.loader.CanHaveSourceMap() && c.options.SourceMap != config.SourceMapNone {
+				addSourceMappings = true
+				lineOffsetTables = dataForSourceMaps[sourceIndex].lineOffsetTables
+			}
+
+			result := css_printer.Print(ast, css_printer.Options{
+				RemoveWhitespace:  c.options.RemoveWhitespace,
+				ASCIIOnly:         c.options.ASCIIOnly,
+				AddSourceMappings: addSourceMappings,
+				KeyframeNames:     c.options.KeyframeNames,
+				LineOffsetTables:  lineOffsetTables,
 			})
+			compileResult.printedCSS = result.CSS
+			compileResult.sourceMapChunk = result.SourceMapChunk
 			compileResult.sourceIndex = sourceIndex
 			waitGroup.Done()
 		}(sourceIndex, compileResult)
@@ -4234,6 +5024,7 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 	return func(continueData generateContinue) []OutputFile {
 		waitGroup.Wait()
 		j := js_printer.Joiner{}
+		prevOffset := lineColumnOffset{}
 		newlineBeforeComment := false
 
 		// Generate any prefix rules now
@@ -4243,16 +5034,34 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 			// "@charset" is the only thing that comes before "@import"
 			for _, compileResult := range compileResults {
 				if compileResult.hasCharset {
-					ast.Rules = append(ast.Rules, &css_ast.RAtCharset{Encoding: "UTF-8"})
+					ast.Rules = append(ast.Rules, css_ast.Rule{Data: &css_ast.RAtCharset{Encoding: "UTF-8"}})
 					break
 				}
 			}
 
+			// The banner cannot come before "@charset", which must be the very
+			// first thing in the file, but comments can come before "@import"
+			if len(c.options.Banner.CSS) > 0 {
+				if len(ast.Rules) > 0 {
+					css := css_printer.Print(ast, css_printer.Options{
+						RemoveWhitespace: c.options.RemoveWhitespace,
+					}).CSS
+					prevOffset.advanceString(css)
+					j.AddString(css)
+					ast.Rules = nil
+				}
+				prevOffset.advanceString(c.options.Banner.CSS)
+				prevOffset.advanceString("\n")
+				j.AddString(c.options.Banner.CSS)
+				j.AddString("\n")
+				newlineBeforeComment = true
+			}
+
 			// Insert all external "@import" rules at the front. In CSS, all "@import"
 			// rules must come first or the browser will just ignore them.
 			for _, compileResult := range compileResults {
 				for _, record := range compileResult.externalImportRecords {
-					ast.Rules = append(ast.Rules, &css_ast.RAtImport{ImportRecordIndex: uint32(len(ast.ImportRecords))})
+					ast.Rules = append(ast.Rules, css_ast.Rule{Data: &css_ast.RAtImport{ImportRecordIndex: uint32(len(ast.ImportRecords))}})
 					ast.ImportRecords = append(ast.ImportRecords, record)
 				}
 			}
@@ -4260,8 +5069,9 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 			if len(ast.Rules) > 0 {
 				css := css_printer.Print(ast, css_printer.Options{
 					RemoveWhitespace: c.options.RemoveWhitespace,
-				})
+				}).CSS
 				if len(css) > 0 {
+					prevOffset.advanceString(css)
 					j.AddString(css)
 					newlineBeforeComment = true
 				}
@@ -4291,18 +5101,41 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 		isFirstMeta := true
 
 		// Concatenate the generated CSS chunks together
+		var compileResultsForSourceMap []sourceMapResult
 		for _, compileResult := range compileResults {
 			if c.options.Mode == config.ModeBundle && !c.options.RemoveWhitespace {
 				if newlineBeforeComment {
+					prevOffset.advanceString("\n")
 					j.AddString("\n")
 				}
-				j.AddString(fmt.Sprintf("/* %s */\n", c.files[compileResult.sourceIndex].source.PrettyPath))
+				text := fmt.Sprintf("/* %s */\n", c.files[compileResult.sourceIndex].source.PrettyPath)
+				prevOffset.advanceString(text)
+				j.AddString(text)
 			}
 			if len(compileResult.printedCSS) > 0 {
 				newlineBeforeComment = true
 			}
+
+			// Save the offset to the start of the stored CSS
+			generatedOffset := prevOffset
 			j.AddString(compileResult.printedCSS)
 
+			// Ignore empty source map chunks
+			if compileResult.sourceMapChunk.ShouldIgnore {
+				prevOffset.advanceString(compileResult.printedCSS)
+			} else {
+				prevOffset = lineColumnOffset{}
+
+				// Include this file in the source map
+				if c.options.SourceMap != config.SourceMapNone {
+					compileResultsForSourceMap = append(compileResultsForSourceMap, sourceMapResult{
+						sourceMapChunk:  compileResult.sourceMapChunk,
+						sourceIndex:     compileResult.sourceIndex,
+						generatedOffset: generatedOffset,
+					})
+				}
+			}
+
 			// Include this file in the metadata
 			if c.options.AbsMetadataFile != "" {
 				if isFirstMeta {
@@ -4321,13 +5154,25 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 			j.AddString("\n")
 		}
 
+		if len(c.options.Footer.CSS) > 0 {
+			j.AddString(c.options.Footer.CSS)
+			j.AddString("\n")
+		}
+
+		if c.options.SourceMap != config.SourceMapNone {
+			sourceMap := c.generateSourceMapForChunk(compileResultsForSourceMap, chunkAbsDir, dataForSourceMaps)
+			if result := c.appendSourceMapComment(&j, chunk, sourceMap, c.options.OutputExtensionCSS, "/*# ", " */\n"); result != nil {
+				results = append(results, *result)
+			}
+		}
+
 		// The CSS contents are done now that the source map comment is in
 		cssContents := j.Done()
 
 		// Figure out the base name for this chunk now that the content hash is known
 		if chunk.baseNameOrEmpty == "" {
-			hash := hashForFileName(cssContents)
-			chunk.baseNameOrEmpty = "chunk." + hash + c.options.OutputExtensionCSS
+			_, baseName := c.sharedChunkRelPath(hashForFileName(cssContents))
+			chunk.baseNameOrEmpty = baseName + c.options.OutputExtensionCSS
 		}
 
 		// End the metadata
@@ -4340,10 +5185,13 @@ func (repr *chunkReprCSS) generate(c *linkerContext, chunk *chunkInfo) func(gene
 			jsonMetadataChunk = jMeta.Done()
 		}
 
+		kind, entryPointSourceIndex := chunk.outputKind()
 		results = append(results, OutputFile{
-			AbsPath:           c.fs.Join(c.options.AbsOutputDir, chunk.relPath()),
-			Contents:          cssContents,
-			jsonMetadataChunk: jsonMetadataChunk,
+			AbsPath:               c.fs.Join(c.options.AbsOutputDir, chunk.relPath()),
+			Contents:              cssContents,
+			Kind:                  kind,
+			jsonMetadataChunk:     jsonMetadataChunk,
+			entryPointSourceIndex: entryPointSourceIndex,
 		})
 		return results
 	}
@@ -4462,8 +5310,141 @@ func (c *linkerContext) preventExportsFromBeingRenamed(sourceIndex uint32) {
 	}
 }
 
+// The comment linking to the source map is appended to the end of the chunk
+// and the comment syntax depends on the language of the chunk. If the source
+// map is written to a separate file, that file is returned as well.
+func (c *linkerContext) appendSourceMapComment(
+	j *js_printer.Joiner,
+	chunk *chunkInfo,
+	sourceMap []byte,
+	outputExtension string,
+	commentStart string,
+	commentEnd string,
+) *OutputFile {
+	var writeDataURL bool
+	var writeFile bool
+	switch c.options.SourceMap {
+	case config.SourceMapInline:
+		writeDataURL = true
+	case config.SourceMapLinkedWithComment, config.SourceMapExternalWithoutComment:
+		writeFile = true
+	case config.SourceMapInlineAndExternal:
+		writeDataURL = true
+		writeFile = true
+	}
+
+	// Write the generated source map as an inline comment
+	if writeDataURL {
+		j.AddString(commentStart + "sourceMappingURL=data:application/json;base64,")
+		j.AddString(base64.StdEncoding.EncodeToString(sourceMap))
+		j.AddString(commentEnd)
+	}
+
+	// Write the generated source map as an external file
+	if !writeFile {
+		return nil
+	}
+
+	// Optionally add metadata about the file
+	var jsonMetadataChunk []byte
+	if c.options.AbsMetadataFile != "" {
+		jsonMetadataChunk = []byte(fmt.Sprintf(
+			"{\n      \"imports\": [],\n      \"exports\": [],\n      \"inputs\": {},\n      \"bytes\": %d\n    }", len(sourceMap)))
+	}
+
+	// Figure out the base name for the source map which may include the content hash
+	var sourceMapBaseName string
+	if chunk.baseNameOrEmpty == "" {
+		hash := hashForFileName(sourceMap)
+		sourceMapBaseName = "chunk." + hash + outputExtension + ".map"
+	} else {
+		sourceMapBaseName = chunk.baseNameOrEmpty + ".map"
+	}
+
+	// Add a comment linking the source to its map
+	if c.options.SourceMap == config.SourceMapLinkedWithComment {
+		j.AddString(commentStart + "sourceMappingURL=")
+		j.AddString(sourceMapBaseName)
+		j.AddString(commentEnd)
+	}
+
+	_, entryPointSourceIndex := chunk.outputKind()
+	return &OutputFile{
+		AbsPath:               c.fs.Join(c.options.AbsOutputDir, chunk.relDir, sourceMapBaseName),
+		Contents:              sourceMap,
+		Kind:                  OutputKindSourceMap,
+		jsonMetadataChunk:     jsonMetadataChunk,
+		entryPointSourceIndex: entryPointSourceIndex,
+	}
+}
+
+func (c *linkerContext) shouldExtractLegalComments() bool {
+	switch c.options.LegalComments {
+	case config.LegalCommentsDefault:
+		return c.options.Mode == config.ModeBundle && c.options.RemoveWhitespace && c.options.Comments == config.CommentsDefault
+	case config.LegalCommentsEndOfFile, config.LegalCommentsLinkedWithComment, config.LegalCommentsExternalWithoutComment:
+		return true
+	}
+	return false
+}
+
+func (c *linkerContext) appendLegalCommentsFile(
+	j *js_printer.Joiner,
+	chunk *chunkInfo,
+	commentList []string,
+	outputExtension string,
+) OutputFile {
+	legal := js_printer.Joiner{}
+	for _, text := range commentList {
+		legal.AddString(text)
+		legal.AddString("\n")
+	}
+	contents := legal.Done()
+
+	// Optionally add metadata about the file
+	var jsonMetadataChunk []byte
+	if c.options.AbsMetadataFile != "" {
+		jsonMetadataChunk = []byte(fmt.Sprintf(
+			"{\n      \"imports\": [],\n      \"exports\": [],\n      \"inputs\": {},\n      \"bytes\": %d\n    }", len(contents)))
+	}
+
+	// Figure out the base name for the file which may include the content hash
+	var legalBaseName string
+	if chunk.baseNameOrEmpty == "" {
+		hash := hashForFileName(contents)
+		legalBaseName = "chunk." + hash + outputExtension + ".LEGAL.txt"
+	} else {
+		legalBaseName = chunk.baseNameOrEmpty + ".LEGAL.txt"
+	}
+
+	// Add a comment linking the output file to its legal comments
+	if c.options.LegalComments == config.LegalCommentsLinkedWithComment {
+		j.AddString("/*! For license information please see " + legalBaseName + " */\n")
+	}
+
+	_, entryPointSourceIndex := chunk.outputKind()
+	return OutputFile{
+		AbsPath:               c.fs.Join(c.options.AbsOutputDir, chunk.relDir, legalBaseName),
+		Contents:              contents,
+		Kind:                  OutputKindLegalComments,
+		jsonMetadataChunk:     jsonMetadataChunk,
+		entryPointSourceIndex: entryPointSourceIndex,
+	}
+}
+
+// This is the part of a compiled JavaScript or CSS file that is needed to
+// join its source map chunk with the others in the same output chunk
+type sourceMapResult struct {
+	sourceMapChunk js_printer.SourceMapChunk
+	sourceIndex    uint32
+
+	// This is the line and column offset since the end of the previous source
+	// map chunk or the start of the file if this is the first source map chunk.
+	generatedOffset lineColumnOffset
+}
+
 func (c *linkerContext) generateSourceMapForChunk(
-	results []compileResultJS,
+	results []sourceMapResult,
 	chunkAbsDir string,
 	dataForSourceMaps []dataForSourceMap,
 ) []byte {
@@ -4566,8 +5547,9 @@ func (c *linkerContext) generateSourceMapForChunk(
 	j.AddString(",\n  \"mappings\": \"")
 	prevEndState := js_printer.SourceMapState{}
 	prevColumnOffset := 0
+	var names []string
 	for _, result := range results {
-		chunk := result.SourceMapChunk
+		chunk := result.sourceMapChunk
 		offset := result.generatedOffset
 		sourcesIndex := sourceIndexToSourcesIndex[result.sourceIndex]
 
@@ -4582,22 +5564,30 @@ func (c *linkerContext) generateSourceMapForChunk(
 		// generate as if their source index is 0. We then adjust the source
 		// index per entry point by modifying the first source mapping. This
 		// is done by AppendSourceMapChunk() using the source index passed
-		// here.
+		// here. The names of each file are adjusted the same way.
 		startState := js_printer.SourceMapState{
 			SourceIndex:     sourcesIndex,
 			GeneratedLine:   offset.lines,
 			GeneratedColumn: offset.columns,
+			OriginalName:    len(names),
 		}
 		if offset.lines == 0 {
 			startState.GeneratedColumn += prevColumnOffset
 		}
 
 		// Append the precomputed source map chunk
-		js_printer.AppendSourceMapChunk(&j, prevEndState, startState, chunk.Buffer)
+		js_printer.AppendSourceMapChunk(&j, prevEndState, startState, chunk)
 
 		// Generate the relative offset to start from next time
+		prevOriginalName := prevEndState.OriginalName
 		prevEndState = chunk.EndState
 		prevEndState.SourceIndex += sourcesIndex
+		if chunk.FirstNameOffset != 0 {
+			prevEndState.OriginalName += len(names)
+			names = append(names, chunk.Names...)
+		} else {
+			prevEndState.OriginalName = prevOriginalName
+		}
 		prevColumnOffset = chunk.FinalGeneratedColumn
 
 		// If this was all one line, include the column offset from the start
@@ -4608,7 +5598,17 @@ func (c *linkerContext) generateSourceMapForChunk(
 	}
 	j.AddString("\"")
 
+	// Write the names
+	j.AddString(",\n  \"names\": [")
+	for i, name := range names {
+		if i != 0 {
+			j.AddString(", ")
+		}
+		j.AddBytes(js_printer.QuoteForJSON(name, c.options.ASCIIOnly))
+	}
+	j.AddString("]")
+
 	// Finish the source map
-	j.AddString(",\n  \"names\": []\n}\n")
+	j.AddString("\n}\n")
 	return j.Done()
 }
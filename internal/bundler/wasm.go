@@ -0,0 +1,270 @@
+package bundler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/evanw/esbuild/internal/compat"
+	"github.com/evanw/esbuild/internal/config"
+	"github.com/evanw/esbuild/internal/js_lexer"
+	"github.com/evanw/esbuild/internal/js_printer"
+)
+
+// This implements the WebAssembly/ESM integration proposal, which is
+// described here: https://github.com/WebAssembly/esm-integration. The exports
+// of the WebAssembly module become the exports of the JavaScript module and
+// its imports become JavaScript imports that the bundler resolves like any
+// other import. The module is compiled and instantiated when the JavaScript
+// module is evaluated, asynchronously using top-level await if possible.
+
+type wasmImport struct {
+	module string
+	name   string
+}
+
+type wasmModule struct {
+	imports []wasmImport
+	exports []string
+}
+
+const (
+	wasmSectionImport = 2
+	wasmSectionExport = 7
+)
+
+var errWasmTruncated = errors.New("Unexpected end of file")
+
+type wasmReader struct {
+	contents string
+	offset   int
+}
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.offset >= len(r.contents) {
+		return 0, errWasmTruncated
+	}
+	c := r.contents[r.offset]
+	r.offset++
+	return c, nil
+}
+
+func (r *wasmReader) u32() (uint32, error) {
+	var value uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		c, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(c&0x7F) << shift
+		if c&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("Invalid integer encoding")
+}
+
+func (r *wasmReader) bytes(n uint32) (string, error) {
+	if uint64(r.offset)+uint64(n) > uint64(len(r.contents)) {
+		return "", errWasmTruncated
+	}
+	text := r.contents[r.offset : r.offset+int(n)]
+	r.offset += int(n)
+	return text, nil
+}
+
+func (r *wasmReader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	return r.bytes(n)
+}
+
+func (r *wasmReader) limits() error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if _, err := r.u32(); err != nil {
+		return err
+	}
+	if flags&1 != 0 {
+		_, err = r.u32()
+	}
+	return err
+}
+
+func parseWasmModule(contents string) (wasmModule, error) {
+	module := wasmModule{}
+	r := wasmReader{contents: contents}
+
+	if header, err := r.bytes(8); err != nil || header[:4] != "\x00asm" {
+		return module, errors.New("Missing the WebAssembly magic number")
+	} else if header[4:] != "\x01\x00\x00\x00" {
+		return module, errors.New("Unsupported WebAssembly version")
+	}
+
+	for r.offset < len(r.contents) {
+		id, err := r.byte()
+		if err != nil {
+			return module, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return module, err
+		}
+		body, err := r.bytes(size)
+		if err != nil {
+			return module, err
+		}
+
+		switch id {
+		case wasmSectionImport:
+			if module.imports, err = parseWasmImports(body); err != nil {
+				return module, err
+			}
+
+		case wasmSectionExport:
+			if module.exports, err = parseWasmExports(body); err != nil {
+				return module, err
+			}
+		}
+	}
+
+	return module, nil
+}
+
+func parseWasmImports(body string) ([]wasmImport, error) {
+	r := wasmReader{contents: body}
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	imports := make([]wasmImport, 0, count)
+	for i := uint32(0); i < count; i++ {
+		module, err := r.name()
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.name()
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip over the description of the import, which depends on its kind
+		kind, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 0: // Function
+			_, err = r.u32()
+		case 1: // Table
+			if _, err = r.byte(); err == nil {
+				err = r.limits()
+			}
+		case 2: // Memory
+			err = r.limits()
+		case 3: // Global
+			_, err = r.bytes(2)
+		default:
+			err = fmt.Errorf("Invalid import kind: %d", kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		imports = append(imports, wasmImport{module: module, name: name})
+	}
+	return imports, nil
+}
+
+func parseWasmExports(body string) ([]string, error) {
+	r := wasmReader{contents: body}
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := r.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.bytes(1); err != nil {
+			return nil, err
+		}
+		if _, err := r.u32(); err != nil {
+			return nil, err
+		}
+		exports = append(exports, name)
+	}
+	return exports, nil
+}
+
+func quoteForJS(text string) string {
+	return string(js_printer.QuoteForJSON(text, false))
+}
+
+func propertyAccessForJS(target string, name string) string {
+	if js_lexer.IsIdentifier(name) {
+		return target + "." + name
+	}
+	return target + "[" + quoteForJS(name) + "]"
+}
+
+// Top-level await can only be used when all code ends up in "esm" output
+// files, and if the target supports it. Otherwise the synchronous API is used,
+// which browsers only allow for small modules on the main thread.
+func wasmUsesTopLevelAwait(options *config.Options) bool {
+	return options.Mode == config.ModeBundle && options.OutputFormat == config.FormatESModule &&
+		len(options.OutputFormats) == 0 && len(options.EntryPointFormats) == 0 &&
+		!options.UnsupportedJSFeatures.Has(compat.TopLevelAwait)
+}
+
+// Generates the JavaScript code for a WebAssembly module. Exports whose names
+// aren't identifiers are not exported since they can't be imported by name.
+func wasmModuleToJS(module wasmModule, contents string, async bool) string {
+	sb := strings.Builder{}
+
+	// Import each module once using a namespace import
+	var modules []string
+	itemsForModule := make(map[string][]string)
+	for _, item := range module.imports {
+		if _, ok := itemsForModule[item.module]; !ok {
+			modules = append(modules, item.module)
+		}
+		itemsForModule[item.module] = append(itemsForModule[item.module], item.name)
+	}
+	for i, name := range modules {
+		sb.WriteString(fmt.Sprintf("import * as __wasm_import_%d from %s;\n", i, quoteForJS(name)))
+	}
+
+	sb.WriteString(fmt.Sprintf("var __wasm_bytes = %s;\n", quoteForJS(base64.StdEncoding.EncodeToString([]byte(contents)))))
+	bytes := "typeof Buffer !== \"undefined\" ? Buffer.from(__wasm_bytes, \"base64\") : Uint8Array.from(atob(__wasm_bytes), (c) => c.charCodeAt(0))"
+	if async {
+		sb.WriteString("var { instance: __wasm_instance } = await WebAssembly.instantiate(" + bytes + ", {\n")
+	} else {
+		sb.WriteString("var __wasm_instance = new WebAssembly.Instance(new WebAssembly.Module(" + bytes + "), {\n")
+	}
+	for i, name := range modules {
+		sb.WriteString(fmt.Sprintf("  %s: {\n", quoteForJS(name)))
+		for _, item := range itemsForModule[name] {
+			namespace := fmt.Sprintf("__wasm_import_%d", i)
+			sb.WriteString(fmt.Sprintf("    %s: %s,\n", quoteForJS(item), propertyAccessForJS(namespace, item)))
+		}
+		sb.WriteString("  },\n")
+	}
+	sb.WriteString("});\n")
+
+	for i, name := range module.exports {
+		if js_lexer.IsIdentifier(name) {
+			sb.WriteString(fmt.Sprintf("var __wasm_export_%d = %s;\n", i, propertyAccessForJS("__wasm_instance.exports", name)))
+			sb.WriteString(fmt.Sprintf("export { __wasm_export_%d as %s };\n", i, name))
+		}
+	}
+
+	return sb.String()
+}
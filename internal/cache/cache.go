@@ -2,6 +2,7 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/evanw/esbuild/internal/logger"
 	"github.com/evanw/esbuild/internal/runtime"
@@ -60,6 +61,15 @@ func MakeCacheSet() *CacheSet {
 	}
 }
 
+// This returns how many times a file has been parsed because it was not found
+// in the cache. Subtracting two of these values counts the files parsed again
+// by an incremental build.
+func (c *CacheSet) ParseCount() uint32 {
+	return atomic.LoadUint32(&c.JSCache.parseCount) +
+		atomic.LoadUint32(&c.CSSCache.parseCount) +
+		atomic.LoadUint32(&c.JSONCache.parseCount)
+}
+
 type SourceIndexCache struct {
 	mutex           sync.Mutex
 	entries         map[sourceIndexKey]uint32
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/evanw/esbuild/internal/css_ast"
 	"github.com/evanw/esbuild/internal/css_parser"
@@ -27,8 +28,9 @@ import (
 // CSS
 
 type CSSCache struct {
-	mutex   sync.Mutex
-	entries map[logger.Path]*cssCacheEntry
+	mutex      sync.Mutex
+	entries    map[logger.Path]*cssCacheEntry
+	parseCount uint32
 }
 
 type cssCacheEntry struct {
@@ -55,6 +57,7 @@ func (c *CSSCache) Parse(log logger.Log, source logger.Source, options css_parse
 	}
 
 	// Cache miss
+	atomic.AddUint32(&c.parseCount, 1)
 	tempLog := logger.NewDeferLog()
 	ast := css_parser.Parse(tempLog, source, options)
 	msgs := tempLog.Done()
@@ -81,8 +84,9 @@ func (c *CSSCache) Parse(log logger.Log, source logger.Source, options css_parse
 // JSON
 
 type JSONCache struct {
-	mutex   sync.Mutex
-	entries map[logger.Path]*jsonCacheEntry
+	mutex      sync.Mutex
+	entries    map[logger.Path]*jsonCacheEntry
+	parseCount uint32
 }
 
 type jsonCacheEntry struct {
@@ -110,6 +114,7 @@ func (c *JSONCache) Parse(log logger.Log, source logger.Source, options js_parse
 	}
 
 	// Cache miss
+	atomic.AddUint32(&c.parseCount, 1)
 	tempLog := logger.NewDeferLog()
 	expr, ok := js_parser.ParseJSON(tempLog, source, options)
 	msgs := tempLog.Done()
@@ -137,8 +142,9 @@ func (c *JSONCache) Parse(log logger.Log, source logger.Source, options js_parse
 // JS
 
 type JSCache struct {
-	mutex   sync.Mutex
-	entries map[logger.Path]*jsCacheEntry
+	mutex      sync.Mutex
+	entries    map[logger.Path]*jsCacheEntry
+	parseCount uint32
 }
 
 type jsCacheEntry struct {
@@ -166,6 +172,7 @@ func (c *JSCache) Parse(log logger.Log, source logger.Source, options js_parser.
 	}
 
 	// Cache miss
+	atomic.AddUint32(&c.parseCount, 1)
 	tempLog := logger.NewDeferLog()
 	ast, ok := js_parser.Parse(tempLog, source, options)
 	msgs := tempLog.Done()
@@ -23,6 +23,8 @@ func ParseLoader(text string) (api.Loader, error) {
 		return api.LoaderCSS, nil
 	case "json":
 		return api.LoaderJSON, nil
+	case "json5":
+		return api.LoaderJSON5, nil
 	case "text":
 		return api.LoaderText, nil
 	case "base64":
@@ -31,12 +33,14 @@ func ParseLoader(text string) (api.Loader, error) {
 		return api.LoaderDataURL, nil
 	case "file":
 		return api.LoaderFile, nil
+	case "asset":
+		return api.LoaderAsset, nil
 	case "binary":
 		return api.LoaderBinary, nil
 	case "default":
 		return api.LoaderDefault, nil
 	default:
 		return api.LoaderNone, fmt.Errorf("Invalid loader: %q (valid: "+
-			"js, jsx, ts, tsx, css, json, text, base64, dataurl, file, binary)", text)
+			"js, jsx, ts, tsx, css, json, json5, text, base64, dataurl, file, asset, binary)", text)
 	}
 }
@@ -19,6 +19,12 @@ func (features CSSFeature) Has(feature CSSFeature) bool {
 	return (features & feature) != 0
 }
 
+var StringToCSSFeature = map[string]CSSFeature{
+	"hex-rgba":       HexRGBA,
+	"rebecca-purple": RebeccaPurple,
+	"modern-rgb-hsl": Modern_RGB_HSL,
+}
+
 var cssTable = map[CSSFeature]map[Engine][]int{
 	// Data from: https://developer.mozilla.org/en-US/docs/Web/CSS/color_value
 	HexRGBA: {
@@ -26,21 +32,27 @@ var cssTable = map[CSSFeature]map[Engine][]int{
 		Edge:    {79},
 		Firefox: {49},
 		IOS:     {9, 3},
+		Opera:   {49},
 		Safari:  {9, 1},
+		Samsung: {8, 2},
 	},
 	RebeccaPurple: {
 		Chrome:  {38},
 		Edge:    {12},
 		Firefox: {33},
 		IOS:     {8},
+		Opera:   {25},
 		Safari:  {9},
+		Samsung: {3},
 	},
 	Modern_RGB_HSL: {
 		Chrome:  {66},
 		Edge:    {79},
 		Firefox: {52},
 		IOS:     {12, 2},
+		Opera:   {53},
 		Safari:  {12, 1},
+		Samsung: {9, 2},
 	},
 }
 
@@ -6,12 +6,16 @@ type Engine uint8
 
 const (
 	Chrome Engine = iota
+	Deno
 	Edge
 	ES
 	Firefox
+	Hermes
 	IOS
 	Node
+	Opera
 	Safari
+	Samsung
 )
 
 type JSFeature uint64
@@ -61,311 +65,483 @@ func (features JSFeature) Has(feature JSFeature) bool {
 	return (features & feature) != 0
 }
 
+var StringToJSFeature = map[string]JSFeature{
+	"array-spread":                  ArraySpread,
+	"arrow":                         Arrow,
+	"async-await":                   AsyncAwait,
+	"async-generator":               AsyncGenerator,
+	"big-int":                       BigInt,
+	"class":                         Class,
+	"class-field":                   ClassField,
+	"class-private-accessor":        ClassPrivateAccessor,
+	"class-private-field":           ClassPrivateField,
+	"class-private-method":          ClassPrivateMethod,
+	"class-private-static-accessor": ClassPrivateStaticAccessor,
+	"class-private-static-field":    ClassPrivateStaticField,
+	"class-private-static-method":   ClassPrivateStaticMethod,
+	"class-static-field":            ClassStaticField,
+	"const":                         Const,
+	"default-argument":              DefaultArgument,
+	"destructuring":                 Destructuring,
+	"exponent-operator":             ExponentOperator,
+	"export-star-as":                ExportStarAs,
+	"for-await":                     ForAwait,
+	"for-of":                        ForOf,
+	"generator":                     Generator,
+	"hashbang":                      Hashbang,
+	"import-meta":                   ImportMeta,
+	"let":                           Let,
+	"logical-assignment":            LogicalAssignment,
+	"nested-rest-binding":           NestedRestBinding,
+	"new-target":                    NewTarget,
+	"nullish-coalescing":            NullishCoalescing,
+	"object-accessors":              ObjectAccessors,
+	"object-extensions":             ObjectExtensions,
+	"object-rest-spread":            ObjectRestSpread,
+	"optional-catch-binding":        OptionalCatchBinding,
+	"optional-chain":                OptionalChain,
+	"rest-argument":                 RestArgument,
+	"template-literal":              TemplateLiteral,
+	"top-level-await":               TopLevelAwait,
+	"unicode-escapes":               UnicodeEscapes,
+}
+
 var jsTable = map[JSFeature]map[Engine][]int{
 	ArraySpread: {
 		Chrome:  {46},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {27},
+		Hermes:  {0, 7},
 		IOS:     {8},
 		Node:    {5},
+		Opera:   {33},
 		Safari:  {7, 1},
+		Samsung: {5},
 	},
 	Arrow: {
 		Chrome:  {45},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {22},
+		Hermes:  {0, 7},
 		IOS:     {10},
 		Node:    {4},
+		Opera:   {32},
 		Safari:  {10},
+		Samsung: {5},
 	},
 	AsyncAwait: {
 		Chrome:  {55},
+		Deno:    {1, 0},
 		Edge:    {15},
 		ES:      {2017},
 		Firefox: {52},
 		IOS:     {10, 3},
 		Node:    {7, 6},
+		Opera:   {42},
 		Safari:  {10, 1},
+		Samsung: {6, 2},
 	},
 	AsyncGenerator: {
 		Chrome:  {63},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2018},
 		Firefox: {57},
 		IOS:     {12},
 		Node:    {10, 0},
+		Opera:   {50},
 		Safari:  {12},
+		Samsung: {8, 2},
 	},
 	BigInt: {
 		Chrome:  {67},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2020},
 		Firefox: {68},
 		IOS:     {14},
 		Node:    {10, 4},
+		Opera:   {54},
 		Safari:  {14},
+		Samsung: {9, 2},
 	},
 	Class: {
 		Chrome:  {49},
+		Deno:    {1, 0},
 		Edge:    {13},
 		ES:      {2015},
 		Firefox: {45},
 		IOS:     {9},
 		Node:    {6},
+		Opera:   {36},
 		Safari:  {9},
+		Samsung: {5},
 	},
 	ClassField: {
 		Chrome:  {72},
+		Deno:    {1, 0},
 		Edge:    {79},
 		Firefox: {69},
 		IOS:     {14},
 		Node:    {12, 0},
+		Opera:   {59},
 		Safari:  {14},
+		Samsung: {11, 1},
 	},
 	ClassPrivateAccessor: {
-		Chrome: {84},
-		Edge:   {84},
-		Node:   {14, 6},
+		Chrome:  {84},
+		Deno:    {1, 0},
+		Edge:    {84},
+		Node:    {14, 6},
+		Opera:   {71},
+		Samsung: {14},
 	},
 	ClassPrivateField: {
-		Chrome: {74},
-		Edge:   {79},
-		Node:   {12, 0},
-		Safari: {14, 1},
+		Chrome:  {74},
+		Deno:    {1, 0},
+		Edge:    {79},
+		Node:    {12, 0},
+		Opera:   {61},
+		Safari:  {14, 1},
+		Samsung: {11, 1},
 	},
 	ClassPrivateMethod: {
-		Chrome: {84},
-		Edge:   {84},
-		Node:   {14, 6},
+		Chrome:  {84},
+		Deno:    {1, 0},
+		Edge:    {84},
+		Node:    {14, 6},
+		Opera:   {71},
+		Samsung: {14},
 	},
 	ClassPrivateStaticAccessor: {
-		Chrome: {84},
-		Edge:   {84},
-		Node:   {14, 6},
+		Chrome:  {84},
+		Deno:    {1, 0},
+		Edge:    {84},
+		Node:    {14, 6},
+		Opera:   {71},
+		Samsung: {14},
 	},
 	ClassPrivateStaticField: {
-		Chrome: {74},
-		Edge:   {79},
-		Node:   {12, 0},
-		Safari: {14, 1},
+		Chrome:  {74},
+		Deno:    {1, 0},
+		Edge:    {79},
+		Node:    {12, 0},
+		Opera:   {61},
+		Safari:  {14, 1},
+		Samsung: {11, 1},
 	},
 	ClassPrivateStaticMethod: {
-		Chrome: {84},
-		Edge:   {84},
-		Node:   {14, 6},
+		Chrome:  {84},
+		Deno:    {1, 0},
+		Edge:    {84},
+		Node:    {14, 6},
+		Opera:   {71},
+		Samsung: {14},
 	},
 	ClassStaticField: {
 		Chrome:  {72},
+		Deno:    {1, 0},
 		Edge:    {79},
 		Firefox: {75},
 		Node:    {12, 0},
+		Opera:   {59},
 		Safari:  {14, 1},
+		Samsung: {11, 1},
 	},
 	Const: {
 		Chrome:  {5},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {3},
+		Hermes:  {0, 7},
 		IOS:     {6},
 		Node:    {0, 12},
+		Opera:   {15},
 		Safari:  {3, 1},
+		Samsung: {1},
 	},
 	DefaultArgument: {
 		Chrome:  {49},
+		Deno:    {1, 0},
 		Edge:    {14},
 		ES:      {2015},
 		Firefox: {15},
+		Hermes:  {0, 7},
 		IOS:     {10},
 		Node:    {6},
+		Opera:   {36},
 		Safari:  {10},
+		Samsung: {5},
 	},
 	Destructuring: {
 		Chrome:  {49},
+		Deno:    {1, 0},
 		Edge:    {14},
 		ES:      {2015},
 		Firefox: {2},
+		Hermes:  {0, 7},
 		IOS:     {8},
 		Node:    {6},
+		Opera:   {36},
 		Safari:  {7, 1},
+		Samsung: {5},
 	},
 	ExponentOperator: {
 		Chrome:  {52},
+		Deno:    {1, 0},
 		Edge:    {14},
 		ES:      {2016},
 		Firefox: {52},
+		Hermes:  {0, 7},
 		IOS:     {10, 3},
 		Node:    {7},
+		Opera:   {39},
 		Safari:  {10, 1},
+		Samsung: {6, 2},
 	},
 	ExportStarAs: {
 		Chrome:  {72},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2020},
 		Firefox: {80},
 		Node:    {12},
+		Opera:   {59},
+		Samsung: {11, 1},
 	},
 	ForAwait: {
 		Chrome:  {63},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2018},
 		Firefox: {57},
 		IOS:     {12},
 		Node:    {10, 0},
+		Opera:   {50},
 		Safari:  {12},
+		Samsung: {8, 2},
 	},
 	ForOf: {
 		Chrome:  {38},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {13},
+		Hermes:  {0, 7},
 		IOS:     {8},
 		Node:    {0, 12},
+		Opera:   {25},
 		Safari:  {7, 1},
+		Samsung: {3},
 	},
 	Generator: {
 		Chrome:  {39},
+		Deno:    {1, 0},
 		Edge:    {13},
 		ES:      {2015},
 		Firefox: {27},
+		Hermes:  {0, 7},
 		IOS:     {10},
 		Node:    {4},
+		Opera:   {26},
 		Safari:  {10},
+		Samsung: {4},
 	},
 	Hashbang: {
 		Chrome:  {74},
+		Deno:    {1, 0},
 		Edge:    {79},
 		Firefox: {67},
 		IOS:     {13, 4},
 		Node:    {12, 0},
+		Opera:   {61},
 		Safari:  {13, 1},
+		Samsung: {11, 1},
 	},
 	ImportMeta: {
 		Chrome:  {64},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2020},
 		Firefox: {62},
 		IOS:     {12},
 		Node:    {10, 4},
+		Opera:   {51},
 		Safari:  {11, 1},
+		Samsung: {9, 2},
 	},
 	Let: {
 		Chrome:  {49},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {44},
+		Hermes:  {0, 7},
 		IOS:     {10},
 		Node:    {6},
+		Opera:   {36},
 		Safari:  {10},
+		Samsung: {5},
 	},
 	LogicalAssignment: {
 		Chrome:  {85},
+		Deno:    {1, 2},
 		Edge:    {85},
 		Firefox: {79},
 		IOS:     {14},
 		Node:    {15, 0},
+		Opera:   {72},
 		Safari:  {14},
+		Samsung: {14},
 	},
 	NestedRestBinding: {
 		Chrome:  {49},
+		Deno:    {1, 0},
 		Edge:    {14},
 		ES:      {2016},
 		Firefox: {47},
+		Hermes:  {0, 7},
 		IOS:     {10, 3},
 		Node:    {6},
+		Opera:   {36},
 		Safari:  {10, 1},
+		Samsung: {5},
 	},
 	NewTarget: {
 		Chrome:  {46},
+		Deno:    {1, 0},
 		Edge:    {13},
 		ES:      {2015},
 		Firefox: {41},
+		Hermes:  {0, 7},
 		IOS:     {10},
 		Node:    {5},
+		Opera:   {33},
 		Safari:  {10},
+		Samsung: {5},
 	},
 	NullishCoalescing: {
 		Chrome:  {80},
+		Deno:    {1, 0},
 		Edge:    {80},
 		ES:      {2020},
 		Firefox: {72},
+		Hermes:  {0, 7},
 		IOS:     {13, 4},
 		Node:    {14, 0},
+		Opera:   {67},
 		Safari:  {13, 1},
+		Samsung: {13},
 	},
 	ObjectAccessors: {
 		Chrome:  {5},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {5},
 		Firefox: {2},
+		Hermes:  {0, 7},
 		IOS:     {6},
 		Node:    {0, 10},
+		Opera:   {15},
 		Safari:  {3, 1},
+		Samsung: {1},
 	},
 	ObjectExtensions: {
 		Chrome:  {44},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {34},
+		Hermes:  {0, 7},
 		IOS:     {8},
 		Node:    {4},
+		Opera:   {31},
 		Safari:  {7, 1},
+		Samsung: {4},
 	},
 	ObjectRestSpread: {
 		Chrome:  {60},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2018},
 		Firefox: {55},
+		Hermes:  {0, 7},
 		IOS:     {11, 3},
 		Node:    {8, 3},
+		Opera:   {47},
 		Safari:  {11, 1},
+		Samsung: {8, 2},
 	},
 	OptionalCatchBinding: {
 		Chrome:  {66},
+		Deno:    {1, 0},
 		Edge:    {79},
 		ES:      {2019},
 		Firefox: {58},
+		Hermes:  {0, 7},
 		IOS:     {11, 3},
 		Node:    {10, 0},
+		Opera:   {53},
 		Safari:  {11, 1},
+		Samsung: {9, 2},
 	},
 	OptionalChain: {
 		Chrome:  {80},
+		Deno:    {1, 0},
 		Edge:    {80},
 		ES:      {2020},
 		Firefox: {74},
+		Hermes:  {0, 7},
 		IOS:     {13, 4},
 		Node:    {14, 0},
+		Opera:   {67},
 		Safari:  {13, 1},
+		Samsung: {13},
 	},
 	RestArgument: {
 		Chrome:  {47},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {15},
+		Hermes:  {0, 7},
 		IOS:     {10},
 		Node:    {6},
+		Opera:   {34},
 		Safari:  {10},
+		Samsung: {5},
 	},
 	TemplateLiteral: {
 		Chrome:  {41},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {34},
+		Hermes:  {0, 7},
 		IOS:     {9},
 		Node:    {4},
+		Opera:   {28},
 		Safari:  {9},
+		Samsung: {4},
 	},
 	TopLevelAwait: {},
 	UnicodeEscapes: {
 		Chrome:  {44},
+		Deno:    {1, 0},
 		Edge:    {12},
 		ES:      {2015},
 		Firefox: {40},
+		Hermes:  {0, 7},
 		IOS:     {9},
 		Node:    {4},
+		Opera:   {31},
 		Safari:  {9},
+		Samsung: {4},
 	},
 }
 
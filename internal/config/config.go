@@ -2,14 +2,15 @@ package config
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 	"sync"
 
 	"github.com/evanw/esbuild/internal/compat"
 	"github.com/evanw/esbuild/internal/fs"
-	"github.com/evanw/esbuild/internal/js_ast"
 	"github.com/evanw/esbuild/internal/logger"
+	"github.com/evanw/esbuild/internal/trace"
 )
 
 var localFS, _ = fs.RealFS(fs.RealFSOptions{})
@@ -18,6 +19,7 @@ type LanguageTarget int8
 
 type JSXOptions struct {
 	Parse    bool
+	Preserve bool // Print JSX elements instead of calling the factory
 	Factory  []string
 	Fragment []string
 }
@@ -64,12 +66,15 @@ const (
 	LoaderTS
 	LoaderTSX
 	LoaderJSON
+	LoaderJSON5
 	LoaderText
 	LoaderBase64
 	LoaderDataURL
 	LoaderFile
+	LoaderAsset // Either "dataurl" or "file" depending on "AssetInlineLimit"
 	LoaderBinary
 	LoaderCSS
+	LoaderWasmModule // Only used when "WasmModule" is enabled
 	LoaderDefault
 )
 
@@ -77,8 +82,16 @@ func (loader Loader) IsTypeScript() bool {
 	return loader == LoaderTS || loader == LoaderTSX
 }
 
+func (loader Loader) IsText() bool {
+	switch loader {
+	case LoaderJS, LoaderJSX, LoaderTS, LoaderTSX, LoaderJSON, LoaderJSON5, LoaderText, LoaderCSS:
+		return true
+	}
+	return false
+}
+
 func (loader Loader) CanHaveSourceMap() bool {
-	return loader == LoaderJS || loader == LoaderJSX || loader == LoaderTS || loader == LoaderTSX
+	return loader == LoaderJS || loader == LoaderJSX || loader == LoaderTS || loader == LoaderTSX || loader == LoaderCSS
 }
 
 type Format uint8
@@ -125,8 +138,40 @@ const (
 	// }(typeof self !== 'undefined' ? self : this, function() {
 	//   ... bundled code ...
 	// }));
+	//
+	// External dependencies are passed to the factory as parameters. Their
+	// browser globals are looked up using GlobalExternals:
+	//
+	// (function(root, factory) {
+	//   if (typeof define === 'function' && define.amd) {
+	//     define(['dep'], factory);
+	//   } else if (typeof module === 'object' && module.exports) {
+	//     module.exports = factory(require('dep'));
+	//   } else {
+	//     root.returnExports = factory(root.Dep);
+	//   }
+	// }(typeof self !== 'undefined' ? self : this, function(_dep) {
+	//   ... bundled code ...
+	// }));
 	FormatUMD
 
+	// The SystemJS format looks like this:
+	//
+	//   System.register(["dep"], function(_export, _context) {
+	//     var _deps = [];
+	//     return {
+	//       setters: [function(m) {
+	//         _deps[0] = m;
+	//       }],
+	//       execute: function() {
+	//         ... bundled code ...
+	//         _export({...});
+	//       }
+	//     };
+	//   });
+	//
+	FormatSystemJS
+
 	// The ES module format looks like this:
 	//
 	//   ... bundled code ...
@@ -158,12 +203,102 @@ func (f Format) String() string {
 		return "cjs"
 	case FormatUMD:
 		return "umd"
+	case FormatSystemJS:
+		return "system"
 	case FormatESModule:
 		return "esm"
 	}
 	return ""
 }
 
+type Comments uint8
+
+const (
+	// Legal comments are kept. They are moved to the end of the file when
+	// bundling and removing whitespace.
+	CommentsDefault Comments = iota
+
+	// Comments preceding statements are kept
+	CommentsAll
+
+	// No comments are kept, not even the legal ones
+	CommentsNone
+
+	// Legal comments are kept where they are even when removing whitespace
+	CommentsLegal
+)
+
+// This controls where legal comments end up, which are comments starting with
+// "/*!" or containing "@license" or "@preserve"
+type LegalComments uint8
+
+const (
+	// Legal comments are moved to the end of the file when bundling and
+	// removing whitespace, otherwise they are kept where they are
+	LegalCommentsDefault LegalComments = iota
+
+	// Legal comments are removed
+	LegalCommentsNone
+
+	// Legal comments are kept where they are
+	LegalCommentsInline
+
+	// Legal comments are moved to the end of the file
+	LegalCommentsEndOfFile
+
+	// Legal comments are moved to a ".LEGAL.txt" file next to the output file,
+	// which is pointed to by a comment at the end of the output file
+	LegalCommentsLinkedWithComment
+
+	// Legal comments are moved to a ".LEGAL.txt" file next to the output file
+	LegalCommentsExternalWithoutComment
+)
+
+// This controls which statements and calls are removed from the output
+type DropOptions struct {
+	// Remove all "debugger" statements
+	Debugger bool
+
+	// Remove calls to all methods of the global "console" object
+	Console bool
+
+	// Remove calls to only these methods of the global "console" object, which
+	// is ignored when "Console" is true
+	ConsoleMethods []string
+}
+
+func (drop *DropOptions) Equal(other *DropOptions) bool {
+	if drop.Debugger != other.Debugger || drop.Console != other.Console || len(drop.ConsoleMethods) != len(other.ConsoleMethods) {
+		return false
+	}
+	for i, method := range drop.ConsoleMethods {
+		if method != other.ConsoleMethods[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if calls to the method of the global "console" object with the
+// specified name should be removed
+func (drop *DropOptions) DropsConsoleMethod(name string) bool {
+	if drop.Console {
+		return true
+	}
+	for _, method := range drop.ConsoleMethods {
+		if method == name {
+			return true
+		}
+	}
+	return false
+}
+
+// This is text added to output files, which can differ for JavaScript and CSS
+type OutputText struct {
+	JS  string
+	CSS string
+}
+
 type StdinInfo struct {
 	Loader        Loader
 	Contents      string
@@ -202,6 +337,13 @@ type AMDPlugin struct {
 	LoadScript          *AMDLoadableScript
 }
 
+// A non-AMD script, which exports a global variable, is defined as a module
+// depending on the modules in "Deps" and exporting the global in "Exports"
+type AMDShim struct {
+	Deps    []string
+	Exports string
+}
+
 type AMDOptions struct {
 	BaseUrl   string
 	Paths     map[string]string
@@ -209,15 +351,43 @@ type AMDOptions struct {
 	StarMap   map[string]string
 	Namespace string
 	Plugins   map[string]*AMDPlugin
+	Shim      map[string]AMDShim
+
+	// The query string appended to the URLs of modules loaded at run-time, or
+	// the source code of a function computing it if UrlArgsIsFunction is set
+	UrlArgs           string
+	UrlArgsIsFunction bool
+
+	// The modules to load once the bundle has been evaluated and the callback
+	// to call with their exports, which is either a name of a module exporting
+	// the callback, or the source code of a function if CallbackIsFunction is
+	// set
+	Deps               []string
+	Callback           string
+	CallbackIsFunction bool
 
 	Parse               bool
 	MappedModuleNames   bool
 	KnownFileExtensions map[string]bool
 
-	backwardPaths          map[string]string
-	backwardPathsMutex     *sync.RWMutex
-	pluginExpressions      map[string]string
-	pluginExpressionsMutex *sync.RWMutex
+	// Everything above is written only while the AMD config is being parsed
+	// and is read-only afterward. The module names below are discovered while
+	// the modules are resolved and parsed in parallel, so they are kept apart
+	// and guarded by their own lock.
+	names *amdModuleNames
+}
+
+type amdModuleNames struct {
+	mutex             sync.RWMutex
+	backwardPaths     map[string]string
+	pluginExpressions map[string]string
+}
+
+func newAMDModuleNames() *amdModuleNames {
+	return &amdModuleNames{
+		backwardPaths:     make(map[string]string),
+		pluginExpressions: make(map[string]string),
+	}
 }
 
 type Options struct {
@@ -228,6 +398,7 @@ type Options struct {
 	MangleSyntax      bool
 	CodeSplitting     bool
 	WatchMode         bool
+	AllowOverwrite    bool
 
 	// Setting this to true disables warnings about code that is very likely to
 	// be a bug. This is used to ignore issues inside "node_modules" directories.
@@ -246,10 +417,17 @@ type Options struct {
 
 	OmitRuntimeForTests     bool
 	PreserveUnusedImportsTS bool
+	ReportTypeElision       bool // Logs the TypeScript imports removed as type-only
+	IsolatedModulesTS       bool
 	UseDefineForClassFields bool
 	ASCIIOnly               bool
 	KeepNames               bool
+	MangleKeyframes         bool // Renames "@keyframes" in CSS consistently within the bundle
+	Polyfills               bool // Prepends polyfills of the used runtime APIs missing in the target
 	IgnoreDCEAnnotations    bool
+	Comments                Comments
+	LegalComments           LegalComments
+	Drop                    DropOptions
 
 	Defines  *ProcessedDefines
 	AMD      AMDOptions
@@ -262,6 +440,7 @@ type Options struct {
 
 	ExtensionOrder  []string
 	MainFields      []string
+	Conditions      []string // Custom conditions for "exports" and "imports" in package.json
 	AbsNodePaths    []string // The "NODE_PATH" variable from Node.js
 	ExternalModules ExternalModules
 
@@ -270,23 +449,92 @@ type Options struct {
 	AbsOutputBase      string
 	OutputExtensionJS  string
 	OutputExtensionCSS string
+	AssetInlineLimit   int // Files smaller than this are inlined by the "asset" loader
 	GlobalName         []string
-	AMDConfig          string
+	GlobalExternals    map[string][]string // Browser globals of external modules in the UMD format
+	AMDConfigs         []string
 	TsConfigOverride   string
 	ExtensionToLoader  map[string]Loader
 	OutputFormat       Format
 	PublicPath         string
 	InjectAbsPaths     []string
-	InjectedDefines    []InjectedDefine
 	InjectedFiles      []InjectedFile
-	Banner             string
-	Footer             string
+	Banner             OutputText
+	Footer             OutputText
 
 	Plugins []Plugin
 
+	// Closing this channel stops the build as soon as possible
+	Cancel <-chan struct{}
+
+	// If present, spans of time spent in the build are recorded here
+	Tracer *trace.Tracer
+
+	// These name the shared chunks created by code splitting and the files
+	// copied by the "file" loader relative to the output directory. See
+	// "PathTemplate" for the placeholders. Empty templates use "[name].[hash]".
+	ChunkPathTemplate string
+	AssetPathTemplate string
+
+	// This names the entry points relative to the output directory like the
+	// templates above, but an empty template uses "[dir]/[name]" instead
+	EntryPathTemplate string
+
+	// This overrides "OutputFormat" for the entry points with these absolute
+	// paths. Code shared by entry points of different formats is not put into
+	// common chunks, because a chunk can only be written in one format.
+	EntryPointFormats map[string]Format
+
+	// If present, this overrides "OutputFormat" and the bundle is linked once
+	// for each of these formats. The JavaScript outputs of each format get a
+	// different extension, so they can be written to the same directory.
+	OutputFormats []Format
+
+	// If true, an empty "OutputExtensionJS" means ".mjs" for the ESM format and
+	// ".cjs" for the CommonJS format instead of ".js"
+	AutoExtension bool
+
+	// These add to "Banner" and "Footer" in the JavaScript outputs of the entry
+	// points with these absolute paths
+	EntryPointBanners map[string]string
+	EntryPointFooters map[string]string
+
+	// This is filled in by the bundler from "MangleKeyframes" and maps the
+	// names of "@keyframes" defined in the bundle to their short names
+	KeyframeNames map[string]string
+
 	// If present, metadata about the bundle is written as JSON here
 	AbsMetadataFile string
 
+	// This indents the metadata to be readable in diffs. Otherwise it is
+	// written as compact JSON.
+	MetafilePretty bool
+
+	// This adds a hash of the original source of each input to the metadata
+	IncludeHashes bool
+
+	// This adds how many times each user-specified define was substituted to
+	// the metadata, including the defines that were never substituted
+	IncludeDefineStats bool
+	DefineKeys         []string
+
+	// This writes the "exports" field for "package.json" pointing at the
+	// JavaScript outputs of the entry points to "package-exports.json" in the
+	// output directory
+	PackageExports bool
+
+	// Resolved imports of files outside of all of these absolute directories
+	// are reported as errors. Files inside "node_modules" are exempt.
+	RestrictImports []string
+
+	// Package names and absolute paths of modules, which are considered to have
+	// no side effects like with "sideEffects": false in "package.json"
+	NoSideEffectsModules map[string]bool
+
+	// Bundled packages imported from outside of "node_modules", which are listed
+	// only in "devDependencies" of the nearest "package.json", are reported
+	CheckDevDependencies bool
+
 	SourceMap             SourceMap
 	ExcludeSourcesContent bool
 
@@ -297,17 +545,10 @@ func IsTreeShakingEnabled(mode Mode, outputFormat Format) bool {
 	return mode == ModeBundle || (mode == ModeConvertFormat && outputFormat == FormatIIFE)
 }
 
-type InjectedDefine struct {
-	Source logger.Source
-	Data   js_ast.E
-	Name   string
-}
-
 type InjectedFile struct {
 	Path        string
 	SourceIndex uint32
 	Exports     []string
-	IsDefine    bool
 }
 
 var filterMutex sync.Mutex
@@ -370,8 +611,15 @@ func PluginAppliesToPath(path logger.Path, filter *regexp.Regexp, namespace stri
 
 type Plugin struct {
 	Name      string
+	OnStart   []OnStart
 	OnResolve []OnResolve
 	OnLoad    []OnLoad
+	OnEnd     []OnEnd
+}
+
+type OnStart struct {
+	Name     string
+	Callback func()
 }
 
 type OnResolve struct {
@@ -386,6 +634,7 @@ type OnResolveArgs struct {
 	Importer   logger.Path
 	ResolveDir string
 	PluginData interface{}
+	With       map[string]string // The import attributes like "type"
 }
 
 type OnResolveResult struct {
@@ -393,8 +642,12 @@ type OnResolveResult struct {
 
 	Path       logger.Path
 	External   bool
+	Loader     Loader // Overrides the loader picked by the file extension
 	PluginData interface{}
 
+	AbsWatchFiles []string
+	AbsWatchDirs  []string
+
 	Msgs        []logger.Msg
 	ThrownError error
 }
@@ -423,6 +676,21 @@ type OnLoadResult struct {
 	ThrownError error
 }
 
+type OnEnd struct {
+	Name     string
+	Callback func(OnEndArgs)
+}
+
+type OnEndArgs struct {
+	Msgs        []logger.Msg
+	OutputFiles []OnEndOutputFile
+}
+
+type OnEndOutputFile struct {
+	AbsPath  string
+	Contents []byte
+}
+
 func (a *AMDLoadableScript) Equal(b *AMDLoadableScript) bool {
 	return a.ReplacementPattern == b.ReplacementPattern &&
 		a.ReplacementValue == b.ReplacementValue &&
@@ -452,6 +720,9 @@ func stringArraysEqual(a []string, b []string) bool {
 
 func (a *AMDOptions) Equal(b *AMDOptions) bool {
 	if a.BaseUrl != b.BaseUrl || a.Namespace != b.Namespace ||
+		a.UrlArgs != b.UrlArgs || a.UrlArgsIsFunction != b.UrlArgsIsFunction ||
+		a.Callback != b.Callback || a.CallbackIsFunction != b.CallbackIsFunction ||
+		!stringArraysEqual(a.Deps, b.Deps) ||
 		a.Parse != b.Parse || a.MappedModuleNames != b.MappedModuleNames {
 		return false
 	}
@@ -498,6 +769,15 @@ func (a *AMDOptions) Equal(b *AMDOptions) bool {
 		}
 	}
 
+	if len(a.Shim) != len(b.Shim) {
+		return false
+	}
+	for k, v := range a.Shim {
+		if w, ok := b.Shim[k]; !ok || v.Exports != w.Exports || !stringArraysEqual(v.Deps, w.Deps) {
+			return false
+		}
+	}
+
 	if len(a.KnownFileExtensions) != len(b.KnownFileExtensions) {
 		return false
 	}
@@ -535,10 +815,7 @@ func (options *AMDOptions) Init(baseUrl string) {
 		".txt":  true,
 		".css":  true,
 	}
-	options.backwardPaths = make(map[string]string)
-	options.backwardPathsMutex = &sync.RWMutex{}
-	options.pluginExpressions = make(map[string]string)
-	options.pluginExpressionsMutex = &sync.RWMutex{}
+	options.names = newAMDModuleNames()
 }
 
 // The following configuration:
@@ -585,9 +862,9 @@ func (options *AMDOptions) ModuleNameToPath(importPath string, sourcePath string
 		if !options.HasKnownFileExtension(targetPath) {
 			targetPath += ".js"
 		}
-		options.backwardPathsMutex.Lock()
-		options.backwardPaths[targetPath] = importPath
-		options.backwardPathsMutex.Unlock()
+		options.names.mutex.Lock()
+		options.names.backwardPaths[targetPath] = importPath
+		options.names.mutex.Unlock()
 		return targetPath
 	}
 	if mappedPath != "" && !options.HasKnownFileExtension(mappedPath) {
@@ -598,12 +875,68 @@ func (options *AMDOptions) ModuleNameToPath(importPath string, sourcePath string
 
 func (options *AMDOptions) ModulePathToName(sourcePath string) string {
 	modulePath, _ := localFS.Rel(options.BaseUrl, sourcePath)
-	options.backwardPathsMutex.RLock()
-	importPath := options.backwardPaths[modulePath]
-	options.backwardPathsMutex.RUnlock()
+	options.names.mutex.RLock()
+	importPath := options.names.backwardPaths[modulePath]
+	options.names.mutex.RUnlock()
 	return importPath
 }
 
+// This returns the shim of the module with the source path. The module name
+// is looked up like in dependencies, either mapped or relative to "baseUrl".
+func (options *AMDOptions) ShimForModulePath(sourcePath string) (AMDShim, bool) {
+	if len(options.Shim) == 0 {
+		return AMDShim{}, false
+	}
+	name := options.ModulePathToName(sourcePath)
+	if name == "" {
+		name, _ = localFS.Rel(options.BaseUrl, sourcePath)
+		name = strings.TrimSuffix(name, ".js")
+	}
+	shim, ok := options.Shim[name]
+	return shim, ok
+}
+
+// This remembers the name of a module, which has not been mapped by itself,
+// but which has been imported by a relative path from a mapped module. The
+// module has to be defined with the same name that its dependents use.
+func (options *AMDOptions) SetModulePathName(sourcePath string, name string) {
+	modulePath, _ := localFS.Rel(options.BaseUrl, sourcePath)
+	options.names.mutex.Lock()
+	if _, ok := options.names.backwardPaths[modulePath]; !ok {
+		options.names.backwardPaths[modulePath] = name
+	}
+	options.names.mutex.Unlock()
+}
+
+// Module names, which are not mapped explicitly, are paths relative to the
+// base URL without the ".js" extension. If the namespace is set, it is used
+// as their prefix, for example "ns/foo/bar" for "{baseUrl}/foo/bar.js".
+func (options *AMDOptions) PrefixModuleName(name string) string {
+	if options.Namespace == "" {
+		return name
+	}
+	return options.Namespace + "/" + name
+}
+
+// This checks if the module name is mapped by "map" or "paths" without
+// remembering the mapping like ModuleNameToPath does. The source path can
+// be empty if the module name is not imported from another module.
+func (options *AMDOptions) IsMappedModule(importPath string, sourcePath string) bool {
+	if sourcePath != "" {
+		mappedSource := options.ModulePathToName(sourcePath)
+		if mappedSource == "" {
+			mappedSource, _ = localFS.Rel(options.BaseUrl, sourcePath)
+			if strings.HasSuffix(mappedSource, ".js") {
+				mappedSource = mappedSource[:len(mappedSource)-3]
+			}
+		}
+		if scope := options.Map[mappedSource]; scope != nil && mapSegmentedPath(importPath, scope) != "" {
+			return true
+		}
+	}
+	return mapSegmentedPath(importPath, options.StarMap) != "" || mapSegmentedPath(importPath, options.Paths) != ""
+}
+
 func (options *AMDOptions) UsesPlugin(importPath string) bool {
 	return strings.Contains(importPath, "!")
 }
@@ -640,17 +973,17 @@ func (options *AMDOptions) PluginExpressionToModulePath(importPath string, modul
 	if strings.HasPrefix(modulePath, "./") || strings.HasPrefix(modulePath, "../") {
 		modulePath, _ = localFS.Rel(options.BaseUrl, localFS.Join(localFS.Dir(sourcePath), modulePath))
 	}
-	options.pluginExpressionsMutex.Lock()
-	options.pluginExpressions[modulePath] = moduleName
-	options.pluginExpressionsMutex.Unlock()
+	options.names.mutex.Lock()
+	options.names.pluginExpressions[modulePath] = moduleName
+	options.names.mutex.Unlock()
 	return importPath
 }
 
 func (options *AMDOptions) ModulePathToPluginExpression(sourcePath string) string {
 	modulePath, _ := localFS.Rel(options.BaseUrl, sourcePath)
-	options.pluginExpressionsMutex.RLock()
-	moduleName := options.pluginExpressions[modulePath]
-	options.pluginExpressionsMutex.RUnlock()
+	options.names.mutex.RLock()
+	moduleName := options.names.pluginExpressions[modulePath]
+	options.names.mutex.RUnlock()
 	return moduleName
 }
 
@@ -707,3 +1040,37 @@ func mapSegmentedPath(importPath string, paths map[string]string) string {
 	}
 	return ""
 }
+
+// The values of the placeholders in an output path template. "[dir]" is the
+// directory of the input file relative to the output base, "[name]" is the base
+// name of the input file without its extension (or "chunk" for shared chunks)
+// and "[hash]" is a hash of the contents of the output file. The output
+// extension is appended to the path produced by the template.
+type PathTemplate struct {
+	Dir  string
+	Name string
+	Hash string
+}
+
+func (placeholders PathTemplate) Apply(template string) string {
+	if template == "" {
+		template = "[name].[hash]"
+	}
+	result := strings.NewReplacer(
+		"[dir]", placeholders.Dir,
+		"[name]", placeholders.Name,
+		"[hash]", placeholders.Hash,
+	).Replace(template)
+
+	// An empty directory shouldn't leave a leading slash or "./" behind
+	return strings.TrimPrefix(path.Clean("/"+result), "/")
+}
+
+func (options *Options) IsCancelled() bool {
+	select {
+	case <-options.Cancel:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,6 +1,8 @@
 package css_ast
 
 import (
+	"strings"
+
 	"github.com/evanw/esbuild/internal/ast"
 	"github.com/evanw/esbuild/internal/css_lexer"
 	"github.com/evanw/esbuild/internal/logger"
@@ -22,7 +24,7 @@ import (
 
 type AST struct {
 	ImportRecords []ast.ImportRecord
-	Rules         []R
+	Rules         []Rule
 }
 
 // We create a lot of tokens, so make sure this layout is memory-efficient.
@@ -86,6 +88,13 @@ func (t Token) DimensionUnit() string {
 	return t.Text[t.UnitOffset:]
 }
 
+// Rules keep the location where they started in the source file, which is
+// needed to generate source maps.
+type Rule struct {
+	Loc  logger.Loc
+	Data R
+}
+
 // This interface is never called. Its purpose is to encode a variant type in
 // Go's type system.
 type R interface {
@@ -113,13 +122,13 @@ type RAtKeyframes struct {
 
 type KeyframeBlock struct {
 	Selectors []string
-	Rules     []R
+	Rules     []Rule
 }
 
 type RKnownAt struct {
 	AtToken string
 	Prelude []Token
-	Rules   []R
+	Rules   []Rule
 }
 
 type RUnknownAt struct {
@@ -130,12 +139,12 @@ type RUnknownAt struct {
 
 type RSelector struct {
 	Selectors []ComplexSelector
-	Rules     []R
+	Rules     []Rule
 }
 
 type RQualified struct {
 	Prelude []Token
-	Rules   []R
+	Rules   []Rule
 }
 
 type RDeclaration struct {
@@ -146,6 +155,79 @@ type RDeclaration struct {
 	Important bool
 }
 
+// This returns the indices of the tokens that name keyframes in the value of
+// "animation-name" or of the "animation" shorthand, including their vendor-
+// prefixed variants. In the shorthand, a keyword like "linear" belongs to the
+// first component accepting it, so it's only a name if that one is taken.
+func (r *RDeclaration) KeyframeNameIndices() []int {
+	key := strings.ToLower(r.KeyText)
+	for _, prefix := range []string{"-webkit-", "-moz-", "-ms-", "-o-"} {
+		if strings.HasPrefix(key, prefix) {
+			key = key[len(prefix):]
+			break
+		}
+	}
+	isShorthand := key == "animation"
+	if !isShorthand && key != "animation-name" {
+		return nil
+	}
+
+	var indices []int
+	var components animationComponent
+	for i, t := range r.Value {
+		switch t.Kind {
+		case css_lexer.TComma:
+			components = 0
+		case css_lexer.TIdent:
+			if isShorthand {
+				if component := animationKeywords[t.Text]; component != 0 && (components&component) == 0 {
+					components |= component
+					continue
+				}
+				if (components & animationName) != 0 {
+					continue
+				}
+				components |= animationName
+			}
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+type animationComponent uint8
+
+const (
+	animationName animationComponent = 1 << iota
+	animationTimingFunction
+	animationIterationCount
+	animationDirection
+	animationFillMode
+	animationPlayState
+)
+
+// The keywords of the other components of the "animation" shorthand
+var animationKeywords = map[string]animationComponent{
+	"ease":              animationTimingFunction,
+	"ease-in":           animationTimingFunction,
+	"ease-in-out":       animationTimingFunction,
+	"ease-out":          animationTimingFunction,
+	"linear":            animationTimingFunction,
+	"step-end":          animationTimingFunction,
+	"step-start":        animationTimingFunction,
+	"infinite":          animationIterationCount,
+	"alternate":         animationDirection,
+	"alternate-reverse": animationDirection,
+	"normal":            animationDirection,
+	"reverse":           animationDirection,
+	"backwards":         animationFillMode,
+	"both":              animationFillMode,
+	"forwards":          animationFillMode,
+	"none":              animationFillMode,
+	"paused":            animationPlayState,
+	"running":           animationPlayState,
+}
+
 type RBadDeclaration struct {
 	Tokens []Token
 }
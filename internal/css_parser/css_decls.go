@@ -668,9 +668,9 @@ func (p *parser) mangleColor(token css_ast.Token) css_ast.Token {
 	return token
 }
 
-func (p *parser) processDeclarations(rules []css_ast.R) {
+func (p *parser) processDeclarations(rules []css_ast.Rule) {
 	for _, rule := range rules {
-		decl, ok := rule.(*css_ast.RDeclaration)
+		decl, ok := rule.Data.(*css_ast.RDeclaration)
 		if !ok {
 			continue
 		}
@@ -152,12 +152,11 @@ type ruleContext struct {
 	parseSelectors bool
 }
 
-func (p *parser) parseListOfRules(context ruleContext) []css_ast.R {
+func (p *parser) parseListOfRules(context ruleContext) []css_ast.Rule {
 	didWarnAboutCharset := false
 	didWarnAboutImport := false
 	didWarnAboutNamespace := false
-	rules := []css_ast.R{}
-	locs := []logger.Loc{}
+	rules := []css_ast.Rule{}
 
 	for {
 		switch p.current().Kind {
@@ -178,7 +177,7 @@ func (p *parser) parseListOfRules(context ruleContext) []css_ast.R {
 				case *css_ast.RAtCharset:
 					if !didWarnAboutCharset && len(rules) > 0 {
 						p.log.AddRangeWarningWithNotes(&p.source, first, "\"@charset\" must be the first rule in the file",
-							[]logger.MsgData{logger.RangeData(&p.source, logger.Range{Loc: locs[len(locs)-1]},
+							[]logger.MsgData{logger.RangeData(&p.source, logger.Range{Loc: rules[len(rules)-1].Loc},
 								"This rule cannot come before a \"@charset\" rule")})
 						didWarnAboutCharset = true
 					}
@@ -186,12 +185,12 @@ func (p *parser) parseListOfRules(context ruleContext) []css_ast.R {
 				case *css_ast.RAtImport:
 					if !didWarnAboutImport {
 					importLoop:
-						for i, before := range rules {
-							switch before.(type) {
+						for _, before := range rules {
+							switch before.Data.(type) {
 							case *css_ast.RAtCharset, *css_ast.RAtImport:
 							default:
 								p.log.AddRangeWarningWithNotes(&p.source, first, "All \"@import\" rules must come first",
-									[]logger.MsgData{logger.RangeData(&p.source, logger.Range{Loc: locs[i]},
+									[]logger.MsgData{logger.RangeData(&p.source, logger.Range{Loc: before.Loc},
 										"This rule cannot come before an \"@import\" rule")})
 								didWarnAboutImport = true
 								break importLoop
@@ -202,12 +201,12 @@ func (p *parser) parseListOfRules(context ruleContext) []css_ast.R {
 				case *css_ast.RAtNamespace:
 					if !didWarnAboutNamespace {
 					namespaceLoop:
-						for i, before := range rules {
-							switch before.(type) {
+						for _, before := range rules {
+							switch before.Data.(type) {
 							case *css_ast.RAtCharset, *css_ast.RAtImport, *css_ast.RAtNamespace:
 							default:
 								p.log.AddRangeWarningWithNotes(&p.source, first, "\"@namespace\" rules can only come after \"@import\" rules",
-									[]logger.MsgData{logger.RangeData(&p.source, logger.Range{Loc: locs[i]},
+									[]logger.MsgData{logger.RangeData(&p.source, logger.Range{Loc: before.Loc},
 										"This rule cannot come before a \"@namespace\" rule")})
 								didWarnAboutNamespace = true
 								break namespaceLoop
@@ -217,10 +216,7 @@ func (p *parser) parseListOfRules(context ruleContext) []css_ast.R {
 				}
 			}
 
-			rules = append(rules, rule)
-			if context.isTopLevel {
-				locs = append(locs, first.Loc)
-			}
+			rules = append(rules, css_ast.Rule{Loc: first.Loc, Data: rule})
 			continue
 
 		case css_lexer.TCDO, css_lexer.TCDC:
@@ -230,19 +226,18 @@ func (p *parser) parseListOfRules(context ruleContext) []css_ast.R {
 			}
 		}
 
-		if context.isTopLevel {
-			locs = append(locs, p.current().Range.Loc)
-		}
+		loc := p.current().Range.Loc
 		if context.parseSelectors {
-			rules = append(rules, p.parseSelectorRule())
+			rules = append(rules, css_ast.Rule{Loc: loc, Data: p.parseSelectorRule()})
 		} else {
-			rules = append(rules, p.parseQualifiedRuleFrom(p.index, false /* isAlreadyInvalid */))
+			rules = append(rules, css_ast.Rule{Loc: loc, Data: p.parseQualifiedRuleFrom(p.index, false /* isAlreadyInvalid */)})
 		}
 	}
 }
 
-func (p *parser) parseListOfDeclarations() (list []css_ast.R) {
+func (p *parser) parseListOfDeclarations() (list []css_ast.Rule) {
 	for {
+		loc := p.current().Range.Loc
 		switch p.current().Kind {
 		case css_lexer.TWhitespace, css_lexer.TSemicolon:
 			p.advance()
@@ -252,16 +247,16 @@ func (p *parser) parseListOfDeclarations() (list []css_ast.R) {
 			return
 
 		case css_lexer.TAtKeyword:
-			list = append(list, p.parseAtRule(atRuleContext{
+			list = append(list, css_ast.Rule{Loc: loc, Data: p.parseAtRule(atRuleContext{
 				isDeclarationList: true,
-			}))
+			})})
 
 		case css_lexer.TDelimAmpersand:
 			// Reference: https://drafts.csswg.org/css-nesting-1/
-			list = append(list, p.parseSelectorRule())
+			list = append(list, css_ast.Rule{Loc: loc, Data: p.parseSelectorRule()})
 
 		default:
-			list = append(list, p.parseDeclaration())
+			list = append(list, css_ast.Rule{Loc: loc, Data: p.parseDeclaration()})
 		}
 	}
 }
@@ -530,7 +525,7 @@ prelude:
 	case atRuleInheritContext:
 		// Parse known rules whose blocks consist of whatever the current context is
 		p.advance()
-		var rules []css_ast.R
+		var rules []css_ast.Rule
 		if context.isDeclarationList {
 			rules = p.parseListOfDeclarations()
 		} else {
@@ -50,7 +50,7 @@ func expectPrintedCommon(t *testing.T, name string, contents string, expected st
 			}
 		}
 		assertEqual(t, text, "")
-		css := css_printer.Print(tree, css_printer.Options{})
+		css := css_printer.Print(tree, css_printer.Options{}).CSS
 		assertEqual(t, string(css), expected)
 	})
 }
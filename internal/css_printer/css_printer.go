@@ -8,6 +8,8 @@ import (
 	"github.com/evanw/esbuild/internal/ast"
 	"github.com/evanw/esbuild/internal/css_ast"
 	"github.com/evanw/esbuild/internal/css_lexer"
+	"github.com/evanw/esbuild/internal/js_printer"
+	"github.com/evanw/esbuild/internal/logger"
 )
 
 const quoteForURL rune = -1
@@ -16,30 +18,122 @@ type printer struct {
 	Options
 	importRecords []ast.ImportRecord
 	sb            strings.Builder
+
+	// For source maps
+	sourceMap           []byte
+	prevLoc             logger.Loc
+	prevState           js_printer.SourceMapState
+	lastGeneratedUpdate int
+	generatedColumn     int
 }
 
 type Options struct {
-	RemoveWhitespace bool
-	ASCIIOnly        bool
+	RemoveWhitespace  bool
+	ASCIIOnly         bool
+	AddSourceMappings bool
+
+	// If present, this renames "@keyframes" and the references to them in the
+	// "animation" and "animation-name" properties
+	KeyframeNames map[string]string
+
+	// If we're writing out a source map, this table of line start indices lets
+	// us do binary search on to figure out what line a given rule came from
+	LineOffsetTables []js_printer.LineOffsetTable
+}
+
+type PrintResult struct {
+	CSS string
+
+	// This source map chunk just contains the VLQ-encoded offsets for the "CSS"
+	// field above. It's not a full source map. The bundler will be joining many
+	// source map chunks together to form the final source map.
+	SourceMapChunk js_printer.SourceMapChunk
 }
 
-func Print(tree css_ast.AST, options Options) string {
+func Print(tree css_ast.AST, options Options) PrintResult {
 	p := printer{
 		Options:       options,
 		importRecords: tree.ImportRecords,
+		prevLoc:       logger.Loc{Start: -1},
 	}
 	for _, rule := range tree.Rules {
 		p.printRule(rule, 0, false)
 	}
-	return p.sb.String()
+	css := p.sb.String()
+	p.updateGeneratedLineAndColumn()
+
+	// Ignore the chunk if nothing in it maps to the source file
+	shouldIgnore := true
+	for _, c := range p.sourceMap {
+		if c != ';' {
+			shouldIgnore = false
+			break
+		}
+	}
+
+	return PrintResult{
+		CSS: css,
+		SourceMapChunk: js_printer.SourceMapChunk{
+			Buffer:               p.sourceMap,
+			EndState:             p.prevState,
+			FinalGeneratedColumn: p.generatedColumn,
+			ShouldIgnore:         shouldIgnore,
+		},
+	}
+}
+
+func (p *printer) addSourceMapping(loc logger.Loc) {
+	if !p.AddSourceMappings || loc == p.prevLoc {
+		return
+	}
+	p.prevLoc = loc
+	originalLine, originalColumn := js_printer.OriginalLineAndColumn(p.LineOffsetTables, loc)
+
+	p.updateGeneratedLineAndColumn()
+
+	currentState := js_printer.SourceMapState{
+		GeneratedLine:   p.prevState.GeneratedLine,
+		GeneratedColumn: p.generatedColumn,
+		OriginalLine:    originalLine,
+		OriginalColumn:  originalColumn,
+	}
+	var lastByte byte
+	if len(p.sourceMap) != 0 {
+		lastByte = p.sourceMap[len(p.sourceMap)-1]
+	}
+	p.sourceMap = js_printer.AppendMapping(p.sourceMap, lastByte, p.prevState, currentState)
+	p.prevState = currentState
+}
+
+// Scan over the printed text since the last source mapping and update the
+// generated line and column numbers
+func (p *printer) updateGeneratedLineAndColumn() {
+	if !p.AddSourceMappings {
+		return
+	}
+	for _, c := range p.sb.String()[p.lastGeneratedUpdate:] {
+		if c == '\n' {
+			p.prevState.GeneratedLine++
+			p.prevState.GeneratedColumn = 0
+			p.generatedColumn = 0
+			p.sourceMap = append(p.sourceMap, ';')
+		} else if c <= 0xFFFF {
+			// Mozilla's "source-map" library counts columns using UTF-16 code units
+			p.generatedColumn++
+		} else {
+			p.generatedColumn += 2
+		}
+	}
+	p.lastGeneratedUpdate = p.sb.Len()
 }
 
-func (p *printer) printRule(rule css_ast.R, indent int, omitTrailingSemicolon bool) {
+func (p *printer) printRule(rule css_ast.Rule, indent int, omitTrailingSemicolon bool) {
 	if !p.RemoveWhitespace {
 		p.printIndent(indent)
 	}
+	p.addSourceMapping(rule.Loc)
 
-	switch r := rule.(type) {
+	switch r := rule.Data.(type) {
 	case *css_ast.RAtCharset:
 		// It's not valid to remove the space in between these two tokens
 		p.print("@charset ")
@@ -74,10 +168,14 @@ func (p *printer) printRule(rule css_ast.R, indent int, omitTrailingSemicolon bo
 		p.print("@")
 		p.printIdent(r.AtToken, identNormal, mayNeedWhitespaceAfter)
 		p.print(" ")
-		if r.Name == "" {
+		name := r.Name
+		if renamed, ok := p.KeyframeNames[name]; ok {
+			name = renamed
+		}
+		if name == "" {
 			p.print("\"\"")
 		} else {
-			p.printIdent(r.Name, identNormal, canDiscardWhitespaceAfter)
+			p.printIdent(name, identNormal, canDiscardWhitespaceAfter)
 		}
 		if !p.RemoveWhitespace {
 			p.print(" ")
@@ -169,7 +267,11 @@ func (p *printer) printRule(rule css_ast.R, indent int, omitTrailingSemicolon bo
 	case *css_ast.RDeclaration:
 		p.printIdent(r.KeyText, identNormal, canDiscardWhitespaceAfter)
 		p.print(":")
-		hasWhitespaceAfter := p.printTokens(r.Value)
+		value := r.Value
+		if len(p.KeyframeNames) > 0 {
+			value = p.renameKeyframes(value, r.KeyframeNameIndices())
+		}
+		hasWhitespaceAfter := p.printTokens(value)
 		if r.Important {
 			if !hasWhitespaceAfter && !p.RemoveWhitespace && len(r.Value) > 0 {
 				p.print(" ")
@@ -195,7 +297,24 @@ func (p *printer) printRule(rule css_ast.R, indent int, omitTrailingSemicolon bo
 	}
 }
 
-func (p *printer) printRuleBlock(rules []css_ast.R, indent int) {
+// The tokens are copied because the AST is shared with other builds
+func (p *printer) renameKeyframes(tokens []css_ast.Token, indices []int) []css_ast.Token {
+	var renamedTokens []css_ast.Token
+	for _, i := range indices {
+		if renamed, ok := p.KeyframeNames[tokens[i].Text]; ok {
+			if renamedTokens == nil {
+				renamedTokens = append([]css_ast.Token{}, tokens...)
+			}
+			renamedTokens[i].Text = renamed
+		}
+	}
+	if renamedTokens == nil {
+		return tokens
+	}
+	return renamedTokens
+}
+
+func (p *printer) printRuleBlock(rules []css_ast.Rule, indent int) {
 	if p.RemoveWhitespace {
 		p.print("{")
 	} else {
@@ -31,7 +31,7 @@ func expectPrintedCommon(t *testing.T, name string, contents string, expected st
 			}
 		}
 		assertEqual(t, text, "")
-		css := Print(tree, options)
+		css := Print(tree, options).CSS
 		assertEqual(t, string(css), expected)
 	})
 }
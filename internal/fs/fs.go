@@ -47,6 +47,11 @@ type FS interface {
 	ReadDirectory(path string) (map[string]*Entry, error)
 	ReadFile(path string) (string, error)
 
+	// This removes the entries of the directory from the cache, so that they
+	// are read again by the next call to "ReadDirectory". The data recorded
+	// for watch mode about the path is removed as well.
+	InvalidateDirectory(path string)
+
 	// This is a key made from the information returned by "stat". It is intended
 	// to be different if the file has been edited, and to otherwise be equal if
 	// the file has not been edited. It should usually work, but no guarantees.
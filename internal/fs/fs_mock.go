@@ -55,6 +55,10 @@ func (fs *mockFS) ReadDirectory(path string) (map[string]*Entry, error) {
 	return dir, nil
 }
 
+func (fs *mockFS) InvalidateDirectory(path string) {
+	// Directory entries are not cached
+}
+
 func (fs *mockFS) ReadFile(path string) (string, error) {
 	contents, ok := fs.files[path]
 	if !ok {
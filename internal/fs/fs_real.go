@@ -9,9 +9,17 @@ import (
 	"syscall"
 )
 
+// The cache of directory entries is shared by the rebuilds, so it's bounded to
+// not grow forever in a long-running watch mode
+const maxCachedDirectories = 1 << 16
+
 type realFS struct {
-	// Stores the file entries for directories we've listed before
-	entries map[string]entriesOrErr
+	// Stores the file entries for directories we've listed before. Plugins
+	// may cause directories to be read in parallel with the resolver. It holds
+	// at most "maxEntries" directories.
+	entriesMutex sync.Mutex
+	entries      map[string]entriesOrErr
+	maxEntries   int
 
 	// If true, do not use the "entries" cache
 	doNotCacheEntries bool
@@ -107,6 +115,7 @@ func RealFS(options RealFSOptions) (FS, error) {
 
 	return &realFS{
 		entries:           make(map[string]entriesOrErr),
+		maxEntries:        maxCachedDirectories,
 		fp:                fp,
 		watchData:         watchData,
 		doNotCacheEntries: options.DoNotCache,
@@ -116,7 +125,10 @@ func RealFS(options RealFSOptions) (FS, error) {
 func (fs *realFS) ReadDirectory(dir string) (map[string]*Entry, error) {
 	if !fs.doNotCacheEntries {
 		// First, check the cache
-		if cached, ok := fs.entries[dir]; ok {
+		fs.entriesMutex.Lock()
+		cached, ok := fs.entries[dir]
+		fs.entriesMutex.Unlock()
+		if ok {
 			// Cache hit: stop now
 			return cached.entries, cached.err
 		}
@@ -159,11 +171,35 @@ func (fs *realFS) ReadDirectory(dir string) (map[string]*Entry, error) {
 		entries = nil
 	}
 	if !fs.doNotCacheEntries {
+		fs.entriesMutex.Lock()
+		if _, ok := fs.entries[dir]; !ok && len(fs.entries) >= fs.maxEntries {
+			// Evict an arbitrary directory to make room. It will be read again if
+			// it's needed later.
+			for evicted := range fs.entries {
+				delete(fs.entries, evicted)
+				break
+			}
+		}
 		fs.entries[dir] = entriesOrErr{entries: entries, err: err}
+		fs.entriesMutex.Unlock()
 	}
 	return entries, err
 }
 
+func (fs *realFS) InvalidateDirectory(dir string) {
+	fs.entriesMutex.Lock()
+	delete(fs.entries, dir)
+	fs.entriesMutex.Unlock()
+
+	// Forget the old state too. Otherwise it would be reported as changed
+	// forever, even after the path has been read again.
+	if fs.watchData != nil {
+		fs.watchMutex.Lock()
+		delete(fs.watchData, dir)
+		fs.watchMutex.Unlock()
+	}
+}
+
 func (fs *realFS) ReadFile(path string) (string, error) {
 	BeforeFileOpen()
 	defer AfterFileClose()
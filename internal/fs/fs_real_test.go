@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRealFSEntriesLimit(t *testing.T) {
+	dir := t.TempDir()
+	var dirs []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		dirs = append(dirs, path.Join(dir, name))
+		if err := os.Mkdir(dirs[len(dirs)-1], 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := RealFS(RealFSOptions{AbsWorkingDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	real := fs.(*realFS)
+	real.maxEntries = 2
+
+	// Reading more directories than the limit evicts the ones read before
+	for _, dir := range dirs {
+		if _, err := fs.ReadDirectory(dir); err != nil {
+			t.Fatal(err)
+		}
+		if len(real.entries) > real.maxEntries {
+			t.Fatalf("Too many cached directories: %d", len(real.entries))
+		}
+	}
+	if _, ok := real.entries[dirs[len(dirs)-1]]; !ok {
+		t.Fatalf("The last directory was not cached")
+	}
+
+	// Reading a cached directory again does not evict another one
+	if _, err := fs.ReadDirectory(dirs[len(dirs)-1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(real.entries) != real.maxEntries {
+		t.Fatalf("Unexpected count of cached directories: %d", len(real.entries))
+	}
+}
@@ -249,8 +249,9 @@ type LocRef struct {
 }
 
 type Comment struct {
-	Loc  logger.Loc
-	Text string
+	Loc            logger.Loc
+	Text           string
+	IsLegalComment bool
 }
 
 type Span struct {
@@ -540,6 +541,11 @@ type EIdentifier struct {
 // doing this instead of opt-out.
 type EImportIdentifier struct {
 	Ref Ref
+
+	// If true, this identifier represents a function that, when called, can be
+	// unwrapped if the resulting value is unused. This is set when the import
+	// was marked as pure using "--pure".
+	CallCanBeUnwrappedIfUnused bool
 }
 
 // This is similar to EIdentifier but it represents class-private fields and
@@ -903,7 +909,8 @@ type SEmpty struct{}
 type STypeScript struct{}
 
 type SComment struct {
-	Text string
+	Text           string
+	IsLegalComment bool
 }
 
 type SDebugger struct{}
@@ -912,6 +919,13 @@ type SDirective struct {
 	Value []uint16
 }
 
+// The "use client" and "use server" directives of React Server Components only
+// have an effect at the top of the file, so they must stay there even after
+// the module has been bundled together with other modules
+func IsComponentDirective(value string) bool {
+	return value == "use client" || value == "use server"
+}
+
 type SExportClause struct {
 	Items        []ClauseItem
 	IsSingleLine bool
@@ -976,6 +990,7 @@ type SEnum struct {
 	Arg      Ref
 	Values   []EnumValue
 	IsExport bool
+	IsConst  bool
 }
 
 type SNamespace struct {
@@ -1553,15 +1568,24 @@ type AST struct {
 	UsesExportsRef    bool
 	UsesModuleRef     bool
 
+	// This is where "module.exports" is assigned a function or a class, unless
+	// the module is marked by "__esModule" as transpiled from an ES6 module
+	NonObjectModuleExports *logger.Loc
+
 	// This is a list of AMD features
 	IsAMD bool
 
+	// The names of AMD modules can depend on the names used by other files.
+	// They are assigned after all files have been scanned, in the order of
+	// the imports, so they are the same in every build.
+	AMDModuleNames []AMDModuleName
+
 	// This is a list of ES6 features
 	HasES6Imports bool
 	HasES6Exports bool
 
 	Hashbang    string
-	Directive   string
+	Directives  []string
 	URLForCSS   string
 	Parts       []Part
 	Symbols     []Symbol
@@ -1587,9 +1611,32 @@ type AST struct {
 	TopLevelSymbolToParts   map[Ref][]uint32
 	ExportStarImportRecords []uint32
 
+	// The number of substitutions of each define in this file
+	DefineUses map[string]uint32
+
+	// The runtime APIs used in this file, which the target doesn't support
+	PolyfillUses map[string]bool
+
+	// The syntax features, which were lowered in this file
+	LoweredFeatures compat.JSFeature
+
+	// This is true if the output format changed the parsed code or its errors,
+	// for example because of "import.meta". Such a file is parsed again for
+	// each of the other formats of a build with several formats.
+	DependsOnOutputFormat bool
+
 	SourceMapComment Span
 }
 
+// This is a string with the name of an AMD module in a "define" or "require"
+// call. The path is either the dependency as written in the source, or the
+// absolute path of the file itself for the name of the module it defines.
+type AMDModuleName struct {
+	Value    *EString
+	Path     string
+	IsDefine bool
+}
+
 // This is a histogram of character frequencies for minification
 type CharFreq [64]int32
 
@@ -234,10 +234,12 @@ type Lexer struct {
 	Identifier                      string
 	JSXFactoryPragmaComment         js_ast.Span
 	JSXFragmentPragmaComment        js_ast.Span
+	KeepNamesPragmaComment          js_ast.Span
 	SourceMappingURL                js_ast.Span
 	Number                          float64
 	rescanCloseBraceAsTemplateToken bool
 	forGlobalName                   bool
+	preserveAllComments             bool
 	json                            json
 	prevErrorLoc                    logger.Loc
 
@@ -270,6 +272,19 @@ func NewLexerGlobalName(log logger.Log, source logger.Source) Lexer {
 	return lexer
 }
 
+// Unlike NewLexer, this preserves all comments, not only the legal ones
+func NewLexerPreservingComments(log logger.Log, source logger.Source) Lexer {
+	lexer := Lexer{
+		log:                 log,
+		source:              source,
+		prevErrorLoc:        logger.Loc{Start: -1},
+		preserveAllComments: true,
+	}
+	lexer.step()
+	lexer.Next()
+	return lexer
+}
+
 func NewLexerJSON(log logger.Log, source logger.Source, allowComments bool) Lexer {
 	lexer := Lexer{
 		log:          log,
@@ -2500,6 +2515,10 @@ func (lexer *Lexer) scanCommentText() {
 				if arg, ok := scanForPragmaArg(pragmaSkipSpaceFirst, lexer.start+i+1, "jsxFrag", rest); ok {
 					lexer.JSXFragmentPragmaComment = arg
 				}
+			} else if hasPrefixWithWordBoundary(rest, "esbuild-keep-names") {
+				if arg, ok := scanForPragmaArg(pragmaSkipSpaceFirst, lexer.start+i+1, "esbuild-keep-names", rest); ok {
+					lexer.KeepNamesPragmaComment = arg
+				}
 			} else if strings.HasPrefix(rest, " sourceMappingURL=") {
 				if arg, ok := scanForPragmaArg(pragmaNoSpaceFirst, lexer.start+i+1, " sourceMappingURL=", rest); ok {
 					lexer.SourceMappingURL = arg
@@ -2508,14 +2527,15 @@ func (lexer *Lexer) scanCommentText() {
 		}
 	}
 
-	if hasPreserveAnnotation || lexer.PreserveAllCommentsBefore {
+	if hasPreserveAnnotation || lexer.PreserveAllCommentsBefore || lexer.preserveAllComments {
 		if isMultiLineComment {
 			text = removeMultiLineCommentIndent(lexer.source.Contents[:lexer.start], text)
 		}
 
 		lexer.CommentsToPreserveBefore = append(lexer.CommentsToPreserveBefore, js_ast.Comment{
-			Loc:  logger.Loc{Start: int32(lexer.start)},
-			Text: text,
+			Loc:            logger.Loc{Start: int32(lexer.start)},
+			Text:           text,
+			IsLegalComment: hasPreserveAnnotation,
 		})
 	}
 }
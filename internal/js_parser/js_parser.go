@@ -42,11 +42,14 @@ type parser struct {
 	allowIn                  bool
 	allowPrivateIdentifiers  bool
 	hasTopLevelReturn        bool
+	hasESModuleMarker        bool
 	fnOrArrowDataParse       fnOrArrowDataParse
 	fnOrArrowDataVisit       fnOrArrowDataVisit
 	fnOnlyDataVisit          fnOnlyDataVisit
 	latestReturnHadSemicolon bool
 	hasImportMeta            bool
+	dependsOnOutputFormat    bool
+	nonObjectModuleExports   *logger.Loc
 	allocatedNames           []string
 	latestArrowArgLoc        logger.Loc
 	forbidSuffixAfterAsLoc   logger.Loc
@@ -61,11 +64,12 @@ type parser struct {
 	importMetaRef            js_ast.Ref
 	promiseRef               js_ast.Ref
 	findSymbolHelper         func(loc logger.Loc, name string) js_ast.Ref
-	symbolForDefineHelper    func(int) js_ast.Ref
-	injectedDefineSymbols    []js_ast.Ref
 	symbolUses               map[js_ast.Ref]js_ast.SymbolUse
 	declaredSymbols          []js_ast.DeclaredSymbol
 	runtimeImports           map[string]js_ast.Ref
+	defineUses               map[string]uint32
+	polyfillUses             map[string]bool
+	loweredFeatures          compat.JSFeature
 	duplicateCaseChecker     duplicateCaseChecker
 	nonBMPIdentifiers        map[string]bool
 	lackOfDefineWarnings     map[string]bool
@@ -111,7 +115,8 @@ type parser struct {
 	externalImportRecords []ast.ImportRecord
 
 	// These are for handling AMD imports and exports
-	isAMD bool
+	isAMD          bool
+	amdModuleNames []js_ast.AMDModuleName
 
 	// These are for handling ES6 imports and exports
 	es6ImportKeyword        logger.Range
@@ -266,6 +271,7 @@ type parser struct {
 type Options struct {
 	injectedFiles []config.InjectedFile
 	jsx           config.JSXOptions
+	drop          config.DropOptions
 
 	// This pointer will always be different for each build but the contents
 	// shouldn't ever behave different semantically. We ignore this field for the
@@ -287,21 +293,27 @@ type optionsThatSupportStructuralEquality struct {
 	mode                           config.Mode
 	platform                       config.Platform
 	outputFormat                   config.Format
+	comments                       config.Comments
 	asciiOnly                      bool
 	keepNames                      bool
+	polyfills                      bool
 	mangleSyntax                   bool
 	minifyIdentifiers              bool
 	omitRuntimeForTests            bool
 	ignoreDCEAnnotations           bool
 	preserveUnusedImportsTS        bool
+	reportTypeElision              bool
+	isolatedModulesTS              bool
 	useDefineForClassFields        bool
 	suppressWarningsAboutWeirdCode bool
+	allowTopLevelAwait             bool
 }
 
 func OptionsFromConfig(options *config.Options) Options {
 	return Options{
 		injectedFiles: options.InjectedFiles,
 		jsx:           options.JSX,
+		drop:          options.Drop,
 		defines:       options.Defines,
 		optionsThatSupportStructuralEquality: optionsThatSupportStructuralEquality{
 			unsupportedJSFeatures:          options.UnsupportedJSFeatures,
@@ -310,30 +322,49 @@ func OptionsFromConfig(options *config.Options) Options {
 			mode:                           options.Mode,
 			platform:                       options.Platform,
 			outputFormat:                   options.OutputFormat,
+			comments:                       options.Comments,
 			asciiOnly:                      options.ASCIIOnly,
 			keepNames:                      options.KeepNames,
+			polyfills:                      options.Polyfills,
 			mangleSyntax:                   options.MangleSyntax,
 			minifyIdentifiers:              options.MinifyIdentifiers,
 			omitRuntimeForTests:            options.OmitRuntimeForTests,
 			ignoreDCEAnnotations:           options.IgnoreDCEAnnotations,
 			preserveUnusedImportsTS:        options.PreserveUnusedImportsTS,
+			reportTypeElision:              options.ReportTypeElision,
+			isolatedModulesTS:              options.IsolatedModulesTS,
 			useDefineForClassFields:        options.UseDefineForClassFields,
 			suppressWarningsAboutWeirdCode: options.SuppressWarningsAboutWeirdCode,
 		},
 	}
 }
 
+// Top-level await isn't supported when bundling in general, but generated code
+// can use it if it's known to stay at the top level of an "esm" output file
+func (options *Options) AllowTopLevelAwait() {
+	options.allowTopLevelAwait = true
+}
+
+// A file, which depends on the output format, is parsed again with the same
+// options for each of the other formats of a build with several formats
+func (options *Options) SetOutputFormat(format config.Format) {
+	options.outputFormat = format
+}
+
 func (a *optionsThatSupportStructuralEquality) Equal(b *optionsThatSupportStructuralEquality) bool {
 	return a.unsupportedJSFeatures == b.unsupportedJSFeatures && a.amd.Equal(&b.amd) &&
 		a.ts == b.ts && a.mode == b.mode && a.platform == b.platform &&
 		a.outputFormat == b.outputFormat && a.asciiOnly == b.asciiOnly &&
-		a.keepNames == b.keepNames && a.mangleSyntax == b.mangleSyntax &&
+		a.keepNames == b.keepNames && a.polyfills == b.polyfills && a.mangleSyntax == b.mangleSyntax &&
 		a.minifyIdentifiers == b.minifyIdentifiers &&
 		a.omitRuntimeForTests == b.omitRuntimeForTests &&
 		a.ignoreDCEAnnotations == b.ignoreDCEAnnotations &&
 		a.preserveUnusedImportsTS == b.preserveUnusedImportsTS &&
+		a.reportTypeElision == b.reportTypeElision &&
+		a.isolatedModulesTS == b.isolatedModulesTS &&
 		a.useDefineForClassFields == b.useDefineForClassFields &&
-		a.suppressWarningsAboutWeirdCode == b.suppressWarningsAboutWeirdCode
+		a.suppressWarningsAboutWeirdCode == b.suppressWarningsAboutWeirdCode &&
+		a.allowTopLevelAwait == b.allowTopLevelAwait
 }
 
 func (a *Options) Equal(b *Options) bool {
@@ -354,7 +385,12 @@ func (a *Options) Equal(b *Options) bool {
 	}
 
 	// Compare "JSX"
-	if a.jsx.Parse != b.jsx.Parse || !stringArraysEqual(a.jsx.Factory, b.jsx.Factory) || !stringArraysEqual(a.jsx.Fragment, b.jsx.Fragment) {
+	if a.jsx.Parse != b.jsx.Parse || a.jsx.Preserve != b.jsx.Preserve || !stringArraysEqual(a.jsx.Factory, b.jsx.Factory) || !stringArraysEqual(a.jsx.Fragment, b.jsx.Fragment) {
+		return false
+	}
+
+	// Compare "Drop"
+	if !a.drop.Equal(&b.drop) {
 		return false
 	}
 
@@ -1476,6 +1512,21 @@ func (p *parser) ignoreUsage(ref js_ast.Ref) {
 	// the value is ignored because that's what the TypeScript compiler does.
 }
 
+// Returns true if this call target is a method of the global "console" object
+// whose calls must be removed. The use of "console" is rolled back if so.
+func (p *parser) isDroppedConsoleCall(target js_ast.Expr) bool {
+	if dot, ok := target.Data.(*js_ast.EDot); ok {
+		if id, ok := dot.Target.Data.(*js_ast.EIdentifier); ok {
+			if symbol := p.symbols[id.Ref.InnerIndex]; symbol.Kind == js_ast.SymbolUnbound &&
+				symbol.OriginalName == "console" && p.options.drop.DropsConsoleMethod(dot.Name) {
+				p.ignoreUsage(id.Ref)
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p *parser) callRuntime(loc logger.Loc, name string, args []js_ast.Expr) js_ast.Expr {
 	ref, ok := p.runtimeImports[name]
 	if !ok {
@@ -2680,7 +2731,7 @@ func (p *parser) parsePrefix(level js_ast.L, errors *deferredErrors, flags exprF
 	case js_lexer.TTemplateHead:
 		head := p.lexer.StringLiteral
 		parts := p.parseTemplateParts(false /* includeRaw */)
-		if p.options.unsupportedJSFeatures.Has(compat.TemplateLiteral) {
+		if p.shouldLower(compat.TemplateLiteral) {
 			var value js_ast.Expr
 			if len(head) == 0 {
 				// "`${x}y`" => "x + 'y'"
@@ -4797,6 +4848,13 @@ func (p *parser) parseLabelName() *js_ast.LocRef {
 	return &name
 }
 
+// Type-only imports are skipped by the parser, so they are reported here
+func (p *parser) reportTypeOnlyImport(pathLoc logger.Loc, pathText string) {
+	if p.options.reportTypeElision {
+		p.log.AddRangeInfo(&p.source, p.source.RangeOfString(pathLoc), fmt.Sprintf("Removed the type-only import of %q", pathText))
+	}
+}
+
 func (p *parser) parsePath() (logger.Loc, string) {
 	pathLoc := p.lexer.Loc()
 	pathText := js_lexer.UTF16ToString(p.lexer.StringLiteral)
@@ -4808,6 +4866,53 @@ func (p *parser) parsePath() (logger.Loc, string) {
 	return pathLoc, pathText
 }
 
+// This parses the optional "with { type: 'json' }" clause or the older "assert
+// { type: 'json' }" clause after an import path. The attributes are stored in
+// the import record unless it is nil, which ignores them.
+func (p *parser) parseImportAttributes(record *ast.ImportRecord) {
+	useAssert := false
+	if p.lexer.IsContextualKeyword("assert") && !p.lexer.HasNewlineBefore {
+		useAssert = true
+	} else if p.lexer.Token != js_lexer.TWith {
+		return
+	}
+	p.lexer.Next()
+	p.lexer.Expect(js_lexer.TOpenBrace)
+
+	var attributes []ast.ImportAttribute
+	keys := make(map[string]bool)
+	for p.lexer.Token != js_lexer.TCloseBrace {
+		var key string
+		keyRange := p.lexer.Range()
+		if p.lexer.Token == js_lexer.TStringLiteral {
+			key = js_lexer.UTF16ToString(p.lexer.StringLiteral)
+		} else if p.lexer.IsIdentifierOrKeyword() {
+			key = p.lexer.Identifier
+		} else {
+			p.lexer.Expect(js_lexer.TIdentifier)
+		}
+		if keys[key] {
+			p.log.AddRangeError(&p.source, keyRange, fmt.Sprintf("Duplicate import attribute %q", key))
+		}
+		keys[key] = true
+		p.lexer.Next()
+		p.lexer.Expect(js_lexer.TColon)
+		value := js_lexer.UTF16ToString(p.lexer.StringLiteral)
+		p.lexer.Expect(js_lexer.TStringLiteral)
+		attributes = append(attributes, ast.ImportAttribute{Key: key, Value: value})
+		if p.lexer.Token != js_lexer.TComma {
+			break
+		}
+		p.lexer.Next()
+	}
+	p.lexer.Expect(js_lexer.TCloseBrace)
+
+	if record != nil {
+		record.Attributes = attributes
+		record.AttributesUseAssert = useAssert
+	}
+}
+
 // This assumes the "function" token has already been parsed
 func (p *parser) parseFnStmt(loc logger.Loc, opts parseStmtOpts, isAsync bool, asyncRange logger.Range) js_ast.Stmt {
 	isGenerator := p.lexer.Token == js_lexer.TAsterisk
@@ -5185,6 +5290,7 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 				namespaceRef = p.storeNameInRef(name)
 			}
 			importRecordIndex := p.addImportRecord(ast.ImportStmt, pathLoc, pathText)
+			p.parseImportAttributes(&p.importRecords[importRecordIndex])
 
 			p.lexer.ExpectOrInsertSemicolon()
 			return js_ast.Stmt{Loc: loc, Data: &js_ast.SExportStar{
@@ -5203,6 +5309,7 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 				p.lexer.Next()
 				pathLoc, pathText := p.parsePath()
 				importRecordIndex := p.addImportRecord(ast.ImportStmt, pathLoc, pathText)
+				p.parseImportAttributes(&p.importRecords[importRecordIndex])
 				name := "import_" + js_ast.GenerateNonUniqueNameFromPath(pathText)
 				namespaceRef := p.storeNameInRef(name)
 				p.lexer.ExpectOrInsertSemicolon()
@@ -5241,7 +5348,7 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 		if !p.options.ts.Parse {
 			p.lexer.Unexpected()
 		}
-		return p.parseTypeScriptEnumStmt(loc, opts)
+		return p.parseTypeScriptEnumStmt(loc, opts, false /* isConst */)
 
 	case js_lexer.TAt:
 		// Parse decorators before class statements, which are potentially exported
@@ -5308,7 +5415,7 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 		p.lexer.Next()
 
 		if p.options.ts.Parse && p.lexer.Token == js_lexer.TEnum {
-			return p.parseTypeScriptEnumStmt(loc, opts)
+			return p.parseTypeScriptEnumStmt(loc, opts, true /* isConst */)
 		}
 
 		decls := p.parseAndDeclareDecls(js_ast.SymbolConst, opts)
@@ -5448,7 +5555,7 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 
 			// The catch binding is optional, and can be omitted
 			if p.lexer.Token == js_lexer.TOpenBrace {
-				if p.options.unsupportedJSFeatures.Has(compat.OptionalCatchBinding) {
+				if p.shouldLower(compat.OptionalCatchBinding) {
 					// Generate a new symbol for the catch binding for older browsers
 					ref := p.newSymbol(js_ast.SymbolOther, "e")
 					p.currentScope.Generated = append(p.currentScope.Generated, ref)
@@ -5690,8 +5797,10 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 							// "import type foo from 'bar';"
 							p.lexer.Next()
 							p.lexer.ExpectContextualKeyword("from")
-							p.parsePath()
+							pathLoc, pathText := p.parsePath()
+							p.parseImportAttributes(nil)
 							p.lexer.ExpectOrInsertSemicolon()
+							p.reportTypeOnlyImport(pathLoc, pathText)
 							return js_ast.Stmt{Loc: loc, Data: &js_ast.STypeScript{}}
 						}
 
@@ -5701,16 +5810,20 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 						p.lexer.ExpectContextualKeyword("as")
 						p.lexer.Expect(js_lexer.TIdentifier)
 						p.lexer.ExpectContextualKeyword("from")
-						p.parsePath()
+						pathLoc, pathText := p.parsePath()
+						p.parseImportAttributes(nil)
 						p.lexer.ExpectOrInsertSemicolon()
+						p.reportTypeOnlyImport(pathLoc, pathText)
 						return js_ast.Stmt{Loc: loc, Data: &js_ast.STypeScript{}}
 
 					case js_lexer.TOpenBrace:
 						// "import type {foo} from 'bar';"
 						p.parseImportClause()
 						p.lexer.ExpectContextualKeyword("from")
-						p.parsePath()
+						pathLoc, pathText := p.parsePath()
+						p.parseImportAttributes(nil)
 						p.lexer.ExpectOrInsertSemicolon()
+						p.reportTypeOnlyImport(pathLoc, pathText)
 						return js_ast.Stmt{Loc: loc, Data: &js_ast.STypeScript{}}
 					}
 				}
@@ -5755,6 +5868,7 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 		pathLoc, pathText := p.parsePath()
 		stmt.ImportRecordIndex = p.addImportRecord(ast.ImportStmt, pathLoc, pathText)
 		p.importRecords[stmt.ImportRecordIndex].WasOriginallyBareImport = wasOriginallyBareImport
+		p.parseImportAttributes(&p.importRecords[stmt.ImportRecordIndex])
 		p.lexer.ExpectOrInsertSemicolon()
 
 		if stmt.StarNameLoc != nil {
@@ -5993,8 +6107,9 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 
 		p.lexer.ExpectOrInsertSemicolon()
 
-		// Parse a "use strict" directive
-		if str, ok := expr.Data.(*js_ast.EString); ok && !str.PreferTemplate && js_lexer.UTF16EqualsString(str.Value, "use strict") {
+		// Parse a "use strict", "use client" or "use server" directive
+		if str, ok := expr.Data.(*js_ast.EString); ok && !str.PreferTemplate && (js_lexer.UTF16EqualsString(str.Value, "use strict") ||
+			js_ast.IsComponentDirective(js_lexer.UTF16ToString(str.Value))) {
 			return js_ast.Stmt{Loc: loc, Data: &js_ast.SDirective{Value: str.Value}}
 		}
 
@@ -6080,7 +6195,7 @@ func (p *parser) parseStmtsUpTo(end js_lexer.T, opts parseStmtOpts) []js_ast.Stm
 			for _, comment := range comments {
 				stmts = append(stmts, js_ast.Stmt{
 					Loc:  comment.Loc,
-					Data: &js_ast.SComment{Text: comment.Text},
+					Data: &js_ast.SComment{Text: comment.Text, IsLegalComment: comment.IsLegalComment},
 				})
 			}
 		}
@@ -7795,6 +7910,39 @@ func (p *parser) keepExprSymbolName(value js_ast.Expr, name string) js_ast.Expr
 	return value
 }
 
+// Remember if "module.exports" is assigned a function or a class. Importing
+// the default export of such CommonJS module may behave differently in node
+// and in bundlers, which is worth a warning from the linker.
+func (p *parser) checkForNonObjectModuleExports(target js_ast.Expr, value js_ast.Expr) {
+	dot, ok := target.Data.(*js_ast.EDot)
+	if !ok {
+		return
+	}
+
+	// Transpiled ES6 modules are not ambiguous: "exports.__esModule = true"
+	if dot.Name == "__esModule" {
+		p.hasESModuleMarker = true
+		return
+	}
+
+	if id, ok := dot.Target.Data.(*js_ast.EIdentifier); !ok || id.Ref != p.moduleRef || dot.Name != "exports" {
+		return
+	}
+	switch v := value.Data.(type) {
+	case *js_ast.EFunction, *js_ast.EArrow, *js_ast.EClass:
+	case *js_ast.EIdentifier:
+		if kind := p.symbols[v.Ref.InnerIndex].Kind; kind != js_ast.SymbolHoistedFunction && kind != js_ast.SymbolClass {
+			return
+		}
+	default:
+		return
+	}
+	if p.nonObjectModuleExports == nil {
+		loc := target.Loc
+		p.nonObjectModuleExports = &loc
+	}
+}
+
 func (p *parser) keepStmtSymbolName(loc logger.Loc, ref js_ast.Ref, name string) js_ast.Stmt {
 	return js_ast.Stmt{Loc: loc, Data: &js_ast.SExpr{
 		Value: p.callRuntime(loc, "__name", []js_ast.Expr{
@@ -7809,7 +7957,12 @@ func (p *parser) keepStmtSymbolName(loc logger.Loc, ref js_ast.Ref, name string)
 
 func (p *parser) visitAndAppendStmt(stmts []js_ast.Stmt, stmt js_ast.Stmt) []js_ast.Stmt {
 	switch s := stmt.Data.(type) {
-	case *js_ast.SDebugger, *js_ast.SEmpty, *js_ast.SDirective, *js_ast.SComment:
+	case *js_ast.SDebugger:
+		if p.options.drop.Debugger {
+			return stmts
+		}
+
+	case *js_ast.SEmpty, *js_ast.SDirective, *js_ast.SComment:
 		// These don't contain anything to traverse
 
 	case *js_ast.STypeScript:
@@ -7886,7 +8039,7 @@ func (p *parser) visitAndAppendStmt(stmts []js_ast.Stmt, stmt js_ast.Stmt) []js_
 		if s.Alias != nil {
 			// "import * as ns from 'path'"
 			// "export {ns}"
-			if p.options.unsupportedJSFeatures.Has(compat.ExportStarAs) {
+			if p.shouldLower(compat.ExportStarAs) {
 				p.recordUsage(s.NamespaceRef)
 				return append(stmts,
 					js_ast.Stmt{Loc: stmt.Loc, Data: &js_ast.SImport{
@@ -8088,7 +8241,13 @@ func (p *parser) visitAndAppendStmt(stmts []js_ast.Stmt, stmt js_ast.Stmt) []js_
 		}
 
 	case *js_ast.SExpr:
-		s.Value = p.visitExpr(s.Value)
+		var out exprOut
+		s.Value, out = p.visitExprInOut(s.Value, exprIn{})
+
+		// Remove the statement entirely if it was a call that has been dropped
+		if out.wasDroppedCall {
+			return stmts
+		}
 
 		// Trim expressions without side effects
 		if p.options.mangleSyntax {
@@ -8504,6 +8663,17 @@ func (p *parser) visitAndAppendStmt(stmts []js_ast.Stmt, stmt js_ast.Stmt) []js_
 
 		p.shouldFoldNumericConstants = oldShouldFoldNumericConstants
 
+		// Each file is compiled on its own with "isolatedModules", so const enums
+		// can't be inlined in other files. They are compiled like regular enums
+		// and their values aren't inlined in this file either to be consistent.
+		if s.IsConst && p.options.isolatedModulesTS {
+			delete(p.knownEnumValues, s.Name.Ref)
+			delete(p.knownEnumValues, s.Arg)
+			p.log.AddRangeWarning(&p.source, js_lexer.RangeOfIdentifier(p.source, s.Name.Loc),
+				fmt.Sprintf("The values of the const enum %q are not inlined because \"isolatedModules\" is enabled",
+					p.symbols[s.Name.Ref.InnerIndex].OriginalName))
+		}
+
 		// Generate statements from expressions
 		valueStmts := []js_ast.Stmt{}
 		if len(valueExprs) > 0 {
@@ -8884,12 +9054,15 @@ func (p *parser) visitArgs(args []js_ast.Arg) {
 	}
 }
 
-func (p *parser) isDotDefineMatch(expr js_ast.Expr, parts []string) bool {
+// If "allowImports" is true, the root of the chain may also be an imported
+// symbol. This is used for marking calls such as "React.createElement()" as
+// pure even though "React" is an import instead of a global.
+func (p *parser) isDotDefineMatch(expr js_ast.Expr, parts []string, allowImports bool) bool {
 	if len(parts) > 1 {
 		// Intermediates must be dot expressions
 		e, ok := expr.Data.(*js_ast.EDot)
 		last := len(parts) - 1
-		return ok && parts[last] == e.Name && e.OptionalChain == js_ast.OptionalChainNone && p.isDotDefineMatch(e.Target, parts[:last])
+		return ok && parts[last] == e.Name && e.OptionalChain == js_ast.OptionalChainNone && p.isDotDefineMatch(e.Target, parts[:last], allowImports)
 	}
 
 	// The last expression must be an identifier
@@ -8912,7 +9085,36 @@ func (p *parser) isDotDefineMatch(expr js_ast.Expr, parts []string) bool {
 	}
 
 	// The last symbol must be unbound
-	return p.symbols[result.ref.InnerIndex].Kind == js_ast.SymbolUnbound
+	kind := p.symbols[result.ref.InnerIndex].Kind
+	return kind == js_ast.SymbolUnbound || (allowImports && kind == js_ast.SymbolImport)
+}
+
+// Returns true if this define only marks calls as pure. Such defines may also
+// apply to imported symbols because they don't substitute anything.
+func isPureCallDefine(data config.DefineData) bool {
+	return data.DefineFunc == nil && !data.CanBeRemovedIfUnused && !data.WarnAboutLackOfDefine && data.CallCanBeUnwrappedIfUnused
+}
+
+// The element is kept as-is for a later tool to transform, so only its parts
+// are visited. The factory is still referenced to keep an import of it alive.
+func (p *parser) visitPreservedJSXElement(loc logger.Loc, e *js_ast.EJSXElement) js_ast.Expr {
+	if e.Tag == nil {
+		p.findSymbol(loc, p.options.jsx.Fragment[0])
+	} else {
+		*e.Tag = p.visitExpr(*e.Tag)
+	}
+	p.findSymbol(loc, p.options.jsx.Factory[0])
+
+	for i, property := range e.Properties {
+		if property.Value != nil {
+			*property.Value = p.visitExpr(*property.Value)
+		}
+		e.Properties[i] = property
+	}
+	for i, child := range e.Children {
+		e.Children[i] = p.visitExpr(child)
+	}
+	return js_ast.Expr{Loc: loc, Data: e}
 }
 
 func (p *parser) jsxStringsToMemberExpression(loc logger.Loc, parts []string) js_ast.Expr {
@@ -8930,6 +9132,7 @@ func (p *parser) jsxStringsToMemberExpression(loc logger.Loc, parts []string) js
 
 			// Substitute user-specified defines
 			if define.Data.DefineFunc != nil {
+				p.recordDefineUse(strings.Join(define.Parts, "."))
 				return p.valueForDefine(loc, js_ast.AssignTargetNone, false, define.Data.DefineFunc)
 			}
 		}
@@ -8991,7 +9194,7 @@ func (p *parser) warnAboutTypeofAndString(a js_ast.Expr, b js_ast.Expr) {
 				// https://github.com/olifolkerd/tabulator/issues/2962
 				if !p.options.suppressWarningsAboutWeirdCode {
 					r := p.source.RangeOfString(b.Loc)
-					p.log.AddRangeWarning(&p.source, r, fmt.Sprintf("The \"typeof\" operator will never evaluate to %q", value))
+					p.log.AddRangeWarningWithID(logger.MsgIDImpossibleTypeof, &p.source, r, fmt.Sprintf("The \"typeof\" operator will never evaluate to %q", value))
 				}
 			}
 		}
@@ -9039,7 +9242,7 @@ func (p *parser) warnAboutEqualityCheck(op string, value js_ast.Expr, afterOpLoc
 			if op == "case" {
 				text = "Comparison with -0 using a case clause will also match 0"
 			}
-			p.log.AddRangeWarning(&p.source, r, text)
+			p.log.AddRangeWarningWithID(logger.MsgIDEqualsNegativeZero, &p.source, r, text)
 			return true
 		}
 
@@ -9049,7 +9252,7 @@ func (p *parser) warnAboutEqualityCheck(op string, value js_ast.Expr, afterOpLoc
 			if op == "case" {
 				text = "This case clause will never be evaluated because equality with NaN is always false"
 			}
-			p.log.AddRangeWarning(&p.source, p.source.RangeOfOperatorBefore(afterOpLoc, op), text)
+			p.log.AddRangeWarningWithID(logger.MsgIDEqualsNaN, &p.source, p.source.RangeOfOperatorBefore(afterOpLoc, op), text)
 			return true
 		}
 
@@ -9064,7 +9267,7 @@ func (p *parser) warnAboutEqualityCheck(op string, value js_ast.Expr, afterOpLoc
 			if op == "case" {
 				text = "This case clause will never be evaluated because the comparison is always false"
 			}
-			p.log.AddRangeWarning(&p.source, p.source.RangeOfOperatorBefore(afterOpLoc, op), text)
+			p.log.AddRangeWarningWithID(logger.MsgIDEqualsNewObject, &p.source, p.source.RangeOfOperatorBefore(afterOpLoc, op), text)
 			return true
 		}
 	}
@@ -9355,6 +9558,10 @@ type exprOut struct {
 	// with an IsOptionalChain value of true)
 	childContainsOptionalChain bool
 
+	// True if the child node was a call that has been removed because of the
+	// "drop" setting. A statement consisting of only this call can be removed.
+	wasDroppedCall bool
+
 	// If our parent is an ECall node with an OptionalChain value of
 	// OptionalChainContinue, then we may need to return the value for "this"
 	// from this node or one of this node's children so that the parent that is
@@ -9578,19 +9785,22 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			if p.options.mode == config.ModeBundle {
 				p.log.AddRangeErrorWithNotes(&p.source, r, fmt.Sprintf("Cannot assign to %q because it is a constant", name), notes)
 			} else {
-				p.log.AddRangeWarningWithNotes(&p.source, r, fmt.Sprintf("This assignment will throw because %q is a constant", name), notes)
+				p.log.AddRangeWarningWithIDAndNotes(logger.MsgIDAssignToConstant, &p.source, r, fmt.Sprintf("This assignment will throw because %q is a constant", name), notes)
 			}
 		}
 
-		// Substitute user-specified defines for unbound symbols
-		if p.symbols[e.Ref.InnerIndex].Kind == js_ast.SymbolUnbound && !result.isInsideWithScope && e != p.deleteTarget {
-			if data, ok := p.options.defines.IdentifierDefines[name]; ok {
+		// Substitute user-specified defines for unbound symbols. Imported symbols
+		// can only be marked as pure since they don't refer to globals.
+		kind := p.symbols[e.Ref.InnerIndex].Kind
+		if (kind == js_ast.SymbolUnbound || kind == js_ast.SymbolImport) && !result.isInsideWithScope && e != p.deleteTarget {
+			if data, ok := p.options.defines.IdentifierDefines[name]; ok && (kind == js_ast.SymbolUnbound || isPureCallDefine(data)) {
 				if data.DefineFunc != nil {
 					new := p.valueForDefine(expr.Loc, in.assignTarget, isDeleteTarget, data.DefineFunc)
 
 					// Don't substitute an identifier for a non-identifier if this is an
 					// assignment target, since it'll cause a syntax error
 					if _, ok := new.Data.(*js_ast.EIdentifier); in.assignTarget == js_ast.AssignTargetNone || ok {
+						p.recordDefineUse(name)
 						return new, exprOut{}
 					}
 				}
@@ -9615,6 +9825,10 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 		panic("Internal error")
 
 	case *js_ast.EJSXElement:
+		if p.options.jsx.Preserve {
+			return p.visitPreservedJSXElement(expr.Loc, e), exprOut{}
+		}
+
 		// A missing tag is a fragment
 		tag := e.Tag
 		if tag == nil {
@@ -9881,7 +10095,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 				}
 			}
 
-			if p.options.unsupportedJSFeatures.Has(compat.NullishCoalescing) {
+			if p.shouldLower(compat.NullishCoalescing) {
 				return p.lowerNullishCoalescing(expr.Loc, e.Left, e.Right), exprOut{}
 			}
 
@@ -10000,7 +10214,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			}
 
 			// Lower the exponentiation operator for browsers that don't support it
-			if p.options.unsupportedJSFeatures.Has(compat.ExponentOperator) {
+			if p.shouldLower(compat.ExponentOperator) {
 				return p.callRuntime(expr.Loc, "__pow", []js_ast.Expr{e.Left, e.Right}), exprOut{}
 			}
 
@@ -10055,6 +10269,8 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 				e.Right = p.maybeKeepExprSymbolName(e.Right, p.symbols[id.Ref.InnerIndex].OriginalName, wasAnonymousNamedExpr)
 			}
 
+			p.checkForNonObjectModuleExports(e.Left, e.Right)
+
 			if target, loc, private := p.extractPrivateIndex(e.Left); private != nil {
 				return p.lowerPrivateSet(target, loc, private, e.Right), exprOut{}
 			}
@@ -10096,7 +10312,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 
 		case js_ast.BinOpPowAssign:
 			// Lower the exponentiation operator for browsers that don't support it
-			if p.options.unsupportedJSFeatures.Has(compat.ExponentOperator) {
+			if p.shouldLower(compat.ExponentOperator) {
 				return p.lowerExponentiationAssignmentOperator(expr.Loc, e), exprOut{}
 			}
 
@@ -10135,17 +10351,17 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			}
 
 		case js_ast.BinOpNullishCoalescingAssign:
-			if p.options.unsupportedJSFeatures.Has(compat.LogicalAssignment) {
+			if p.shouldLower(compat.LogicalAssignment) {
 				return p.lowerNullishCoalescingAssignmentOperator(expr.Loc, e), exprOut{}
 			}
 
 		case js_ast.BinOpLogicalAndAssign:
-			if p.options.unsupportedJSFeatures.Has(compat.LogicalAssignment) {
+			if p.shouldLower(compat.LogicalAssignment) {
 				return p.lowerLogicalAssignmentOperator(expr.Loc, e, js_ast.BinOpLogicalAnd), exprOut{}
 			}
 
 		case js_ast.BinOpLogicalOrAssign:
-			if p.options.unsupportedJSFeatures.Has(compat.LogicalAssignment) {
+			if p.shouldLower(compat.LogicalAssignment) {
 				return p.lowerLogicalAssignmentOperator(expr.Loc, e, js_ast.BinOpLogicalOr), exprOut{}
 			}
 		}
@@ -10211,6 +10427,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			if p.options.unsupportedJSFeatures.Has(kind.Feature()) && e.OptionalChain == js_ast.OptionalChainNone &&
 				in.assignTarget == js_ast.AssignTargetNone && !isCallTarget {
 				// "foo.#bar" => "__privateGet(foo, #bar)"
+				p.loweredFeatures |= kind.Feature()
 				return p.lowerPrivateGet(e.Target, e.Index.Loc, private), exprOut{}
 			}
 		} else {
@@ -10436,9 +10653,10 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 		// Check both user-specified defines and known globals
 		if defines, ok := p.options.defines.DotDefines[e.Name]; ok {
 			for _, define := range defines {
-				if p.isDotDefineMatch(expr, define.Parts) {
+				if p.isDotDefineMatch(expr, define.Parts, isPureCallDefine(define.Data)) {
 					// Substitute user-specified defines
 					if define.Data.DefineFunc != nil {
+						p.recordDefineUse(strings.Join(define.Parts, "."))
 						return p.valueForDefine(expr.Loc, in.assignTarget, isDeleteTarget, define.Data.DefineFunc), exprOut{}
 					}
 
@@ -10470,6 +10688,11 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 		})
 		e.Target = target
 
+		// Remember the runtime APIs that need to be polyfilled
+		if p.options.polyfills {
+			p.recordPolyfillUse(e.Target, e.Name)
+		}
+
 		// Lower "super.prop" if necessary
 		if !isCallTarget && p.shouldLowerSuperPropertyAccess(e.Target) {
 			key := js_ast.Expr{Loc: e.NameLoc, Data: &js_ast.EString{Value: js_lexer.StringToUTF16(e.Name)}}
@@ -10493,6 +10716,10 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			out.thisArgWrapFunc = nil
 		}
 		if value, ok := p.maybeRewritePropertyAccess(expr.Loc, in.assignTarget, isDeleteTarget, e.OptionalChain, e.Target, e.Name, e.NameLoc, isCallTarget); ok {
+			// Keep the call side effect flag if this became an import item
+			if id, ok := value.Data.(*js_ast.EImportIdentifier); ok && e.CallCanBeUnwrappedIfUnused {
+				id.CallCanBeUnwrappedIfUnused = true
+			}
 			return value, out
 		}
 		return js_ast.Expr{Loc: expr.Loc, Data: e}, out
@@ -10657,7 +10884,13 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			}
 
 			if property.Value != nil {
+				wasAnonymousNamedExpr := in.assignTarget == js_ast.AssignTargetNone && !property.IsMethod && p.isAnonymousNamedExpr(*property.Value)
 				*property.Value, _ = p.visitExprInOut(*property.Value, exprIn{assignTarget: in.assignTarget})
+
+				// Optionally preserve the name inferred from the property key
+				if str, ok := property.Key.Data.(*js_ast.EString); ok {
+					*property.Value = p.maybeKeepExprSymbolName(*property.Value, js_lexer.UTF16ToString(str.Value), wasAnonymousNamedExpr)
+				}
 			}
 			if property.Initializer != nil {
 				wasAnonymousNamedExpr := p.isAnonymousNamedExpr(*property.Initializer)
@@ -10704,7 +10937,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 								nextKey.kind = keyGetAndSet
 							} else {
 								r := js_lexer.RangeOfIdentifier(p.source, property.Key.Loc)
-								p.log.AddRangeWarningWithNotes(&p.source, r, fmt.Sprintf("Duplicate key %q in object literal", key),
+								p.log.AddRangeWarningWithIDAndNotes(logger.MsgIDDuplicateObjectKey, &p.source, r, fmt.Sprintf("Duplicate key %q in object literal", key),
 									[]logger.MsgData{logger.RangeData(&p.source, js_lexer.RangeOfIdentifier(p.source, prevKey.loc),
 										fmt.Sprintf("The original %q is here", key))})
 							}
@@ -10788,7 +11021,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 						text += " (surround with a try/catch to silence this warning)"
 					}
 					r := js_lexer.RangeOfIdentifier(p.source, expr.Loc)
-					p.log.AddRangeWarning(&p.source, r, text)
+					p.log.AddRangeWarningWithID(logger.MsgIDUnsupportedDynamicImport, &p.source, r, text)
 				}
 			}
 
@@ -10807,6 +11040,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			// this case here instead of in the printer because both the printer
 			// and the linker currently need an import record to handle this case
 			// correctly, and you need a string literal to get an import record.
+			p.dependsOnOutputFormat = true
 			if !p.options.outputFormat.KeepES6ImportExportSyntax() {
 				var then js_ast.Expr
 				value := p.callRuntime(arg.Loc, "__toModule", []js_ast.Expr{{Loc: arg.Loc, Data: &js_ast.ECall{
@@ -10863,6 +11097,15 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			storeThisArgForParentOptionalChain: e.OptionalChain == js_ast.OptionalChainStart,
 		})
 		e.Target = target
+
+		// Remove calls to "console" methods if requested. The arguments are still
+		// visited, but as dead code, so that they don't keep anything alive.
+		oldIsControlFlowDead := p.isControlFlowDead
+		mustBeDropped := p.isDroppedConsoleCall(e.Target)
+		if mustBeDropped {
+			p.isControlFlowDead = true
+		}
+
 		hasSpread := false
 		for i, arg := range e.Args {
 			arg = p.visitExpr(arg)
@@ -10872,6 +11115,18 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			e.Args[i] = arg
 		}
 
+		if mustBeDropped {
+			p.isControlFlowDead = oldIsControlFlowDead
+			return js_ast.Expr{Loc: expr.Loc, Data: &js_ast.EUndefined{}}, exprOut{wasDroppedCall: true}
+		}
+
+		// Recognize "Object.defineProperty(exports, '__esModule', ...)"
+		if len(e.Args) >= 2 {
+			if str, ok := e.Args[1].Data.(*js_ast.EString); ok && js_lexer.UTF16EqualsString(str.Value, "__esModule") {
+				p.hasESModuleMarker = true
+			}
+		}
+
 		// Warn about calling an import namespace
 		if p.options.outputFormat != config.FormatPreserve {
 			if id, ok := e.Target.Data.(*js_ast.EIdentifier); ok && p.importItemsForNamespace[id.Ref] != nil {
@@ -10965,6 +11220,10 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			if t.CallCanBeUnwrappedIfUnused {
 				e.CanBeUnwrappedIfUnused = true
 			}
+		case *js_ast.EImportIdentifier:
+			if t.CallCanBeUnwrappedIfUnused {
+				e.CanBeUnwrappedIfUnused = true
+			}
 		case *js_ast.EDot:
 			if t.CallCanBeUnwrappedIfUnused {
 				e.CanBeUnwrappedIfUnused = true
@@ -11231,7 +11490,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 		p.fnOrArrowDataVisit = oldFnOrArrowData
 
 		// Convert arrow functions to function expressions when lowering
-		if p.options.unsupportedJSFeatures.Has(compat.Arrow) {
+		if p.shouldLower(compat.Arrow) {
 			return js_ast.Expr{Loc: expr.Loc, Data: &js_ast.EFunction{Fn: js_ast.Fn{
 				Args:         e.Args,
 				Body:         e.Body,
@@ -11269,17 +11528,33 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 }
 
 func (p *parser) createModuleName(sourcePath string) (string, bool) {
+	return createModuleName(&p.options.amd, p.source.KeyPath.Text, sourcePath, false)
+}
+
+// Modules imported by a relative path from a mapped module are named by the
+// path of the importer. Remembering such names affects the names of other
+// files, so it is done only after all files have been scanned.
+func createModuleName(amd *config.AMDOptions, parentPath string, sourcePath string, rememberNames bool) (string, bool) {
 	// The generated name of the module has to be unique in the whole bundle.
 	if strings.HasPrefix(sourcePath, "./") || strings.HasPrefix(sourcePath, "../") {
 		// If the module p[ath is relative, make it relative to the project base.
 		// Distinct files have naturally unique paths.
-		parentPath := p.source.KeyPath.Text
-		aliasPath := p.options.amd.ModulePathToName(parentPath)
+		aliasPath := amd.ModulePathToName(parentPath)
 		if aliasPath != "" {
+			targetPath := localFS.Join(localFS.Dir(parentPath), sourcePath)
+			if !amd.HasKnownFileExtension(targetPath) {
+				targetPath += ".js"
+			}
 			sourcePath = localFS.Join(localFS.Dir(aliasPath), sourcePath)
+			if rememberNames {
+				// The module may have been named by another importer already
+				amd.SetModulePathName(targetPath, sourcePath)
+				return amd.ModulePathToName(targetPath), true
+			}
+			return sourcePath, true
 		} else {
 			sourcePath = localFS.Join(localFS.Dir(parentPath), sourcePath)
-			if !p.options.amd.HasKnownFileExtension(sourcePath) {
+			if !amd.HasKnownFileExtension(sourcePath) {
 				sourcePath += ".js"
 			}
 		}
@@ -11287,7 +11562,7 @@ func (p *parser) createModuleName(sourcePath string) (string, bool) {
 	if localFS.IsAbs(sourcePath) {
 		// If the module path is not relative, check if it is mapped to "empty:",
 		// which means an external module not to be resolved and bundled.
-		aliasPath := p.options.amd.ModulePathToName(sourcePath)
+		aliasPath := amd.ModulePathToName(sourcePath)
 		if aliasPath != "" {
 			return aliasPath, true
 		}
@@ -11296,52 +11571,120 @@ func (p *parser) createModuleName(sourcePath string) (string, bool) {
 		}
 		// If the module path is absolute, the module name should be inferred
 		// from other modules' dependencies, or be relative to the project base.
-		if relativePath, ok := localFS.Rel(p.options.amd.BaseUrl, sourcePath); ok {
-			sourcePath = relativePath
+		if relativePath, ok := localFS.Rel(amd.BaseUrl, sourcePath); ok {
+			return amd.PrefixModuleName(relativePath), true
 		}
-	} else if p.options.amd.UsesPlugin(sourcePath) {
-		if pluginPrefix, targetModule, ok := p.options.amd.ParsePluginExpression(sourcePath); ok {
-			moduleName, resolve := p.createModuleName(targetModule)
+		return sourcePath, true
+	} else if amd.UsesPlugin(sourcePath) {
+		if pluginPrefix, targetModule, ok := amd.ParsePluginExpression(sourcePath); ok {
+			moduleName, resolve := createModuleName(amd, parentPath, targetModule, rememberNames)
 			return pluginPrefix + "!" + moduleName, resolve
 		}
 		return sourcePath, false
-	} else if p.options.amd.IsSpecialModule(sourcePath) || p.options.amd.IsExternalModule(sourcePath) {
+	} else if amd.IsSpecialModule(sourcePath) || amd.IsExternalModule(sourcePath) {
 		// If the module path is not relative, check if it is mapped to "empty:",
 		// which means an external module not to be resolved and bundled.
 		return sourcePath, false
 	}
 	// If the module path is not relative, it has to be either mapped to
 	// or be relative to the project root, which is unique as stated above.
+	if !amd.IsMappedModule(sourcePath, parentPath) {
+		sourcePath = amd.PrefixModuleName(sourcePath)
+	}
 	return sourcePath, true
 }
 
+// The names of the dependencies of all files have to be assigned before the
+// names of the modules in their "define" calls, because a module has to be
+// defined with the same name that its dependents use.
+func AssignAMDDependencyNames(amd *config.AMDOptions, parentPath string, names []js_ast.AMDModuleName) {
+	for _, name := range names {
+		if !name.IsDefine {
+			moduleName, _ := createModuleName(amd, parentPath, name.Path, true)
+			if amd.UsesPlugin(name.Path) {
+				amd.PluginExpressionToModulePath(name.Path, moduleName, parentPath)
+			}
+			name.Value.Value = js_lexer.StringToUTF16(moduleName)
+		}
+	}
+}
+
+func AssignAMDDefineNames(amd *config.AMDOptions, names []js_ast.AMDModuleName) {
+	for _, name := range names {
+		if name.IsDefine {
+			moduleName := amd.ModulePathToPluginExpression(name.Path)
+			if moduleName == "" {
+				moduleName, _ = createModuleName(amd, "", name.Path, true)
+			}
+			name.Value.Value = js_lexer.StringToUTF16(moduleName)
+		}
+	}
+}
+
 func (p *parser) assignModuleName(e *js_ast.ECall) {
 	moduleName := p.options.amd.ModulePathToPluginExpression(p.source.KeyPath.Text)
 	if moduleName == "" {
 		moduleName, _ = p.createModuleName(p.source.KeyPath.Text)
 	}
-	e.Args = append([]js_ast.Expr{
-		{Data: &js_ast.EString{Value: js_lexer.StringToUTF16(moduleName)}},
-	}, e.Args...)
+	value := &js_ast.EString{Value: js_lexer.StringToUTF16(moduleName)}
+	p.amdModuleNames = append(p.amdModuleNames, js_ast.AMDModuleName{Value: value, Path: p.source.KeyPath.Text, IsDefine: true})
+	e.Args = append([]js_ast.Expr{{Data: value}}, e.Args...)
 }
 
 func (p *parser) convertModulePathToName(module *js_ast.Expr) {
 	dependency := module.Data.(*js_ast.EString)
 	modulePath := js_lexer.UTF16ToString(dependency.Value)
 	moduleName, resolve := p.createModuleName(modulePath)
-	module.Data = &js_ast.EString{Value: js_lexer.StringToUTF16(moduleName)}
+	value := &js_ast.EString{Value: js_lexer.StringToUTF16(moduleName)}
+	module.Data = value
 	if resolve {
+		p.amdModuleNames = append(p.amdModuleNames, js_ast.AMDModuleName{Value: value, Path: modulePath})
+		originalPath := ""
 		if p.options.amd.UsesPlugin(modulePath) {
+			originalPath = modulePath
 			modulePath = p.options.amd.PluginExpressionToModulePath(modulePath, moduleName, p.source.KeyPath.Text)
 		}
 		importRecordIndex := p.addImportRecord(ast.ImportRequire, module.Loc, modulePath)
 		p.importRecords[importRecordIndex].IsInsideTryBody = false
+		p.importRecords[importRecordIndex].OriginalPath = originalPath
 		p.importRecordsForCurrentPart = append(p.importRecordsForCurrentPart, importRecordIndex)
 	} else if !p.options.amd.IsSpecialModule(modulePath) {
 		p.addExternalImportRecord(ast.ImportRequire, module.Loc, modulePath)
 	}
 }
 
+// This generates "define([deps], {})" to be visited
+func (p *parser) generateShimDefine(shim config.AMDShim) *js_ast.ECall {
+	deps := make([]js_ast.Expr, len(shim.Deps))
+	for i, dep := range shim.Deps {
+		deps[i] = js_ast.Expr{Data: &js_ast.EString{Value: js_lexer.StringToUTF16(dep)}}
+	}
+	return &js_ast.ECall{
+		Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: p.storeNameInRef("define")}},
+		Args: []js_ast.Expr{
+			{Data: &js_ast.EArray{Items: deps}},
+			{Data: &js_ast.EObject{}},
+		},
+	}
+}
+
+// The module factory returns the global variable with the dotted name in
+// "exports", which has been assigned by the script, or nothing without
+// "exports". The value can't be passed to "define" directly, because a
+// function would be called as the factory instead of being the module value.
+func (p *parser) shimFactory(shim config.AMDShim) js_ast.Expr {
+	var stmts []js_ast.Stmt
+	if shim.Exports != "" {
+		names := strings.Split(shim.Exports, ".")
+		value := js_ast.Expr{Data: &js_ast.EIdentifier{Ref: p.findSymbol(logger.Loc{}, names[0]).ref}}
+		for _, name := range names[1:] {
+			value = js_ast.Expr{Data: &js_ast.EDot{Target: value, Name: name}}
+		}
+		stmts = []js_ast.Stmt{{Data: &js_ast.SReturn{Value: &value}}}
+	}
+	return js_ast.Expr{Data: &js_ast.EFunction{Fn: js_ast.Fn{Body: js_ast.FnBody{Stmts: stmts}}}}
+}
+
 func (p *parser) convertModulePathsToNames(dependencies *js_ast.EArray) {
 	if dependencies != nil {
 		for index, item := range dependencies.Items {
@@ -11351,11 +11694,38 @@ func (p *parser) convertModulePathsToNames(dependencies *js_ast.EArray) {
 	}
 }
 
+// This counts substitutions so unused defines can be reported in the metafile
+func (p *parser) recordDefineUse(key string) {
+	if p.defineUses == nil {
+		p.defineUses = make(map[string]uint32)
+	}
+	p.defineUses[key]++
+}
+
+// Property accesses on unbound globals like "Object.assign" are looked up in
+// the polyfills, which are needed by the target
+func (p *parser) recordPolyfillUse(target js_ast.Expr, name string) {
+	id, ok := target.Data.(*js_ast.EIdentifier)
+	if !ok {
+		return
+	}
+	symbol := &p.symbols[id.Ref.InnerIndex]
+	if symbol.Kind != js_ast.SymbolUnbound {
+		return
+	}
+	key := symbol.OriginalName + "." + name
+	if polyfill, ok := runtime.Polyfills[key]; ok && p.options.unsupportedJSFeatures.Has(polyfill.Feature) {
+		if p.polyfillUses == nil {
+			p.polyfillUses = make(map[string]bool)
+		}
+		p.polyfillUses[key] = true
+	}
+}
+
 func (p *parser) valueForDefine(loc logger.Loc, assignTarget js_ast.AssignTarget, isDeleteTarget bool, defineFunc config.DefineFunc) js_ast.Expr {
 	expr := js_ast.Expr{Loc: loc, Data: defineFunc(config.DefineArgs{
-		Loc:             loc,
-		FindSymbol:      p.findSymbolHelper,
-		SymbolForDefine: p.symbolForDefineHelper,
+		Loc:        loc,
+		FindSymbol: p.findSymbolHelper,
 	})}
 	if id, ok := expr.Data.(*js_ast.EIdentifier); ok {
 		return p.handleIdentifier(loc, assignTarget, isDeleteTarget, id)
@@ -11390,7 +11760,7 @@ func (p *parser) handleIdentifier(loc logger.Loc, assignTarget js_ast.AssignTarg
 
 	// Substitute an EImportIdentifier now if this is an import item
 	if p.isImportItem[ref] {
-		return js_ast.Expr{Loc: loc, Data: &js_ast.EImportIdentifier{Ref: ref}}
+		return js_ast.Expr{Loc: loc, Data: &js_ast.EImportIdentifier{Ref: ref, CallCanBeUnwrappedIfUnused: e.CallCanBeUnwrappedIfUnused}}
 	}
 
 	// Substitute a namespace export reference now if appropriate
@@ -11677,6 +12047,10 @@ func (p *parser) scanForImportsAndExports(stmts []js_ast.Stmt) (result scanForIm
 					// for injected files and we definitely do not want to trim these.
 					if record := &p.importRecords[s.ImportRecordIndex]; record.SourceIndex == nil {
 						record.IsUnused = true
+						if p.options.reportTypeElision {
+							p.log.AddRangeInfo(&p.source, record.Range, fmt.Sprintf(
+								"Removed the import of %q because none of its imports are used as values", record.Path.Text))
+						}
 						continue
 					}
 				}
@@ -12481,12 +12855,6 @@ func newParser(log logger.Log, source logger.Source, lexer js_lexer.Lexer, optio
 		return p.findSymbol(loc, name).ref
 	}
 
-	p.symbolForDefineHelper = func(index int) js_ast.Ref {
-		ref := p.injectedDefineSymbols[index]
-		p.recordUsage(ref)
-		return ref
-	}
-
 	p.pushScopeForParsePass(js_ast.ScopeEntry, logger.Loc{Start: locModuleScope})
 
 	return p
@@ -12519,7 +12887,13 @@ func Parse(log logger.Log, source logger.Source, options Options) (result js_ast
 		options.useDefineForClassFields = true
 	}
 
-	p := newParser(log, source, js_lexer.NewLexer(log, source), &options)
+	var lexer js_lexer.Lexer
+	if options.comments == config.CommentsAll {
+		lexer = js_lexer.NewLexerPreservingComments(log, source)
+	} else {
+		lexer = js_lexer.NewLexer(log, source)
+	}
+	p := newParser(log, source, lexer, &options)
 
 	// Consume a leading hashbang comment
 	hashbang := ""
@@ -12536,13 +12910,36 @@ func Parse(log logger.Log, source logger.Source, options Options) (result js_ast
 	stmts := p.parseStmtsUpTo(js_lexer.TEndOfFile, parseStmtOpts{isModuleScope: true})
 	p.prepareForVisitPass()
 
-	// Strip off a leading "use strict" directive when not bundling
-	directive := ""
-	if p.options.mode != config.ModeBundle && len(stmts) > 0 {
-		if s, ok := stmts[0].Data.(*js_ast.SDirective); ok {
-			directive = js_lexer.UTF16ToString(s.Value)
+	// Strip off the leading directives when not bundling. When bundling, only
+	// strip off "use client" and "use server" directives since the linker moves
+	// them to the top of the output chunk.
+	var directives []string
+	if p.options.mode != config.ModeBundle {
+		for len(stmts) > 0 {
+			s, ok := stmts[0].Data.(*js_ast.SDirective)
+			if !ok {
+				break
+			}
+			directives = append(directives, js_lexer.UTF16ToString(s.Value))
 			stmts = stmts[1:]
 		}
+	} else {
+		prologue := make([]js_ast.Stmt, 0, len(stmts))
+		for i, stmt := range stmts {
+			if _, ok := stmt.Data.(*js_ast.SComment); !ok {
+				s, ok := stmt.Data.(*js_ast.SDirective)
+				if !ok {
+					prologue = append(prologue, stmts[i:]...)
+					break
+				}
+				if text := js_lexer.UTF16ToString(s.Value); js_ast.IsComponentDirective(text) {
+					directives = append(directives, text)
+					continue
+				}
+			}
+			prologue = append(prologue, stmt)
+		}
+		stmts = prologue
 	}
 
 	// Insert a variable for "import.meta" at the top of the file if it was used.
@@ -12568,20 +12965,12 @@ func Parse(log logger.Log, source logger.Source, options Options) (result js_ast
 	for _, file := range p.options.injectedFiles {
 		exportsNoConflict := make([]string, 0, len(file.Exports))
 		symbols := make(map[string]js_ast.Ref)
-		if file.IsDefine {
-			ref := p.newSymbol(js_ast.SymbolOther, js_ast.GenerateNonUniqueNameFromPath(file.Path))
-			p.moduleScope.Generated = append(p.moduleScope.Generated, ref)
-			symbols["default"] = ref
-			exportsNoConflict = append(exportsNoConflict, "default")
-			p.injectedDefineSymbols = append(p.injectedDefineSymbols, ref)
-		} else {
-			for _, alias := range file.Exports {
-				if _, ok := p.moduleScope.Members[alias]; !ok {
-					ref := p.newSymbol(js_ast.SymbolOther, alias)
-					p.moduleScope.Members[alias] = js_ast.ScopeMember{Ref: ref}
-					symbols[alias] = ref
-					exportsNoConflict = append(exportsNoConflict, alias)
-				}
+		for _, alias := range file.Exports {
+			if _, ok := p.moduleScope.Members[alias]; !ok {
+				ref := p.newSymbol(js_ast.SymbolOther, alias)
+				p.moduleScope.Members[alias] = js_ast.ScopeMember{Ref: ref}
+				symbols[alias] = ref
+				exportsNoConflict = append(exportsNoConflict, alias)
 			}
 		}
 		before = p.generateImportStmt(file.Path, exportsNoConflict, file.SourceIndex, before, symbols)
@@ -12624,11 +13013,30 @@ func Parse(log logger.Log, source logger.Source, options Options) (result js_ast
 		}
 	}
 
+	// A non-AMD script configured by "shim" is defined as a module after it
+	// runs. The generated "define" call is visited like the ones in the source,
+	// so the dependencies are bundled before the script and the module gets
+	// its name. The placeholder of the factory is replaced afterwards, because
+	// a generated function would lack the scope from the parse pass.
+	if p.options.amd.Parse && p.options.mode == config.ModeBundle && !p.isAMD {
+		if shim, ok := p.options.amd.ShimForModulePath(source.KeyPath.Text); ok {
+			call := p.generateShimDefine(shim)
+			parts = p.appendPart(parts, []js_ast.Stmt{{Data: &js_ast.SExpr{Value: js_ast.Expr{Data: call}}}})
+			call.Args[len(call.Args)-1] = p.shimFactory(shim)
+
+			// The dependencies have to run before the whole script, not just
+			// before the "define" call at its end
+			if len(parts) > 1 {
+				parts[0].ImportRecordIndices = append(parts[0].ImportRecordIndices, parts[len(parts)-1].ImportRecordIndices...)
+			}
+		}
+	}
+
 	// Pop the module scope to apply the "ContainsDirectEval" rules
 	p.popScope()
 
 	parts = append(append(before, parts...), after...)
-	result = p.toAST(source, parts, hashbang, directive)
+	result = p.toAST(source, parts, hashbang, directives)
 	result.SourceMapComment = p.lexer.SourceMappingURL
 	return
 }
@@ -12659,6 +13067,7 @@ func LazyExportAST(log logger.Log, source logger.Source, options Options, expr j
 		moduleName = options.amd.ModulePathToName(modulePath)
 		if moduleName == "" {
 			moduleName, _ = localFS.Rel(options.amd.BaseUrl, modulePath)
+			moduleName = options.amd.PrefixModuleName(moduleName)
 		}
 		export := expr
 		if strings.HasSuffix(moduleName, ".json") {
@@ -12676,12 +13085,11 @@ func LazyExportAST(log logger.Log, source logger.Source, options Options, expr j
 		if pluginName != "" {
 			moduleName = pluginName
 		}
+		value := &js_ast.EString{Value: js_lexer.StringToUTF16(moduleName)}
+		p.amdModuleNames = append(p.amdModuleNames, js_ast.AMDModuleName{Value: value, Path: modulePath, IsDefine: true})
 		defineCall := js_ast.Expr{Data: &js_ast.ECall{
 			Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: p.defineRef}},
-			Args: []js_ast.Expr{
-				{Data: &js_ast.EString{Value: js_lexer.StringToUTF16(moduleName)}},
-				export,
-			},
+			Args:   []js_ast.Expr{{Data: value}, export},
 		}}
 		stmts = []js_ast.Stmt{{Loc: expr.Loc, Data: &js_ast.SExpr{Value: defineCall}}}
 	}
@@ -12700,7 +13108,7 @@ func LazyExportAST(log logger.Log, source logger.Source, options Options, expr j
 	}
 	p.symbolUses = nil
 
-	ast := p.toAST(source, []js_ast.Part{part}, "", "")
+	ast := p.toAST(source, []js_ast.Part{part}, "", nil)
 	ast.HasLazyExport = hasLazyExport
 	return ast
 }
@@ -12750,6 +13158,9 @@ func (p *parser) prepareForVisitPass() {
 	}
 
 	// Convert "import.meta" to a variable if it's not supported in the output format
+	if p.hasImportMeta && p.options.mode != config.ModePassThrough {
+		p.dependsOnOutputFormat = true
+	}
 	if p.hasImportMeta && (p.options.unsupportedJSFeatures.Has(compat.ImportMeta) ||
 		(p.options.mode != config.ModePassThrough && !p.options.outputFormat.KeepES6ImportExportSyntax())) {
 		p.importMetaRef = p.newSymbol(js_ast.SymbolOther, "import_meta")
@@ -12767,6 +13178,16 @@ func (p *parser) prepareForVisitPass() {
 			p.options.jsx.Fragment = value
 		}
 	}
+
+	// Handle the "@esbuild-keep-names" pragma, which lets hot code opt out of
+	// the extra calls that preserve the names of functions and classes
+	if span := p.lexer.KeepNamesPragmaComment; span.Text != "" {
+		if span.Text == "off" {
+			p.options.keepNames = false
+		} else {
+			p.log.AddRangeWarning(&p.source, span.Range, fmt.Sprintf("Invalid keep names pragma: %s (valid: off)", span.Text))
+		}
+	}
 }
 
 func (p *parser) declareCommonJSSymbol(kind js_ast.SymbolKind, name string) js_ast.Ref {
@@ -12896,7 +13317,7 @@ func (p *parser) generateImportStmt(
 	})
 }
 
-func (p *parser) toAST(source logger.Source, parts []js_ast.Part, hashbang string, directive string) js_ast.AST {
+func (p *parser) toAST(source logger.Source, parts []js_ast.Part, hashbang string, directives []string) js_ast.AST {
 	// Insert an import statement for any runtime imports we generated
 	if len(p.runtimeImports) > 0 && !p.options.omitRuntimeForTests {
 		// Sort the imports for determinism
@@ -13008,6 +13429,12 @@ func (p *parser) toAST(source logger.Source, parts []js_ast.Part, hashbang strin
 		nestedScopeSlotCounts = renamer.AssignNestedScopeSlots(p.moduleScope, p.symbols)
 	}
 
+	// Modules marked by "__esModule" are not ambiguous
+	nonObjectModuleExports := p.nonObjectModuleExports
+	if p.hasESModuleMarker {
+		nonObjectModuleExports = nil
+	}
+
 	return js_ast.AST{
 		Parts:                   parts,
 		ModuleScope:             p.moduleScope,
@@ -13017,7 +13444,7 @@ func (p *parser) toAST(source logger.Source, parts []js_ast.Part, hashbang strin
 		ModuleRef:               p.moduleRef,
 		WrapperRef:              wrapperRef,
 		Hashbang:                hashbang,
-		Directive:               directive,
+		Directives:              directives,
 		NamedImports:            p.namedImports,
 		NamedExports:            p.namedExports,
 		NestedScopeSlotCounts:   nestedScopeSlotCounts,
@@ -13025,15 +13452,21 @@ func (p *parser) toAST(source logger.Source, parts []js_ast.Part, hashbang strin
 		ExportStarImportRecords: p.exportStarImportRecords,
 		ImportRecords:           p.importRecords,
 		ExternalImportRecords:   p.externalImportRecords,
+		DefineUses:              p.defineUses,
+		PolyfillUses:            p.polyfillUses,
+		LoweredFeatures:         p.loweredFeatures,
+		DependsOnOutputFormat:   p.dependsOnOutputFormat,
 		ApproximateLineCount:    int32(p.lexer.ApproximateNewlineCount) + 1,
 
 		// CommonJS features
-		HasTopLevelReturn: p.hasTopLevelReturn,
-		UsesExportsRef:    p.symbols[p.exportsRef.InnerIndex].UseCountEstimate > 0,
-		UsesModuleRef:     p.symbols[p.moduleRef.InnerIndex].UseCountEstimate > 0,
+		HasTopLevelReturn:      p.hasTopLevelReturn,
+		UsesExportsRef:         p.symbols[p.exportsRef.InnerIndex].UseCountEstimate > 0,
+		UsesModuleRef:          p.symbols[p.moduleRef.InnerIndex].UseCountEstimate > 0,
+		NonObjectModuleExports: nonObjectModuleExports,
 
 		// AMD features
-		IsAMD: p.isAMD,
+		IsAMD:          p.isAMD,
+		AMDModuleNames: p.amdModuleNames,
 
 		// ES6 features
 		HasES6Imports: p.es6ImportKeyword.Len > 0,
@@ -19,7 +19,7 @@ func (p *parser) markSyntaxFeature(feature compat.JSFeature, r logger.Range) (di
 
 	if !p.options.unsupportedJSFeatures.Has(feature) {
 		if feature == compat.TopLevelAwait {
-			if p.options.mode == config.ModeBundle {
+			if p.options.mode == config.ModeBundle && !p.options.allowTopLevelAwait {
 				p.log.AddRangeError(&p.source, r, "Top-level await is currently not supported when bundling")
 				return
 			}
@@ -102,6 +102,7 @@ func (p *parser) markSyntaxFeature(feature compat.JSFeature, r logger.Range) (di
 
 	case compat.ImportMeta:
 		// This can't be polyfilled
+		p.loweredFeatures |= feature
 		p.log.AddRangeWarning(&p.source, r,
 			fmt.Sprintf("\"import.meta\" is not available in %s and will be empty", where))
 		return
@@ -177,9 +178,12 @@ func (p *parser) markStrictModeFeature(feature strictModeFeature, r logger.Range
 		}
 		p.log.AddRangeErrorWithNotes(&p.source, r,
 			fmt.Sprintf("%s cannot be used in strict mode", text), notes)
-	} else if !canBeTransformed && p.isStrictModeOutputFormat() {
-		p.log.AddRangeError(&p.source, r,
-			fmt.Sprintf("%s cannot be used with the \"esm\" output format due to strict mode", text))
+	} else if !canBeTransformed {
+		p.dependsOnOutputFormat = true
+		if p.isStrictModeOutputFormat() {
+			p.log.AddRangeError(&p.source, r,
+				fmt.Sprintf("%s cannot be used with the \"esm\" output format due to strict mode", text))
+		}
 	}
 }
 
@@ -191,8 +195,17 @@ func (p *parser) markLoweredSyntaxFeature(feature compat.JSFeature, r logger.Ran
 	}
 }
 
+// Check if the feature is unsupported and remember that it was lowered
+func (p *parser) shouldLower(feature compat.JSFeature) bool {
+	if p.options.unsupportedJSFeatures.Has(feature) {
+		p.loweredFeatures |= feature
+		return true
+	}
+	return false
+}
+
 func (p *parser) isPrivateUnsupported(private *js_ast.EPrivateIdentifier) bool {
-	return p.options.unsupportedJSFeatures.Has(p.symbols[private.Ref.InnerIndex].Kind.Feature())
+	return p.shouldLower(p.symbols[private.Ref.InnerIndex].Kind.Feature())
 }
 
 func (p *parser) captureThis() js_ast.Ref {
@@ -256,6 +269,7 @@ func (p *parser) lowerFunction(
 		// effect order.
 		for i, arg := range *args {
 			if bindingHasObjectRest(arg.Binding) {
+				p.loweredFeatures |= compat.ObjectRestSpread
 				ref := p.generateTempRef(tempRefNoDeclare, "")
 				target := p.convertBindingToExpr(arg.Binding, nil)
 				init := js_ast.Expr{Loc: arg.Binding.Loc, Data: &js_ast.EIdentifier{Ref: ref}}
@@ -278,7 +292,7 @@ func (p *parser) lowerFunction(
 	}
 
 	// Lower async functions
-	if p.options.unsupportedJSFeatures.Has(compat.AsyncAwait) && *isAsync {
+	if *isAsync && p.shouldLower(compat.AsyncAwait) {
 		// Use the shortened form if we're an arrow function
 		if preferExpr != nil {
 			*preferExpr = true
@@ -515,7 +529,7 @@ flatten:
 	// Don't lower this if we don't need to. This check must be done here instead
 	// of earlier so we can do the dead code elimination above when the target is
 	// null or undefined.
-	if !p.options.unsupportedJSFeatures.Has(compat.OptionalChain) && !containsPrivateName {
+	if !p.shouldLower(compat.OptionalChain) && !containsPrivateName {
 		return originalExpr, exprOut{}
 	}
 
@@ -897,6 +911,7 @@ func (p *parser) lowerObjectSpread(loc logger.Loc, e *js_ast.EObject) js_ast.Exp
 	if p.options.unsupportedJSFeatures.Has(compat.ObjectRestSpread) {
 		for _, property := range e.Properties {
 			if property.Kind == js_ast.PropertySpread {
+				p.loweredFeatures |= compat.ObjectRestSpread
 				needsLowering = true
 				break
 			}
@@ -1111,6 +1126,7 @@ func (p *parser) lowerObjectRestInDecls(decls []js_ast.Decl) []js_ast.Decl {
 	// little overhead as possible in the common case.
 	for i, decl := range decls {
 		if decl.Value != nil && bindingHasObjectRest(decl.Binding) {
+			p.loweredFeatures |= compat.ObjectRestSpread
 			clone := append([]js_ast.Decl{}, decls[:i]...)
 			for _, decl := range decls[i:] {
 				if decl.Value != nil {
@@ -1685,8 +1701,8 @@ func (p *parser) lowerClass(stmt js_ast.Stmt, expr js_ast.Expr, shadowRef js_ast
 
 		// Class fields must be lowered if the environment doesn't support them
 		mustLowerField := !prop.IsMethod &&
-			(!prop.IsStatic && p.options.unsupportedJSFeatures.Has(compat.ClassField) ||
-				(prop.IsStatic && p.options.unsupportedJSFeatures.Has(compat.ClassStaticField)))
+			(!prop.IsStatic && p.shouldLower(compat.ClassField) ||
+				(prop.IsStatic && p.shouldLower(compat.ClassStaticField)))
 
 		// Be conservative and always lower static fields when we're doing TDZ-
 		// avoidance and the shadowing name for the class was captured somewhere.
@@ -149,6 +149,16 @@ func expectPrintedJSX(t *testing.T, contents string, expected string) {
 	})
 }
 
+func expectPrintedJSXPreserve(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectPrintedCommon(t, contents, expected, config.Options{
+		JSX: config.JSXOptions{
+			Parse:    true,
+			Preserve: true,
+		},
+	})
+}
+
 func TestBinOp(t *testing.T) {
 	for code, entry := range js_ast.OpTable {
 		opCode := js_ast.OpCode(code)
@@ -195,6 +205,15 @@ func TestComments(t *testing.T) {
 	expectPrinted(t, "if(x-->y)z", "if (x-- > y)\n  z;\n")
 }
 
+func TestComponentDirectives(t *testing.T) {
+	expectPrinted(t, "'use client'; foo()", "\"use client\";\nfoo();\n")
+	expectPrinted(t, "'use server'; foo()", "\"use server\";\nfoo();\n")
+	expectPrinted(t, "'use strict'; 'use client'; foo()", "\"use strict\";\n\"use client\";\nfoo();\n")
+	expectPrinted(t, "`use client`; foo()", "`use client`;\nfoo();\n")
+	expectPrintedMangle(t, "'use client'; foo()", "\"use client\";\nfoo();\n")
+	expectPrintedMangle(t, "'use other'; foo()", "foo();\n")
+}
+
 func TestStrictMode(t *testing.T) {
 	expectPrinted(t, "'use strict'", "\"use strict\";\n")
 	expectPrinted(t, "`use strict`", "`use strict`;\n")
@@ -1720,6 +1739,20 @@ func TestImport(t *testing.T) {
 	expectPrinted(t, "import {\\u0061rguments as x} from 'foo'", "import {arguments as x} from \"foo\";\n")
 }
 
+func TestImportAttributes(t *testing.T) {
+	expectPrinted(t, "import x from 'foo' with { type: 'json' }; x", "import x from \"foo\" with { type: \"json\" };\nx;\n")
+	expectPrinted(t, "import x from 'foo' assert { type: 'json' }; x", "import x from \"foo\" assert { type: \"json\" };\nx;\n")
+	expectPrinted(t, "import 'foo' with { 'a-b': 'c', type: 'css', }", "import \"foo\" with { \"a-b\": \"c\", type: \"css\" };\n")
+	expectPrinted(t, "import 'foo' with {}", "import \"foo\";\n")
+	expectPrinted(t, "export * from 'foo' with { type: 'json' }", "export * from \"foo\" with { type: \"json\" };\n")
+	expectPrinted(t, "export * as ns from 'foo' with { type: 'json' }", "export * as ns from \"foo\" with { type: \"json\" };\n")
+	expectPrinted(t, "export {x} from 'foo' with { type: 'json' }", "export {x} from \"foo\" with { type: \"json\" };\n")
+	expectPrinted(t, "import 'foo'\nassert({})", "import \"foo\";\nassert({});\n")
+
+	expectParseError(t, "import 'foo' with { type: 'json', type: 'css' }", "<stdin>: error: Duplicate import attribute \"type\"\n")
+	expectParseError(t, "import 'foo' with { type: json }", "<stdin>: error: Expected string but found \"json\"\n")
+}
+
 func TestExport(t *testing.T) {
 	expectPrinted(t, "export default x", "export default x;\n")
 	expectPrinted(t, "export class x {}", "export class x {\n}\n")
@@ -2039,6 +2072,24 @@ func TestMangleUndefined(t *testing.T) {
 	expectPrintedMangle(t, "with (x) while (i) y(undefined); z(undefined)", "with (x)\n  for (; i; )\n    y(undefined);\nz(void 0);\n")
 }
 
+func TestDrop(t *testing.T) {
+	dropConsole := config.Options{Drop: config.DropOptions{Console: true}}
+	expectPrintedCommon(t, "console.log(x); console.error(y); console.x()", "", dropConsole)
+	expectPrintedCommon(t, "a = console.log(x)", "a = void 0;\n", dropConsole)
+	expectPrintedCommon(t, "let console; console.log(x)", "let console;\nconsole.log(x);\n", dropConsole)
+	expectPrintedCommon(t, "console.log; console.log.call(x)", "console.log;\nconsole.log.call(x);\n", dropConsole)
+
+	dropLog := config.Options{Drop: config.DropOptions{ConsoleMethods: []string{"log", "debug"}}}
+	expectPrintedCommon(t, "console.log(x); console.debug(y); console.error(z); console.warn(w)",
+		"console.error(z);\nconsole.warn(w);\n", dropLog)
+	expectPrintedCommon(t, "if (x) console.log(x); else console.error(x)",
+		"if (x)\n  ;\nelse\n  console.error(x);\n", dropLog)
+
+	dropDebugger := config.Options{Drop: config.DropOptions{Debugger: true}}
+	expectPrintedCommon(t, "debugger; console.log(x)", "console.log(x);\n", dropDebugger)
+	expectPrintedCommon(t, "if (x) debugger", "if (x)\n  ;\n", dropDebugger)
+}
+
 func TestMangleIndex(t *testing.T) {
 	expectPrintedMangle(t, "x['y']", "x.y;\n")
 	expectPrintedMangle(t, "x['y z']", "x[\"y z\"];\n")
@@ -3457,6 +3508,21 @@ func TestJSX(t *testing.T) {
 	expectParseErrorJSX(t, "<x:0y/>", "<stdin>: error: Expected identifier after \"x:\" in namespaced JSX name\n")
 }
 
+func TestJSXPreserve(t *testing.T) {
+	expectPrintedJSXPreserve(t, "<div/>", "<div />;\n")
+	expectPrintedJSXPreserve(t, "<a:b-c/>", "<a:b-c />;\n")
+	expectPrintedJSXPreserve(t, "<A.B.C/>", "<A.B.C />;\n")
+	expectPrintedJSXPreserve(t, "<></>", "<></>;\n")
+	expectPrintedJSXPreserve(t, "<>x</>", "<>x</>;\n")
+	expectPrintedJSXPreserve(t, "<a b c='d' e={f} {...g}/>", "<a b c=\"d\" e={f} {...g} />;\n")
+	expectPrintedJSXPreserve(t, "<a b={'\"'} c='&amp;'/>", "<a b={'\"'} c={\"&\"} />;\n")
+	expectPrintedJSXPreserve(t, "<a>b {c} <d/></a>", "<a>b {c} <d /></a>;\n")
+	expectPrintedJSXPreserve(t, "<a>\n  b\n  c\n</a>", "<a>b c</a>;\n")
+	expectPrintedJSXPreserve(t, "<a>&lt;{'}'}</a>", "<a>{\"<\"}{\"}\"}</a>;\n")
+	expectPrintedJSXPreserve(t, "<a>{1 + 2}{x, y}</a>", "<a>{1 + 2}{(x, y)}</a>;\n")
+	expectPrintedJSXPreserve(t, "let x = <a>{<b/>}</a>", "let x = <a><b /></a>;\n")
+}
+
 func TestJSXPragmas(t *testing.T) {
 	expectPrintedJSX(t, "// @jsx h\n<a/>", "/* @__PURE__ */ h(\"a\", null);\n")
 	expectPrintedJSX(t, "/*@jsx h*/\n<a/>", "/* @__PURE__ */ h(\"a\", null);\n")
@@ -2,6 +2,7 @@ package js_parser
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/evanw/esbuild/internal/js_ast"
 	"github.com/evanw/esbuild/internal/js_lexer"
@@ -20,7 +21,7 @@ func (p *jsonParser) parseMaybeTrailingComma(closeToken js_lexer.T) bool {
 	p.lexer.Expect(js_lexer.TComma)
 
 	if p.lexer.Token == closeToken {
-		if !p.options.AllowTrailingCommas {
+		if !p.options.AllowTrailingCommas && !p.options.JSON5 {
 			p.log.AddRangeError(&p.source, commaRange, "JSON does not support trailing commas")
 		}
 		return false
@@ -51,15 +52,25 @@ func (p *jsonParser) parseExpr() js_ast.Expr {
 		return js_ast.Expr{Loc: loc, Data: &js_ast.EString{Value: value}}
 
 	case js_lexer.TNumericLiteral:
-		value := p.lexer.Number
-		p.lexer.Next()
-		return js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: value}}
+		return js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: p.parseNumber()}}
+
+	case js_lexer.TIdentifier:
+		if p.options.JSON5 && (p.lexer.Identifier == "Infinity" || p.lexer.Identifier == "NaN") {
+			return js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: p.parseNumber()}}
+		}
+		p.lexer.Unexpected()
+		return js_ast.Expr{}
 
 	case js_lexer.TMinus:
 		p.lexer.Next()
-		value := p.lexer.Number
-		p.lexer.Expect(js_lexer.TNumericLiteral)
-		return js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: -value}}
+		return js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: -p.parseNumber()}}
+
+	case js_lexer.TPlus:
+		if !p.options.JSON5 {
+			p.lexer.Unexpected()
+		}
+		p.lexer.Next()
+		return js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: p.parseNumber()}}
 
 	case js_lexer.TOpenBracket:
 		p.lexer.Next()
@@ -111,15 +122,22 @@ func (p *jsonParser) parseExpr() js_ast.Expr {
 				}
 			}
 
-			keyString := p.lexer.StringLiteral
+			var keyString []uint16
 			keyRange := p.lexer.Range()
+			if p.options.JSON5 && p.lexer.IsIdentifierOrKeyword() {
+				// JSON5 allows unquoted keys, including reserved words
+				keyString = js_lexer.StringToUTF16(p.lexer.Identifier)
+				p.lexer.Next()
+			} else {
+				keyString = p.lexer.StringLiteral
+				p.lexer.Expect(js_lexer.TStringLiteral)
+			}
 			key := js_ast.Expr{Loc: keyRange.Loc, Data: &js_ast.EString{Value: keyString}}
-			p.lexer.Expect(js_lexer.TStringLiteral)
 
 			// Warn about duplicate keys
 			keyText := js_lexer.UTF16ToString(keyString)
 			if duplicates[keyText] {
-				p.log.AddRangeWarning(&p.source, keyRange, fmt.Sprintf("Duplicate key %q in object literal", keyText))
+				p.log.AddRangeWarningWithID(logger.MsgIDDuplicateObjectKey, &p.source, keyRange, fmt.Sprintf("Duplicate key %q in object literal", keyText))
 			} else {
 				duplicates[keyText] = true
 			}
@@ -150,9 +168,32 @@ func (p *jsonParser) parseExpr() js_ast.Expr {
 	}
 }
 
+func (p *jsonParser) parseNumber() float64 {
+	// JSON5 allows the special values "Infinity" and "NaN"
+	if p.options.JSON5 && p.lexer.Token == js_lexer.TIdentifier {
+		switch p.lexer.Identifier {
+		case "Infinity":
+			p.lexer.Next()
+			return math.Inf(1)
+
+		case "NaN":
+			p.lexer.Next()
+			return math.NaN()
+		}
+	}
+
+	value := p.lexer.Number
+	p.lexer.Expect(js_lexer.TNumericLiteral)
+	return value
+}
+
 type JSONOptions struct {
 	AllowComments       bool
 	AllowTrailingCommas bool
+
+	// Accept the JSON5 superset of JSON: comments, trailing commas, unquoted
+	// keys, single-quoted strings, hexadecimal numbers, "Infinity" and "NaN"
+	JSON5 bool
 }
 
 func ParseJSON(log logger.Log, source logger.Source, options JSONOptions) (result js_ast.Expr, ok bool) {
@@ -170,7 +211,13 @@ func ParseJSON(log logger.Log, source logger.Source, options JSONOptions) (resul
 		log:     log,
 		source:  source,
 		options: options,
-		lexer:   js_lexer.NewLexerJSON(log, source, options.AllowComments),
+	}
+
+	// The JavaScript lexer already understands everything JSON5 adds to JSON
+	if options.JSON5 {
+		p.lexer = js_lexer.NewLexer(log, source)
+	} else {
+		p.lexer = js_lexer.NewLexerJSON(log, source, options.AllowComments)
 	}
 
 	result = p.parseExpr()
@@ -11,11 +11,21 @@ import (
 )
 
 func expectParseErrorJSON(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectParseErrorJSONWithOptions(t, contents, JSONOptions{}, expected)
+}
+
+func expectParseErrorJSON5(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectParseErrorJSONWithOptions(t, contents, JSONOptions{JSON5: true}, expected)
+}
+
+func expectParseErrorJSONWithOptions(t *testing.T, contents string, options JSONOptions, expected string) {
 	t.Helper()
 	t.Run(contents, func(t *testing.T) {
 		t.Helper()
 		log := logger.NewDeferLog()
-		ParseJSON(log, test.SourceForTest(contents), JSONOptions{})
+		ParseJSON(log, test.SourceForTest(contents), options)
 		msgs := log.Done()
 		text := ""
 		for _, msg := range msgs {
@@ -34,11 +44,21 @@ func expectPrintedJSON(t *testing.T, contents string, expected string) {
 }
 
 func expectPrintedJSONWithWarning(t *testing.T, contents string, warning string, expected string) {
+	t.Helper()
+	expectPrintedJSONWithOptions(t, contents, JSONOptions{}, warning, expected)
+}
+
+func expectPrintedJSON5(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectPrintedJSONWithOptions(t, contents, JSONOptions{JSON5: true}, "", expected)
+}
+
+func expectPrintedJSONWithOptions(t *testing.T, contents string, options JSONOptions, warning string, expected string) {
 	t.Helper()
 	t.Run(contents, func(t *testing.T) {
 		t.Helper()
 		log := logger.NewDeferLog()
-		expr, ok := ParseJSON(log, test.SourceForTest(contents), JSONOptions{})
+		expr, ok := ParseJSON(log, test.SourceForTest(contents), options)
 		msgs := log.Done()
 		text := ""
 		for _, msg := range msgs {
@@ -177,3 +197,20 @@ func TestJSONComments(t *testing.T) {
 	expectParseErrorJSON(t, "{}/*comment*/", "<stdin>: error: JSON does not support comments\n")
 	expectParseErrorJSON(t, "{}//comment\n", "<stdin>: error: JSON does not support comments\n")
 }
+
+func TestJSON5(t *testing.T) {
+	expectPrintedJSON5(t, "/* comment */ {a: 1, // comment\n}", "({a:1})")
+	expectPrintedJSON5(t, "{a: 1, b: [2, 3,],}", "({a:1,b:[2,3]})")
+	expectPrintedJSON5(t, "{if: 1, true: 2, $_x: 3}", "({if:1,true:2,$_x:3})")
+	expectPrintedJSON5(t, "{'a': 'b', \"c\": 'd\\'e'}", "({a:\"b\",c:\"d'e\"})")
+	expectPrintedJSON5(t, "[0x1F, 0XAb, .5, 5., +1, -Infinity, NaN]", "[31,171,.5,5,1,-Infinity,NaN]")
+	expectPrintedJSON5(t, "'line \\\ncontinued\\x41'", "\"line continuedA\"")
+
+	expectParseErrorJSON5(t, "{1: 2}", "<stdin>: error: Expected string but found \"1\"\n")
+	expectParseErrorJSON5(t, "[undefined]", "<stdin>: error: Unexpected \"undefined\"\n")
+	expectParseErrorJSON5(t, "{a: 1}{}", "<stdin>: error: Expected end of file but found \"{\"\n")
+
+	expectParseErrorJSON(t, "{a: 1}", "<stdin>: error: Expected string but found \"a\"\n")
+	expectParseErrorJSON(t, "[+1]", "<stdin>: error: Unexpected \"+\"\n")
+	expectParseErrorJSON(t, "[NaN]", "<stdin>: error: Unexpected \"NaN\"\n")
+}
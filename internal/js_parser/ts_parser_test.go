@@ -1046,6 +1046,26 @@ func TestTSEnumConstantFolding(t *testing.T) {
 `)
 }
 
+func TestTSConstEnumIsolatedModules(t *testing.T) {
+	isolatedModules := config.Options{
+		TS:                config.TSOptions{Parse: true},
+		IsolatedModulesTS: true,
+	}
+
+	// Const enums are inlined unless each file is compiled on its own
+	expectPrintedTS(t, "const enum Foo { A, B = A + 1 } console.log(Foo.B)",
+		"var Foo;\n(function(Foo) {\n  Foo[Foo[\"A\"] = 0] = \"A\";\n  Foo[Foo[\"B\"] = 1] = \"B\";\n})(Foo || (Foo = {}));\nconsole.log(1);\n")
+	expectPrintedCommon(t, "const enum Foo { A, B = A + 1 } console.log(Foo.B)",
+		"var Foo;\n(function(Foo) {\n  Foo[Foo[\"A\"] = 0] = \"A\";\n  Foo[Foo[\"B\"] = 1] = \"B\";\n})(Foo || (Foo = {}));\nconsole.log(Foo.B);\n", isolatedModules)
+	expectParseErrorCommon(t, "const enum Foo { A } console.log(Foo.A)",
+		"<stdin>: warning: The values of the const enum \"Foo\" are not inlined because \"isolatedModules\" is enabled\n", isolatedModules)
+
+	// Regular enums are not affected
+	expectParseErrorCommon(t, "enum Foo { A } console.log(Foo.A)", "", isolatedModules)
+	expectPrintedCommon(t, "enum Foo { A } console.log(Foo.A)",
+		"var Foo;\n(function(Foo) {\n  Foo[Foo[\"A\"] = 0] = \"A\";\n})(Foo || (Foo = {}));\nconsole.log(0);\n", isolatedModules)
+}
+
 func TestTSFunction(t *testing.T) {
 	expectPrintedTS(t, "function foo(): void; function foo(): void {}", "function foo() {\n}\n")
 
@@ -15,6 +15,7 @@ import (
 	"github.com/evanw/esbuild/internal/js_lexer"
 	"github.com/evanw/esbuild/internal/logger"
 	"github.com/evanw/esbuild/internal/renamer"
+	"github.com/evanw/esbuild/internal/runtime"
 	"github.com/evanw/esbuild/internal/sourcemap"
 )
 
@@ -35,6 +36,11 @@ type SourceMapState struct {
 	SourceIndex     int
 	OriginalLine    int
 	OriginalColumn  int
+
+	// This is stored as an optional fifth field, but only for mappings with a
+	// name. Mappings without a name keep the index of the previous name.
+	OriginalName    int
+	HasOriginalName bool
 }
 
 // Source map chunks are computed in parallel for speed. Each chunk is relative
@@ -45,7 +51,14 @@ type SourceMapState struct {
 // After all chunks are computed, they are joined together in a second pass.
 // This rewrites the first mapping in each chunk to be relative to the end
 // state of the previous chunk.
-func AppendSourceMapChunk(j *Joiner, prevEndState SourceMapState, startState SourceMapState, sourceMap []byte) {
+//
+// Names are indexed relative to the start of the chunk too, so the first name
+// in each chunk is rewritten the same way using the name offset passed in the
+// start state.
+func AppendSourceMapChunk(j *Joiner, prevEndState SourceMapState, startState SourceMapState, chunk SourceMapChunk) {
+	sourceMap := chunk.Buffer
+	firstNameOffset := chunk.FirstNameOffset
+
 	// Handle line breaks in between this mapping and the previous one
 	if startState.GeneratedLine != 0 {
 		j.AddBytes(bytes.Repeat([]byte{';'}, startState.GeneratedLine))
@@ -60,6 +73,7 @@ func AppendSourceMapChunk(j *Joiner, prevEndState SourceMapState, startState Sou
 	if semicolons > 0 {
 		j.AddBytes(sourceMap[:semicolons])
 		sourceMap = sourceMap[semicolons:]
+		firstNameOffset -= semicolons
 		prevEndState.GeneratedColumn = 0
 		startState.GeneratedColumn = 0
 	}
@@ -72,6 +86,7 @@ func AppendSourceMapChunk(j *Joiner, prevEndState SourceMapState, startState Sou
 	originalLine, i := sourcemap.DecodeVLQ(sourceMap, i)
 	originalColumn, i := sourcemap.DecodeVLQ(sourceMap, i)
 	sourceMap = sourceMap[i:]
+	firstNameOffset -= i
 
 	// Rewrite the first mapping to be relative to the end state of the previous
 	// chunk. We now know what the end state is because we're in the second pass
@@ -80,13 +95,22 @@ func AppendSourceMapChunk(j *Joiner, prevEndState SourceMapState, startState Sou
 	startState.GeneratedColumn += generatedColumn
 	startState.OriginalLine += originalLine
 	startState.OriginalColumn += originalColumn
-	j.AddBytes(appendMapping(nil, j.lastByte, prevEndState, startState))
+	j.AddBytes(AppendMapping(nil, j.lastByte, prevEndState, startState))
+
+	// Rewrite the first name to be relative to the name of the previous chunk.
+	// The following names are relative to the first one and stay the same.
+	if chunk.FirstNameOffset != 0 {
+		originalName, i := sourcemap.DecodeVLQ(sourceMap, firstNameOffset)
+		j.AddBytes(sourceMap[:firstNameOffset])
+		j.AddBytes(sourcemap.EncodeVLQ(startState.OriginalName + originalName - prevEndState.OriginalName))
+		sourceMap = sourceMap[i:]
+	}
 
 	// Then append everything after that without modification.
 	j.AddBytes(sourceMap)
 }
 
-func appendMapping(buffer []byte, lastByte byte, prevState SourceMapState, currentState SourceMapState) []byte {
+func AppendMapping(buffer []byte, lastByte byte, prevState SourceMapState, currentState SourceMapState) []byte {
 	// Put commas in between mappings
 	if lastByte != 0 && lastByte != ';' && lastByte != '"' {
 		buffer = append(buffer, ',')
@@ -108,6 +132,11 @@ func appendMapping(buffer []byte, lastByte byte, prevState SourceMapState, curre
 	buffer = append(buffer, sourcemap.EncodeVLQ(currentState.OriginalColumn-prevState.OriginalColumn)...)
 	prevState.OriginalColumn = currentState.OriginalColumn
 
+	// Record the original name, if there is one
+	if currentState.HasOriginalName {
+		buffer = append(buffer, sourcemap.EncodeVLQ(currentState.OriginalName-prevState.OriginalName)...)
+	}
+
 	return buffer
 }
 
@@ -470,6 +499,10 @@ type printer struct {
 	prevRegExpEnd      int
 	intToBytesBuffer   [64]byte
 
+	// This is the assignment being passed to "_export" in the SystemJS format
+	systemJSExportValue js_ast.E
+	usesSystemJSTemp    bool
+
 	// For source maps
 	sourceMap           []byte
 	prevLoc             logger.Loc
@@ -479,6 +512,15 @@ type printer struct {
 	hasPrevState        bool
 	lineOffsetTables    []LineOffsetTable
 
+	// The original names of renamed symbols referenced by the mappings. The
+	// previous mapping is remembered so that it can be replaced by a mapping
+	// with a name at the same position.
+	names            []string
+	nameIndices      map[string]int
+	firstNameOffset  int
+	prevMappingStart int
+	prevMappingState SourceMapState
+
 	// This is a workaround for a bug in the popular "source-map" library:
 	// https://github.com/mozilla/source-map/issues/261. The library will
 	// sometimes return null when querying a source map unless every line
@@ -518,6 +560,36 @@ func (p *printer) printBytes(bytes []byte) {
 	p.js = append(p.js, bytes...)
 }
 
+func (p *printer) printImportAttributes(record *ast.ImportRecord) {
+	if len(record.Attributes) == 0 {
+		return
+	}
+	p.printSpace()
+	if record.AttributesUseAssert {
+		p.print("assert")
+	} else {
+		p.print("with")
+	}
+	p.printSpace()
+	p.print("{")
+	for i, attribute := range record.Attributes {
+		if i > 0 {
+			p.print(",")
+		}
+		p.printSpace()
+		if js_lexer.IsIdentifier(attribute.Key) {
+			p.print(attribute.Key)
+		} else {
+			p.printQuotedUTF8(attribute.Key, false /* allowBacktick */)
+		}
+		p.print(":")
+		p.printSpace()
+		p.printQuotedUTF8(attribute.Value, false /* allowBacktick */)
+	}
+	p.printSpace()
+	p.print("}")
+}
+
 func (p *printer) printQuotedUTF8(text string, allowBacktick bool) {
 	value := js_lexer.StringToUTF16(text)
 	c := p.bestQuoteCharForString(value, allowBacktick)
@@ -530,30 +602,52 @@ func (p *printer) addSourceMapping(loc logger.Loc) {
 	if !p.options.AddSourceMappings || loc == p.prevLoc {
 		return
 	}
-	p.prevLoc = loc
+	p.appendSourceMapping(loc, SourceMapState{})
+}
 
-	// Binary search to find the line
-	lineOffsetTables := p.lineOffsetTables
-	count := len(lineOffsetTables)
-	originalLine := 0
-	for count > 0 {
-		step := count / 2
-		i := originalLine + step
-		if lineOffsetTables[i].byteOffsetToStartOfLine <= loc.Start {
-			originalLine = i + 1
-			count = count - step - 1
-		} else {
-			count = step
+// Symbols that were renamed, such as by minification, get a mapping with
+// their original name, so that debuggers can show that name instead
+func (p *printer) addSourceMappingForSymbol(loc logger.Loc, ref js_ast.Ref, name string) {
+	if !p.options.AddSourceMappings {
+		return
+	}
+
+	// The names in the input source map are not known, so they are left out.
+	// Symbols from the runtime are left out too since they don't come from
+	// the code at the location of the mapping.
+	ref = js_ast.FollowSymbols(p.symbols, ref)
+	originalName := p.symbols.Get(ref).OriginalName
+	if originalName == name || p.options.InputSourceMap != nil || ref.OuterIndex == runtime.SourceIndex {
+		p.addSourceMapping(loc)
+		return
+	}
+
+	// Replace the previous mapping if it's at the position of this symbol
+	p.updateGeneratedLineAndColumn()
+	if p.prevMappingStart != -1 && p.prevState.GeneratedColumn == p.generatedColumn {
+		p.sourceMap = p.sourceMap[:p.prevMappingStart]
+		p.prevState = p.prevMappingState
+		p.prevMappingStart = -1
+		if p.firstNameOffset >= len(p.sourceMap) {
+			p.firstNameOffset = 0
 		}
 	}
-	originalLine--
 
-	// Use the line to compute the column
-	line := &lineOffsetTables[originalLine]
-	originalColumn := int(loc.Start - line.byteOffsetToStartOfLine)
-	if line.columnsForNonASCII != nil && originalColumn >= int(line.byteOffsetToFirstNonASCII) {
-		originalColumn = int(line.columnsForNonASCII[originalColumn-int(line.byteOffsetToFirstNonASCII)])
+	index, ok := p.nameIndices[originalName]
+	if !ok {
+		if p.nameIndices == nil {
+			p.nameIndices = make(map[string]int)
+		}
+		index = len(p.names)
+		p.names = append(p.names, originalName)
+		p.nameIndices[originalName] = index
 	}
+	p.appendSourceMapping(loc, SourceMapState{OriginalName: index, HasOriginalName: true})
+}
+
+func (p *printer) appendSourceMapping(loc logger.Loc, currentState SourceMapState) {
+	p.prevLoc = loc
+	originalLine, originalColumn := OriginalLineAndColumn(p.lineOffsetTables, loc)
 
 	p.updateGeneratedLineAndColumn()
 
@@ -569,17 +663,43 @@ func (p *printer) addSourceMapping(loc logger.Loc) {
 		})
 	}
 
-	p.appendMapping(SourceMapState{
-		GeneratedLine:   p.prevState.GeneratedLine,
-		GeneratedColumn: p.generatedColumn,
-		OriginalLine:    originalLine,
-		OriginalColumn:  originalColumn,
-	})
+	currentState.GeneratedLine = p.prevState.GeneratedLine
+	currentState.GeneratedColumn = p.generatedColumn
+	currentState.OriginalLine = originalLine
+	currentState.OriginalColumn = originalColumn
+	p.appendMapping(currentState)
 
 	// This line now has a mapping on it, so don't insert another one
 	p.lineStartsWithMapping = true
 }
 
+// This converts a location in the original file to the line and the column
+// stored in source maps. The column is counted in UTF-16 code units.
+func OriginalLineAndColumn(lineOffsetTables []LineOffsetTable, loc logger.Loc) (int, int) {
+	// Binary search to find the line
+	count := len(lineOffsetTables)
+	originalLine := 0
+	for count > 0 {
+		step := count / 2
+		i := originalLine + step
+		if lineOffsetTables[i].byteOffsetToStartOfLine <= loc.Start {
+			originalLine = i + 1
+			count = count - step - 1
+		} else {
+			count = step
+		}
+	}
+	originalLine--
+
+	// Use the line to compute the column
+	line := &lineOffsetTables[originalLine]
+	originalColumn := int(loc.Start - line.byteOffsetToStartOfLine)
+	if line.columnsForNonASCII != nil && originalColumn >= int(line.byteOffsetToFirstNonASCII) {
+		originalColumn = int(line.columnsForNonASCII[originalColumn-int(line.byteOffsetToFirstNonASCII)])
+	}
+	return originalLine, originalColumn
+}
+
 // Scan over the printed text since the last source mapping and update the
 // generated line and column numbers
 func (p *printer) updateGeneratedLineAndColumn() {
@@ -610,6 +730,7 @@ func (p *printer) updateGeneratedLineAndColumn() {
 			p.prevState.GeneratedColumn = 0
 			p.generatedColumn = 0
 			p.sourceMap = append(p.sourceMap, ';')
+			p.prevMappingStart = -1
 
 			// This new line doesn't have a mapping yet
 			p.lineStartsWithMapping = false
@@ -733,7 +854,18 @@ func (p *printer) appendMappingWithoutRemapping(currentState SourceMapState) {
 		lastByte = p.sourceMap[len(p.sourceMap)-1]
 	}
 
-	p.sourceMap = appendMapping(p.sourceMap, lastByte, p.prevState, currentState)
+	// Mappings without a name keep the name index of the previous mapping
+	if !currentState.HasOriginalName {
+		currentState.OriginalName = p.prevState.OriginalName
+	} else if p.firstNameOffset == 0 {
+		withoutName := currentState
+		withoutName.HasOriginalName = false
+		p.firstNameOffset = len(p.sourceMap) + len(AppendMapping(nil, lastByte, p.prevState, withoutName))
+	}
+
+	p.prevMappingStart = len(p.sourceMap)
+	p.prevMappingState = p.prevState
+	p.sourceMap = AppendMapping(p.sourceMap, lastByte, p.prevState, currentState)
 	p.prevState = currentState
 	p.hasPrevState = true
 }
@@ -751,6 +883,15 @@ func (p *printer) printSymbol(ref js_ast.Ref) {
 	p.printIdentifier(p.renamer.NameForSymbol(ref))
 }
 
+// This also adds a source mapping for the symbol, with its original name if
+// it was renamed
+func (p *printer) printSymbolAt(loc logger.Loc, ref js_ast.Ref) {
+	p.printSpaceBeforeIdentifier()
+	name := p.renamer.NameForSymbol(ref)
+	p.addSourceMappingForSymbol(loc, ref, name)
+	p.printIdentifier(name)
+}
+
 func CanQuoteIdentifier(name string, unsupportedJSFeatures compat.JSFeature, asciiOnly bool) bool {
 	return js_lexer.IsIdentifier(name) && (!asciiOnly ||
 		!unsupportedJSFeatures.Has(compat.UnicodeEscapes) ||
@@ -816,7 +957,7 @@ func (p *printer) printBinding(binding js_ast.Binding) {
 	case *js_ast.BMissing:
 
 	case *js_ast.BIdentifier:
-		p.printSymbol(b.Ref)
+		p.printSymbolAt(binding.Loc, b.Ref)
 
 	case *js_ast.BArray:
 		p.print("[")
@@ -1154,7 +1295,8 @@ func (p *printer) printProperty(item js_ast.Property) {
 			if !p.options.UnsupportedFeatures.Has(compat.ObjectExtensions) && item.Value != nil {
 				switch e := item.Value.Data.(type) {
 				case *js_ast.EIdentifier:
-					if js_lexer.UTF16EqualsString(key.Value, p.renamer.NameForSymbol(e.Ref)) {
+					if _, ok := p.options.CrossChunkImports[js_ast.FollowSymbols(p.symbols, e.Ref)]; !ok &&
+						js_lexer.UTF16EqualsString(key.Value, p.renamer.NameForSymbol(e.Ref)) {
 						if item.Initializer != nil {
 							p.printSpace()
 							p.print("=")
@@ -1168,7 +1310,8 @@ func (p *printer) printProperty(item js_ast.Property) {
 					// Make sure we're not using a property access instead of an identifier
 					ref := js_ast.FollowSymbols(p.symbols, e.Ref)
 					symbol := p.symbols.Get(ref)
-					if symbol.NamespaceAlias == nil && js_lexer.UTF16EqualsString(key.Value, p.renamer.NameForSymbol(e.Ref)) {
+					_, isCrossChunk := p.options.CrossChunkImports[ref]
+					if symbol.NamespaceAlias == nil && !isCrossChunk && js_lexer.UTF16EqualsString(key.Value, p.renamer.NameForSymbol(e.Ref)) {
 						if item.Initializer != nil {
 							p.printSpace()
 							p.print("=")
@@ -1269,6 +1412,24 @@ func (p *printer) printRequireOrImportExpr(importRecordIndex uint32, leadingInte
 	record := &p.importRecords[importRecordIndex]
 	p.printSpaceBeforeIdentifier()
 
+	if record.SourceIndex == nil && p.options.SystemJS != nil {
+		switch record.Kind {
+		case ast.ImportStmt:
+			// "_deps[0]"
+			p.printSymbol(p.options.SystemJS.DepsRef)
+			p.print(fmt.Sprintf("[%d]", p.options.SystemJS.DepIndices[record.Path.Text]))
+			return
+
+		case ast.ImportDynamic:
+			// "_context.import('path')"
+			p.printSymbol(p.options.SystemJS.ContextRef)
+			p.print(".import(")
+			p.printQuotedUTF8(record.Path.Text, true /* allowBacktick */)
+			p.print(")")
+			return
+		}
+	}
+
 	// Preserve "import()" expressions that don't point inside the bundle
 	if record.SourceIndex == nil && record.Kind == ast.ImportDynamic && p.options.OutputFormat.KeepES6ImportExportSyntax() {
 		p.print("import(")
@@ -1322,6 +1483,8 @@ func (p *printer) printRequireOrImportExpr(importRecordIndex uint32, leadingInte
 	if record.SourceIndex != nil {
 		p.printSymbol(p.options.WrapperRefForSource(*record.SourceIndex))
 		p.print("()")
+	} else if ref, ok := p.umdDepRef(record); ok {
+		p.printSymbol(ref)
 	} else {
 		p.print("require(")
 		p.printQuotedUTF8(record.Path.Text, true /* allowBacktick */)
@@ -1347,6 +1510,14 @@ func (p *printer) printRequireOrImportExpr(importRecordIndex uint32, leadingInte
 	}
 }
 
+func (p *printer) umdDepRef(record *ast.ImportRecord) (js_ast.Ref, bool) {
+	if p.options.UMD == nil || (record.Kind != ast.ImportStmt && record.Kind != ast.ImportRequire) {
+		return js_ast.InvalidRef, false
+	}
+	ref, ok := p.options.UMD.DepRefs[record.Path.Text]
+	return ref, ok
+}
+
 const (
 	forbidCall = 1 << iota
 	forbidIn
@@ -1363,6 +1534,93 @@ func (p *printer) printUndefined(level js_ast.L) {
 	}
 }
 
+// JSX text and attribute strings can't contain escapes, so anything that
+// could be misinterpreted is printed as a string in an expression container
+func (p *printer) canPrintJSXText(text []uint16, quote uint16) bool {
+	for _, c := range text {
+		switch c {
+		case '{', '}', '<', '>', '&', '\r', '\n', quote:
+			return false
+		}
+		if p.options.ASCIIOnly && c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *printer) printJSXElement(e *js_ast.EJSXElement) {
+	p.print("<")
+	if e.Tag != nil {
+		p.printJSXTag(*e.Tag)
+	}
+
+	for _, property := range e.Properties {
+		p.print(" ")
+		if property.Kind == js_ast.PropertySpread {
+			p.print("{...")
+			p.printExpr(*property.Value, js_ast.LComma, 0)
+			p.print("}")
+			continue
+		}
+		p.print(js_lexer.UTF16ToString(property.Key.Data.(*js_ast.EString).Value))
+		switch value := property.Value.Data.(type) {
+		case *js_ast.EBoolean:
+			if value.Value {
+				continue
+			}
+		case *js_ast.EString:
+			if p.canPrintJSXText(value.Value, '"') {
+				p.print("=\"")
+				p.print(js_lexer.UTF16ToString(value.Value))
+				p.print("\"")
+				continue
+			}
+		}
+		p.print("={")
+		p.printExpr(*property.Value, js_ast.LComma, 0)
+		p.print("}")
+	}
+
+	// Elements without children are self-closing, but fragments aren't
+	if len(e.Children) == 0 && e.Tag != nil {
+		p.print(" />")
+		return
+	}
+	p.print(">")
+
+	// Children are printed on the same line since whitespace is significant
+	for _, child := range e.Children {
+		switch c := child.Data.(type) {
+		case *js_ast.EJSXElement:
+			p.printJSXElement(c)
+			continue
+		case *js_ast.EString:
+			if len(c.Value) > 0 && p.canPrintJSXText(c.Value, 0) {
+				p.print(js_lexer.UTF16ToString(c.Value))
+				continue
+			}
+		}
+		p.print("{")
+		p.printExpr(child, js_ast.LComma, 0)
+		p.print("}")
+	}
+
+	p.print("</")
+	if e.Tag != nil {
+		p.printJSXTag(*e.Tag)
+	}
+	p.print(">")
+}
+
+func (p *printer) printJSXTag(tag js_ast.Expr) {
+	if str, ok := tag.Data.(*js_ast.EString); ok {
+		p.print(js_lexer.UTF16ToString(str.Value))
+	} else {
+		p.printExpr(tag, js_ast.LPostfix, 0)
+	}
+}
+
 func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 	p.addSourceMapping(expr.Loc)
 
@@ -1519,7 +1777,7 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 		}
 
 		var leadingInteriorComments []js_ast.Comment
-		if !p.options.RemoveWhitespace {
+		if !p.options.RemoveWhitespace && p.options.Comments != config.CommentsNone {
 			leadingInteriorComments = e.LeadingInteriorComments
 		}
 
@@ -1679,7 +1937,7 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 			p.printSpace()
 		}
 		if e.Fn.Name != nil {
-			p.printSymbol(e.Fn.Name.Ref)
+			p.printSymbolAt(e.Fn.Name.Loc, e.Fn.Name.Ref)
 		}
 		p.printFn(e.Fn)
 		if wrap {
@@ -1695,7 +1953,7 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 		p.printSpaceBeforeIdentifier()
 		p.print("class")
 		if e.Class.Name != nil {
-			p.printSymbol(e.Class.Name.Ref)
+			p.printSymbolAt(e.Class.Name.Loc, e.Class.Name.Ref)
 		}
 		p.printClass(e.Class)
 		if wrap {
@@ -1904,31 +2162,31 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 		}
 
 	case *js_ast.EIdentifier:
-		p.printSpaceBeforeIdentifier()
-		p.printSymbol(e.Ref)
+		if alias, ok := p.options.CrossChunkImports[js_ast.FollowSymbols(p.symbols, e.Ref)]; ok {
+			p.printNamespaceAlias(alias)
+		} else {
+			p.printSpaceBeforeIdentifier()
+			p.printSymbolAt(expr.Loc, e.Ref)
+		}
 
 	case *js_ast.EImportIdentifier:
 		// Potentially use a property access instead of an identifier
 		ref := js_ast.FollowSymbols(p.symbols, e.Ref)
 		symbol := p.symbols.Get(ref)
 
-		if symbol.ImportItemStatus == js_ast.ImportItemMissing {
+		if alias, ok := p.options.CrossChunkImports[ref]; ok {
+			p.printNamespaceAlias(alias)
+		} else if symbol.ImportItemStatus == js_ast.ImportItemMissing {
 			p.printUndefined(level)
 		} else if symbol.NamespaceAlias != nil {
-			p.printSymbol(symbol.NamespaceAlias.NamespaceRef)
-			alias := symbol.NamespaceAlias.Alias
-			if p.canPrintIdentifier(alias) {
-				p.print(".")
-				p.printIdentifier(alias)
-			} else {
-				p.print("[")
-				p.printQuotedUTF8(alias, true /* allowBacktick */)
-				p.print("]")
-			}
+			p.printNamespaceAlias(*symbol.NamespaceAlias)
 		} else {
-			p.printSymbol(e.Ref)
+			p.printSymbolAt(expr.Loc, e.Ref)
 		}
 
+	case *js_ast.EJSXElement:
+		p.printJSXElement(e)
+
 	case *js_ast.EAwait:
 		wrap := level >= js_ast.LPrefix
 
@@ -1968,6 +2226,13 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 		}
 
 	case *js_ast.EUnary:
+		if e.Op.UnaryAssignTarget() != js_ast.AssignTargetNone && expr.Data != p.systemJSExportValue {
+			if aliases := p.systemJSExportAliases(e.Value); len(aliases) > 0 {
+				p.printSystemJSUpdate(expr, e, aliases, level)
+				break
+			}
+		}
+
 		entry := js_ast.OpTable[e.Op]
 		wrap := level >= entry.Level
 
@@ -1999,6 +2264,13 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 		}
 
 	case *js_ast.EBinary:
+		if e.Op.BinaryAssignTarget() != js_ast.AssignTargetNone && expr.Data != p.systemJSExportValue {
+			if aliases := p.systemJSExportAliases(e.Left); len(aliases) > 0 {
+				p.printSystemJSExport(aliases, expr, level)
+				break
+			}
+		}
+
 		entry := js_ast.OpTable[e.Op]
 		wrap := level >= entry.Level || (e.Op == js_ast.BinOpIn && (flags&forbidIn) != 0)
 
@@ -2083,6 +2355,19 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags int) {
 	}
 }
 
+func (p *printer) printNamespaceAlias(namespaceAlias js_ast.NamespaceAlias) {
+	p.printSymbol(namespaceAlias.NamespaceRef)
+	alias := namespaceAlias.Alias
+	if p.canPrintIdentifier(alias) {
+		p.print(".")
+		p.printIdentifier(alias)
+	} else {
+		p.print("[")
+		p.printQuotedUTF8(alias, true /* allowBacktick */)
+		p.print("]")
+	}
+}
+
 func (p *printer) isUnboundEvalIdentifier(value js_ast.Expr) bool {
 	if id, ok := value.Data.(*js_ast.EIdentifier); ok {
 		// Using the original name here is ok since unbound symbols are not renamed
@@ -2458,8 +2743,12 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 
 	switch s := stmt.Data.(type) {
 	case *js_ast.SComment:
+		if p.options.Comments == config.CommentsNone ||
+			(s.IsLegalComment && p.options.LegalComments == config.LegalCommentsNone) {
+			break
+		}
 		text := s.Text
-		if p.options.ExtractComments {
+		if p.options.ExtractComments && s.IsLegalComment {
 			if p.extractedComments == nil {
 				p.extractedComments = make(map[string]bool)
 			}
@@ -2482,7 +2771,7 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 			p.print("*")
 			p.printSpace()
 		}
-		p.printSymbol(s.Fn.Name.Ref)
+		p.printSymbolAt(s.Fn.Name.Loc, s.Fn.Name.Ref)
 		p.printFn(s.Fn)
 		p.printNewline()
 
@@ -2493,7 +2782,7 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 			p.print("export ")
 		}
 		p.print("class")
-		p.printSymbol(s.Class.Name.Ref)
+		p.printSymbolAt(s.Class.Name.Loc, s.Class.Name.Ref)
 		p.printClass(s.Class)
 		p.printNewline()
 
@@ -2565,6 +2854,7 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 		p.print("from")
 		p.printSpace()
 		p.printQuotedUTF8(p.importRecords[s.ImportRecordIndex].Path.Text, false /* allowBacktick */)
+		p.printImportAttributes(&p.importRecords[s.ImportRecordIndex])
 		p.printSemicolonAfterStatement()
 
 	case *js_ast.SExportClause:
@@ -2648,6 +2938,7 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 		p.print("from")
 		p.printSpace()
 		p.printQuotedUTF8(p.importRecords[s.ImportRecordIndex].Path.Text, false /* allowBacktick */)
+		p.printImportAttributes(&p.importRecords[s.ImportRecordIndex])
 		p.printSemicolonAfterStatement()
 
 	case *js_ast.SLocal:
@@ -2921,6 +3212,7 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 		}
 
 		p.printQuotedUTF8(p.importRecords[s.ImportRecordIndex].Path.Text, false /* allowBacktick */)
+		p.printImportAttributes(&p.importRecords[s.ImportRecordIndex])
 		p.printSemicolonAfterStatement()
 
 	case *js_ast.SBlock:
@@ -2992,6 +3284,75 @@ func (p *printer) printStmt(stmt js_ast.Stmt) {
 	}
 }
 
+func (p *printer) systemJSExportAliases(target js_ast.Expr) []string {
+	if p.options.SystemJS == nil {
+		return nil
+	}
+	if id, ok := target.Data.(*js_ast.EIdentifier); ok {
+		return p.options.SystemJS.ExportAliases[js_ast.FollowSymbols(p.symbols, id.Ref)]
+	}
+	return nil
+}
+
+// Live bindings in the SystemJS format are updated by passing the new value
+// to "_export" whenever an exported variable is assigned. For example, "x = 1"
+// becomes "_export("x", x = 1)".
+func (p *printer) printSystemJSExport(aliases []string, value js_ast.Expr, level js_ast.L) {
+	wrap := level >= js_ast.LNew
+	if wrap {
+		p.print("(")
+	}
+	for _, alias := range aliases {
+		p.printSymbol(p.options.SystemJS.ExportRef)
+		p.print("(")
+		p.printQuotedUTF8(alias, true /* allowBacktick */)
+		p.print(",")
+		p.printSpace()
+	}
+	p.systemJSExportValue = value.Data
+	p.printExpr(value, js_ast.LComma, 0)
+	p.systemJSExportValue = nil
+	for range aliases {
+		p.print(")")
+	}
+	if wrap {
+		p.print(")")
+	}
+}
+
+// Prefix updates can be passed to "_export" directly, but postfix updates
+// have to export the new value separately, because they return the old one.
+// The old value is kept in a temporary variable of the wrapper, because it
+// can't be computed back from the new one for strings or BigInts. For example,
+// "x++" becomes "(_tmp = x++, _export("x", x), _tmp)".
+func (p *printer) printSystemJSUpdate(expr js_ast.Expr, e *js_ast.EUnary, aliases []string, level js_ast.L) {
+	if e.Op.IsPrefix() {
+		p.printSystemJSExport(aliases, expr, level)
+		return
+	}
+	p.usesSystemJSTemp = true
+	wrap := level >= js_ast.LComma
+	if wrap {
+		p.print("(")
+	}
+	p.printSymbol(p.options.SystemJS.TempRef)
+	p.printSpace()
+	p.print("=")
+	p.printSpace()
+	p.systemJSExportValue = expr.Data
+	p.printExpr(expr, js_ast.LAssign, 0)
+	p.systemJSExportValue = nil
+	p.print(",")
+	p.printSpace()
+	p.printSystemJSExport(aliases, e.Value, js_ast.LComma)
+	p.print(",")
+	p.printSpace()
+	p.printSymbol(p.options.SystemJS.TempRef)
+	if wrap {
+		p.print(")")
+	}
+}
+
 func (p *printer) shouldIgnoreSourceMap() bool {
 	for _, c := range p.sourceMap {
 		if c != ';' {
@@ -3007,6 +3368,8 @@ type Options struct {
 	MangleSyntax        bool
 	ASCIIOnly           bool
 	ExtractComments     bool
+	Comments            config.Comments
+	LegalComments       config.LegalComments
 	AddSourceMappings   bool
 	Indent              int
 	ToModuleRef         js_ast.Ref
@@ -3020,6 +3383,39 @@ type Options struct {
 	// This will be present if the input file had a source map. In that case we
 	// want to map all the way back to the original input file(s).
 	InputSourceMap *sourcemap.SourceMap
+
+	// This will be present if the output format is SystemJS
+	SystemJS *SystemJSOptions
+
+	// This will be present if the output format is UMD
+	UMD *UMDOptions
+
+	// Symbols imported from other chunks in the CommonJS format are read as
+	// properties of the objects returned by "require()" to keep them live
+	CrossChunkImports map[js_ast.Ref]js_ast.NamespaceAlias
+}
+
+// The SystemJS format wraps the bundle in a "System.register" call. The code
+// in the bundle uses the wrapper's variables to access external modules and
+// to update the exports of the entry point.
+type SystemJSOptions struct {
+	ExportRef  js_ast.Ref
+	ContextRef js_ast.Ref
+	DepsRef    js_ast.Ref
+	TempRef    js_ast.Ref
+
+	// External import paths mapped to their indices in the "_deps" array
+	DepIndices map[string]uint32
+
+	// Symbols exported from the entry point mapped to their export aliases
+	ExportAliases map[js_ast.Ref][]string
+}
+
+// The UMD format passes external modules to the factory function of the
+// wrapper. The code in the bundle uses its parameters instead of "require()".
+type UMDOptions struct {
+	// External import paths mapped to the parameters of the factory function
+	DepRefs map[string]js_ast.Ref
 }
 
 type SourceMapChunk struct {
@@ -3035,6 +3431,12 @@ type SourceMapChunk struct {
 	FinalGeneratedColumn int
 
 	ShouldIgnore bool
+
+	// The original names referenced by the mappings, indexed from zero in this
+	// chunk. The offset of the first name in the buffer is zero if there are
+	// no names, which is never a valid offset for a name.
+	Names           []string
+	FirstNameOffset int
 }
 
 type PrintResult struct {
@@ -3046,6 +3448,10 @@ type PrintResult struct {
 	SourceMapChunk SourceMapChunk
 
 	ExtractedComments map[string]bool
+
+	// The wrapper of the SystemJS format declares the temporary variable only
+	// if it was used by the code
+	UsesSystemJSTemp bool
 }
 
 func Print(tree js_ast.AST, symbols js_ast.SymbolMap, r renamer.Renamer, options Options) PrintResult {
@@ -3062,6 +3468,7 @@ func Print(tree js_ast.AST, symbols js_ast.SymbolMap, r renamer.Renamer, options
 		prevRegExpEnd:      -1,
 		prevLoc:            logger.Loc{Start: -1},
 		lineOffsetTables:   options.LineOffsetTables,
+		prevMappingStart:   -1,
 
 		// We automatically repeat the previous source mapping if we ever generate
 		// a line that doesn't start with a mapping. This helps give files more
@@ -3077,9 +3484,9 @@ func Print(tree js_ast.AST, symbols js_ast.SymbolMap, r renamer.Renamer, options
 		coverLinesWithoutMappings: options.InputSourceMap == nil,
 	}
 
-	// Add the top-level directive if present
-	if tree.Directive != "" {
-		p.printQuotedUTF8(tree.Directive, options.ASCIIOnly)
+	// Add the top-level directives if present
+	for _, directive := range tree.Directives {
+		p.printQuotedUTF8(directive, options.ASCIIOnly)
 		p.print(";")
 		p.printNewline()
 	}
@@ -3096,11 +3503,14 @@ func Print(tree js_ast.AST, symbols js_ast.SymbolMap, r renamer.Renamer, options
 	return PrintResult{
 		JS:                p.js,
 		ExtractedComments: p.extractedComments,
+		UsesSystemJSTemp:  p.usesSystemJSTemp,
 		SourceMapChunk: SourceMapChunk{
 			Buffer:               p.sourceMap,
 			EndState:             p.prevState,
 			FinalGeneratedColumn: p.generatedColumn,
 			ShouldIgnore:         p.shouldIgnoreSourceMap(),
+			Names:                p.names,
+			FirstNameOffset:      p.firstNameOffset,
 		},
 	}
 }
@@ -27,6 +27,7 @@ func expectPrintedCommon(t *testing.T, name string, contents string, expected st
 		tree, ok := js_parser.Parse(log, test.SourceForTest(contents), js_parser.OptionsFromConfig(&config.Options{
 			MangleSyntax:          options.MangleSyntax,
 			UnsupportedJSFeatures: options.UnsupportedFeatures,
+			Comments:              options.Comments,
 		}))
 		msgs := log.Done()
 		text := ""
@@ -87,6 +88,21 @@ func expectPrintedMinifyASCII(t *testing.T, contents string, expected string) {
 	})
 }
 
+func expectPrintedComments(t *testing.T, comments config.Comments, contents string, expected string) {
+	t.Helper()
+	expectPrintedCommon(t, contents+" [comments]", contents, expected, Options{
+		Comments: comments,
+	})
+}
+
+func expectPrintedCommentsMinify(t *testing.T, comments config.Comments, contents string, expected string) {
+	t.Helper()
+	expectPrintedCommon(t, contents+" [comments, minified]", contents, expected, Options{
+		Comments:         comments,
+		RemoveWhitespace: true,
+	})
+}
+
 func expectPrintedTarget(t *testing.T, esVersion int, contents string, expected string) {
 	t.Helper()
 	expectPrintedCommon(t, contents, contents, expected, Options{
@@ -742,6 +758,23 @@ func TestMinify(t *testing.T) {
 	expectPrintedMinify(t, "/*!multi-\nline*/\nthrow 1 + 2", "/*!multi-\nline*/throw 1+2;")
 }
 
+func TestComments(t *testing.T) {
+	expectPrinted(t, "// comment\nlet x = {a: 1}", "let x = {a: 1};\n")
+	expectPrinted(t, "/*! license */\nlet x = {a: 1}", "/*! license */\nlet x = {a: 1};\n")
+
+	expectPrintedComments(t, config.CommentsAll, "// comment\nlet x = {a: 1}", "// comment\nlet x = {a: 1};\n")
+	expectPrintedComments(t, config.CommentsAll, "function f() {\n  /* a */\n  return 1 // b\n}", "function f() {\n  /* a */\n  return 1;\n  // b\n}\n")
+	expectPrintedComments(t, config.CommentsAll, "import(/* chunk */ 'path')", "import(\n  /* chunk */\n  \"path\"\n);\n")
+
+	expectPrintedComments(t, config.CommentsNone, "// comment\nlet x = {a: 1}", "let x = {a: 1};\n")
+	expectPrintedComments(t, config.CommentsNone, "/*! license */\nlet x = {a: 1}", "let x = {a: 1};\n")
+	expectPrintedComments(t, config.CommentsNone, "import(/* chunk */ 'path')", "import(\"path\");\n")
+
+	expectPrintedComments(t, config.CommentsLegal, "// comment\n/*! license */\nlet x = {a: 1}", "/*! license */\nlet x = {a: 1};\n")
+	expectPrintedComments(t, config.CommentsLegal, "// @license MIT\nlet x", "// @license MIT\nlet x;\n")
+	expectPrintedCommentsMinify(t, config.CommentsLegal, "// comment\n/*! license */\nlet x = {a: 1}", "/*! license */let x={a:1};")
+}
+
 func TestES5(t *testing.T) {
 	expectPrintedTargetMangle(t, 5, "foo('a\\n\\n\\nb')", "foo(\"a\\n\\n\\nb\");\n")
 	expectPrintedTargetMangle(t, 2015, "foo('a\\n\\n\\nb')", "foo(`a\n\n\nb`);\n")
@@ -40,6 +40,7 @@ const (
 	Error MsgKind = iota
 	Warning
 	Note
+	Info
 )
 
 func (kind MsgKind) String() string {
@@ -50,17 +51,42 @@ func (kind MsgKind) String() string {
 		return "warning"
 	case Note:
 		return "note"
+	case Info:
+		return "info"
 	default:
 		panic("Internal error")
 	}
 }
 
 type Msg struct {
+	// An optional stable identifier for this kind of message. It's used by
+	// "OutputOptions.Overrides" to reclassify or suppress specific messages.
+	ID    string
 	Kind  MsgKind
 	Data  MsgData
 	Notes []MsgData
 }
 
+// Stable identifiers of messages that can be reclassified or suppressed
+// using "OutputOptions.Overrides"
+const (
+	MsgIDAmbiguousExtension       = "ambiguous-extension"
+	MsgIDAssignToConstant         = "assign-to-constant"
+	MsgIDDuplicateObjectKey       = "duplicate-object-key"
+	MsgIDEqualsNaN                = "equals-nan"
+	MsgIDEqualsNegativeZero       = "equals-negative-zero"
+	MsgIDEqualsNewObject          = "equals-new-object"
+	MsgIDImpossibleTypeof         = "impossible-typeof"
+	MsgIDUnsupportedDynamicImport = "unsupported-dynamic-import"
+	MsgIDUnusedExternal           = "unused-external"
+)
+
+// Messages with these identifiers are too noisy to be reported by default.
+// They are only reported if they are reclassified using "OutputOptions.Overrides".
+var msgIDsSilentByDefault = map[string]bool{
+	MsgIDAmbiguousExtension: true,
+}
+
 type MsgData struct {
 	Text     string
 	Location *MsgLocation
@@ -336,6 +362,11 @@ func NewStderrLog(options OutputOptions) Log {
 
 	return Log{
 		AddMsg: func(msg Msg) {
+			msg, ok := options.applyOverride(msg)
+			if !ok {
+				return
+			}
+
 			mutex.Lock()
 			defer mutex.Unlock()
 			msgs = append(msgs, msg)
@@ -379,6 +410,12 @@ func NewStderrLog(options OutputOptions) Log {
 						deferredWarnings = append(deferredWarnings, msg)
 					}
 				}
+
+			case Info:
+				// Informational messages don't count against the message limit
+				if options.LogLevel <= LevelInfo {
+					writeStringWithColor(os.Stderr, msg.String(options, terminalInfo))
+				}
 			}
 		},
 		HasErrors: func() bool {
@@ -715,13 +752,32 @@ func PrintSummary(osArgs []string, table SummaryTable, start time.Time) {
 	})
 }
 
+// The messages are kept as they are, so they can be passed on to another log
+// that applies its own overrides
 func NewDeferLog() Log {
+	return newDeferLog(nil)
+}
+
+// Like "NewDeferLog", but the messages are reclassified or suppressed using
+// "OutputOptions.Overrides" like the ones passed to "NewStderrLog"
+func NewDeferLogWithOptions(options OutputOptions) Log {
+	return newDeferLog(&options)
+}
+
+func newDeferLog(options *OutputOptions) Log {
 	var msgs SortableMsgs
 	var mutex sync.Mutex
 	var hasErrors bool
 
 	return Log{
 		AddMsg: func(msg Msg) {
+			if options != nil {
+				var ok bool
+				if msg, ok = options.applyOverride(msg); !ok {
+					return
+				}
+			}
+
 			mutex.Lock()
 			defer mutex.Unlock()
 			if msg.Kind == Error {
@@ -771,6 +827,31 @@ type OutputOptions struct {
 	MessageLimit  int
 	Color         UseColor
 	LogLevel      LogLevel
+
+	// Maps message identifiers to the level they should be reported at
+	// instead. Messages overridden with "LevelSilent" are dropped entirely and
+	// the ones overridden with "LevelInfo" are reported as informational.
+	Overrides map[string]LogLevel
+}
+
+func (options OutputOptions) applyOverride(msg Msg) (Msg, bool) {
+	if msg.ID != "" {
+		if level, ok := options.Overrides[msg.ID]; ok {
+			switch level {
+			case LevelSilent:
+				return msg, false
+			case LevelError:
+				msg.Kind = Error
+			case LevelWarning:
+				msg.Kind = Warning
+			case LevelInfo:
+				msg.Kind = Info
+			}
+		} else if msgIDsSilentByDefault[msg.ID] {
+			return msg, false
+		}
+	}
+	return msg, true
 }
 
 func (msg Msg) String(options OutputOptions, terminalInfo TerminalInfo) string {
@@ -845,6 +926,9 @@ func msgString(options OutputOptions, terminalInfo TerminalInfo, kind MsgKind, d
 	case Warning:
 		kindColor = colorMagenta
 
+	case Info:
+		kindColor = colorBlue
+
 	case Note:
 		textColor = colorReset
 		kindColor = colorResetBold
@@ -1212,6 +1296,21 @@ func (log Log) AddRangeWarning(source *Source, r Range, text string) {
 	})
 }
 
+func (log Log) AddRangeWarningWithID(id string, source *Source, r Range, text string) {
+	log.AddMsg(Msg{
+		ID:   id,
+		Kind: Warning,
+		Data: RangeData(source, r, text),
+	})
+}
+
+func (log Log) AddRangeInfo(source *Source, r Range, text string) {
+	log.AddMsg(Msg{
+		Kind: Info,
+		Data: RangeData(source, r, text),
+	})
+}
+
 func (log Log) AddRangeErrorWithNotes(source *Source, r Range, text string, notes []MsgData) {
 	log.AddMsg(Msg{
 		Kind:  Error,
@@ -1228,6 +1327,15 @@ func (log Log) AddRangeWarningWithNotes(source *Source, r Range, text string, no
 	})
 }
 
+func (log Log) AddRangeWarningWithIDAndNotes(id string, source *Source, r Range, text string, notes []MsgData) {
+	log.AddMsg(Msg{
+		ID:    id,
+		Kind:  Warning,
+		Data:  RangeData(source, r, text),
+		Notes: notes,
+	})
+}
+
 func RangeData(source *Source, r Range, text string) MsgData {
 	return MsgData{
 		Text:     text,
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"testing"
+)
+
+func TestDeferLogOverrides(t *testing.T) {
+	msgs := []Msg{
+		{ID: MsgIDEqualsNaN, Kind: Warning, Data: MsgData{Text: "nan"}},
+		{ID: MsgIDDuplicateObjectKey, Kind: Warning, Data: MsgData{Text: "key"}},
+		{ID: MsgIDImpossibleTypeof, Kind: Warning, Data: MsgData{Text: "typeof"}},
+		{ID: MsgIDAmbiguousExtension, Kind: Warning, Data: MsgData{Text: "extension"}},
+		{Kind: Warning, Data: MsgData{Text: "other"}},
+	}
+
+	// The messages are kept as they are without options
+	log := NewDeferLog()
+	for _, msg := range msgs {
+		log.AddMsg(msg)
+	}
+	if done := log.Done(); len(done) != len(msgs) || log.HasErrors() {
+		t.Fatalf("Unexpected messages: %v", done)
+	}
+
+	log = NewDeferLogWithOptions(OutputOptions{
+		Overrides: map[string]LogLevel{
+			MsgIDEqualsNaN:          LevelError,
+			MsgIDDuplicateObjectKey: LevelSilent,
+			MsgIDImpossibleTypeof:   LevelInfo,
+		},
+	})
+	for _, msg := range msgs {
+		log.AddMsg(msg)
+	}
+	if !log.HasErrors() {
+		t.Fatal("Expected errors")
+	}
+	kinds := map[string]MsgKind{}
+	for _, msg := range log.Done() {
+		kinds[msg.Data.Text] = msg.Kind
+	}
+	if len(kinds) != 3 || kinds["nan"] != Error || kinds["typeof"] != Info || kinds["other"] != Warning {
+		t.Fatalf("Unexpected messages: %v", kinds)
+	}
+}
@@ -0,0 +1,173 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/evanw/esbuild/internal/ast"
+	"github.com/evanw/esbuild/internal/config"
+	"github.com/evanw/esbuild/internal/js_ast"
+	"github.com/evanw/esbuild/internal/js_lexer"
+)
+
+// This implements a subset of the "exports" and "imports" resolution
+// algorithms from node.js, which are described here:
+// https://nodejs.org/api/esm.html#esm_resolver_algorithm_specification
+//
+// Conditions are matched in the order in which they appear in package.json.
+// The "default" condition always matches, "import" or "require" match
+// depending on the kind of the import, "browser" or "node" match depending on
+// the platform and any custom conditions from the options match too.
+
+func (r *resolver) conditionsForKind(kind ast.ImportKind) map[string]bool {
+	conditions := map[string]bool{"default": true}
+	if kind == ast.ImportRequire || kind == ast.ImportRequireResolve {
+		conditions["require"] = true
+	} else {
+		conditions["import"] = true
+	}
+	switch r.options.Platform {
+	case config.PlatformBrowser:
+		conditions["browser"] = true
+	case config.PlatformNode:
+		conditions["node"] = true
+	}
+	for _, condition := range r.options.Conditions {
+		conditions[condition] = true
+	}
+	return conditions
+}
+
+// Splits "@scope/pkg/sub/path" into "@scope/pkg" and "./sub/path"
+func splitPackageSubpath(path string) (string, string) {
+	slash := strings.IndexByte(path, '/')
+	if strings.HasPrefix(path, "@") && slash != -1 {
+		if next := strings.IndexByte(path[slash+1:], '/'); next != -1 {
+			slash += next + 1
+		} else {
+			slash = -1
+		}
+	}
+	if slash == -1 {
+		return path, "."
+	}
+	return path[:slash], "." + path[slash:]
+}
+
+func (r *resolver) loadPackageExports(absPkgPath string, exports js_ast.Expr, subpath string, kind ast.ImportKind) (PathPair, bool) {
+	// The value may be a shorthand for the main export only
+	if obj, ok := exports.Data.(*js_ast.EObject); !ok || !hasSubpathKeys(obj) {
+		if subpath != "." {
+			return PathPair{}, false
+		}
+		exports = js_ast.Expr{Data: &js_ast.EObject{Properties: []js_ast.Property{{
+			Key:   js_ast.Expr{Data: &js_ast.EString{Value: js_lexer.StringToUTF16(".")}},
+			Value: &exports,
+		}}}}
+	}
+
+	target, ok := r.matchSubpathMap(exports, subpath, r.conditionsForKind(kind))
+	if !ok || !strings.HasPrefix(target, "./") {
+		return PathPair{}, false
+	}
+	return r.loadAsFileOrDirectory(r.fs.Join(absPkgPath, target), kind)
+}
+
+func (r *resolver) loadPackageImports(pkgDirInfo *dirInfo, path string, kind ast.ImportKind) (PathPair, bool) {
+	target, ok := r.matchSubpathMap(*pkgDirInfo.packageJSON.importsJSON, path, r.conditionsForKind(kind))
+	if !ok {
+		return PathPair{}, false
+	}
+
+	// Unlike "exports", the targets of "imports" may be other packages
+	if strings.HasPrefix(target, "./") {
+		return r.loadAsFileOrDirectory(r.fs.Join(pkgDirInfo.absPath, target), kind)
+	}
+	if IsPackagePath(target) {
+		return r.loadNodeModules(target, kind, pkgDirInfo)
+	}
+	return PathPair{}, false
+}
+
+func hasSubpathKeys(obj *js_ast.EObject) bool {
+	for _, prop := range obj.Properties {
+		if key, ok := getString(prop.Key); ok && strings.HasPrefix(key, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *resolver) matchSubpathMap(json js_ast.Expr, subpath string, conditions map[string]bool) (string, bool) {
+	obj, ok := json.Data.(*js_ast.EObject)
+	if !ok {
+		return "", false
+	}
+
+	// Check for exact matches first
+	for _, prop := range obj.Properties {
+		if key, ok := getString(prop.Key); ok && key == subpath && !strings.ContainsRune(key, '*') && prop.Value != nil {
+			return resolvePackageTarget(*prop.Value, "", conditions)
+		}
+	}
+
+	// Then use the pattern with the longest prefix. Patterns either contain a
+	// single "*" or end with "/", which is the deprecated form of "/*".
+	bestPrefix := ""
+	bestMatch := ""
+	var bestTarget *js_ast.Expr
+	for _, prop := range obj.Properties {
+		key, ok := getString(prop.Key)
+		if !ok || prop.Value == nil {
+			continue
+		}
+		if star := strings.IndexByte(key, '*'); star != -1 {
+			prefix, suffix := key[:star], key[star+1:]
+			if len(prefix) > len(bestPrefix) && len(subpath) >= len(key)-1 &&
+				strings.HasPrefix(subpath, prefix) && strings.HasSuffix(subpath, suffix) {
+				bestPrefix = key
+				bestMatch = subpath[len(prefix) : len(subpath)-len(suffix)]
+				bestTarget = prop.Value
+			}
+		} else if strings.HasSuffix(key, "/") && len(key) > len(bestPrefix) && strings.HasPrefix(subpath, key) {
+			bestPrefix = key
+			bestMatch = subpath[len(key):]
+			bestTarget = prop.Value
+		}
+	}
+	if bestTarget == nil {
+		return "", false
+	}
+	target, ok := resolvePackageTarget(*bestTarget, bestMatch, conditions)
+	if ok && strings.HasSuffix(bestPrefix, "/") {
+		target += bestMatch
+	}
+	return target, ok
+}
+
+func resolvePackageTarget(target js_ast.Expr, match string, conditions map[string]bool) (string, bool) {
+	switch t := target.Data.(type) {
+	case *js_ast.EString:
+		return strings.ReplaceAll(js_lexer.UTF16ToString(t.Value), "*", match), true
+
+	case *js_ast.EArray:
+		// Use the first valid alternative
+		for _, item := range t.Items {
+			if result, ok := resolvePackageTarget(item, match, conditions); ok {
+				return result, true
+			}
+		}
+
+	case *js_ast.EObject:
+		// Use the first matching condition that leads to a valid target
+		for _, prop := range t.Properties {
+			if key, ok := getString(prop.Key); ok && conditions[key] && prop.Value != nil {
+				if result, ok := resolvePackageTarget(*prop.Value, match, conditions); ok {
+					return result, true
+				}
+			}
+		}
+	}
+
+	// A "null" target means that this subpath is explicitly not exported
+	return "", false
+}
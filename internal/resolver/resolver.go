@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -83,6 +84,15 @@ type IgnoreIfUnusedData struct {
 
 	// If true, "sideEffects" was an array. If false, "sideEffects" was false.
 	IsSideEffectsArrayInJSON bool
+
+	// If true, the module was marked by the "NoSideEffectsModules" option and
+	// the other fields are empty
+	IsNoSideEffectsOption bool
+}
+
+type DevDependencyData struct {
+	Source *logger.Source
+	Range  logger.Range
 }
 
 type ResolveResult struct {
@@ -91,6 +101,10 @@ type ResolveResult struct {
 	// If this was resolved by a plugin, the plugin gets to store its data here
 	PluginData interface{}
 
+	// If this was resolved by a plugin, the plugin can force a loader for the
+	// file here instead of the one picked by the file extension
+	Loader config.Loader
+
 	// If not empty, these should override the default values
 	JSXFactory  []string // Default if empty: "React.createElement"
 	JSXFragment []string // Default if empty: "React.Fragment"
@@ -108,6 +122,10 @@ type ResolveResult struct {
 	// behavior of the "importsNotUsedAsValues" field in "tsconfig.json" when the
 	// value is not "remove".
 	PreserveUnusedImportsTS bool
+
+	// If true, each TypeScript file is expected to be compiled on its own. This
+	// matches the behavior of the "isolatedModules" field in "tsconfig.json".
+	IsolatedModulesTS bool
 }
 
 type Resolver interface {
@@ -118,6 +136,22 @@ type Resolver interface {
 	// This tries to run "Resolve" on a package path as a relative path. If
 	// successful, the user just forgot a leading "./" in front of the path.
 	ProbeResolvePackageAsRelative(sourceDir string, importPath string, kind ast.ImportKind) *ResolveResult
+
+	// This returns the external modules and paths from the options that no
+	// import path has matched so far, sorted alphabetically. Modules that are
+	// external implicitly, like the built-in modules of node, are not included.
+	UnusedExternals() []string
+
+	// This forgets the cached information about a file or a directory and
+	// about its parent directory. It is used when the file system changes, for
+	// example when a file is added, removed or renamed in watch mode.
+	Invalidate(absPath string)
+
+	// This returns the location of the package in "devDependencies" in the
+	// nearest "package.json" enclosing the directory. It returns nil if the
+	// package is not listed there, or if it is also listed in "dependencies"
+	// or "peerDependencies". It requires the "CheckDevDependencies" option.
+	DevOnlyDependency(sourceDir string, packageName string) *DevDependencyData
 }
 
 type resolver struct {
@@ -154,9 +188,20 @@ type resolver struct {
 	// This cache maps a directory path to information about that directory and
 	// all parent directories
 	dirCache map[string]*dirInfo
+
+	// The external modules and paths from the options before the built-in
+	// modules were added and the ones that were matched by an import path
+	explicitExternals config.ExternalModules
+	usedExternals     map[string]bool
+
+	// Paths without an extension that matched multiple files, which are only
+	// reported once
+	ambiguousPaths map[string]bool
 }
 
 func NewResolver(fs fs.FS, log logger.Log, caches *cache.CacheSet, options config.Options) Resolver {
+	explicitExternals := options.ExternalModules
+
 	// Bundling for node implies allowing node's builtin modules
 	if options.Platform == config.PlatformNode {
 		externalNodeModules := make(map[string]bool)
@@ -187,9 +232,31 @@ func NewResolver(fs fs.FS, log logger.Log, caches *cache.CacheSet, options confi
 		caches:                 caches,
 		dirCache:               make(map[string]*dirInfo),
 		atImportExtensionOrder: atImportExtensionOrder,
+		explicitExternals:      explicitExternals,
+		usedExternals:          make(map[string]bool),
+		ambiguousPaths:         make(map[string]bool),
 	}
 }
 
+func (r *resolver) UnusedExternals() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var unused []string
+	for name := range r.explicitExternals.NodeModules {
+		if !r.usedExternals[name] {
+			unused = append(unused, name)
+		}
+	}
+	for absPath := range r.explicitExternals.AbsPaths {
+		if !r.usedExternals[absPath] {
+			unused = append(unused, r.PrettyPath(logger.Path{Text: absPath, Namespace: "file"}))
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
 func (r *resolver) Resolve(sourceDir string, importPath string, sourcePath string, kind ast.ImportKind) *ResolveResult {
 	// Certain types of URLs default to being external for convenience
 	if r.isExternalPattern(importPath) ||
@@ -233,6 +300,31 @@ func (r *resolver) Resolve(sourceDir string, importPath string, sourcePath strin
 	return r.finalizeResolve(*result)
 }
 
+func (r *resolver) DevOnlyDependency(sourceDir string, packageName string) *DevDependencyData {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	info := r.dirInfoCached(sourceDir)
+	for info != nil && info.packageJSON == nil {
+		info = info.parent
+	}
+	if info == nil {
+		return nil
+	}
+	return info.packageJSON.devOnlyDependencies[packageName]
+}
+
+func (r *resolver) Invalidate(absPath string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// The parent directory lists the file, so its entries must be read again
+	for _, path := range []string{absPath, r.fs.Dir(absPath)} {
+		r.fs.InvalidateDirectory(path)
+		delete(r.dirCache, path)
+	}
+}
+
 func (r *resolver) isExternalPattern(path string) bool {
 	for _, pattern := range r.options.ExternalModules.Patterns {
 		if len(path) >= len(pattern.Prefix)+len(pattern.Suffix) &&
@@ -330,6 +422,7 @@ func (r *resolver) finalizeResolve(result ResolveResult) *ResolveResult {
 					result.JSXFragment = dirInfo.tsConfigJSON.JSXFragmentFactory
 					result.UseDefineForClassFieldsTS = dirInfo.tsConfigJSON.UseDefineForClassFields
 					result.PreserveUnusedImportsTS = dirInfo.tsConfigJSON.PreserveImportsNotUsedAsValues
+					result.IsolatedModulesTS = dirInfo.tsConfigJSON.IsolatedModules
 				}
 
 				if !r.options.PreserveSymlinks {
@@ -365,6 +458,8 @@ func (r *resolver) resolveWithoutSymlinks(sourceDir string, importPath string, s
 		}
 
 		if r.options.ExternalModules.AbsPaths != nil && r.options.ExternalModules.AbsPaths[importPath] {
+			r.usedExternals[importPath] = true
+
 			// If the string literal in the source text is an absolute path and has
 			// been marked as an external module, mark it as *not* an absolute path.
 			// That way we preserve the literal text in the output and don't generate
@@ -386,6 +481,7 @@ func (r *resolver) resolveWithoutSymlinks(sourceDir string, importPath string, s
 
 		// Check for external packages first
 		if r.options.ExternalModules.AbsPaths != nil && r.options.ExternalModules.AbsPaths[absPath] {
+			r.usedExternals[absPath] = true
 			return &ResolveResult{PathPair: PathPair{Primary: logger.Path{Text: absPath, Namespace: "file"}}, IsExternal: true}
 		}
 
@@ -421,6 +517,7 @@ func (r *resolver) resolveWithoutSymlinks(sourceDir string, importPath string, s
 			query := importPath
 			for {
 				if r.options.ExternalModules.NodeModules[query] {
+					r.usedExternals[query] = true
 					return &ResolveResult{PathPair: PathPair{Primary: logger.Path{Text: importPath}}, IsExternal: true}
 				}
 
@@ -546,6 +643,11 @@ func (r *resolver) PrettyPath(path logger.Path) string {
 type packageJSON struct {
 	absMainFields map[string]string
 
+	// The "exports" and "imports" maps are kept as parsed JSON because which
+	// target they resolve to depends on the kind of each import
+	exportsJSON *js_ast.Expr
+	importsJSON *js_ast.Expr
+
 	// Present if the "browser" field is present. This field is intended to be
 	// used by bundlers and lets you redirect the paths of certain 3rd-party
 	// modules that don't work in the browser to other modules that shim that
@@ -587,6 +689,11 @@ type packageJSON struct {
 	sideEffectsMap     map[string]bool
 	sideEffectsRegexps []*regexp.Regexp
 	ignoreIfUnusedData *IgnoreIfUnusedData
+
+	// Present if the "CheckDevDependencies" option is enabled. This maps the
+	// names of the packages listed in "devDependencies", but neither in
+	// "dependencies" nor in "peerDependencies", to their locations.
+	devOnlyDependencies map[string]*DevDependencyData
 }
 
 type dirInfo struct {
@@ -907,6 +1014,20 @@ func (r *resolver) parsePackageJSON(path string) *packageJSON {
 		}
 	}
 
+	// Read the "exports" and "imports" maps
+	if exportsJson, _, ok := getProperty(json, "exports"); ok {
+		if _, isNull := exportsJson.Data.(*js_ast.ENull); !isNull {
+			packageJSON.exportsJSON = &exportsJson
+		}
+	}
+	if importsJson, _, ok := getProperty(json, "imports"); ok {
+		if _, isObject := importsJson.Data.(*js_ast.EObject); isObject {
+			packageJSON.importsJSON = &importsJson
+		} else {
+			r.log.AddWarning(&jsonSource, importsJson.Loc, "The value for \"imports\" must be an object")
+		}
+	}
+
 	// Read the "browser" property, but only when targeting the browser
 	if browserJson, _, ok := getProperty(json, "browser"); ok && r.options.Platform == config.PlatformBrowser {
 		// We both want the ability to have the option of CJS vs. ESM and the
@@ -1009,6 +1130,36 @@ func (r *resolver) parsePackageJSON(path string) *packageJSON {
 		}
 	}
 
+	// Read the "devDependencies" property, but only when checking imports
+	if devJson, _, ok := getProperty(json, "devDependencies"); ok && r.options.CheckDevDependencies {
+		if dev, ok := devJson.Data.(*js_ast.EObject); ok {
+			isProdDependency := make(map[string]bool)
+			for _, field := range []string{"dependencies", "peerDependencies"} {
+				if prodJson, _, ok := getProperty(json, field); ok {
+					if prod, ok := prodJson.Data.(*js_ast.EObject); ok {
+						for _, prop := range prod.Properties {
+							if key, ok := getString(prop.Key); ok {
+								isProdDependency[key] = true
+							}
+						}
+					}
+				}
+			}
+
+			for _, prop := range dev.Properties {
+				if key, ok := getString(prop.Key); ok && !isProdDependency[key] {
+					if packageJSON.devOnlyDependencies == nil {
+						packageJSON.devOnlyDependencies = make(map[string]*DevDependencyData)
+					}
+					packageJSON.devOnlyDependencies[key] = &DevDependencyData{
+						Source: &jsonSource,
+						Range:  jsonSource.RangeOfString(prop.Key.Loc),
+					}
+				}
+			}
+		}
+	}
+
 	return packageJSON
 }
 
@@ -1061,8 +1212,9 @@ func (r *resolver) loadAsFile(path string, extensionOrder []string) (string, boo
 	}
 
 	// Try the path with extensions
-	for _, ext := range extensionOrder {
+	for i, ext := range extensionOrder {
 		if entry, ok := entries[base+ext]; ok && entry.Kind(r.fs) == fs.FileEntry {
+			r.checkForAmbiguousExtension(path, ext, extensionOrder[i+1:], entries)
 			return path + ext, true
 		}
 	}
@@ -1096,6 +1248,29 @@ func (r *resolver) loadAsFile(path string, extensionOrder []string) (string, boo
 	return "", false
 }
 
+// Files that differ only by their extension make the file picked for a path
+// without an extension depend on the order of the extensions to try. This
+// is common enough to not be reported unless the message is enabled.
+func (r *resolver) checkForAmbiguousExtension(path string, ext string, otherExts []string, entries map[string]*fs.Entry) {
+	if r.ambiguousPaths[path] {
+		return
+	}
+	base := r.fs.Base(path)
+	candidates := []string{fmt.Sprintf("%q", base+ext)}
+	for _, other := range otherExts {
+		if entry, ok := entries[base+other]; ok && entry.Kind(r.fs) == fs.FileEntry {
+			candidates = append(candidates, fmt.Sprintf("%q", base+other))
+		}
+	}
+	if len(candidates) == 1 {
+		return
+	}
+	r.ambiguousPaths[path] = true
+	r.log.AddRangeWarningWithID(logger.MsgIDAmbiguousExtension, nil, logger.Range{},
+		fmt.Sprintf("The path %q matches multiple files (%s), using %q",
+			r.PrettyPath(logger.Path{Text: path, Namespace: "file"}), strings.Join(candidates, ", "), base+ext))
+}
+
 // We want to minimize the number of times directory contents are listed. For
 // this reason, the directory entries are computed by the caller and then
 // passed down to us.
@@ -1281,6 +1456,19 @@ func (r *resolver) matchTSConfigPaths(tsConfigJSON *TSConfigJSON, path string, k
 }
 
 func (r *resolver) loadNodeModules(path string, kind ast.ImportKind, dirInfo *dirInfo) (PathPair, bool) {
+	// Paths starting with "#" are resolved using the "imports" map from the
+	// "package.json" file of the enclosing package
+	if strings.HasPrefix(path, "#") {
+		for info := dirInfo; info != nil; info = info.parent {
+			if info.packageJSON != nil {
+				if info.packageJSON.importsJSON != nil {
+					return r.loadPackageImports(info, path, kind)
+				}
+				break
+			}
+		}
+	}
+
 	// First, check path overrides from the nearest enclosing TypeScript "tsconfig.json" file
 	if dirInfo.tsConfigJSON != nil {
 		// Try path substitutions first
@@ -1328,6 +1516,13 @@ func (r *resolver) loadNodeModules(path string, kind ast.ImportKind, dirInfo *di
 				}
 			}
 
+			// The "exports" map of a package takes precedence over its files
+			pkgName, subpath := splitPackageSubpath(path)
+			if pkgDirInfo := r.dirInfoCached(r.fs.Join(dirInfo.absPath, "node_modules", pkgName)); pkgDirInfo != nil &&
+				pkgDirInfo.packageJSON != nil && pkgDirInfo.packageJSON.exportsJSON != nil {
+				return r.loadPackageExports(pkgDirInfo.absPath, *pkgDirInfo.packageJSON.exportsJSON, subpath, kind)
+			}
+
 			if absolute, ok := r.loadAsFileOrDirectory(absPath, kind); ok {
 				return absolute, true
 			}
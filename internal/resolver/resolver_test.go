@@ -0,0 +1,96 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/evanw/esbuild/internal/ast"
+	"github.com/evanw/esbuild/internal/cache"
+	"github.com/evanw/esbuild/internal/config"
+	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/logger"
+)
+
+func TestInvalidateNewFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "",
+	})
+
+	realFS, err := fs.RealFS(fs.RealFSOptions{AbsWorkingDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver(realFS, logger.NewDeferLog(), cache.MakeCacheSet(), config.Options{
+		ExtensionOrder: []string{".js"},
+	})
+	resolve := func() *ResolveResult {
+		return r.Resolve(dir, "./added", path.Join(dir, "entry.js"), ast.ImportStmt)
+	}
+	if result := resolve(); result != nil {
+		t.Fatalf("Unexpectedly resolved to %s", result.PathPair.Primary.Text)
+	}
+
+	// The entries of the directory are cached, so the new file isn't found
+	added := path.Join(dir, "added.js")
+	if err := ioutil.WriteFile(added, []byte(""), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := resolve(); result != nil {
+		t.Fatalf("Unexpectedly resolved to %s", result.PathPair.Primary.Text)
+	}
+
+	// Invalidating the new file makes its directory be read again
+	r.Invalidate(added)
+	if result := resolve(); result == nil || result.PathPair.Primary.Text != added {
+		t.Fatalf("Failed to resolve %s", added)
+	}
+}
+
+func TestAmbiguousExtension(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "",
+		"util.js":  "",
+		"util.ts":  "",
+	})
+
+	realFS, err := fs.RealFS(fs.RealFSOptions{AbsWorkingDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := logger.NewDeferLog()
+	r := NewResolver(realFS, log, cache.MakeCacheSet(), config.Options{
+		ExtensionOrder: []string{".js", ".ts"},
+	})
+
+	// The first extension wins and the other candidates are reported once
+	for i := 0; i < 2; i++ {
+		result := r.Resolve(dir, "./util", path.Join(dir, "entry.js"), ast.ImportStmt)
+		if result == nil || result.PathPair.Primary.Text != path.Join(dir, "util.js") {
+			t.Fatalf("Failed to resolve %s", path.Join(dir, "util.js"))
+		}
+	}
+	msgs := log.Done()
+	if len(msgs) != 1 || msgs[0].ID != logger.MsgIDAmbiguousExtension ||
+		msgs[0].Data.Text != `The path "util" matches multiple files ("util.js", "util.ts"), using "util.js"` {
+		t.Fatalf("Unexpected messages: %v", msgs)
+	}
+}
+
+// This writes the files to a new temporary directory, which is removed when
+// the test ends, and returns the path of the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		file := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
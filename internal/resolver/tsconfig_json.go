@@ -34,6 +34,7 @@ type TSConfigJSON struct {
 	JSXFragmentFactory             []string
 	UseDefineForClassFields        bool
 	PreserveImportsNotUsedAsValues bool
+	IsolatedModules                bool
 }
 
 func ParseTSConfigJSON(
@@ -101,6 +102,13 @@ func ParseTSConfigJSON(
 			}
 		}
 
+		// Parse "isolatedModules"
+		if valueJSON, _, ok := getProperty(compilerOptionsJSON, "isolatedModules"); ok {
+			if value, ok := getBool(valueJSON); ok {
+				result.IsolatedModules = value
+			}
+		}
+
 		// Parse "importsNotUsedAsValues"
 		if valueJSON, _, ok := getProperty(compilerOptionsJSON, "importsNotUsedAsValues"); ok {
 			if value, ok := getString(valueJSON); ok {
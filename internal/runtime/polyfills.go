@@ -0,0 +1,43 @@
+package runtime
+
+import "github.com/evanw/esbuild/internal/compat"
+
+// A polyfill defines a runtime API that is missing in older engines. It is
+// prepended to the output if the API is used and the target doesn't support it.
+type Polyfill struct {
+	// A syntax feature introduced in the same edition of the language as the
+	// API. Targets without support for the syntax are assumed to lack the API.
+	Feature compat.JSFeature
+
+	// ES5 code, which defines the API only if it is missing
+	Code string
+}
+
+// The keys are property accesses on global objects like "Object.assign"
+var Polyfills = map[string]Polyfill{
+	"Object.assign": {
+		Feature: compat.ObjectExtensions,
+		Code: `if (typeof Object.assign !== "function") Object.assign = function(target) {
+  for (var i = 1; i < arguments.length; i++) {
+    var source = arguments[i];
+    if (source != null) for (var key in source) if (Object.prototype.hasOwnProperty.call(source, key)) target[key] = source[key];
+  }
+  return target;
+};
+`,
+	},
+	"Object.entries": {
+		Feature: compat.AsyncAwait,
+		Code: `if (typeof Object.entries !== "function") Object.entries = function(object) {
+  return Object.keys(object).map(function(key) { return [key, object[key]]; });
+};
+`,
+	},
+	"Object.values": {
+		Feature: compat.AsyncAwait,
+		Code: `if (typeof Object.values !== "function") Object.values = function(object) {
+  return Object.keys(object).map(function(key) { return object[key]; });
+};
+`,
+	},
+}
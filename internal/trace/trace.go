@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// This records spans of time in the Chrome trace event format, which can be
+// loaded in "chrome://tracing" or in Perfetto. All methods do nothing when
+// called on a nil tracer, so tracing costs nothing when it's disabled.
+//
+// Go doesn't expose goroutine ids, so spans are put on "lanes" instead, which
+// are shown as threads. A span takes the first lane that isn't used by another
+// span in progress, which means that overlapping spans never share a lane.
+type Tracer struct {
+	mutex     sync.Mutex
+	start     time.Time
+	events    []event
+	busyLanes []bool
+}
+
+// See "Complete Events" in the "Trace Event Format" document
+type event struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat"`
+	Ph   string            `json:"ph"`
+	TS   int64             `json:"ts"`
+	Dur  int64             `json:"dur"`
+	PID  int               `json:"pid"`
+	TID  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{start: time.Now()}
+}
+
+// Forgets all recorded spans, which is used to start tracing a rebuild
+func (t *Tracer) Reset() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.start = time.Now()
+	t.events = nil
+}
+
+// Starts a span and returns a function that ends it
+func (t *Tracer) Begin(category string, name string, args map[string]string) func() {
+	if t == nil {
+		return func() {}
+	}
+
+	t.mutex.Lock()
+	lane := 0
+	for lane < len(t.busyLanes) && t.busyLanes[lane] {
+		lane++
+	}
+	if lane == len(t.busyLanes) {
+		t.busyLanes = append(t.busyLanes, true)
+	} else {
+		t.busyLanes[lane] = true
+	}
+	t.mutex.Unlock()
+
+	start := time.Now()
+	return func() {
+		end := time.Now()
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.busyLanes[lane] = false
+		t.events = append(t.events, event{
+			Name: name,
+			Cat:  category,
+			Ph:   "X",
+			TS:   start.Sub(t.start).Microseconds(),
+			Dur:  end.Sub(start).Microseconds(),
+			PID:  1,
+			TID:  lane,
+			Args: args,
+		})
+	}
+}
+
+// Returns the recorded spans as a JSON object with a "traceEvents" array
+func (t *Tracer) JSON() []byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	events := t.events
+	if events == nil {
+		events = []event{}
+	}
+	bytes, _ := json.Marshal(struct {
+		TraceEvents []event `json:"traceEvents"`
+	}{events})
+	return bytes
+}
@@ -0,0 +1,191 @@
+package watcher
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/logger"
+)
+
+// This polls the file system entries used by the latest run of a build or of
+// a transform and runs it again when any of them changes.
+type Watcher struct {
+	// This is the kind of the run used in log messages, e.g. "build"
+	Name string
+
+	// This is used to print the path of a changed file in log messages
+	PrettyPath func(absPath string) string
+
+	// This runs the build or the transform again and returns the file system
+	// entries it used
+	Rerun func() fs.WatchData
+
+	mutex             sync.Mutex
+	data              fs.WatchData
+	shouldStop        int32
+	recentItems       []string
+	itemsToScan       []string
+	itemsPerIteration int
+}
+
+func (w *Watcher) SetWatchData(data fs.WatchData) {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	w.data = data
+	w.itemsToScan = w.itemsToScan[:0] // Reuse memory
+
+	// Remove any recent items that weren't a part of the latest run
+	end := 0
+	for _, path := range w.recentItems {
+		if data.Paths[path] != nil {
+			w.recentItems[end] = path
+			end++
+		}
+	}
+	w.recentItems = w.recentItems[:end]
+}
+
+// The time to wait between watch intervals
+const watchIntervalSleep = 100 * time.Millisecond
+
+// The maximum number of recently-edited items to check every interval
+const maxRecentItemCount = 16
+
+// The minimum number of non-recent items to check every interval
+const minItemCountPerIter = 64
+
+// The maximum number of intervals before a change is detected
+const maxIntervalsBeforeUpdate = 20
+
+// The time without any other change to wait for after a change is detected
+// before running again, so that a burst of changes, like saving several files
+// at once, causes a single run
+const debounceSleep = 50 * time.Millisecond
+
+func (w *Watcher) Start(logLevel logger.LogLevel, useColor logger.UseColor) {
+	go func() {
+		// Note: Do not change these log messages without a breaking version change.
+		// People want to run regexes over esbuild's stderr stream to look for these
+		// messages instead of using esbuild's API.
+
+		if logLevel == logger.LevelInfo {
+			logger.PrintTextWithColor(os.Stderr, useColor, func(colors logger.Colors) string {
+				return fmt.Sprintf("%s[watch] %s finished, watching for changes...%s\n", colors.Dim, w.Name, colors.Default)
+			})
+		}
+
+		for atomic.LoadInt32(&w.shouldStop) == 0 {
+			// Sleep for the watch interval
+			time.Sleep(watchIntervalSleep)
+
+			// Run again if we're dirty
+			if absPath := w.tryToFindDirtyPath(nil); absPath != "" {
+				if !w.waitUntilQuiet(absPath) {
+					break
+				}
+				if logLevel == logger.LevelInfo {
+					logger.PrintTextWithColor(os.Stderr, useColor, func(colors logger.Colors) string {
+						prettyPath := w.PrettyPath(absPath)
+						return fmt.Sprintf("%s[watch] %s started (change: %q)%s\n", colors.Dim, w.Name, prettyPath, colors.Default)
+					})
+				}
+
+				// Run the build or the transform
+				w.SetWatchData(w.Rerun())
+
+				if logLevel == logger.LevelInfo {
+					logger.PrintTextWithColor(os.Stderr, useColor, func(colors logger.Colors) string {
+						return fmt.Sprintf("%s[watch] %s finished%s\n", colors.Dim, w.Name, colors.Default)
+					})
+				}
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	atomic.StoreInt32(&w.shouldStop, 1)
+}
+
+// This returns false if the watcher was stopped while waiting. Each path that
+// changes during the wait restarts it, but the paths that were already found
+// changed are not checked again, since they stay changed until the next run.
+func (w *Watcher) waitUntilQuiet(absPath string) bool {
+	changed := map[string]bool{absPath: true}
+	for {
+		time.Sleep(debounceSleep)
+		if atomic.LoadInt32(&w.shouldStop) != 0 {
+			return false
+		}
+		absPath := w.tryToFindDirtyPath(changed)
+		if absPath == "" {
+			return true
+		}
+		changed[absPath] = true
+	}
+}
+
+// The paths to skip are the ones that are already known to have changed
+func (w *Watcher) tryToFindDirtyPath(skip map[string]bool) string {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+
+	// If we ran out of items to scan, fill the items back up in a random order
+	if len(w.itemsToScan) == 0 {
+		items := w.itemsToScan[:0] // Reuse memory
+		for path := range w.data.Paths {
+			items = append(items, path)
+		}
+		rand.Seed(time.Now().UnixNano())
+		for i := int32(len(items) - 1); i > 0; i-- { // Fisher–Yates shuffle
+			j := rand.Int31n(i + 1)
+			items[i], items[j] = items[j], items[i]
+		}
+		w.itemsToScan = items
+
+		// Determine how many items to check every iteration, rounded up
+		perIter := (len(items) + maxIntervalsBeforeUpdate - 1) / maxIntervalsBeforeUpdate
+		if perIter < minItemCountPerIter {
+			perIter = minItemCountPerIter
+		}
+		w.itemsPerIteration = perIter
+	}
+
+	// Always check all recent items every iteration
+	for i, path := range w.recentItems {
+		if !skip[path] && w.data.Paths[path]() {
+			// Move this path to the back of the list (i.e. the "most recent" position)
+			copy(w.recentItems[i:], w.recentItems[i+1:])
+			w.recentItems[len(w.recentItems)-1] = path
+			return path
+		}
+	}
+
+	// Check a constant number of items every iteration
+	remainingCount := len(w.itemsToScan) - w.itemsPerIteration
+	if remainingCount < 0 {
+		remainingCount = 0
+	}
+	toCheck, remaining := w.itemsToScan[remainingCount:], w.itemsToScan[:remainingCount]
+	w.itemsToScan = remaining
+
+	// Check if any of the entries in this iteration have been modified
+	for _, path := range toCheck {
+		if !skip[path] && w.data.Paths[path]() {
+			// Mark this item as recent by adding it to the back of the list
+			w.recentItems = append(w.recentItems, path)
+			if len(w.recentItems) > maxRecentItemCount {
+				// Remove items from the front of the list when we hit the limit
+				copy(w.recentItems, w.recentItems[1:])
+				w.recentItems = w.recentItems[:maxRecentItemCount]
+			}
+			return path
+		}
+	}
+	return ""
+}
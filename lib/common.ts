@@ -86,11 +86,18 @@ function pushLogFlags(flags: string[], options: CommonOptions, keys: OptionKeys,
   let color = getFlag(options, keys, 'color', mustBeBoolean);
   let logLevel = getFlag(options, keys, 'logLevel', mustBeString);
   let errorLimit = getFlag(options, keys, 'errorLimit', mustBeInteger);
+  let logOverride = getFlag(options, keys, 'logOverride', mustBeObject);
 
   if (color) flags.push(`--color=${color}`);
   else if (isTTY) flags.push(`--color=true`); // This is needed to fix "execFileSync" which buffers stderr
   flags.push(`--log-level=${logLevel || logLevelDefault}`);
   flags.push(`--error-limit=${errorLimit || 0}`);
+  if (logOverride) {
+    for (let id in logOverride) {
+      if (id.indexOf('=') >= 0) throw new Error(`Invalid log override: ${id}`);
+      flags.push(`--log-override:${id}=${logOverride[id]}`);
+    }
+  }
 }
 
 function pushCommonFlags(flags: string[], options: CommonOptions, keys: OptionKeys): void {
@@ -103,15 +110,22 @@ function pushCommonFlags(flags: string[], options: CommonOptions, keys: OptionKe
   let minifyWhitespace = getFlag(options, keys, 'minifyWhitespace', mustBeBoolean);
   let minifyIdentifiers = getFlag(options, keys, 'minifyIdentifiers', mustBeBoolean);
   let charset = getFlag(options, keys, 'charset', mustBeString);
+  let comments = getFlag(options, keys, 'comments', mustBeString);
+  let legalComments = getFlag(options, keys, 'legalComments', mustBeString);
   let treeShaking = getFlag(options, keys, 'treeShaking', mustBeStringOrBoolean);
+  let jsx = getFlag(options, keys, 'jsx', mustBeString);
   let jsxFactory = getFlag(options, keys, 'jsxFactory', mustBeString);
   let jsxFragment = getFlag(options, keys, 'jsxFragment', mustBeString);
   let define = getFlag(options, keys, 'define', mustBeObject);
   let pure = getFlag(options, keys, 'pure', mustBeArray);
+  let drop = getFlag(options, keys, 'drop', mustBeArray);
   let avoidTDZ = getFlag(options, keys, 'avoidTDZ', mustBeBoolean);
   let keepNames = getFlag(options, keys, 'keepNames', mustBeBoolean);
+  let mangleKeyframes = getFlag(options, keys, 'mangleKeyframes', mustBeBoolean);
   let banner = getFlag(options, keys, 'banner', mustBeString);
   let footer = getFlag(options, keys, 'footer', mustBeString);
+  let bannerCSS = getFlag(options, keys, 'bannerCSS', mustBeString);
+  let footerCSS = getFlag(options, keys, 'footerCSS', mustBeString);
 
   if (sourcesContent !== void 0) flags.push(`--sources-content=${sourcesContent}`);
   if (target) {
@@ -126,8 +140,11 @@ function pushCommonFlags(flags: string[], options: CommonOptions, keys: OptionKe
   if (minifyWhitespace) flags.push('--minify-whitespace');
   if (minifyIdentifiers) flags.push('--minify-identifiers');
   if (charset) flags.push(`--charset=${charset}`);
+  if (comments) flags.push(`--comments=${comments}`);
+  if (legalComments) flags.push(`--legal-comments=${legalComments}`);
   if (treeShaking !== void 0 && treeShaking !== true) flags.push(`--tree-shaking=${treeShaking}`);
 
+  if (jsx) flags.push(`--jsx=${jsx}`);
   if (jsxFactory) flags.push(`--jsx-factory=${jsxFactory}`);
   if (jsxFragment) flags.push(`--jsx-fragment=${jsxFragment}`);
   if (define) {
@@ -137,11 +154,15 @@ function pushCommonFlags(flags: string[], options: CommonOptions, keys: OptionKe
     }
   }
   if (pure) for (let fn of pure) flags.push(`--pure:${fn}`);
+  if (drop) for (let what of drop) flags.push(`--drop:${what}`);
   if (avoidTDZ) flags.push(`--avoid-tdz`);
   if (keepNames) flags.push(`--keep-names`);
+  if (mangleKeyframes) flags.push(`--mangle-keyframes`);
 
   if (banner) flags.push(`--banner=${banner}`);
   if (footer) flags.push(`--footer=${footer}`);
+  if (bannerCSS) flags.push(`--banner:css=${bannerCSS}`);
+  if (footerCSS) flags.push(`--footer:css=${footerCSS}`);
 }
 
 function flagsForBuildOptions(
@@ -174,22 +195,46 @@ function flagsForBuildOptions(
   let watch = getFlag(options, keys, 'watch', mustBeBooleanOrObject);
   let splitting = getFlag(options, keys, 'splitting', mustBeBoolean);
   let preserveSymlinks = getFlag(options, keys, 'preserveSymlinks', mustBeBoolean);
+  let reportTypeElision = getFlag(options, keys, 'reportTypeElision', mustBeBoolean);
+  let outputMode = getFlag(options, keys, 'outputMode', mustBeInteger);
+  let allowOverwrite = getFlag(options, keys, 'allowOverwrite', mustBeBoolean);
+  let wasmModule = getFlag(options, keys, 'wasmModule', mustBeBoolean);
   let metafile = getFlag(options, keys, 'metafile', mustBeString);
+  let metafilePretty = getFlag(options, keys, 'metafilePretty', mustBeBoolean);
+  let includeHashes = getFlag(options, keys, 'includeHashes', mustBeBoolean);
+  let generatePackageExports = getFlag(options, keys, 'generatePackageExports', mustBeBoolean);
+  let restrictImports = getFlag(options, keys, 'restrictImports', mustBeArray);
+  let polyfills = getFlag(options, keys, 'polyfills', mustBeBoolean);
+  let checkDevDependencies = getFlag(options, keys, 'checkDevDependencies', mustBeBoolean);
+  let noSideEffects = getFlag(options, keys, 'noSideEffects', mustBeArray);
+  let trace = getFlag(options, keys, 'trace', mustBeString);
   let outfile = getFlag(options, keys, 'outfile', mustBeString);
   let outdir = getFlag(options, keys, 'outdir', mustBeString);
   let outbase = getFlag(options, keys, 'outbase', mustBeString);
+  let entryNames = getFlag(options, keys, 'entryNames', mustBeString);
+  let chunkNames = getFlag(options, keys, 'chunkNames', mustBeString);
+  let assetNames = getFlag(options, keys, 'assetNames', mustBeString);
   let platform = getFlag(options, keys, 'platform', mustBeString);
-  let amdconfig = getFlag(options, keys, 'amdconfig', mustBeString);
+  let amdconfig = getFlag(options, keys, 'amdconfig', mustBeStringOrArray);
   let tsconfig = getFlag(options, keys, 'tsconfig', mustBeString);
   let resolveExtensions = getFlag(options, keys, 'resolveExtensions', mustBeArray);
   let nodePathsInput = getFlag(options, keys, 'nodePaths', mustBeArray);
   let mainFields = getFlag(options, keys, 'mainFields', mustBeArray);
+  let conditions = getFlag(options, keys, 'conditions', mustBeArray);
   let external = getFlag(options, keys, 'external', mustBeArray);
   let loader = getFlag(options, keys, 'loader', mustBeObject);
   let outExtension = getFlag(options, keys, 'outExtension', mustBeObject);
+  let autoExtension = getFlag(options, keys, 'autoExtension', mustBeBoolean);
+  let globalExternals = getFlag(options, keys, 'globalExternals', mustBeObject);
   let publicPath = getFlag(options, keys, 'publicPath', mustBeString);
+  let assetInlineLimit = getFlag(options, keys, 'assetInlineLimit', mustBeInteger);
   let inject = getFlag(options, keys, 'inject', mustBeArray);
   let entryPoints = getFlag(options, keys, 'entryPoints', mustBeArray);
+  let entryPointFormats = getFlag(options, keys, 'entryPointFormats', mustBeObject);
+  let formats = getFlag(options, keys, 'formats', mustBeArray);
+  let entryPointBanners = getFlag(options, keys, 'entryPointBanners', mustBeObject);
+  let entryPointFooters = getFlag(options, keys, 'entryPointFooters', mustBeObject);
+  let globRoot = getFlag(options, keys, 'globRoot', mustBeString);
   let absWorkingDir = getFlag(options, keys, 'absWorkingDir', mustBeString);
   let stdin = getFlag(options, keys, 'stdin', mustBeObject);
   let write = getFlag(options, keys, 'write', mustBeBoolean) ?? writeDefault; // Default to true if not specified
@@ -212,12 +257,39 @@ function flagsForBuildOptions(
   }
   if (splitting) flags.push('--splitting');
   if (preserveSymlinks) flags.push('--preserve-symlinks');
+  if (reportTypeElision) flags.push('--report-type-elision');
+  if (outputMode) flags.push(`--chmod=${outputMode.toString(8)}`);
+  if (allowOverwrite) flags.push('--allow-overwrite');
+  if (wasmModule) flags.push('--wasm-module');
   if (metafile) flags.push(`--metafile=${metafile}`);
+  if (metafilePretty) flags.push('--metafile-pretty');
+  if (includeHashes) flags.push('--include-hashes');
+  if (generatePackageExports) flags.push('--package-exports');
+  if (polyfills) flags.push('--polyfills');
+  if (checkDevDependencies) flags.push('--check-dev-dependencies');
+  if (noSideEffects) for (let name of noSideEffects) flags.push(`--no-side-effects:${name}`);
+  if (restrictImports) {
+    let values: string[] = [];
+    for (let value of restrictImports) {
+      value += '';
+      if (value.indexOf(',') >= 0) throw new Error(`Invalid restricted imports path: ${value}`);
+      values.push(value);
+    }
+    flags.push(`--restrict-imports=${values.join(',')}`);
+  }
+  if (trace) flags.push(`--trace=${trace}`);
   if (outfile) flags.push(`--outfile=${outfile}`);
   if (outdir) flags.push(`--outdir=${outdir}`);
   if (outbase) flags.push(`--outbase=${outbase}`);
+  if (entryNames) flags.push(`--entry-names=${entryNames}`);
+  if (chunkNames) flags.push(`--chunk-names=${chunkNames}`);
+  if (assetNames) flags.push(`--asset-names=${assetNames}`);
+  if (globRoot) flags.push(`--glob-root=${globRoot}`);
   if (platform) flags.push(`--platform=${platform}`);
-  if (amdconfig) flags.push(`--amdconfig=${amdconfig}`);
+  if (amdconfig) {
+    if (Array.isArray(amdconfig)) for (let path of amdconfig) flags.push(`--amdconfig=${path}`);
+    else flags.push(`--amdconfig=${amdconfig}`);
+  }
   if (tsconfig) flags.push(`--tsconfig=${tsconfig}`);
   if (resolveExtensions) {
     let values: string[] = [];
@@ -229,6 +301,7 @@ function flagsForBuildOptions(
     flags.push(`--resolve-extensions=${values.join(',')}`);
   }
   if (publicPath) flags.push(`--public-path=${publicPath}`);
+  if (assetInlineLimit) flags.push(`--asset-inline-limit=${assetInlineLimit}`);
   if (mainFields) {
     let values: string[] = [];
     for (let value of mainFields) {
@@ -238,6 +311,15 @@ function flagsForBuildOptions(
     }
     flags.push(`--main-fields=${values.join(',')}`);
   }
+  if (conditions) {
+    let values: string[] = [];
+    for (let value of conditions) {
+      value += '';
+      if (value.indexOf(',') >= 0) throw new Error(`Invalid condition: ${value}`);
+      values.push(value);
+    }
+    flags.push(`--conditions=${values.join(',')}`);
+  }
   if (external) for (let name of external) flags.push(`--external:${name}`);
   if (inject) for (let path of inject) flags.push(`--inject:${path}`);
   if (loader) {
@@ -252,6 +334,32 @@ function flagsForBuildOptions(
       flags.push(`--out-extension:${ext}=${outExtension[ext]}`);
     }
   }
+  if (autoExtension) flags.push('--auto-extension');
+  if (globalExternals) {
+    for (let path in globalExternals) {
+      if (path.indexOf('=') >= 0) throw new Error(`Invalid global external: ${path}`);
+      flags.push(`--global-external:${path}=${globalExternals[path]}`);
+    }
+  }
+
+  if (formats) flags.push(`--format=${formats.join(',')}`);
+  if (entryPointFormats) {
+    for (let entryPoint in entryPointFormats) {
+      flags.push(`--entry-format:${entryPoint}=${entryPointFormats[entryPoint]}`);
+    }
+  }
+  if (entryPointBanners) {
+    for (let entryPoint in entryPointBanners) {
+      if (entryPoint.indexOf('=') >= 0) throw new Error(`Invalid entry point: ${entryPoint}`);
+      flags.push(`--entry-banner:${entryPoint}=${entryPointBanners[entryPoint]}`);
+    }
+  }
+  if (entryPointFooters) {
+    for (let entryPoint in entryPointFooters) {
+      if (entryPoint.indexOf('=') >= 0) throw new Error(`Invalid entry point: ${entryPoint}`);
+      flags.push(`--entry-footer:${entryPoint}=${entryPointFooters[entryPoint]}`);
+    }
+  }
 
   if (entryPoints) {
     for (let entryPoint of entryPoints) {
@@ -309,14 +417,18 @@ function flagsForTransformOptions(
 
   let sourcemap = getFlag(options, keys, 'sourcemap', mustBeStringOrBoolean);
   let tsconfigRaw = getFlag(options, keys, 'tsconfigRaw', mustBeStringOrObject);
+  let isolatedModules = getFlag(options, keys, 'isolatedModules', mustBeBoolean);
   let sourcefile = getFlag(options, keys, 'sourcefile', mustBeString);
   let loader = getFlag(options, keys, 'loader', mustBeString);
+  let inject = getFlag(options, keys, 'inject', mustBeArray);
   checkForInvalidFlags(options, keys, `in ${callName}() call`);
 
   if (sourcemap) flags.push(`--sourcemap=${sourcemap === true ? 'external' : sourcemap}`);
   if (tsconfigRaw) flags.push(`--tsconfig-raw=${typeof tsconfigRaw === 'string' ? tsconfigRaw : JSON.stringify(tsconfigRaw)}`);
+  if (isolatedModules) flags.push('--isolated-modules');
   if (sourcefile) flags.push(`--sourcefile=${sourcefile}`);
   if (loader) flags.push(`--loader=${loader}`);
+  if (inject) for (let path of inject) flags.push(`--inject:${path}`);
 
   return flags;
 }
@@ -345,12 +457,16 @@ function flagsForAnalyseOptions(
   let bundle = getFlag(options, keys, 'bundle', mustBeBoolean);
   let splitting = getFlag(options, keys, 'splitting', mustBeBoolean);
   let metafile = getFlag(options, keys, 'metafile', mustBeString);
+  let pretty = getFlag(options, keys, 'pretty', mustBeBoolean);
+  let includeHashes = getFlag(options, keys, 'includeHashes', mustBeBoolean);
+  let includeDefineStats = getFlag(options, keys, 'includeDefineStats', mustBeBoolean);
   let platform = getFlag(options, keys, 'platform', mustBeString);
-  let amdconfig = getFlag(options, keys, 'amdconfig', mustBeString);
+  let amdconfig = getFlag(options, keys, 'amdconfig', mustBeStringOrArray);
   let tsconfig = getFlag(options, keys, 'tsconfig', mustBeString);
   let resolveExtensions = getFlag(options, keys, 'resolveExtensions', mustBeArray);
   let nodePathsInput = getFlag(options, keys, 'nodePaths', mustBeArray);
   let mainFields = getFlag(options, keys, 'mainFields', mustBeArray);
+  let conditions = getFlag(options, keys, 'conditions', mustBeArray);
   let external = getFlag(options, keys, 'external', mustBeArray);
   let loader = getFlag(options, keys, 'loader', mustBeObject);
   let entryPoints = getFlag(options, keys, 'entryPoints', mustBeArray);
@@ -363,8 +479,14 @@ function flagsForAnalyseOptions(
   if (bundle) flags.push('--bundle');
   if (splitting) flags.push('--splitting');
   if (metafile) flags.push(`--metafile=${metafile}`);
+  if (pretty) flags.push('--metafile-pretty');
+  if (includeHashes) flags.push('--include-hashes');
+  if (includeDefineStats) flags.push('--include-define-stats');
   if (platform) flags.push(`--platform=${platform}`);
-  if (amdconfig) flags.push(`--amdconfig=${amdconfig}`);
+  if (amdconfig) {
+    if (Array.isArray(amdconfig)) for (let path of amdconfig) flags.push(`--amdconfig=${path}`);
+    else flags.push(`--amdconfig=${amdconfig}`);
+  }
   if (tsconfig) flags.push(`--tsconfig=${tsconfig}`);
   if (resolveExtensions) {
     let values: string[] = [];
@@ -384,6 +506,15 @@ function flagsForAnalyseOptions(
     }
     flags.push(`--main-fields=${values.join(',')}`);
   }
+  if (conditions) {
+    let values: string[] = [];
+    for (let value of conditions) {
+      value += '';
+      if (value.indexOf(',') >= 0) throw new Error(`Invalid condition: ${value}`);
+      values.push(value);
+    }
+    flags.push(`--conditions=${values.join(',')}`);
+  }
   if (external) for (let name of external) flags.push(`--external:${name}`);
   if (loader) {
     for (let ext in loader) {
@@ -760,6 +891,7 @@ export function createChannel(streamIn: StreamIn): StreamOut {
                 namespace: request.namespace,
                 resolveDir: request.resolveDir,
                 pluginData: stash.load(request.pluginData),
+                with: request.with,
               });
 
               if (result != null) {
@@ -769,7 +901,10 @@ export function createChannel(streamIn: StreamIn): StreamOut {
                 let path = getFlag(result, keys, 'path', mustBeString);
                 let namespace = getFlag(result, keys, 'namespace', mustBeString);
                 let external = getFlag(result, keys, 'external', mustBeBoolean);
+                let loader = getFlag(result, keys, 'loader', mustBeString);
                 let pluginData = getFlag(result, keys, 'pluginData', canBeAnything);
+                let watchFiles = getFlag(result, keys, 'watchFiles', mustBeArray);
+                let watchDirs = getFlag(result, keys, 'watchDirs', mustBeArray);
                 let errors = getFlag(result, keys, 'errors', mustBeArray);
                 let warnings = getFlag(result, keys, 'warnings', mustBeArray);
                 checkForInvalidFlags(result, keys, `from onResolve() callback in plugin ${JSON.stringify(name)}`);
@@ -779,7 +914,10 @@ export function createChannel(streamIn: StreamIn): StreamOut {
                 if (path != null) response.path = path;
                 if (namespace != null) response.namespace = namespace;
                 if (external != null) response.external = external;
+                if (loader != null) response.loader = loader;
                 if (pluginData != null) response.pluginData = stash.store(pluginData);
+                if (watchFiles != null) response.watchFiles = watchFiles.map(String);
+                if (watchDirs != null) response.watchDirs = watchDirs.map(String);
                 if (errors != null) response.errors = sanitizeMessages(errors, 'errors', stash);
                 if (warnings != null) response.warnings = sanitizeMessages(warnings, 'warnings', stash);
                 break;
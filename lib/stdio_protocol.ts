@@ -121,6 +121,7 @@ export interface OnResolveRequest {
   namespace: string;
   resolveDir: string;
   pluginData: number;
+  with: Record<string, string>;
 }
 
 export interface OnResolveResponse {
@@ -133,7 +134,10 @@ export interface OnResolveResponse {
   path?: string;
   external?: boolean;
   namespace?: string;
+  loader?: string;
   pluginData?: number;
+  watchFiles?: string[];
+  watchDirs?: string[];
 }
 
 export interface OnLoadRequest {
@@ -1,9 +1,12 @@
 export type Platform = 'browser' | 'node' | 'neutral';
-export type Format = 'iife' | 'cjs' | 'umd' | 'esm';
-export type Loader = 'js' | 'jsx' | 'ts' | 'tsx' | 'css' | 'json' | 'text' | 'base64' | 'file' | 'dataurl' | 'binary' | 'default';
+export type Format = 'iife' | 'cjs' | 'umd' | 'system' | 'esm';
+export type Loader = 'js' | 'jsx' | 'ts' | 'tsx' | 'css' | 'json' | 'json5' | 'text' | 'base64' | 'file' | 'asset' | 'dataurl' | 'binary' | 'default';
 export type LogLevel = 'info' | 'warning' | 'error' | 'silent';
 export type Charset = 'ascii' | 'utf8';
+export type Comments = 'all' | 'none' | 'legal';
+export type LegalComments = 'none' | 'inline' | 'eof' | 'linked' | 'external';
 export type TreeShaking = true | 'ignore-annotations';
+export type JSX = 'transform' | 'preserve';
 
 interface CommonOptions {
   sourcemap?: boolean | 'inline' | 'external' | 'both';
@@ -18,19 +21,27 @@ interface CommonOptions {
   minifyIdentifiers?: boolean;
   minifySyntax?: boolean;
   charset?: Charset;
+  comments?: Comments;
+  legalComments?: LegalComments;
   treeShaking?: TreeShaking;
 
+  jsx?: JSX;
   jsxFactory?: string;
   jsxFragment?: string;
   define?: { [key: string]: string };
   pure?: string[];
+  drop?: string[];
   avoidTDZ?: boolean;
   keepNames?: boolean;
+  mangleKeyframes?: boolean;
   banner?: string;
   footer?: string;
+  bannerCSS?: string;
+  footerCSS?: string;
 
   color?: boolean;
   logLevel?: LogLevel;
+  logOverride?: Record<string, LogLevel>;
   errorLimit?: number;
 }
 
@@ -38,23 +49,47 @@ export interface BuildOptions extends CommonOptions {
   bundle?: boolean;
   splitting?: boolean;
   preserveSymlinks?: boolean;
+  reportTypeElision?: boolean;
+  allowOverwrite?: boolean;
+  wasmModule?: boolean;
   outfile?: string;
   metafile?: string;
+  metafilePretty?: boolean;
+  includeHashes?: boolean;
+  generatePackageExports?: boolean;
+  restrictImports?: string[];
+  polyfills?: boolean;
+  checkDevDependencies?: boolean;
+  noSideEffects?: string[];
+  trace?: string;
   outdir?: string;
   outbase?: string;
+  entryNames?: string;
+  chunkNames?: string;
+  assetNames?: string;
+  outputMode?: number;
   platform?: Platform;
   external?: string[];
   loader?: { [ext: string]: Loader };
   resolveExtensions?: string[];
   mainFields?: string[];
+  conditions?: string[];
   write?: boolean;
-  amdconfig?: string;
+  amdconfig?: string | string[];
   tsconfig?: string;
   outExtension?: { [ext: string]: string };
+  autoExtension?: boolean;
+  globalExternals?: { [path: string]: string };
   publicPath?: string;
+  assetInlineLimit?: number;
   inject?: string[];
   incremental?: boolean;
   entryPoints?: string[];
+  entryPointFormats?: { [entryPoint: string]: Format };
+  formats?: Format[];
+  entryPointBanners?: { [entryPoint: string]: string };
+  entryPointFooters?: { [entryPoint: string]: string };
+  globRoot?: string; // Where relative entry points with "*" wildcards start
   stdin?: StdinOptions;
   plugins?: Plugin[];
   absWorkingDir?: string;
@@ -153,11 +188,14 @@ export interface TransformOptions extends CommonOptions {
       jsxFragmentFactory?: string,
       useDefineForClassFields?: boolean,
       importsNotUsedAsValues?: 'remove' | 'preserve' | 'error',
+      isolatedModules?: boolean,
     },
   };
+  isolatedModules?: boolean;
 
   sourcefile?: string;
   loader?: Loader;
+  inject?: string[];
 }
 
 export interface TransformResult {
@@ -194,6 +232,7 @@ export interface OnResolveArgs {
   namespace: string;
   resolveDir: string;
   pluginData: any;
+  with: Record<string, string>;
 }
 
 export interface OnResolveResult {
@@ -205,7 +244,11 @@ export interface OnResolveResult {
   path?: string;
   external?: boolean;
   namespace?: string;
+  loader?: Loader;
   pluginData?: any;
+
+  watchFiles?: string[];
+  watchDirs?: string[];
 }
 
 export interface OnLoadOptions {
@@ -258,13 +301,17 @@ export interface AnalyseOptions extends CommonOptions {
   bundle?: boolean;
   splitting?: boolean;
   metafile?: string;
+  pretty?: boolean;
+  includeHashes?: boolean;
+  includeDefineStats?: boolean;
   platform?: Platform;
   external?: string[];
   loader?: { [ext: string]: Loader };
   resolveExtensions?: string[];
   mainFields?: string[];
+  conditions?: string[];
   write?: boolean;
-  amdconfig?: string;
+  amdconfig?: string | string[];
   tsconfig?: string;
 
   entryPoints?: string[];
@@ -294,12 +341,15 @@ export interface AnalyseMetadata {
   inputs: {
     [path: string]: {
       bytes: number
+      hash?: string // Only with "includeHashes: true"
       imports: {
         path: string
         kind: MetadataImportKind
+        original: string // The import path as written in the source code
       }[]
     }
   }
+  defines?: { [key: string]: number } // Only with "includeDefineStats: true"
 }
 
 // This is the type information for the "metafile" JSON format from build
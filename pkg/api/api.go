@@ -107,6 +107,8 @@
 //
 package api
 
+import "time"
+
 type SourceMap uint8
 
 const (
@@ -146,10 +148,12 @@ const (
 	LoaderTS
 	LoaderTSX
 	LoaderJSON
+	LoaderJSON5
 	LoaderText
 	LoaderBase64
 	LoaderDataURL
 	LoaderFile
+	LoaderAsset // Inlines files smaller than "AssetInlineLimit" like "dataurl", otherwise like "file"
 	LoaderBinary
 	LoaderCSS
 	LoaderDefault
@@ -171,17 +175,22 @@ const (
 	FormatCommonJS
 	FormatUMD
 	FormatESModule
+	FormatSystemJS
 )
 
 type EngineName uint8
 
 const (
 	EngineChrome EngineName = iota
+	EngineDeno
 	EngineEdge
 	EngineFirefox
+	EngineHermes
 	EngineIOS
 	EngineNode
+	EngineOpera
 	EngineSafari
+	EngineSamsung
 )
 
 type Engine struct {
@@ -238,6 +247,33 @@ const (
 	CharsetUTF8
 )
 
+type Comments uint8
+
+const (
+	CommentsDefault Comments = iota
+	CommentsAll
+	CommentsNone
+	CommentsLegal
+)
+
+type LegalComments uint8
+
+const (
+	LegalCommentsDefault LegalComments = iota
+	LegalCommentsNone
+	LegalCommentsInline
+	LegalCommentsEndOfFile
+	LegalCommentsLinked
+	LegalCommentsExternal
+)
+
+type JSXMode uint8
+
+const (
+	JSXModeTransform JSXMode = iota
+	JSXModePreserve
+)
+
 type TreeShaking uint8
 
 const (
@@ -249,9 +285,10 @@ const (
 // Build API
 
 type BuildOptions struct {
-	Color      StderrColor
-	ErrorLimit int
-	LogLevel   LogLevel
+	Color       StderrColor
+	ErrorLimit  int
+	LogLevel    LogLevel
+	LogOverride map[string]LogLevel
 
 	Sourcemap      SourceMap
 	SourcesContent SourcesContent
@@ -262,46 +299,98 @@ type BuildOptions struct {
 	MinifyWhitespace  bool
 	MinifyIdentifiers bool
 	MinifySyntax      bool
+	MangleKeyframes   bool // Renames "@keyframes" in CSS consistently within the bundle
 	Charset           Charset
+	Comments          Comments
+	LegalComments     LegalComments
 	TreeShaking       TreeShaking
 
+	JSXMode     JSXMode
 	JSXFactory  string
 	JSXFragment string
 
-	Define    map[string]string
-	Pure      []string
-	AvoidTDZ  bool
-	KeepNames bool
+	Define      map[string]string
+	Pure        []string
+	Drop        []string // "console", "console.METHOD" or "debugger"
+	AvoidTDZ    bool
+	KeepNames   bool
+	ProcessShim *ProcessShim
+	WasmModule  bool // Import ".wasm" files as modules with named exports
 
 	GlobalName        string
+	GlobalExternals   map[string]string // Browser globals of external modules in the UMD format
 	Bundle            bool
 	PreserveSymlinks  bool
+	AllowOverwrite    bool // Allows output files to overwrite input files
 	Splitting         bool
 	Outfile           string
 	Metafile          string
+	MetafilePretty    bool // Indents the metafile instead of writing compact JSON
+	IncludeHashes     bool // Adds "hash" to the inputs in the metafile
 	Outdir            string
 	Outbase           string
+	EntryNames        string // Entry points, like "[dir]/[name]-[hash]"
+	ChunkNames        string // Shared chunks, like "chunks/[name]-[hash]"
+	AssetNames        string // Files from the "file" loader, like "assets/[dir]/[name]-[hash]"
+	OutputMode        uint32 // Permissions of entry points, like 0755 (default 0755 with a hashbang, 0644 otherwise)
 	AbsWorkingDir     string
 	Platform          Platform
 	Format            Format
+	Formats           []Format // Overrides "Format" to build both "esm" and "cjs" from one scan
 	External          []string
 	MainFields        []string
+	Conditions        []string
 	Loader            map[string]Loader
+	AssetInlineLimit  int // Files smaller than this many bytes are inlined by the "asset" loader
 	ResolveExtensions []string
 	AMDConfig         string
+	AMDConfigs        []string // Merged after "AMDConfig" in order, later files override earlier ones
 	Tsconfig          string
+	ReportTypeElision bool // Logs the TypeScript imports that were removed as type-only
 	OutExtensions     map[string]string
+	AutoExtension     bool // Uses ".mjs" for "esm" and ".cjs" for "cjs" unless ".js" is in OutExtensions
 	PublicPath        string
 	Inject            []string
-	Banner            string
-	Footer            string
+	Banner            string // Prepended to JavaScript output files
+	Footer            string // Appended to JavaScript output files
+	BannerCSS         string
+	FooterCSS         string
 	NodePaths         []string // The "NODE_PATH" variable from Node.js
 
-	EntryPoints []string
-	Stdin       *StdinOptions
-	Write       bool
-	Incremental bool
-	Plugins     []Plugin
+	EntryPoints       []string          // Can contain "*" and "**" wildcards
+	EntryPointFormats map[string]Format // Overrides "Format" for these entry points
+	EntryPointBanners map[string]string // Added after "Banner" to the outputs of these entry points
+	EntryPointFooters map[string]string // Added after "Footer" to the outputs of these entry points
+	GlobRoot          string            // Where relative wildcard entry points start
+	Stdin             *StdinOptions
+	Write             bool
+	SortOutputFiles   bool // Entry points first, then source maps, chunks and assets
+	Incremental       bool // Fills in "Rebuild" in the build result
+	CollectMetrics    bool // Fills in "Metrics" in the build result
+	Plugins           []Plugin
+
+	// Writes "package-exports.json" to the output directory with the "exports"
+	// field for "package.json", which points at the outputs of the entry points
+	GeneratePackageExports bool
+
+	// Reports imports of files outside of all of these directories as errors,
+	// except for the files inside "node_modules"
+	RestrictImports []string
+
+	// Package names or paths of modules, which have no side effects, so that
+	// their unused imports are removed like with "sideEffects" in package.json
+	NoSideEffects []string
+
+	// Prepends polyfills of the runtime APIs like "Object.assign", which are
+	// used in the bundle, but missing in the target
+	Polyfills bool
+
+	// Warns about bundled packages, which are listed only in "devDependencies"
+	// of the nearest package.json and thus may be missing in production
+	CheckDevDependencies bool
+
+	Cancel <-chan struct{} // Closing it stops this build early, but not its rebuilds
+	Trace  string          // Writes the spans of time spent in the build in the Chrome trace format
 
 	Watch *WatchMode
 }
@@ -309,7 +398,20 @@ type BuildOptions struct {
 type WatchMode struct {
 	SpinnerBusy string
 	SpinnerIdle []string
-	OnRebuild   func(BuildResult)
+
+	// This is called with the result of every rebuild, including its errors.
+	// It runs on the goroutine of the watcher, which doesn't look for further
+	// changes until it returns, so it should not block.
+	OnRebuild func(BuildResult)
+}
+
+// Replaces "process.platform" and "process.arch" with constants, which lets
+// the platform-specific branches of a node tool be eliminated. Empty fields
+// default to the platform and architecture of the build host, named the way
+// node names them. Explicit entries in "Define" take precedence.
+type ProcessShim struct {
+	Platform string
+	Arch     string
 }
 
 type StdinOptions struct {
@@ -324,9 +426,39 @@ type BuildResult struct {
 	Warnings []Message
 
 	OutputFiles []OutputFile
+	Metadata    []byte // Only when "Metafile" is set, even if it is not written
 
 	Rebuild func() BuildResult // Only when "Incremental: true"
+
+	// Like "Rebuild", but closing the channel stops this rebuild early. Only
+	// when "Incremental: true". The rebuilds started by the watcher are stopped
+	// early by "Stop".
+	RebuildWithCancel func(cancel <-chan struct{}) BuildResult
+
 	Stop    func()             // Only when "Watch: true"
+	Metrics *BuildMetrics      // Only when "CollectMetrics: true"
+
+	Cancelled bool // Nothing was written or returned because "Cancel" was closed
+}
+
+type BuildMetrics struct {
+	ResolverTime  time.Duration // Creating the resolver
+	ScanTime      time.Duration // Scanning and parsing all input files
+	CompileTime   time.Duration // Linking and generating all output files
+	FilesParsed   int
+	FilesReparsed int // Files not reused from the previous incremental build
+	Plugins       []PluginMetrics
+}
+
+// Tells if the callbacks of a plugin were called during the build. A callback
+// is called only if its filter and namespace matched. If it returned no result
+// after that, the path was passed through to the next plugin or esbuild itself.
+type PluginMetrics struct {
+	Name           string
+	ResolveMatches int // Calls of the "OnResolve" callbacks
+	ResolveHandled int // Calls of the "OnResolve" callbacks that returned a path
+	LoadMatches    int // Calls of the "OnLoad" callbacks
+	LoadHandled    int // Calls of the "OnLoad" callbacks that returned contents
 }
 
 type OutputFile struct {
@@ -342,9 +474,10 @@ func Build(options BuildOptions) BuildResult {
 // Transform API
 
 type TransformOptions struct {
-	Color      StderrColor
-	ErrorLimit int
-	LogLevel   LogLevel
+	Color       StderrColor
+	ErrorLimit  int
+	LogLevel    LogLevel
+	LogOverride map[string]LogLevel
 
 	Sourcemap      SourceMap
 	SourcesContent SourcesContent
@@ -357,22 +490,38 @@ type TransformOptions struct {
 	MinifyWhitespace  bool
 	MinifyIdentifiers bool
 	MinifySyntax      bool
+	MangleKeyframes   bool // Renames "@keyframes" in CSS consistently within the bundle
 	Charset           Charset
+	Comments          Comments
+	LegalComments     LegalComments
 	TreeShaking       TreeShaking
 
+	JSXMode     JSXMode
 	JSXFactory  string
 	JSXFragment string
 	TsconfigRaw string
 	Footer      string
 	Banner      string
+	FooterCSS   string
+	BannerCSS   string
 
 	Define    map[string]string
 	Pure      []string
+	Drop      []string // "console", "console.METHOD" or "debugger"
+	Inject    []string // Files read from the file system, unlike the input
 	AvoidTDZ  bool
 	KeepNames bool
 
+	IsolatedModules bool // Also enabled by "isolatedModules" in "TsconfigRaw"
+
 	Sourcefile string
 	Loader     Loader
+
+	// Only "OnLoad" callbacks in the "stdin" namespace are called. They get the
+	// input in "PluginData" and can return the contents to transform instead.
+	Plugins []Plugin
+
+	Stats bool // Fills in "Stats" in the transform result
 }
 
 type TransformResult struct {
@@ -381,19 +530,36 @@ type TransformResult struct {
 
 	Code []byte
 	Map  []byte
+
+	Loader Loader // The loader used, which may have been inferred from "Sourcefile"
+	Module bool   // True if the input used "import" or "export", so it was a module and not a script
+	Stats  *TransformStats
+}
+
+type TransformStats struct {
+	InputBytes  int
+	OutputBytes int
+	Lowered     []string // Lowered syntax features like "arrow" or "template-literal"
 }
 
 func Transform(input string, options TransformOptions) TransformResult {
 	return transformImpl(input, options)
 }
 
+// This returns the loader that "Transform" infers from the extension of the
+// file name in "Sourcefile" if "Loader" is not set
+func LoaderForFile(path string) Loader {
+	return loaderForFileImpl(path)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Analyse API
 
 type AnalyseOptions struct {
-	Color      StderrColor
-	ErrorLimit int
-	LogLevel   LogLevel
+	Color       StderrColor
+	ErrorLimit  int
+	LogLevel    LogLevel
+	LogOverride map[string]LogLevel
 
 	Target  Target
 	Engines []Engine
@@ -404,19 +570,26 @@ type AnalyseOptions struct {
 	Define map[string]string
 	Pure   []string
 
-	GlobalName        string
-	Bundle            bool
-	Splitting         bool
-	Metafile          string
-	AbsWorkingDir     string
-	Platform          Platform
-	External          []string
-	MainFields        []string
-	Loader            map[string]Loader
-	ResolveExtensions []string
-	AMDConfig         string
-	Tsconfig          string
-	NodePaths         []string // The "NODE_PATH" variable from Node.js
+	Charset Charset
+
+	GlobalName         string
+	Bundle             bool
+	Splitting          bool
+	Metafile           string
+	Pretty             bool // Indents the metafile instead of writing compact JSON
+	IncludeHashes      bool // Adds "hash" to the inputs in the metafile
+	IncludeDefineStats bool // Adds "defines" with substitution counts to the metafile
+	AbsWorkingDir      string
+	Platform           Platform
+	External           []string
+	MainFields         []string
+	Conditions         []string
+	Loader             map[string]Loader
+	ResolveExtensions  []string
+	AMDConfig          string
+	AMDConfigs         []string // Merged after "AMDConfig" in order, later files override earlier ones
+	Tsconfig           string
+	NodePaths          []string // The "NODE_PATH" variable from Node.js
 
 	EntryPoints []string
 	Stdin       *StdinOptions
@@ -435,6 +608,45 @@ func Analyse(options AnalyseOptions) AnalyseResult {
 	return analyseImpl(options)
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// AMD Config API
+
+type AMDConfigOptions struct {
+	Color      StderrColor
+	ErrorLimit int
+	LogLevel   LogLevel
+
+	AbsWorkingDir string
+	AMDConfig     string
+}
+
+type AMDConfigResult struct {
+	Errors   []Message
+	Warnings []Message
+}
+
+// This checks the AMD config without building anything. All problems in the
+// config are reported, not just the first one, and the targets of "paths"
+// and the locations of "packages" are checked to exist in the file system.
+func ValidateAMDConfig(options AMDConfigOptions) AMDConfigResult {
+	return validateAMDConfigImpl(options)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Features API
+
+type Features struct {
+	UnsupportedJS  []string // Names like "arrow" or "optional-chain"
+	UnsupportedCSS []string // Names like "hex-rgba"
+}
+
+// This returns the features that are not supported by the target and the
+// engines, which are the features that a build or transform would lower.
+// The names are sorted alphabetically.
+func FeaturesForTarget(target Target, engines []Engine) (Features, error) {
+	return featuresForTargetImpl(target, engines)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Serve API
 
@@ -473,8 +685,15 @@ type Plugin struct {
 }
 
 type PluginBuild interface {
+	OnStart(callback func())
 	OnResolve(options OnResolveOptions, callback func(OnResolveArgs) (OnResolveResult, error))
 	OnLoad(options OnLoadOptions, callback func(OnLoadArgs) (OnLoadResult, error))
+	OnEnd(callback func(result BuildResult))
+
+	// Adds an entry point to the build, which is resolved and loaded like the
+	// other entry points, so it can be a virtual path that the plugin handles
+	// in its own "OnResolve" and "OnLoad" callbacks
+	AddEntryPoint(path string)
 }
 
 type OnResolveOptions struct {
@@ -488,6 +707,7 @@ type OnResolveArgs struct {
 	Namespace  string
 	ResolveDir string
 	PluginData interface{}
+	With       map[string]string // The import attributes like "type"
 }
 
 type OnResolveResult struct {
@@ -499,7 +719,11 @@ type OnResolveResult struct {
 	Path       string
 	External   bool
 	Namespace  string
+	Loader     Loader // Overrides the loader picked by the file extension
 	PluginData interface{}
+
+	WatchFiles []string // Changes to these files cause a rebuild in watch mode
+	WatchDirs  []string // Changes to the entries of these directories cause a rebuild in watch mode
 }
 
 type OnLoadOptions struct {
@@ -1,15 +1,16 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"mime"
 	"net"
 	"net/http"
 	"os"
 	"path"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,8 +27,11 @@ import (
 	"github.com/evanw/esbuild/internal/js_ast"
 	"github.com/evanw/esbuild/internal/js_lexer"
 	"github.com/evanw/esbuild/internal/js_parser"
+	"github.com/evanw/esbuild/internal/js_printer"
 	"github.com/evanw/esbuild/internal/logger"
 	"github.com/evanw/esbuild/internal/resolver"
+	"github.com/evanw/esbuild/internal/trace"
+	"github.com/evanw/esbuild/internal/watcher"
 )
 
 func validatePlatform(value Platform) config.Platform {
@@ -53,6 +57,8 @@ func validateFormat(value Format) config.Format {
 		return config.FormatCommonJS
 	case FormatUMD:
 		return config.FormatUMD
+	case FormatSystemJS:
+		return config.FormatSystemJS
 	case FormatESModule:
 		return config.FormatESModule
 	default:
@@ -105,6 +111,17 @@ func validateLogLevel(value LogLevel) logger.LogLevel {
 	}
 }
 
+func validateLogOverrides(value map[string]LogLevel) map[string]logger.LogLevel {
+	if value == nil {
+		return nil
+	}
+	overrides := make(map[string]logger.LogLevel, len(value))
+	for id, level := range value {
+		overrides[id] = validateLogLevel(level)
+	}
+	return overrides
+}
+
 func validateASCIIOnly(value Charset) bool {
 	switch value {
 	case CharsetDefault, CharsetASCII:
@@ -116,6 +133,40 @@ func validateASCIIOnly(value Charset) bool {
 	}
 }
 
+func validateComments(value Comments) config.Comments {
+	switch value {
+	case CommentsDefault:
+		return config.CommentsDefault
+	case CommentsAll:
+		return config.CommentsAll
+	case CommentsNone:
+		return config.CommentsNone
+	case CommentsLegal:
+		return config.CommentsLegal
+	default:
+		panic("Invalid comments")
+	}
+}
+
+func validateLegalComments(value LegalComments) config.LegalComments {
+	switch value {
+	case LegalCommentsDefault:
+		return config.LegalCommentsDefault
+	case LegalCommentsNone:
+		return config.LegalCommentsNone
+	case LegalCommentsInline:
+		return config.LegalCommentsInline
+	case LegalCommentsEndOfFile:
+		return config.LegalCommentsEndOfFile
+	case LegalCommentsLinked:
+		return config.LegalCommentsLinkedWithComment
+	case LegalCommentsExternal:
+		return config.LegalCommentsExternalWithoutComment
+	default:
+		panic("Invalid legal comments")
+	}
+}
+
 func validateIgnoreDCEAnnotations(value TreeShaking) bool {
 	switch value {
 	case TreeShakingDefault:
@@ -127,6 +178,11 @@ func validateIgnoreDCEAnnotations(value TreeShaking) bool {
 	}
 }
 
+var loaderNames = map[config.Loader]string{
+	config.LoaderFile:  "file",
+	config.LoaderAsset: "asset",
+}
+
 func validateLoader(value Loader) config.Loader {
 	switch value {
 	case LoaderNone:
@@ -141,6 +197,8 @@ func validateLoader(value Loader) config.Loader {
 		return config.LoaderTSX
 	case LoaderJSON:
 		return config.LoaderJSON
+	case LoaderJSON5:
+		return config.LoaderJSON5
 	case LoaderText:
 		return config.LoaderText
 	case LoaderBase64:
@@ -149,6 +207,8 @@ func validateLoader(value Loader) config.Loader {
 		return config.LoaderDataURL
 	case LoaderFile:
 		return config.LoaderFile
+	case LoaderAsset:
+		return config.LoaderAsset
 	case LoaderBinary:
 		return config.LoaderBinary
 	case LoaderCSS:
@@ -164,16 +224,24 @@ func validateEngine(value EngineName) compat.Engine {
 	switch value {
 	case EngineChrome:
 		return compat.Chrome
+	case EngineDeno:
+		return compat.Deno
 	case EngineEdge:
 		return compat.Edge
 	case EngineFirefox:
 		return compat.Firefox
+	case EngineHermes:
+		return compat.Hermes
 	case EngineIOS:
 		return compat.IOS
 	case EngineNode:
 		return compat.Node
+	case EngineOpera:
+		return compat.Opera
 	case EngineSafari:
 		return compat.Safari
+	case EngineSamsung:
+		return compat.Samsung
 	default:
 		panic("Invalid loader")
 	}
@@ -217,16 +285,24 @@ func validateFeatures(log logger.Log, target Target, engines []Engine) (compat.J
 				switch engine.Name {
 				case EngineChrome:
 					constraints[compat.Chrome] = version
+				case EngineDeno:
+					constraints[compat.Deno] = version
 				case EngineEdge:
 					constraints[compat.Edge] = version
 				case EngineFirefox:
 					constraints[compat.Firefox] = version
+				case EngineHermes:
+					constraints[compat.Hermes] = version
 				case EngineIOS:
 					constraints[compat.IOS] = version
 				case EngineNode:
 					constraints[compat.Node] = version
+				case EngineOpera:
+					constraints[compat.Opera] = version
 				case EngineSafari:
 					constraints[compat.Safari] = version
+				case EngineSamsung:
+					constraints[compat.Samsung] = version
 				default:
 					panic("Invalid engine name")
 				}
@@ -240,6 +316,34 @@ func validateFeatures(log logger.Log, target Target, engines []Engine) (compat.J
 	return compat.UnsupportedJSFeatures(constraints), compat.UnsupportedCSSFeatures(constraints)
 }
 
+func featuresForTargetImpl(target Target, engines []Engine) (Features, error) {
+	log := logger.NewDeferLog()
+	jsFeatures, cssFeatures := validateFeatures(log, target, engines)
+	for _, msg := range log.Done() {
+		if msg.Kind == logger.Error {
+			return Features{}, errors.New(msg.Data.Text)
+		}
+	}
+
+	features := Features{
+		UnsupportedJS:  []string{},
+		UnsupportedCSS: []string{},
+	}
+	for name, feature := range compat.StringToJSFeature {
+		if jsFeatures.Has(feature) {
+			features.UnsupportedJS = append(features.UnsupportedJS, name)
+		}
+	}
+	for name, feature := range compat.StringToCSSFeature {
+		if cssFeatures.Has(feature) {
+			features.UnsupportedCSS = append(features.UnsupportedCSS, name)
+		}
+	}
+	sort.Strings(features.UnsupportedJS)
+	sort.Strings(features.UnsupportedCSS)
+	return features, nil
+}
+
 func validateGlobalName(log logger.Log, text string) []string {
 	if text != "" {
 		source := logger.Source{
@@ -256,6 +360,21 @@ func validateGlobalName(log logger.Log, text string) []string {
 	return nil
 }
 
+func validateGlobalExternals(log logger.Log, globals map[string]string) map[string][]string {
+	if len(globals) == 0 {
+		return nil
+	}
+	result := make(map[string][]string, len(globals))
+	for path, text := range globals {
+		if names := validateGlobalName(log, text); names != nil {
+			result[path] = names
+		} else if text == "" {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Missing the global name for the external module %q", path))
+		}
+	}
+	return result
+}
+
 func validateExternals(log logger.Log, fs fs.FS, paths []string) config.ExternalModules {
 	result := config.ExternalModules{
 		NodeModules: make(map[string]bool),
@@ -280,6 +399,76 @@ func validateExternals(log logger.Log, fs fs.FS, paths []string) config.External
 	return result
 }
 
+func validateNoSideEffects(log logger.Log, fs fs.FS, paths []string) map[string]bool {
+	if len(paths) == 0 {
+		return nil
+	}
+	result := make(map[string]bool)
+	for _, path := range paths {
+		if resolver.IsPackagePath(path) {
+			result[path] = true
+		} else if absPath := validatePath(log, fs, path, "no side effects path"); absPath != "" {
+			result[absPath] = true
+		}
+	}
+	return result
+}
+
+// An external that no import path matched is most likely a typo or a left-
+// over from a renamed module, because it doesn't have any effect
+func warnAboutUnusedExternals(log logger.Log, res resolver.Resolver) {
+	for _, external := range res.UnusedExternals() {
+		log.AddRangeWarningWithID(logger.MsgIDUnusedExternal, nil, logger.Range{}, fmt.Sprintf("The external %q is not imported by any file", external))
+	}
+}
+
+func validateEntryPointFormats(log logger.Log, fs fs.FS, formats map[string]Format) map[string]config.Format {
+	if len(formats) == 0 {
+		return nil
+	}
+	result := make(map[string]config.Format)
+	for path, format := range formats {
+		if format == FormatDefault {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Missing format for entry point: %s", path))
+		} else if absPath := validatePath(log, fs, path, "entry point path"); absPath != "" {
+			result[absPath] = validateFormat(format)
+		}
+	}
+	return result
+}
+
+func validateFormats(log logger.Log, formats []Format) []config.Format {
+	if len(formats) == 0 {
+		return nil
+	}
+	result := make([]config.Format, 0, len(formats))
+	seen := make(map[Format]bool)
+	for _, format := range formats {
+		if format != FormatESModule && format != FormatCommonJS {
+			log.AddError(nil, logger.Loc{}, "Multiple formats currently only work with the \"esm\" and \"cjs\" formats")
+			return nil
+		}
+		if !seen[format] {
+			seen[format] = true
+			result = append(result, validateFormat(format))
+		}
+	}
+	return result
+}
+
+func validateEntryPointTexts(log logger.Log, fs fs.FS, texts map[string]string) map[string]string {
+	if len(texts) == 0 {
+		return nil
+	}
+	result := make(map[string]string)
+	for path, text := range texts {
+		if absPath := validatePath(log, fs, path, "entry point path"); absPath != "" {
+			result[absPath] = text
+		}
+	}
+	return result
+}
+
 func isValidExtension(ext string) bool {
 	return len(ext) >= 2 && ext[0] == '.' && ext[len(ext)-1] != '.'
 }
@@ -296,8 +485,11 @@ func validateResolveExtensions(log logger.Log, order []string) []string {
 	return order
 }
 
-func validateLoaders(log logger.Log, loaders map[string]Loader) map[string]config.Loader {
+func validateLoaders(log logger.Log, loaders map[string]Loader, wasmModule bool) map[string]config.Loader {
 	result := bundler.DefaultExtensionToLoaderMap()
+	if wasmModule {
+		result[".wasm"] = config.LoaderWasmModule
+	}
 	if loaders != nil {
 		for ext, loader := range loaders {
 			if !isValidExtension(ext) {
@@ -309,6 +501,22 @@ func validateLoaders(log logger.Log, loaders map[string]Loader) map[string]confi
 	return result
 }
 
+func validatePreserveJSX(log logger.Log, mode JSXMode, minifySyntax bool, minifyIdentifiers bool) bool {
+	if mode != JSXModePreserve {
+		return false
+	}
+
+	// Minification would rewrite JSX into something the downstream tool can't
+	// transform, such as a component renamed to a lowercase intrinsic element
+	if minifySyntax {
+		log.AddError(nil, logger.Loc{}, "Cannot preserve JSX when minifying syntax")
+	}
+	if minifyIdentifiers {
+		log.AddError(nil, logger.Loc{}, "Cannot preserve JSX when minifying identifiers")
+	}
+	return true
+}
+
 func validateJSX(log logger.Log, text string, name string) []string {
 	if text == "" {
 		return nil
@@ -323,14 +531,117 @@ func validateJSX(log logger.Log, text string, name string) []string {
 	return parts
 }
 
-func validateDefines(log logger.Log, defines map[string]string, pureFns []string) (*config.ProcessedDefines, []config.InjectedDefine) {
+func validateDrop(log logger.Log, values []string) (drop config.DropOptions) {
+	for _, value := range values {
+		switch {
+		case value == "debugger":
+			drop.Debugger = true
+		case value == "console":
+			drop.Console = true
+		case strings.HasPrefix(value, "console.") && js_lexer.IsIdentifier(value[len("console."):]):
+			drop.ConsoleMethods = append(drop.ConsoleMethods, value[len("console."):])
+		default:
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Invalid drop value: %q (valid: console, console.METHOD, debugger)", value))
+		}
+	}
+	return
+}
+
+func validateProcessShim(shim *ProcessShim, defines map[string]string) map[string]string {
+	if shim == nil {
+		return defines
+	}
+
+	platform := shim.Platform
+	if platform == "" {
+		switch runtime.GOOS {
+		case "windows":
+			platform = "win32"
+		case "solaris", "illumos":
+			platform = "sunos"
+		default:
+			platform = runtime.GOOS
+		}
+	}
+	arch := shim.Arch
+	if arch == "" {
+		switch runtime.GOARCH {
+		case "amd64":
+			arch = "x64"
+		case "386":
+			arch = "ia32"
+		case "ppc64le":
+			arch = "ppc64"
+		case "mipsle":
+			arch = "mipsel"
+		default:
+			arch = runtime.GOARCH
+		}
+	}
+
+	// Don't modify the map from the caller
+	result := make(map[string]string, len(defines)+2)
+	for key, value := range defines {
+		result[key] = value
+	}
+	if _, ok := result["process.platform"]; !ok {
+		result["process.platform"] = string(js_printer.QuoteForJSON(platform, false))
+	}
+	if _, ok := result["process.arch"]; !ok {
+		result["process.arch"] = string(js_printer.QuoteForJSON(arch, false))
+	}
+	return result
+}
+
+// Substitutions between identifiers are only applied once, so a cycle such as
+// "a=b" and "b=a" would silently swap the two names. That's almost certainly
+// a mistake, so report it instead.
+func checkDefineCycles(log logger.Log, identifierDefines map[string]string) {
+	keys := make([]string, 0, len(identifierDefines))
+	for key := range identifierDefines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reported := make(map[string]bool)
+	for _, key := range keys {
+		if reported[key] {
+			continue
+		}
+		chain := []string{key}
+		for next, ok := identifierDefines[key]; ok && next != chain[len(chain)-1]; next, ok = identifierDefines[next] {
+			if next == key {
+				for _, name := range chain {
+					reported[name] = true
+				}
+				log.AddError(nil, logger.Loc{}, fmt.Sprintf("Cycle in define substitutions: %s -> %s",
+					strings.Join(chain, " -> "), key))
+				break
+			}
+			if len(chain) > len(identifierDefines) {
+				break
+			}
+			chain = append(chain, next)
+		}
+	}
+}
+
+func defineKeys(defines map[string]string) []string {
+	keys := make([]string, 0, len(defines))
+	for key := range defines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateDefines(log logger.Log, defines map[string]string, pureFns []string) *config.ProcessedDefines {
 	if len(defines) == 0 && len(pureFns) == 0 {
-		return nil, nil
+		return nil
 	}
 
 	rawDefines := make(map[string]config.DefineData)
-	valueToInject := make(map[string]config.InjectedDefine)
-	var definesToInject []string
+	identifierDefines := make(map[string]string)
 
 	for key, value := range defines {
 		// The key must be a dot-separated identifier list
@@ -341,9 +652,12 @@ func validateDefines(log logger.Log, defines map[string]string, pureFns []string
 			}
 		}
 
-		// Allow substituting for an identifier
+		// Allow substituting for an identifier. The substituted identifier is not
+		// substituted again even if it's also defined, so "a=b" and "b=c" replace
+		// "a" with "b" and not with "c".
 		if js_lexer.IsIdentifier(value) {
 			if _, ok := js_lexer.Keywords[value]; !ok {
+				identifierDefines[key] = value
 				name := value // The closure must close over a variable inside the loop
 				rawDefines[key] = config.DefineData{
 					DefineFunc: func(args config.DefineArgs) js_ast.E {
@@ -380,27 +694,16 @@ func validateDefines(log logger.Log, defines map[string]string, pureFns []string
 		case *js_ast.ENumber:
 			fn = func(config.DefineArgs) js_ast.E { return &js_ast.ENumber{Value: e.Value} }
 
-		// These values are extracted into a shared symbol reference
+		// These values are inserted inline too. Each substitution gets its own
+		// copy, because the parser may modify the tree that it's given.
 		case *js_ast.EArray, *js_ast.EObject:
-			definesToInject = append(definesToInject, key)
-			valueToInject[key] = config.InjectedDefine{Source: source, Data: e, Name: key}
-			continue
+			fn = func(args config.DefineArgs) js_ast.E { return cloneJSONValue(e, args.Loc) }
 		}
 
 		rawDefines[key] = config.DefineData{DefineFunc: fn}
 	}
 
-	// Sort injected defines for determinism, since the imports will be injected
-	// into every file in the order that we return them from this function
-	injectedDefines := make([]config.InjectedDefine, len(definesToInject))
-	sort.Strings(definesToInject)
-	for i, key := range definesToInject {
-		index := i // Capture this for the closure below
-		injectedDefines[i] = valueToInject[key]
-		rawDefines[key] = config.DefineData{DefineFunc: func(args config.DefineArgs) js_ast.E {
-			return &js_ast.EIdentifier{Ref: args.SymbolForDefine(index)}
-		}}
-	}
+	checkDefineCycles(log, identifierDefines)
 
 	for _, key := range pureFns {
 		// The key must be a dot-separated identifier list
@@ -420,7 +723,51 @@ func validateDefines(log logger.Log, defines map[string]string, pureFns []string
 	// Processing defines is expensive. Process them once here so the same object
 	// can be shared between all parsers we create using these arguments.
 	processed := config.ProcessDefines(rawDefines)
-	return &processed, injectedDefines
+	return &processed
+}
+
+// This makes a deep copy of a value parsed from JSON. The copy is located at
+// the substituted expression, since it has no location in the source file.
+func cloneJSONValue(value js_ast.E, loc logger.Loc) js_ast.E {
+	switch e := value.(type) {
+	case *js_ast.ENull:
+		return &js_ast.ENull{}
+
+	case *js_ast.EBoolean:
+		return &js_ast.EBoolean{Value: e.Value}
+
+	case *js_ast.EString:
+		return &js_ast.EString{Value: append([]uint16{}, e.Value...)}
+
+	case *js_ast.ENumber:
+		return &js_ast.ENumber{Value: e.Value}
+
+	case *js_ast.EArray:
+		items := make([]js_ast.Expr, len(e.Items))
+		for i, item := range e.Items {
+			items[i] = js_ast.Expr{Loc: loc, Data: cloneJSONValue(item.Data, loc)}
+		}
+		return &js_ast.EArray{Items: items, IsSingleLine: e.IsSingleLine}
+
+	case *js_ast.EObject:
+		properties := make([]js_ast.Property, len(e.Properties))
+		for i, property := range e.Properties {
+			key := cloneJSONValue(property.Key.Data, loc)
+			value := js_ast.Expr{Loc: loc, Data: cloneJSONValue(property.Value.Data, loc)}
+
+			// The "__proto__" key of a JSON object is an own property, but it would
+			// set the prototype in an object literal unless it is computed
+			isProto := js_lexer.UTF16EqualsString(key.(*js_ast.EString).Value, "__proto__")
+			properties[i] = js_ast.Property{
+				Key:        js_ast.Expr{Loc: loc, Data: key},
+				Value:      &value,
+				IsComputed: isProto,
+			}
+		}
+		return &js_ast.EObject{Properties: properties, IsSingleLine: e.IsSingleLine}
+	}
+
+	panic("Internal error")
 }
 
 func validatePath(log logger.Log, fs fs.FS, relPath string, pathKind string) string {
@@ -434,6 +781,174 @@ func validatePath(log logger.Log, fs fs.FS, relPath string, pathKind string) str
 	return absPath
 }
 
+// Configuration files are only loaded after all options have been validated,
+// so a missing file would otherwise be silently ignored. This checks that the
+// file can be read up front and returns an empty string if it can't.
+func validateAMDConfigPaths(log logger.Log, fs fs.FS, relPath string, relPaths []string) []string {
+	var absPaths []string
+	if relPath != "" {
+		relPaths = append([]string{relPath}, relPaths...)
+	}
+	for _, relPath := range relPaths {
+		if absPath := validateFilePath(log, fs, relPath, "amdconfig path"); absPath != "" {
+			absPaths = append(absPaths, absPath)
+		}
+	}
+	return absPaths
+}
+
+func validateFilePath(log logger.Log, fs fs.FS, relPath string, pathKind string) string {
+	absPath := validatePath(log, fs, relPath, pathKind)
+	if absPath == "" {
+		return ""
+	}
+	if _, err := fs.ReadFile(absPath); err != nil {
+		if err == syscall.ENOENT {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Cannot find %s: %s", pathKind, relPath))
+		} else {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Cannot read %s: %s (%s)", pathKind, relPath, err.Error()))
+		}
+		return ""
+	}
+	return absPath
+}
+
+// A missing injected file would otherwise only be reported by the resolver
+// later on, with an error message that doesn't mention the "inject" option.
+func validateInjectPath(log logger.Log, fs fs.FS, relPath string) string {
+	absPath := validatePath(log, fs, relPath, "inject path")
+	if absPath != "" {
+		if _, err := fs.ReadFile(absPath); err == syscall.ENOENT {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Injected file not found: %s", relPath))
+		}
+	}
+	return absPath
+}
+
+// A missing resolve directory would otherwise only make the relative imports
+// in stdin fail to resolve, which doesn't point at the actual problem.
+func validateOutputMode(log logger.Log, value uint32) os.FileMode {
+	if value&^0777 != 0 {
+		log.AddError(nil, logger.Loc{}, fmt.Sprintf("Invalid output mode: %o", value))
+		return 0
+	}
+	return os.FileMode(value)
+}
+
+func validateStdinResolveDir(log logger.Log, fs fs.FS, relPath string) string {
+	absPath := validatePath(log, fs, relPath, "resolve directory path")
+	if absPath != "" {
+		if _, err := fs.ReadDirectory(absPath); err == syscall.ENOENT || err == syscall.ENOTDIR {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("stdin resolve directory does not exist: %s", relPath))
+			return ""
+		}
+	}
+	return absPath
+}
+
+// Entry points containing "*" are expanded to the files that they match. The
+// wildcard "*" matches any part of a file or directory name and "**" matches
+// any number of nested directories. Relative patterns are anchored at the
+// glob root, which defaults to the current working directory.
+func expandEntryPointGlobs(log logger.Log, realFS fs.FS, absGlobRoot string, entryPoints []string) []string {
+	expanded := make([]string, 0, len(entryPoints))
+	seen := make(map[string]bool)
+	for _, entryPoint := range entryPoints {
+		if !strings.Contains(entryPoint, "*") {
+			expanded = append(expanded, entryPoint)
+			continue
+		}
+
+		// The search starts in the directory before the first wildcard
+		pattern := strings.ReplaceAll(entryPoint, "\\", "/")
+		slash := strings.LastIndexByte(pattern[:strings.IndexByte(pattern, '*')], '/')
+		dir := pattern[:slash+1]
+		if !realFS.IsAbs(dir) {
+			root := absGlobRoot
+			if root == "" {
+				root = realFS.Cwd()
+			}
+			dir = realFS.Join(root, dir)
+		}
+
+		var matches []string
+		matchGlobSegments(realFS, dir, strings.Split(pattern[slash+1:], "/"), &matches)
+		if len(matches) == 0 {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("No files match the entry point pattern: %s", entryPoint))
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				expanded = append(expanded, match)
+			}
+		}
+	}
+	return expanded
+}
+
+func matchGlobSegments(realFS fs.FS, dir string, segments []string, matches *[]string) {
+	entries, err := realFS.ReadDirectory(dir)
+	if err != nil {
+		return
+	}
+
+	// Match "**" against no directory and then against every subdirectory
+	if segments[0] == "**" {
+		rest := segments[1:]
+		if len(rest) == 0 {
+			rest = []string{"*"}
+		}
+		matchGlobSegments(realFS, dir, rest, matches)
+		for name, entry := range entries {
+			if entry.Kind(realFS) == fs.DirEntry {
+				matchGlobSegments(realFS, realFS.Join(dir, name), segments, matches)
+			}
+		}
+		return
+	}
+
+	for name, entry := range entries {
+		if ok, _ := path.Match(segments[0], name); !ok {
+			continue
+		}
+		kind := entry.Kind(realFS)
+		if len(segments) == 1 {
+			if kind == fs.FileEntry {
+				*matches = append(*matches, realFS.Join(dir, name))
+			}
+		} else if kind == fs.DirEntry {
+			matchGlobSegments(realFS, realFS.Join(dir, name), segments[1:], matches)
+		}
+	}
+}
+
+func validatePathTemplate(log logger.Log, template string, kind string, allowHashInDir bool) string {
+	if template == "" {
+		return ""
+	}
+	template = strings.ReplaceAll(template, "\\", "/")
+	if strings.HasPrefix(template, "/") {
+		log.AddError(nil, logger.Loc{}, fmt.Sprintf("Invalid %s template: %q (must be a relative path)", kind, template))
+		return ""
+	}
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		if segment == ".." {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Invalid %s template: %q (must not contain \"..\")", kind, template))
+			return ""
+		}
+
+		// Shared chunks need to know their directory before the hash is known
+		if !allowHashInDir && i+1 < len(segments) && strings.Contains(segment, "[hash]") {
+			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Invalid %s template: %q (\"[hash]\" must be in the file name)", kind, template))
+			return ""
+		}
+	}
+	return template
+}
+
 func validateOutputExtensions(log logger.Log, outExtensions map[string]string) (js string, css string) {
 	for key, value := range outExtensions {
 		if !isValidExtension(value) {
@@ -542,52 +1057,72 @@ func buildImpl(buildOpts BuildOptions) internalBuildResult {
 		MessageLimit:  buildOpts.ErrorLimit,
 		Color:         validateColor(buildOpts.Color),
 		LogLevel:      validateLogLevel(buildOpts.LogLevel),
+		Overrides:     validateLogOverrides(buildOpts.LogOverride),
 	}
 	log := logger.NewStderrLog(logOptions)
 
-	// Validate that the current working directory is an absolute path
+	// Validate that the current working directory is an absolute path. The
+	// file system is shared by the rebuilds, which only read again what changed.
 	realFS, err := fs.RealFS(fs.RealFSOptions{
 		AbsWorkingDir: buildOpts.AbsWorkingDir,
+		WantWatchData: buildOpts.Watch != nil || buildOpts.Incremental,
 	})
 	if err != nil {
 		log.AddError(nil, logger.Loc{}, err.Error())
 		return internalBuildResult{result: BuildResult{Errors: convertMessagesToPublic(logger.Error, log.Done())}}
 	}
 
-	// Do not re-evaluate plugins when rebuilding
-	plugins := loadPlugins(realFS, log, buildOpts.Plugins)
-	return rebuildImpl(buildOpts, cache.MakeCacheSet(), plugins, logOptions, log, false /* isRebuild */)
+	var tracer *trace.Tracer
+	if buildOpts.Trace != "" {
+		tracer = trace.NewTracer()
+	}
+
+	// Do not re-evaluate plugins when rebuilding. The entry points added by
+	// plugins are kept for rebuilds too.
+	plugins, pluginStats, pluginEntryPoints := loadPlugins(realFS, log, buildOpts.Plugins, buildOpts.CollectMetrics, tracer)
+	if len(pluginEntryPoints) > 0 {
+		buildOpts.EntryPoints = append(append([]string{}, buildOpts.EntryPoints...), pluginEntryPoints...)
+	}
+	return rebuildImpl(buildOpts, realFS, cache.MakeCacheSet(), plugins, pluginStats, tracer, logOptions, log, false /* isRebuild */)
 }
 
+// A rebuild makes the shared file system forget what it cached about the paths
+// that changed since the previous build and about their parent directories, so
+// that a new file is found in a directory read before. Each build has its own
+// resolver, which reads the directories from the file system again.
 func rebuildImpl(
 	buildOpts BuildOptions,
+	realFS fs.FS,
 	caches *cache.CacheSet,
 	plugins []config.Plugin,
+	pluginStats []*pluginStats,
+	tracer *trace.Tracer,
 	logOptions logger.OutputOptions,
 	log logger.Log,
 	isRebuild bool,
 ) internalBuildResult {
-	// Convert and validate the buildOpts
-	realFS, err := fs.RealFS(fs.RealFSOptions{
-		AbsWorkingDir: buildOpts.AbsWorkingDir,
-		WantWatchData: buildOpts.Watch != nil,
-	})
-	if err != nil {
-		// This should already have been checked above
-		panic(err.Error())
+	if isRebuild {
+		for path, isChanged := range realFS.WatchData().Paths {
+			if isChanged() {
+				realFS.InvalidateDirectory(path)
+				realFS.InvalidateDirectory(realFS.Dir(path))
+			}
+		}
 	}
+
+	// Convert and validate the buildOpts
 	jsFeatures, cssFeatures := validateFeatures(log, buildOpts.Target, buildOpts.Engines)
 	outJS, outCSS := validateOutputExtensions(log, buildOpts.OutExtensions)
-	defines, injectedDefines := validateDefines(log, buildOpts.Define, buildOpts.Pure)
+	defines := validateDefines(log, validateProcessShim(buildOpts.ProcessShim, buildOpts.Define), buildOpts.Pure)
 	options := config.Options{
 		UnsupportedJSFeatures:  jsFeatures,
 		UnsupportedCSSFeatures: cssFeatures,
 		JSX: config.JSXOptions{
+			Preserve: validatePreserveJSX(log, buildOpts.JSXMode, buildOpts.MinifySyntax, buildOpts.MinifyIdentifiers),
 			Factory:  validateJSX(log, buildOpts.JSXFactory, "factory"),
 			Fragment: validateJSX(log, buildOpts.JSXFragment, "fragment"),
 		},
 		Defines:               defines,
-		InjectedDefines:       injectedDefines,
 		Platform:              validatePlatform(buildOpts.Platform),
 		SourceMap:             validateSourceMap(buildOpts.Sourcemap),
 		ExcludeSourcesContent: buildOpts.SourcesContent == SourcesContentExclude,
@@ -595,42 +1130,73 @@ func rebuildImpl(
 		RemoveWhitespace:      buildOpts.MinifyWhitespace,
 		MinifyIdentifiers:     buildOpts.MinifyIdentifiers,
 		ASCIIOnly:             validateASCIIOnly(buildOpts.Charset),
+		Comments:              validateComments(buildOpts.Comments),
+		LegalComments:         validateLegalComments(buildOpts.LegalComments),
 		IgnoreDCEAnnotations:  validateIgnoreDCEAnnotations(buildOpts.TreeShaking),
+		Drop:                  validateDrop(log, buildOpts.Drop),
 		GlobalName:            validateGlobalName(log, buildOpts.GlobalName),
+		GlobalExternals:       validateGlobalExternals(log, buildOpts.GlobalExternals),
 		CodeSplitting:         buildOpts.Splitting,
 		OutputFormat:          validateFormat(buildOpts.Format),
+		OutputFormats:         validateFormats(log, buildOpts.Formats),
+		EntryPointFormats:     validateEntryPointFormats(log, realFS, buildOpts.EntryPointFormats),
+		EntryPointBanners:     validateEntryPointTexts(log, realFS, buildOpts.EntryPointBanners),
+		EntryPointFooters:     validateEntryPointTexts(log, realFS, buildOpts.EntryPointFooters),
 		AbsOutputFile:         validatePath(log, realFS, buildOpts.Outfile, "outfile path"),
 		AbsOutputDir:          validatePath(log, realFS, buildOpts.Outdir, "outdir path"),
 		AbsOutputBase:         validatePath(log, realFS, buildOpts.Outbase, "outbase path"),
+		EntryPathTemplate:     validatePathTemplate(log, buildOpts.EntryNames, "entry names", true /* allowHashInDir */),
+		ChunkPathTemplate:     validatePathTemplate(log, buildOpts.ChunkNames, "chunk names", false /* allowHashInDir */),
+		AssetPathTemplate:     validatePathTemplate(log, buildOpts.AssetNames, "asset names", true /* allowHashInDir */),
 		AbsMetadataFile:       validatePath(log, realFS, buildOpts.Metafile, "metafile path"),
+		MetafilePretty:        buildOpts.MetafilePretty,
+		IncludeHashes:         buildOpts.IncludeHashes,
+		PackageExports:        buildOpts.GeneratePackageExports,
 		OutputExtensionJS:     outJS,
 		OutputExtensionCSS:    outCSS,
-		ExtensionToLoader:     validateLoaders(log, buildOpts.Loader),
+		AutoExtension:         buildOpts.AutoExtension,
+		AssetInlineLimit:      buildOpts.AssetInlineLimit,
+		ExtensionToLoader:     validateLoaders(log, buildOpts.Loader, buildOpts.WasmModule),
 		ExtensionOrder:        validateResolveExtensions(log, buildOpts.ResolveExtensions),
 		ExternalModules:       validateExternals(log, realFS, buildOpts.External),
-		AMDConfig:             validatePath(log, realFS, buildOpts.AMDConfig, "amdconfig path"),
-		TsConfigOverride:      validatePath(log, realFS, buildOpts.Tsconfig, "tsconfig path"),
+		AMDConfigs:            validateAMDConfigPaths(log, realFS, buildOpts.AMDConfig, buildOpts.AMDConfigs),
+		TsConfigOverride:      validateFilePath(log, realFS, buildOpts.Tsconfig, "tsconfig path"),
+		ReportTypeElision:     buildOpts.ReportTypeElision,
 		MainFields:            buildOpts.MainFields,
+		Conditions:            buildOpts.Conditions,
 		PublicPath:            buildOpts.PublicPath,
 		KeepNames:             buildOpts.KeepNames,
+		MangleKeyframes:       buildOpts.MangleKeyframes,
+		Polyfills:             buildOpts.Polyfills,
+		CheckDevDependencies:  buildOpts.CheckDevDependencies,
 		InjectAbsPaths:        make([]string, len(buildOpts.Inject)),
 		AbsNodePaths:          make([]string, len(buildOpts.NodePaths)),
-		Banner:                buildOpts.Banner,
-		Footer:                buildOpts.Footer,
+		Banner:                config.OutputText{JS: buildOpts.Banner, CSS: buildOpts.BannerCSS},
+		Footer:                config.OutputText{JS: buildOpts.Footer, CSS: buildOpts.FooterCSS},
 		PreserveSymlinks:      buildOpts.PreserveSymlinks,
+		AllowOverwrite:        buildOpts.AllowOverwrite,
 		WatchMode:             buildOpts.Watch != nil,
 		Plugins:               plugins,
+		Cancel:                buildOpts.Cancel,
+		Tracer:                tracer,
 	}
+	absTracePath := validatePath(log, realFS, buildOpts.Trace, "trace path")
+	outputMode := validateOutputMode(log, buildOpts.OutputMode)
 	for i, path := range buildOpts.Inject {
-		options.InjectAbsPaths[i] = validatePath(log, realFS, path, "inject path")
+		options.InjectAbsPaths[i] = validateInjectPath(log, realFS, path)
 	}
 	for i, path := range buildOpts.NodePaths {
 		options.AbsNodePaths[i] = validatePath(log, realFS, path, "node path")
 	}
+	options.NoSideEffectsModules = validateNoSideEffects(log, realFS, buildOpts.NoSideEffects)
+	for _, path := range buildOpts.RestrictImports {
+		options.RestrictImports = append(options.RestrictImports, validatePath(log, realFS, path, "restricted imports path"))
+	}
 	if options.PublicPath != "" && !strings.HasSuffix(options.PublicPath, "/") && !strings.HasSuffix(options.PublicPath, "\\") {
 		options.PublicPath += "/"
 	}
-	entryPoints := append([]string{}, buildOpts.EntryPoints...)
+	entryPoints := expandEntryPointGlobs(log, realFS,
+		validatePath(log, realFS, buildOpts.GlobRoot, "glob root"), buildOpts.EntryPoints)
 	entryPointCount := len(entryPoints)
 	if buildOpts.Stdin != nil {
 		entryPointCount++
@@ -638,13 +1204,16 @@ func rebuildImpl(
 			Loader:        validateLoader(buildOpts.Stdin.Loader),
 			Contents:      buildOpts.Stdin.Contents,
 			SourceFile:    buildOpts.Stdin.Sourcefile,
-			AbsResolveDir: validatePath(log, realFS, buildOpts.Stdin.ResolveDir, "resolve directory path"),
+			AbsResolveDir: validateStdinResolveDir(log, realFS, buildOpts.Stdin.ResolveDir),
 		}
 	}
 
 	if options.AbsOutputDir == "" && entryPointCount > 1 {
 		log.AddError(nil, logger.Loc{},
 			"Must use \"outdir\" when there are multiple input files")
+	} else if options.AbsOutputDir == "" && len(options.OutputFormats) > 0 {
+		log.AddError(nil, logger.Loc{},
+			"Must use \"outdir\" when there are multiple formats")
 	} else if options.AbsOutputDir == "" && options.CodeSplitting {
 		log.AddError(nil, logger.Loc{},
 			"Must use \"outdir\" when code splitting is enabled")
@@ -663,9 +1232,12 @@ func rebuildImpl(
 		if options.AbsMetadataFile != "" {
 			log.AddError(nil, logger.Loc{}, "Cannot use \"metafile\" without an output path")
 		}
+		if options.PackageExports {
+			log.AddError(nil, logger.Loc{}, "Cannot use \"generatePackageExports\" without an output path")
+		}
 		for _, loader := range options.ExtensionToLoader {
-			if loader == config.LoaderFile {
-				log.AddError(nil, logger.Loc{}, "Cannot use the \"file\" loader without an output path")
+			if loader == config.LoaderFile || loader == config.LoaderAsset {
+				log.AddError(nil, logger.Loc{}, fmt.Sprintf("Cannot use the %q loader without an output path", loaderNames[loader]))
 				break
 			}
 		}
@@ -676,16 +1248,40 @@ func rebuildImpl(
 	}
 
 	options.AMD.Init(realFS.Cwd())
-	if len(options.AMDConfig) > 0 {
-		parseAMDConfig(log, realFS, &caches.JSONCache, options.AMDConfig, &options.AMD)
+	if len(options.AMDConfigs) > 0 {
+		parseAMDConfigs(log, realFS, &caches.JSONCache, options.AMDConfigs, &options.AMD)
 		options.OutputFormat = config.FormatJoin
 	}
 
+	// Each of multiple formats is linked from the same scan, which uses the first
+	// format. The other format-related options would contradict them.
+	if len(options.OutputFormats) > 0 {
+		if buildOpts.Format != FormatDefault {
+			log.AddError(nil, logger.Loc{}, "Cannot use both \"format\" and \"formats\"")
+		}
+		if len(options.EntryPointFormats) > 0 {
+			log.AddError(nil, logger.Loc{}, "Cannot use both \"entryPointFormats\" and \"formats\"")
+		}
+		if len(options.AMDConfigs) > 0 {
+			log.AddError(nil, logger.Loc{}, "Cannot use both \"amdconfig\" and \"formats\"")
+		}
+		if outJS != "" {
+			log.AddError(nil, logger.Loc{}, "Cannot use \"outExtension\" for \".js\" with \"formats\"")
+		}
+		options.OutputFormat = options.OutputFormats[0]
+	}
+
 	if !buildOpts.Bundle {
 		// Disallow bundle-only options when not bundling
 		if len(options.ExternalModules.NodeModules) > 0 || len(options.ExternalModules.AbsPaths) > 0 {
 			log.AddError(nil, logger.Loc{}, "Cannot use \"external\" without \"bundle\"")
 		}
+		if len(options.EntryPointFormats) > 0 {
+			log.AddError(nil, logger.Loc{}, "Cannot use \"entryPointFormats\" without \"bundle\"")
+		}
+		if len(options.OutputFormats) > 0 {
+			log.AddError(nil, logger.Loc{}, "Cannot use \"formats\" without \"bundle\"")
+		}
 	} else if options.OutputFormat == config.FormatPreserve {
 		// If the format isn't specified, set the default format using the platform
 		switch options.Platform {
@@ -705,28 +1301,67 @@ func rebuildImpl(
 		options.Mode = config.ModeConvertFormat
 	}
 
-	// Code splitting is experimental and currently only enabled for ES6 modules
-	if options.CodeSplitting && options.OutputFormat != config.FormatESModule {
-		log.AddError(nil, logger.Loc{}, "Splitting currently only works with the \"esm\" format")
+	// Code splitting is experimental and currently only enabled for ES6 modules and CommonJS
+	if options.CodeSplitting && options.OutputFormat != config.FormatESModule && options.OutputFormat != config.FormatCommonJS {
+		log.AddError(nil, logger.Loc{}, "Splitting currently only works with the \"esm\" and \"cjs\" formats")
 	}
 
 	var outputFiles []OutputFile
+	var metadata []byte
 	var watchData fs.WatchData
+	var cancelled bool
+	var metrics *BuildMetrics
+	if buildOpts.CollectMetrics {
+		metrics = &BuildMetrics{}
+		for _, stats := range pluginStats {
+			stats.reset()
+		}
+	}
+	parseCount := caches.ParseCount()
+	phaseStart := time.Now()
+	tracer.Reset()
 
 	// Stop now if there were errors
+	endTrace := tracer.Begin("build", "resolver", nil)
 	resolver := resolver.NewResolver(realFS, log, caches, options)
+	endTrace()
+	if metrics != nil {
+		metrics.ResolverTime = time.Since(phaseStart)
+	}
 	if !log.HasErrors() {
+		// Let plugins know that the build is starting
+		for _, plugin := range plugins {
+			for _, onStart := range plugin.OnStart {
+				onStart.Callback()
+			}
+		}
+
 		// Scan over the bundle
+		phaseStart = time.Now()
+		endTrace = tracer.Begin("build", "scan", nil)
 		bundle := bundler.ScanBundle(log, realFS, resolver, caches, entryPoints, options)
+		endTrace()
 		watchData = realFS.WatchData()
+		if metrics != nil {
+			metrics.ScanTime = time.Since(phaseStart)
+			metrics.FilesParsed = bundle.FileCount()
+			metrics.FilesReparsed = int(caches.ParseCount() - parseCount)
+		}
+		warnAboutUnusedExternals(log, resolver)
 
-		// Stop now if there were errors
-		if !log.HasErrors() {
+		// Stop now if there were errors or if the build was cancelled
+		if cancelled = options.IsCancelled(); !cancelled && !log.HasErrors() {
 			// Compile the bundle
+			phaseStart = time.Now()
+			endTrace = tracer.Begin("build", "compile", nil)
 			results := bundle.Compile(log, options)
+			endTrace()
+			if metrics != nil {
+				metrics.CompileTime = time.Since(phaseStart)
+			}
 
-			// Stop now if there were errors
-			if !log.HasErrors() {
+			// Stop now if there were errors or if the build was cancelled
+			if cancelled = options.IsCancelled(); !cancelled && !log.HasErrors() {
 				if buildOpts.Write {
 					// Special-case writing to stdout
 					if options.WriteToStdout {
@@ -743,19 +1378,21 @@ func rebuildImpl(
 						waitGroup.Add(len(results))
 						for _, result := range results {
 							go func(result bundler.OutputFile) {
-								fs.BeforeFileOpen()
-								defer fs.AfterFileClose()
-								if err := os.MkdirAll(realFS.Dir(result.AbsPath), 0755); err != nil {
-									log.AddError(nil, logger.Loc{}, fmt.Sprintf(
-										"Failed to create output directory: %s", err.Error()))
-								} else {
-									var mode os.FileMode = 0644
-									if result.IsExecutable {
-										mode = 0755
-									}
-									if err := ioutil.WriteFile(result.AbsPath, result.Contents, mode); err != nil {
+								var mode os.FileMode = 0644
+								if result.IsExecutable {
+									mode = 0755
+								}
+								if outputMode != 0 && result.Kind == bundler.OutputKindEntryPoint {
+									mode = outputMode
+								}
+								writeOutputFile(log, realFS, result.AbsPath, result.Contents, mode)
+
+								// The mode is only applied when a file is created, so an existing
+								// file needs its mode changed too
+								if outputMode != 0 && result.Kind == bundler.OutputKindEntryPoint {
+									if err := os.Chmod(result.AbsPath, mode); err != nil {
 										log.AddError(nil, logger.Loc{}, fmt.Sprintf(
-											"Failed to write to output file: %s", err.Error()))
+											"Failed to change the mode of output file: %s", err.Error()))
 									}
 								}
 								waitGroup.Done()
@@ -766,6 +1403,9 @@ func rebuildImpl(
 				}
 
 				// Return the results
+				if buildOpts.SortOutputFiles {
+					sortOutputFiles(results)
+				}
 				outputFiles = make([]OutputFile, len(results))
 				for i, result := range results {
 					if options.WriteToStdout {
@@ -775,54 +1415,103 @@ func rebuildImpl(
 						Path:     result.AbsPath,
 						Contents: result.Contents,
 					}
+					if result.Kind == bundler.OutputKindMetadata {
+						metadata = result.Contents
+					}
 				}
 			}
 		}
 	}
 
+	// The trace is written even if the build failed, which may help to find out why
+	if tracer != nil && absTracePath != "" {
+		writeOutputFile(log, realFS, absTracePath, tracer.JSON(), 0644)
+	}
+
 	// End the log now, which may print a message
 	msgs := log.Done()
 
+	// Let plugins post-process the results of the build
+	if hasOnEnd(plugins) {
+		args := config.OnEndArgs{Msgs: msgs, OutputFiles: make([]config.OnEndOutputFile, len(outputFiles))}
+		for i, file := range outputFiles {
+			args.OutputFiles[i] = config.OnEndOutputFile{AbsPath: file.Path, Contents: file.Contents}
+		}
+		for _, plugin := range plugins {
+			for _, onEnd := range plugin.OnEnd {
+				onEnd.Callback(args)
+			}
+		}
+	}
+
 	// Start watching, but only for the top-level build
-	var watch *watcher
+	var watch *watcher.Watcher
 	var stop func()
 	if buildOpts.Watch != nil && !isRebuild {
 		onRebuild := buildOpts.Watch.OnRebuild
-		watch = &watcher{
-			data:     watchData,
-			resolver: resolver,
-			rebuild: func() fs.WatchData {
-				value := rebuildImpl(buildOpts, caches, plugins, logOptions, logger.NewStderrLog(logOptions), true /* isRebuild */)
+		stopped := make(chan struct{})
+		stopOnce := sync.Once{}
+		watch = &watcher.Watcher{
+			Name: "build",
+			PrettyPath: func(absPath string) string {
+				return resolver.PrettyPath(logger.Path{Text: absPath, Namespace: "file"})
+			},
+			Rerun: func() fs.WatchData {
+				// The rebuilds started by the watcher are cancelled by stopping it
+				rebuildOpts := buildOpts
+				rebuildOpts.Cancel = stopped
+				value := rebuildImpl(rebuildOpts, realFS, caches, plugins, pluginStats, tracer, logOptions, logger.NewStderrLog(logOptions), true /* isRebuild */)
 				if onRebuild != nil {
-					go onRebuild(value.result)
+					onRebuild(value.result)
 				}
 				return value.watchData
 			},
 		}
-		mode := *buildOpts.Watch
-		watch.start(buildOpts.LogLevel, buildOpts.Color, mode)
+		watch.SetWatchData(watchData)
+		watch.Start(validateLogLevel(buildOpts.LogLevel), validateColor(buildOpts.Color))
 		stop = func() {
-			watch.stop()
+			watch.Stop()
+			stopOnce.Do(func() { close(stopped) })
 		}
 	}
 
 	var rebuild func() BuildResult
+	var rebuildWithCancel func(<-chan struct{}) BuildResult
 	if buildOpts.Incremental {
-		rebuild = func() BuildResult {
-			value := rebuildImpl(buildOpts, caches, plugins, logOptions, logger.NewStderrLog(logOptions), true /* isRebuild */)
+		// Each rebuild has its own cancel, because the one of this build may have
+		// been closed already
+		rebuildWithCancel = func(cancel <-chan struct{}) BuildResult {
+			rebuildOpts := buildOpts
+			rebuildOpts.Cancel = cancel
+			value := rebuildImpl(rebuildOpts, realFS, caches, plugins, pluginStats, tracer, logOptions, logger.NewStderrLog(logOptions), true /* isRebuild */)
 			if watch != nil {
-				watch.setWatchData(value.watchData)
+				watch.SetWatchData(value.watchData)
 			}
 			return value.result
 		}
+		rebuild = func() BuildResult {
+			return rebuildWithCancel(nil)
+		}
+	}
+
+	if metrics != nil {
+		metrics.Plugins = make([]PluginMetrics, len(pluginStats))
+		for i, stats := range pluginStats {
+			metrics.Plugins[i] = stats.metrics()
+		}
 	}
 
 	result := BuildResult{
 		Errors:      convertMessagesToPublic(logger.Error, msgs),
 		Warnings:    convertMessagesToPublic(logger.Warning, msgs),
 		OutputFiles: outputFiles,
+		Metadata:    metadata,
 		Rebuild:     rebuild,
 		Stop:        stop,
+		Metrics:     metrics,
+		Cancelled:   cancelled,
+
+		RebuildWithCancel: rebuildWithCancel,
 	}
 	return internalBuildResult{
 		result:    result,
@@ -831,147 +1520,92 @@ func rebuildImpl(
 	}
 }
 
-type watcher struct {
-	mutex             sync.Mutex
-	data              fs.WatchData
-	resolver          resolver.Resolver
-	shouldStop        int32
-	rebuild           func() fs.WatchData
-	recentItems       []string
-	itemsToScan       []string
-	itemsPerIteration int
-}
-
-func (w *watcher) setWatchData(data fs.WatchData) {
-	defer w.mutex.Unlock()
-	w.mutex.Lock()
-	w.data = data
-	w.itemsToScan = w.itemsToScan[:0] // Reuse memory
-
-	// Remove any recent items that weren't a part of the latest build
-	end := 0
-	for _, path := range w.recentItems {
-		if data.Paths[path] != nil {
-			w.recentItems[end] = path
-			end++
-		}
-	}
-	w.recentItems = w.recentItems[:end]
-}
-
-// The time to wait between watch intervals
-const watchIntervalSleep = 100 * time.Millisecond
-
-// The maximum number of recently-edited items to check every interval
-const maxRecentItemCount = 16
-
-// The minimum number of non-recent items to check every interval
-const minItemCountPerIter = 64
-
-// The maximum number of intervals before a change is detected
-const maxIntervalsBeforeUpdate = 20
-
-func (w *watcher) start(logLevel LogLevel, color StderrColor, mode WatchMode) {
-	useColor := validateColor(color)
-
-	go func() {
-		// Note: Do not change these log messages without a breaking version change.
-		// People want to run regexes over esbuild's stderr stream to look for these
-		// messages instead of using esbuild's API.
-
-		if logLevel == LogLevelInfo {
-			logger.PrintTextWithColor(os.Stderr, useColor, func(colors logger.Colors) string {
-				return fmt.Sprintf("%s[watch] build finished, watching for changes...%s\n", colors.Dim, colors.Default)
-			})
-		}
-
-		for atomic.LoadInt32(&w.shouldStop) == 0 {
-			// Sleep for the watch interval
-			time.Sleep(watchIntervalSleep)
-
-			// Rebuild if we're dirty
-			if absPath := w.tryToFindDirtyPath(); absPath != "" {
-				if logLevel == LogLevelInfo {
-					logger.PrintTextWithColor(os.Stderr, useColor, func(colors logger.Colors) string {
-						prettyPath := w.resolver.PrettyPath(logger.Path{Text: absPath, Namespace: "file"})
-						return fmt.Sprintf("%s[watch] build started (change: %q)%s\n", colors.Dim, prettyPath, colors.Default)
-					})
-				}
-
-				// Run the build
-				w.setWatchData(w.rebuild())
-
-				if logLevel == LogLevelInfo {
-					logger.PrintTextWithColor(os.Stderr, useColor, func(colors logger.Colors) string {
-						return fmt.Sprintf("%s[watch] build finished%s\n", colors.Dim, colors.Default)
-					})
-				}
-			}
-		}
-	}()
-}
-
-func (w *watcher) stop() {
-	atomic.StoreInt32(&w.shouldStop, 1)
-}
-
-func (w *watcher) tryToFindDirtyPath() string {
-	defer w.mutex.Unlock()
-	w.mutex.Lock()
-
-	// If we ran out of items to scan, fill the items back up in a random order
-	if len(w.itemsToScan) == 0 {
-		items := w.itemsToScan[:0] // Reuse memory
-		for path := range w.data.Paths {
-			items = append(items, path)
-		}
-		rand.Seed(time.Now().UnixNano())
-		for i := int32(len(items) - 1); i > 0; i-- { // Fisher–Yates shuffle
-			j := rand.Int31n(i + 1)
-			items[i], items[j] = items[j], items[i]
-		}
-		w.itemsToScan = items
-
-		// Determine how many items to check every iteration, rounded up
-		perIter := (len(items) + maxIntervalsBeforeUpdate - 1) / maxIntervalsBeforeUpdate
-		if perIter < minItemCountPerIter {
-			perIter = minItemCountPerIter
+func hasOnEnd(plugins []config.Plugin) bool {
+	for _, plugin := range plugins {
+		if len(plugin.OnEnd) > 0 {
+			return true
 		}
-		w.itemsPerIteration = perIter
 	}
+	return false
+}
 
-	// Always check all recent items every iteration
-	for i, path := range w.recentItems {
-		if w.data.Paths[path]() {
-			// Move this path to the back of the list (i.e. the "most recent" position)
-			copy(w.recentItems[i:], w.recentItems[i+1:])
-			w.recentItems[len(w.recentItems)-1] = path
-			return path
-		}
+// Output files can be nested deeper than the output directory, for example
+// with "outbase", and the output directory itself may not exist yet either.
+// The missing directories are created before the file is written.
+func writeOutputFile(log logger.Log, realFS fs.FS, absPath string, contents []byte, mode os.FileMode) {
+	fs.BeforeFileOpen()
+	defer fs.AfterFileClose()
+	if err := os.MkdirAll(realFS.Dir(absPath), 0755); err != nil {
+		log.AddError(nil, logger.Loc{}, fmt.Sprintf(
+			"Failed to create output directory: %s", err.Error()))
+	} else if err := ioutil.WriteFile(absPath, contents, mode); err != nil {
+		log.AddError(nil, logger.Loc{}, fmt.Sprintf(
+			"Failed to write to output file: %s", err.Error()))
 	}
+}
 
-	// Check a constant number of items every iteration
-	remainingCount := len(w.itemsToScan) - w.itemsPerIteration
-	if remainingCount < 0 {
-		remainingCount = 0
+// The outputs of entry points come first in the order of the entry points,
+// followed by their source maps and legal comments in the same order. Shared
+// chunks and their source maps and legal comments come next, then files copied
+// by the "file" loader, and the metadata file is the last one. Files of the
+// same kind keep their order.
+func sortOutputFiles(results []bundler.OutputFile) {
+	rank := func(result *bundler.OutputFile) int {
+		switch result.Kind {
+		case bundler.OutputKindEntryPoint:
+			return 0
+		case bundler.OutputKindSourceMap, bundler.OutputKindLegalComments:
+			if result.EntryPointIndex != -1 {
+				return 1
+			}
+			return 3
+		case bundler.OutputKindChunk:
+			return 2
+		case bundler.OutputKindAsset:
+			return 4
+		default:
+			return 5
+		}
 	}
-	toCheck, remaining := w.itemsToScan[remainingCount:], w.itemsToScan[:remainingCount]
-	w.itemsToScan = remaining
+	sort.SliceStable(results, func(i int, j int) bool {
+		a, b := &results[i], &results[j]
+		if rankA, rankB := rank(a), rank(b); rankA != rankB {
+			return rankA < rankB
+		}
+		return a.EntryPointIndex < b.EntryPointIndex
+	})
+}
 
-	// Check if any of the entries in this iteration have been modified
-	for _, path := range toCheck {
-		if w.data.Paths[path]() {
-			// Mark this item as recent by adding it to the back of the list
-			w.recentItems = append(w.recentItems, path)
-			if len(w.recentItems) > maxRecentItemCount {
-				// Remove items from the front of the list when we hit the limit
-				copy(w.recentItems, w.recentItems[1:])
-				w.recentItems = w.recentItems[:maxRecentItemCount]
+// This parses the files in order, where later files override the "paths",
+// "map" and "plugins" entries with the same keys and the other settings of
+// earlier files.
+func parseAMDConfigs(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, files []string, result *config.AMDOptions) bool {
+	ok := true
+	var configPlugins map[string]*config.AMDPlugin
+	for _, file := range files {
+		plugins := result.Plugins
+		result.Plugins = nil
+		if !parseAMDConfig(log, fs, jsonCache, file, result) {
+			ok = false
+		}
+
+		// The "plugins" of a file replace the default plugins, but they are
+		// merged with the "plugins" of earlier files
+		if result.Plugins == nil {
+			result.Plugins = plugins
+			continue
+		}
+		for key, plugin := range configPlugins {
+			if _, ok := result.Plugins[key]; !ok {
+				result.Plugins[key] = plugin
+				for _, fileExtension := range plugin.FileExtensions {
+					result.KnownFileExtensions[fileExtension] = true
+				}
 			}
-			return path
 		}
+		configPlugins = result.Plugins
 	}
-	return ""
+	return ok
 }
 
 // The "baseUrl" field points to a directory which will be used as a base
@@ -988,38 +1622,27 @@ func (w *watcher) tryToFindDirtyPath() string {
 //       "libs": "vendor/libs"
 //     }
 //   }
+//
+// Parsing does not stop at the first invalid key. All problems are reported
+// and false is returned at the end if there were any.
 func parseAMDConfig(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, file string, result *config.AMDOptions) bool {
-	contents, err := fs.ReadFile(file)
-	if err != nil {
-		log.AddError(&logger.Source{
-			KeyPath:    logger.Path{Text: file, Namespace: "file"},
-			PrettyPath: file,
-		}, logger.Loc{}, err.Error())
-		return false
-	}
-	source := logger.Source{
-		KeyPath:    logger.Path{Text: file, Namespace: "file"},
-		PrettyPath: file,
-		Contents:   contents,
-	}
-	json, ok := jsonCache.Parse(log, source, js_parser.JSONOptions{
-		AllowComments:       true,
-		AllowTrailingCommas: true,
-	})
+	source, json, ok := readAMDConfig(log, fs, jsonCache, file)
 	if !ok {
 		return false
 	}
+	hasErrors := false
 
 	if baseUrlJson, baseUrlKeyLoc, ok := getProperty(json, "baseUrl"); ok {
 		if baseUrl, ok := getString(baseUrlJson); ok {
 			if baseUrl, ok = fs.Abs(baseUrl); !ok {
 				log.AddError(&source, baseUrlKeyLoc, "\"baseUrl\" cannot be converted to an absolute path")
-				return false
+				hasErrors = true
+			} else {
+				result.BaseUrl = baseUrl
 			}
-			result.BaseUrl = baseUrl
 		} else {
 			log.AddError(&source, baseUrlKeyLoc, "\"baseUrl\" does not point to a string")
-			return false
+			hasErrors = true
 		}
 	}
 
@@ -1030,17 +1653,17 @@ func parseAMDConfig(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, file s
 					if value, ok := getString(*prop.Value); ok {
 						result.Paths[key] = value
 					} else {
-						log.AddError(&source, pathsKeyLoc, fmt.Sprintf("the key \"%s\" in \"paths\" does not point to a string", key))
-						return false
+						log.AddError(&source, prop.Key.Loc, fmt.Sprintf("the key \"%s\" in \"paths\" does not point to a string", key))
+						hasErrors = true
 					}
 				} else {
-					log.AddError(&source, pathsKeyLoc, "a key in \"paths\" is not a string")
-					return false
+					log.AddError(&source, prop.Key.Loc, "a key in \"paths\" is not a string")
+					hasErrors = true
 				}
 			}
 		} else {
 			log.AddError(&source, pathsKeyLoc, "\"paths\" does not point to an object")
-			return false
+			hasErrors = true
 		}
 	}
 
@@ -1064,35 +1687,137 @@ func parseAMDConfig(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, file s
 								if value, ok := getString(*scopeProp.Value); ok {
 									scope[key] = value
 								} else {
-									log.AddError(&source, mapKeyLoc, fmt.Sprintf("the key \"%s\" in \"map\" below \"%s\" does not point to a string", key, scopeKey))
-									return false
+									log.AddError(&source, scopeProp.Key.Loc, fmt.Sprintf("the key \"%s\" in \"map\" below \"%s\" does not point to a string", key, scopeKey))
+									hasErrors = true
 								}
 							} else {
-								log.AddError(&source, mapKeyLoc, fmt.Sprintf("a key in \"map\" below \"%s\" is not a string", scopeKey))
-								return false
+								log.AddError(&source, scopeProp.Key.Loc, fmt.Sprintf("a key in \"map\" below \"%s\" is not a string", scopeKey))
+								hasErrors = true
 							}
 						}
 					} else {
-						log.AddError(&source, mapKeyLoc, fmt.Sprintf("the key \"%s\" in \"map\" does not point to an object", scopeKey))
-						return false
+						log.AddError(&source, mapProp.Key.Loc, fmt.Sprintf("the key \"%s\" in \"map\" does not point to an object", scopeKey))
+						hasErrors = true
 					}
 				} else {
-					log.AddError(&source, mapKeyLoc, "a key in \"map\" is not a string")
-					return false
+					log.AddError(&source, mapProp.Key.Loc, "a key in \"map\" is not a string")
+					hasErrors = true
 				}
 			}
 		} else {
-			log.AddError(&source, mapKeyLoc, "\"paths\" does not point to an object")
-			return false
+			log.AddError(&source, mapKeyLoc, "\"map\" does not point to an object")
+			hasErrors = true
 		}
 	}
 
 	if namespaceJson, namespaceKeyLoc, ok := getProperty(json, "namespace"); ok {
-		if namespace, ok := getString(namespaceJson); ok {
+		if namespace, ok := getString(namespaceJson); !ok {
+			log.AddError(&source, namespaceKeyLoc, "\"namespace\" does not point to a string")
+			hasErrors = true
+		} else if result.Namespace != "" && result.Namespace != namespace {
+			// All modules are defined in one namespace, so merged AMD configs
+			// must not disagree about it
+			log.AddError(&source, namespaceKeyLoc, fmt.Sprintf(
+				"\"namespace\" %q conflicts with %q from another AMD config", namespace, result.Namespace))
+			hasErrors = true
+		} else {
 			result.Namespace = namespace
+		}
+	}
+
+	if urlArgsJson, urlArgsKeyLoc, ok := getProperty(json, "urlArgs"); ok {
+		if urlArgs, ok := getString(urlArgsJson); ok {
+			// JSON cannot contain a function, so the function form of "urlArgs"
+			// is accepted as a string with the source code of the function
+			result.UrlArgs = urlArgs
+			result.UrlArgsIsFunction = isFunctionSource(urlArgs)
 		} else {
-			log.AddError(&source, namespaceKeyLoc, "\"namespace\" does not point to a string")
-			return false
+			log.AddError(&source, urlArgsKeyLoc, "\"urlArgs\" does not point to a string")
+			hasErrors = true
+		}
+	}
+
+	if depsJson, depsKeyLoc, ok := getProperty(json, "deps"); ok {
+		if depsArray, ok := depsJson.Data.(*js_ast.EArray); ok {
+			result.Deps = make([]string, 0, len(depsArray.Items))
+			for _, item := range depsArray.Items {
+				if dep, ok := getString(item); ok {
+					result.Deps = append(result.Deps, dep)
+				} else {
+					log.AddError(&source, item.Loc, "\"deps\" does not point to an array with strings only")
+					hasErrors = true
+				}
+			}
+		} else {
+			log.AddError(&source, depsKeyLoc, "\"deps\" does not point to an array")
+			hasErrors = true
+		}
+	}
+
+	if callbackJson, callbackKeyLoc, ok := getProperty(json, "callback"); ok {
+		if callback, ok := getString(callbackJson); ok {
+			// The callback is either a name of a module exporting the function,
+			// or the source code of the function like with "urlArgs" above
+			result.Callback = callback
+			result.CallbackIsFunction = isFunctionSource(callback)
+		} else {
+			log.AddError(&source, callbackKeyLoc, "\"callback\" does not point to a string")
+			hasErrors = true
+		}
+	}
+
+	if shimJson, shimKeyLoc, ok := getProperty(json, "shim"); ok {
+		if shimObject, ok := shimJson.Data.(*js_ast.EObject); ok {
+			if result.Shim == nil {
+				result.Shim = make(map[string]config.AMDShim)
+			}
+			for _, shimProp := range shimObject.Properties {
+				moduleKey, ok := getString(shimProp.Key)
+				if !ok {
+					log.AddError(&source, shimProp.Key.Loc, "a key in \"shim\" is not a string")
+					hasErrors = true
+					continue
+				}
+
+				// An array is a shorthand for an object with "deps" only
+				shim := config.AMDShim{Deps: []string{}}
+				depsJson, depsKeyLoc, hasDeps := *shimProp.Value, shimProp.Key.Loc, true
+				if shimValueObject, ok := shimProp.Value.Data.(*js_ast.EObject); ok {
+					depsJson, depsKeyLoc, hasDeps = getObjectProperty(shimValueObject, "deps")
+					if exportsJson, exportsKeyLoc, ok := getObjectProperty(shimValueObject, "exports"); ok {
+						if exports, ok := getString(exportsJson); ok {
+							shim.Exports = exports
+						} else {
+							log.AddError(&source, exportsKeyLoc, fmt.Sprintf("the key \"exports\" in \"%s\" below \"shim\" does not point to a string", moduleKey))
+							hasErrors = true
+						}
+					}
+				} else if _, ok := shimProp.Value.Data.(*js_ast.EArray); !ok {
+					log.AddError(&source, shimProp.Key.Loc, fmt.Sprintf("the key \"%s\" in \"shim\" does not point to an object or an array", moduleKey))
+					hasErrors = true
+					continue
+				}
+				if hasDeps {
+					if depsArray, ok := depsJson.Data.(*js_ast.EArray); ok {
+						for _, item := range depsArray.Items {
+							if dep, ok := getString(item); ok {
+								shim.Deps = append(shim.Deps, dep)
+							} else {
+								log.AddError(&source, depsKeyLoc, fmt.Sprintf("the dependencies of \"%s\" below \"shim\" are not an array with strings only", moduleKey))
+								hasErrors = true
+								break
+							}
+						}
+					} else {
+						log.AddError(&source, depsKeyLoc, fmt.Sprintf("the key \"deps\" in \"%s\" below \"shim\" does not point to an array", moduleKey))
+						hasErrors = true
+					}
+				}
+				result.Shim[moduleKey] = shim
+			}
+		} else {
+			log.AddError(&source, shimKeyLoc, "\"shim\" does not point to an object")
+			hasErrors = true
 		}
 	}
 
@@ -1116,20 +1841,21 @@ func parseAMDConfig(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, file s
 										result.KnownFileExtensions[fileExtensionValue] = true
 									} else {
 										log.AddError(&source, fileExtensionsKeyLoc, fmt.Sprintf("the key \"fileExtensions\" in \"%s\" below \"plugins\" does not point to an array with strings only", pluginKey))
-										return false
+										hasErrors = true
+										break
 									}
 								}
 							} else {
 								log.AddError(&source, fileExtensionsKeyLoc, fmt.Sprintf("the key \"fileExtensions\" in \"%s\" below \"plugins\" does not point to an array", pluginKey))
-								return false
+								hasErrors = true
 							}
 						}
 						if appendFileExtensionJson, appendFileExtensionKeyLoc, ok := getObjectProperty(pluginObject, "appendFileExtension"); ok {
 							if appendFileExtension, ok := getBoolean(appendFileExtensionJson); ok {
 								plugin.AppendFileExtension = appendFileExtension
 							} else {
-								log.AddError(&source, appendFileExtensionKeyLoc, fmt.Sprintf("the key \"addsFileExtension\" in \"%s\" below \"plugins\" does not point to a boolean", pluginKey))
-								return false
+								log.AddError(&source, appendFileExtensionKeyLoc, fmt.Sprintf("the key \"appendFileExtension\" in \"%s\" below \"plugins\" does not point to a boolean", pluginKey))
+								hasErrors = true
 							}
 						}
 						if loadScriptJson, loadScriptKeyLoc, ok := getObjectProperty(pluginObject, "loadScript"); ok {
@@ -1137,53 +1863,207 @@ func parseAMDConfig(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, file s
 								plugin.LoadScript = &config.AMDLoadableScript{}
 								if replacementPatternJson, replacementPatternKeyLoc, ok := getObjectProperty(loadScriptObject, "replacementPattern"); ok {
 									if replacementPattern, ok := getString(replacementPatternJson); ok {
-										plugin.LoadScript.ReplacementPattern = replacementPattern
-										plugin.LoadScript.ReplacementRegexp = regexp.MustCompile(replacementPattern)
+										if replacementRegexp, err := regexp.Compile(replacementPattern); err != nil {
+											log.AddError(&source, replacementPatternKeyLoc, fmt.Sprintf("the key \"loadScript.replacementPattern\" in \"%s\" below \"plugins\" is not a valid regular expression: %s", pluginKey, err.Error()))
+											hasErrors = true
+										} else {
+											plugin.LoadScript.ReplacementPattern = replacementPattern
+											plugin.LoadScript.ReplacementRegexp = replacementRegexp
+										}
 									} else {
 										log.AddError(&source, replacementPatternKeyLoc, fmt.Sprintf("the key \"loadScript.replacementPattern\" in \"%s\" below \"plugins\" does not point to a string", pluginKey))
-										return false
+										hasErrors = true
 									}
 								} else {
-									log.AddError(&source, replacementPatternKeyLoc, fmt.Sprintf("the key \"loadScript.replacementPattern\" in \"%s\" below \"plugins\" does not exist", pluginKey))
-									return false
+									log.AddError(&source, loadScriptKeyLoc, fmt.Sprintf("the key \"loadScript.replacementPattern\" in \"%s\" below \"plugins\" does not exist", pluginKey))
+									hasErrors = true
 								}
 								if replacementValueJson, replacementValueKeyLoc, ok := getObjectProperty(loadScriptObject, "replacementValue"); ok {
 									if replacementValue, ok := getString(replacementValueJson); ok {
 										plugin.LoadScript.ReplacementValue = replacementValue
 									} else {
 										log.AddError(&source, replacementValueKeyLoc, fmt.Sprintf("the key \"loadScript.replacementValue\" in \"%s\" below \"plugins\" does not point to a string", pluginKey))
-										return false
+										hasErrors = true
 									}
 								} else {
-									log.AddError(&source, replacementValueKeyLoc, fmt.Sprintf("the key \"loadScript.replacementValue\" in \"%s\" below \"plugins\" does not exist", pluginKey))
-									return false
+									log.AddError(&source, loadScriptKeyLoc, fmt.Sprintf("the key \"loadScript.replacementValue\" in \"%s\" below \"plugins\" does not exist", pluginKey))
+									hasErrors = true
 								}
 							} else {
 								log.AddError(&source, loadScriptKeyLoc, fmt.Sprintf("the key \"loadScript\" in \"%s\" below \"plugins\" does not point to an object", pluginKey))
-								return false
+								hasErrors = true
 							}
 						}
 					} else {
-						log.AddError(&source, pluginsKeyLoc, fmt.Sprintf("the key \"%s\" in \"plugins\" does not point to an object", pluginKey))
-						return false
+						log.AddError(&source, pluginProps.Key.Loc, fmt.Sprintf("the key \"%s\" in \"plugins\" does not point to an object", pluginKey))
+						hasErrors = true
 					}
 				} else {
-					log.AddError(&source, pluginsKeyLoc, "a key in \"plugins\" is not a string")
-					return false
+					log.AddError(&source, pluginProps.Key.Loc, "a key in \"plugins\" is not a string")
+					hasErrors = true
 				}
 			}
 		} else {
 			log.AddError(&source, pluginsKeyLoc, "\"plugins\" does not point to an object")
-			return false
+			hasErrors = true
 		}
 	}
 
+	if hasErrors {
+		return false
+	}
+
 	result.MappedModuleNames = len(result.Paths) > 0
 	result.Parse = true
 
 	return true
 }
 
+// The value is the source code of a function only if it parses as a single
+// function or arrow function expression. Anything else, like "v=function1" or
+// "functions/init", is a plain string. The closing parenthesis is put on a new
+// line to survive a trailing line comment.
+func isFunctionSource(text string) bool {
+	source := logger.Source{Contents: "(" + text + "\n)"}
+	tree, ok := js_parser.Parse(logger.NewDeferLog(), source, js_parser.OptionsFromConfig(&config.Options{}))
+	if !ok {
+		return false
+	}
+	var stmts []js_ast.Stmt
+	for _, part := range tree.Parts {
+		stmts = append(stmts, part.Stmts...)
+	}
+	if len(stmts) != 1 {
+		return false
+	}
+	if expr, ok := stmts[0].Data.(*js_ast.SExpr); ok {
+		switch expr.Value.Data.(type) {
+		case *js_ast.EFunction, *js_ast.EArrow:
+			return true
+		}
+	}
+	return false
+}
+
+func readAMDConfig(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, file string) (logger.Source, js_ast.Expr, bool) {
+	contents, err := fs.ReadFile(file)
+	if err != nil {
+		log.AddError(&logger.Source{
+			KeyPath:    logger.Path{Text: file, Namespace: "file"},
+			PrettyPath: file,
+		}, logger.Loc{}, err.Error())
+		return logger.Source{}, js_ast.Expr{}, false
+	}
+	source := logger.Source{
+		KeyPath:    logger.Path{Text: file, Namespace: "file"},
+		PrettyPath: file,
+		Contents:   contents,
+	}
+	json, ok := jsonCache.Parse(log, source, js_parser.JSONOptions{
+		AllowComments:       true,
+		AllowTrailingCommas: true,
+	})
+	return source, json, ok
+}
+
+// The targets of "paths" are only resolved when a module using them is
+// imported, so a build does not notice a target that is missing until then.
+// This checks all of them up front. Targets mapped to "empty:" are skipped,
+// because they denote modules excluded from the bundle.
+func checkAMDConfigPaths(log logger.Log, fs fs.FS, source logger.Source, json js_ast.Expr, result *config.AMDOptions) {
+	pathsJson, _, ok := getProperty(json, "paths")
+	if !ok {
+		return
+	}
+	pathsObject, ok := pathsJson.Data.(*js_ast.EObject)
+	if !ok {
+		return
+	}
+	for _, prop := range pathsObject.Properties {
+		key, ok := getString(prop.Key)
+		if !ok {
+			continue
+		}
+		target, ok := getString(*prop.Value)
+		if !ok || strings.HasPrefix(target, "empty:") {
+			continue
+		}
+		absPath := target
+		if !fs.IsAbs(absPath) {
+			absPath = fs.Join(result.BaseUrl, target)
+		}
+		if amdPathTargetExists(fs, absPath) ||
+			(!result.HasKnownFileExtension(absPath) && amdPathTargetExists(fs, absPath+".js")) {
+			continue
+		}
+		log.AddError(&source, prop.Value.Loc, fmt.Sprintf("the key \"%s\" in \"paths\" points to %q, which does not exist",
+			key, prettyPrintPath(fs, absPath)))
+	}
+}
+
+// The packages are either names or objects with "name", "location" and "main".
+// The location defaults to the name and is relative to "baseUrl", the main
+// module defaults to "main" and is relative to the location.
+func checkAMDConfigPackages(log logger.Log, fs fs.FS, source logger.Source, json js_ast.Expr, result *config.AMDOptions) {
+	packagesJson, _, ok := getProperty(json, "packages")
+	if !ok {
+		return
+	}
+	packagesArray, ok := packagesJson.Data.(*js_ast.EArray)
+	if !ok {
+		return
+	}
+	for _, item := range packagesArray.Items {
+		var name, location, main string
+		loc := item.Loc
+		if value, ok := getString(item); ok {
+			name = value
+		} else if packageObject, ok := item.Data.(*js_ast.EObject); ok {
+			if nameJson, _, ok := getObjectProperty(packageObject, "name"); ok {
+				name, _ = getString(nameJson)
+			}
+			if locationJson, locationKeyLoc, ok := getObjectProperty(packageObject, "location"); ok {
+				location, _ = getString(locationJson)
+				loc = locationKeyLoc
+			}
+			if mainJson, _, ok := getObjectProperty(packageObject, "main"); ok {
+				main, _ = getString(mainJson)
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if location == "" {
+			location = name
+		}
+		if main == "" {
+			main = "main"
+		}
+		absPath := location
+		if !fs.IsAbs(absPath) {
+			absPath = fs.Join(result.BaseUrl, location)
+		}
+		if !amdPathTargetExists(fs, absPath) {
+			log.AddError(&source, loc, fmt.Sprintf("the package \"%s\" in \"packages\" points to %q, which does not exist",
+				name, prettyPrintPath(fs, absPath)))
+			continue
+		}
+		mainPath := fs.Join(absPath, strings.TrimSuffix(main, ".js"))
+		if amdPathTargetExists(fs, mainPath) || amdPathTargetExists(fs, mainPath+".js") {
+			continue
+		}
+		log.AddError(&source, loc, fmt.Sprintf("the main module of the package \"%s\" in \"packages\" points to %q, which does not exist",
+			name, prettyPrintPath(fs, mainPath+".js")))
+	}
+}
+
+func amdPathTargetExists(fs fs.FS, absPath string) bool {
+	if entries, err := fs.ReadDirectory(fs.Dir(absPath)); err == nil {
+		return entries[fs.Base(absPath)] != nil
+	}
+	return false
+}
+
 func getProperty(json js_ast.Expr, name string) (js_ast.Expr, logger.Loc, bool) {
 	if obj, ok := json.Data.(*js_ast.EObject); ok {
 		for _, prop := range obj.Properties {
@@ -1227,12 +2107,15 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 		MessageLimit:  transformOpts.ErrorLimit,
 		Color:         validateColor(transformOpts.Color),
 		LogLevel:      validateLogLevel(transformOpts.LogLevel),
+		Overrides:     validateLogOverrides(transformOpts.LogOverride),
 	})
 
 	// Settings from the user come first
 	preserveUnusedImportsTS := false
 	useDefineForClassFieldsTS := false
+	isolatedModulesTS := transformOpts.IsolatedModules
 	jsx := config.JSXOptions{
+		Preserve: validatePreserveJSX(log, transformOpts.JSXMode, transformOpts.MinifySyntax, transformOpts.MinifyIdentifiers),
 		Factory:  validateJSX(log, transformOpts.JSXFactory, "factory"),
 		Fragment: validateJSX(log, transformOpts.JSXFragment, "fragment"),
 	}
@@ -1258,26 +2141,48 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 			if result.PreserveImportsNotUsedAsValues {
 				preserveUnusedImportsTS = true
 			}
+			if result.IsolatedModules {
+				isolatedModulesTS = true
+			}
 		}
 	}
 
 	// Apply default values
+	if transformOpts.Loader == LoaderNone {
+		transformOpts.Loader = loaderForFileImpl(transformOpts.Sourcefile)
+	}
 	if transformOpts.Sourcefile == "" {
 		transformOpts.Sourcefile = "<stdin>"
 	}
-	if transformOpts.Loader == LoaderNone {
-		transformOpts.Loader = LoaderJS
+
+	// The input is never read from the file system, but injected files are. If
+	// there are any, the real file system is used instead of an empty mock one.
+	var transformFS fs.FS
+	var injectAbsPaths []string
+	if len(transformOpts.Inject) > 0 {
+		realFS, err := fs.RealFS(fs.RealFSOptions{})
+		if err != nil {
+			log.AddError(nil, logger.Loc{}, err.Error())
+		} else {
+			transformFS = realFS
+			injectAbsPaths = make([]string, len(transformOpts.Inject))
+			for i, path := range transformOpts.Inject {
+				injectAbsPaths[i] = validateInjectPath(log, realFS, path)
+			}
+		}
+	} else {
+		transformFS = fs.MockFS(make(map[string]string))
 	}
+	plugins, _, _ := loadPlugins(transformFS, log, transformOpts.Plugins, false /* collectMetrics */, nil /* tracer */)
 
 	// Convert and validate the transformOpts
 	jsFeatures, cssFeatures := validateFeatures(log, transformOpts.Target, transformOpts.Engines)
-	defines, injectedDefines := validateDefines(log, transformOpts.Define, transformOpts.Pure)
+	defines := validateDefines(log, transformOpts.Define, transformOpts.Pure)
 	options := config.Options{
 		UnsupportedJSFeatures:   jsFeatures,
 		UnsupportedCSSFeatures:  cssFeatures,
 		JSX:                     jsx,
 		Defines:                 defines,
-		InjectedDefines:         injectedDefines,
 		SourceMap:               validateSourceMap(transformOpts.Sourcemap),
 		ExcludeSourcesContent:   transformOpts.SourcesContent == SourcesContentExclude,
 		OutputFormat:            validateFormat(transformOpts.Format),
@@ -1286,23 +2191,34 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 		RemoveWhitespace:        transformOpts.MinifyWhitespace,
 		MinifyIdentifiers:       transformOpts.MinifyIdentifiers,
 		ASCIIOnly:               validateASCIIOnly(transformOpts.Charset),
+		Comments:                validateComments(transformOpts.Comments),
+		LegalComments:           validateLegalComments(transformOpts.LegalComments),
 		IgnoreDCEAnnotations:    validateIgnoreDCEAnnotations(transformOpts.TreeShaking),
+		Drop:                    validateDrop(log, transformOpts.Drop),
 		AbsOutputFile:           transformOpts.Sourcefile + "-out",
 		KeepNames:               transformOpts.KeepNames,
+		MangleKeyframes:         transformOpts.MangleKeyframes,
+		InjectAbsPaths:          injectAbsPaths,
 		UseDefineForClassFields: useDefineForClassFieldsTS,
 		PreserveUnusedImportsTS: preserveUnusedImportsTS,
+		IsolatedModulesTS:       isolatedModulesTS,
 		Stdin: &config.StdinInfo{
 			Loader:     validateLoader(transformOpts.Loader),
 			Contents:   input,
 			SourceFile: transformOpts.Sourcefile,
 		},
-		Banner: transformOpts.Banner,
-		Footer: transformOpts.Footer,
+		Banner:  config.OutputText{JS: transformOpts.Banner, CSS: transformOpts.BannerCSS},
+		Footer:  config.OutputText{JS: transformOpts.Footer, CSS: transformOpts.FooterCSS},
+		Plugins: plugins,
 	}
 	if options.SourceMap == config.SourceMapLinkedWithComment {
 		// Linked source maps don't make sense because there's no output file name
 		log.AddError(nil, logger.Loc{}, "Cannot transform with linked source maps")
 	}
+	if options.LegalComments == config.LegalCommentsLinkedWithComment || options.LegalComments == config.LegalCommentsExternalWithoutComment {
+		// There's no output file name to put the legal comments next to
+		log.AddError(nil, logger.Loc{}, "Cannot transform with linked or external legal comments")
+	}
 	if options.SourceMap != config.SourceMapNone && options.Stdin.SourceFile == "" {
 		log.AddError(nil, logger.Loc{},
 			"Must use \"sourcefile\" with \"sourcemap\" to set the original file name")
@@ -1314,18 +2230,21 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 	}
 
 	var results []bundler.OutputFile
+	var loweredFeatures compat.JSFeature
+	var isModule bool
 
 	// Stop now if there were errors
 	if !log.HasErrors() {
 		// Scan over the bundle
-		mockFS := fs.MockFS(make(map[string]string))
-		resolver := resolver.NewResolver(mockFS, log, caches, options)
-		bundle := bundler.ScanBundle(log, mockFS, resolver, caches, nil, options)
+		resolver := resolver.NewResolver(transformFS, log, caches, options)
+		bundle := bundler.ScanBundle(log, transformFS, resolver, caches, nil, options)
 
 		// Stop now if there were errors
 		if !log.HasErrors() {
 			// Compile the bundle
 			results = bundle.Compile(log, options)
+			loweredFeatures = bundle.LoweredFeatures()
+			isModule = bundle.HasES6ImportsOrExports()
 		}
 	}
 
@@ -1333,7 +2252,7 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 	var code []byte
 	var sourceMap []byte
 
-	// Unpack the JavaScript file and the source map file
+	// Unpack the output file and the source map file
 	if len(results) == 1 {
 		code = results[0].Contents
 	} else if len(results) == 2 {
@@ -1345,12 +2264,61 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 		}
 	}
 
+	var stats *TransformStats
+	if transformOpts.Stats {
+		stats = &TransformStats{
+			InputBytes:  len(input),
+			OutputBytes: len(code),
+			Lowered:     jsFeatureNames(loweredFeatures),
+		}
+	}
+
 	msgs := log.Done()
 	return TransformResult{
 		Errors:   convertMessagesToPublic(logger.Error, msgs),
 		Warnings: convertMessagesToPublic(logger.Warning, msgs),
 		Code:     code,
 		Map:      sourceMap,
+		Loader:   transformOpts.Loader,
+		Module:   isModule,
+		Stats:    stats,
+	}
+}
+
+// The names are sorted and the same as in "Features" from "FeaturesForTarget"
+func jsFeatureNames(features compat.JSFeature) []string {
+	names := []string{}
+	for name, feature := range compat.StringToJSFeature {
+		if features.Has(feature) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The loader is inferred from the extension of the file name using the same
+// default extensions as when bundling and "json5", with JavaScript as the
+// fallback
+func loaderForFileImpl(path string) Loader {
+	_, _, ext := logger.PlatformIndependentPathDirBaseExt(path)
+	switch ext {
+	case ".jsx":
+		return LoaderJSX
+	case ".ts":
+		return LoaderTS
+	case ".tsx":
+		return LoaderTSX
+	case ".css":
+		return LoaderCSS
+	case ".json":
+		return LoaderJSON
+	case ".json5":
+		return LoaderJSON5
+	case ".txt":
+		return LoaderText
+	default:
+		return LoaderJS
 	}
 }
 
@@ -1360,9 +2328,10 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 	logOptions := logger.OutputOptions{
 		IncludeSource: true,
-		ErrorLimit:    analyseOpts.ErrorLimit,
+		MessageLimit:  analyseOpts.ErrorLimit,
 		Color:         validateColor(analyseOpts.Color),
 		LogLevel:      validateLogLevel(analyseOpts.LogLevel),
+		Overrides:     validateLogOverrides(analyseOpts.LogOverride),
 	}
 	log := logger.NewStderrLog(logOptions)
 
@@ -1375,12 +2344,12 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 		return AnalyseResult{Errors: convertMessagesToPublic(logger.Error, log.Done())}
 	}
 
-	plugins := loadPlugins(realFS, log, analyseOpts.Plugins)
+	plugins, _, pluginEntryPoints := loadPlugins(realFS, log, analyseOpts.Plugins, false /* collectMetrics */, nil /* tracer */)
 	caches := cache.MakeCacheSet()
 
 	// Convert and validate the analyseOpts
 	jsFeatures, cssFeatures := validateFeatures(log, analyseOpts.Target, analyseOpts.Engines)
-	defines, injectedDefines := validateDefines(log, analyseOpts.Define, analyseOpts.Pure)
+	defines := validateDefines(log, analyseOpts.Define, analyseOpts.Pure)
 	options := config.Options{
 		UnsupportedJSFeatures:  jsFeatures,
 		UnsupportedCSSFeatures: cssFeatures,
@@ -1388,30 +2357,36 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 			Factory:  validateJSX(log, analyseOpts.JSXFactory, "factory"),
 			Fragment: validateJSX(log, analyseOpts.JSXFragment, "fragment"),
 		},
-		Defines:           defines,
-		InjectedDefines:   injectedDefines,
-		Platform:          validatePlatform(analyseOpts.Platform),
-		GlobalName:        validateGlobalName(log, analyseOpts.GlobalName),
-		CodeSplitting:     analyseOpts.Splitting,
-		AbsMetadataFile:   validatePath(log, realFS, analyseOpts.Metafile, "metafile path"),
-		ExtensionToLoader: validateLoaders(log, analyseOpts.Loader),
-		ExtensionOrder:    validateResolveExtensions(log, analyseOpts.ResolveExtensions),
-		ExternalModules:   validateExternals(log, realFS, analyseOpts.External),
-		AMDConfig:         validatePath(log, realFS, analyseOpts.AMDConfig, "tsconfig path"),
-		TsConfigOverride:  validatePath(log, realFS, analyseOpts.Tsconfig, "tsconfig path"),
-		MainFields:        analyseOpts.MainFields,
-		Plugins:           plugins,
+		Defines:            defines,
+		Platform:           validatePlatform(analyseOpts.Platform),
+		ASCIIOnly:          validateASCIIOnly(analyseOpts.Charset),
+		GlobalName:         validateGlobalName(log, analyseOpts.GlobalName),
+		CodeSplitting:      analyseOpts.Splitting,
+		AbsMetadataFile:    validatePath(log, realFS, analyseOpts.Metafile, "metafile path"),
+		MetafilePretty:     analyseOpts.Pretty,
+		IncludeHashes:      analyseOpts.IncludeHashes,
+		IncludeDefineStats: analyseOpts.IncludeDefineStats,
+		DefineKeys:         defineKeys(analyseOpts.Define),
+		ExtensionToLoader:  validateLoaders(log, analyseOpts.Loader, false),
+		ExtensionOrder:     validateResolveExtensions(log, analyseOpts.ResolveExtensions),
+		ExternalModules:    validateExternals(log, realFS, analyseOpts.External),
+		AMDConfigs:         validateAMDConfigPaths(log, realFS, analyseOpts.AMDConfig, analyseOpts.AMDConfigs),
+		TsConfigOverride:   validateFilePath(log, realFS, analyseOpts.Tsconfig, "tsconfig path"),
+		MainFields:         analyseOpts.MainFields,
+		Conditions:         analyseOpts.Conditions,
+		AbsNodePaths:       make([]string, len(analyseOpts.NodePaths)),
+		Plugins:            plugins,
 	}
 	for i, path := range analyseOpts.NodePaths {
 		options.AbsNodePaths[i] = validatePath(log, realFS, path, "node path")
 	}
-	entryPoints := append([]string{}, analyseOpts.EntryPoints...)
+	entryPoints := append(append([]string{}, analyseOpts.EntryPoints...), pluginEntryPoints...)
 	if analyseOpts.Stdin != nil {
 		options.Stdin = &config.StdinInfo{
 			Loader:        validateLoader(analyseOpts.Stdin.Loader),
 			Contents:      analyseOpts.Stdin.Contents,
 			SourceFile:    analyseOpts.Stdin.Sourcefile,
-			AbsResolveDir: validatePath(log, realFS, analyseOpts.Stdin.ResolveDir, "resolve directory path"),
+			AbsResolveDir: validateStdinResolveDir(log, realFS, analyseOpts.Stdin.ResolveDir),
 		}
 	}
 
@@ -1424,8 +2399,8 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 
 		// Forbid certain features when writing to stdout
 		for _, loader := range options.ExtensionToLoader {
-			if loader == config.LoaderFile {
-				log.AddError(nil, logger.Loc{}, "Cannot use the \"file\" loader without an output path")
+			if loader == config.LoaderFile || loader == config.LoaderAsset {
+				log.AddError(nil, logger.Loc{}, fmt.Sprintf("Cannot use the %q loader without an output path", loaderNames[loader]))
 				break
 			}
 		}
@@ -1436,8 +2411,8 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 	}
 
 	options.AMD.Init(realFS.Cwd())
-	if len(options.AMDConfig) > 0 {
-		parseAMDConfig(log, realFS, &caches.JSONCache, options.AMDConfig, &options.AMD)
+	if len(options.AMDConfigs) > 0 {
+		parseAMDConfigs(log, realFS, &caches.JSONCache, options.AMDConfigs, &options.AMD)
 		options.OutputFormat = config.FormatJoin
 	}
 
@@ -1465,9 +2440,9 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 		options.Mode = config.ModeConvertFormat
 	}
 
-	// Code splitting is experimental and currently only enabled for ES6 modules
-	if options.CodeSplitting && options.OutputFormat != config.FormatESModule {
-		log.AddError(nil, logger.Loc{}, "Splitting currently only works with the \"esm\" format")
+	// Code splitting is experimental and currently only enabled for ES6 modules and CommonJS
+	if options.CodeSplitting && options.OutputFormat != config.FormatESModule && options.OutputFormat != config.FormatCommonJS {
+		log.AddError(nil, logger.Loc{}, "Splitting currently only works with the \"esm\" and \"cjs\" formats")
 	}
 
 	var metadata []byte
@@ -1477,11 +2452,12 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 	if !log.HasErrors() {
 		// Scan over the bundle
 		bundle := bundler.ScanBundle(log, realFS, resolver, caches, entryPoints, options)
+		warnAboutUnusedExternals(log, resolver)
 
 		// Stop now if there were errors
 		if !log.HasErrors() {
 			// Analyse the bundle
-			metadata = bundle.Analyse()
+			metadata = bundle.Analyse(options)
 
 			// Stop now if there were errors
 			if !log.HasErrors() {
@@ -1493,18 +2469,7 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 								"Failed to write to stdout: %s", err.Error()))
 						}
 					} else {
-						fs.BeforeFileOpen()
-						defer fs.AfterFileClose()
-						if err := os.MkdirAll(realFS.Dir(options.AbsMetadataFile), 0755); err != nil {
-							log.AddError(nil, logger.Loc{}, fmt.Sprintf(
-								"Failed to create output directory: %s", err.Error()))
-						} else {
-							var mode os.FileMode = 0644
-							if err := ioutil.WriteFile(options.AbsMetadataFile, metadata, mode); err != nil {
-								log.AddError(nil, logger.Loc{}, fmt.Sprintf(
-									"Failed to write to output file: %s", err.Error()))
-							}
-						}
+						writeOutputFile(log, realFS, options.AbsMetadataFile, metadata, 0644)
 					}
 				}
 			}
@@ -1519,6 +2484,52 @@ func analyseImpl(analyseOpts AnalyseOptions) AnalyseResult {
 	}
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// AMD Config API
+
+func validateAMDConfigImpl(amdConfigOpts AMDConfigOptions) AMDConfigResult {
+	log := logger.NewStderrLog(logger.OutputOptions{
+		IncludeSource: true,
+		MessageLimit:  amdConfigOpts.ErrorLimit,
+		Color:         validateColor(amdConfigOpts.Color),
+		LogLevel:      validateLogLevel(amdConfigOpts.LogLevel),
+	})
+
+	// Validate that the current working directory is an absolute path
+	realFS, err := fs.RealFS(fs.RealFSOptions{
+		AbsWorkingDir: amdConfigOpts.AbsWorkingDir,
+	})
+	if err != nil {
+		log.AddError(nil, logger.Loc{}, err.Error())
+		return AMDConfigResult{Errors: convertMessagesToPublic(logger.Error, log.Done())}
+	}
+
+	if amdConfigOpts.AMDConfig == "" {
+		log.AddError(nil, logger.Loc{}, "Must use \"amdconfig\" to validate the AMD config")
+	} else if file := validatePath(log, realFS, amdConfigOpts.AMDConfig, "amdconfig path"); file != "" {
+		validateAMDConfig(log, realFS, file)
+	}
+
+	msgs := log.Done()
+	return AMDConfigResult{
+		Errors:   convertMessagesToPublic(logger.Error, msgs),
+		Warnings: convertMessagesToPublic(logger.Warning, msgs),
+	}
+}
+
+func validateAMDConfig(log logger.Log, fs fs.FS, file string) {
+	caches := cache.MakeCacheSet()
+	var amd config.AMDOptions
+	amd.Init(fs.Cwd())
+	parseAMDConfig(log, fs, &caches.JSONCache, file, &amd)
+
+	// Problems with reading the file have been reported above already
+	if source, json, ok := readAMDConfig(logger.NewDeferLog(), fs, &caches.JSONCache, file); ok {
+		checkAMDConfigPaths(log, fs, source, json, &amd)
+		checkAMDConfigPackages(log, fs, source, json, &amd)
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Plugin API
 
@@ -1526,6 +2537,44 @@ type pluginImpl struct {
 	log    logger.Log
 	fs     fs.FS
 	plugin config.Plugin
+	stats  *pluginStats  // Only when "CollectMetrics: true"
+	tracer *trace.Tracer // Only when "Trace" is set
+
+	entryPoints []string
+}
+
+// The callbacks are called from multiple goroutines, so the counters are
+// updated atomically
+type pluginStats struct {
+	name           string
+	resolveMatches int32
+	resolveHandled int32
+	loadMatches    int32
+	loadHandled    int32
+}
+
+func (stats *pluginStats) reset() {
+	atomic.StoreInt32(&stats.resolveMatches, 0)
+	atomic.StoreInt32(&stats.resolveHandled, 0)
+	atomic.StoreInt32(&stats.loadMatches, 0)
+	atomic.StoreInt32(&stats.loadHandled, 0)
+}
+
+func (stats *pluginStats) metrics() PluginMetrics {
+	return PluginMetrics{
+		Name:           stats.name,
+		ResolveMatches: int(atomic.LoadInt32(&stats.resolveMatches)),
+		ResolveHandled: int(atomic.LoadInt32(&stats.resolveHandled)),
+		LoadMatches:    int(atomic.LoadInt32(&stats.loadMatches)),
+		LoadHandled:    int(atomic.LoadInt32(&stats.loadHandled)),
+	}
+}
+
+func (impl *pluginImpl) OnStart(callback func()) {
+	impl.plugin.OnStart = append(impl.plugin.OnStart, config.OnStart{
+		Name:     impl.plugin.Name,
+		Callback: callback,
+	})
 }
 
 func (impl *pluginImpl) OnResolve(options OnResolveOptions, callback func(OnResolveArgs) (OnResolveResult, error)) {
@@ -1540,14 +2589,24 @@ func (impl *pluginImpl) OnResolve(options OnResolveOptions, callback func(OnReso
 		Filter:    filter,
 		Namespace: options.Namespace,
 		Callback: func(args config.OnResolveArgs) (result config.OnResolveResult) {
+			if impl.tracer != nil {
+				defer impl.tracer.Begin("plugin", "onResolve", map[string]string{"plugin": impl.plugin.Name, "path": args.Path})()
+			}
 			response, err := callback(OnResolveArgs{
 				Path:       args.Path,
 				Importer:   args.Importer.Text,
 				Namespace:  args.Importer.Namespace,
 				ResolveDir: args.ResolveDir,
 				PluginData: args.PluginData,
+				With:       args.With,
 			})
 			result.PluginName = response.PluginName
+			if impl.stats != nil {
+				atomic.AddInt32(&impl.stats.resolveMatches, 1)
+				if err == nil && (response.Path != "" || response.External) {
+					atomic.AddInt32(&impl.stats.resolveHandled, 1)
+				}
+			}
 
 			if err != nil {
 				result.ThrownError = err
@@ -1556,7 +2615,12 @@ func (impl *pluginImpl) OnResolve(options OnResolveOptions, callback func(OnReso
 
 			result.Path = logger.Path{Text: response.Path, Namespace: response.Namespace}
 			result.External = response.External
+			result.Loader = validateLoader(response.Loader)
 			result.PluginData = response.PluginData
+			result.AbsWatchFiles = validateWatchPaths(impl.log, impl.fs, response.WatchFiles,
+				fmt.Sprintf("watch file path for plugin %q", impl.plugin.Name))
+			result.AbsWatchDirs = validateWatchPaths(impl.log, impl.fs, response.WatchDirs,
+				fmt.Sprintf("watch directory path for plugin %q", impl.plugin.Name))
 
 			// Convert log messages
 			if len(response.Errors)+len(response.Warnings) > 0 {
@@ -1582,12 +2646,21 @@ func (impl *pluginImpl) OnLoad(options OnLoadOptions, callback func(OnLoadArgs)
 		Filter:    filter,
 		Namespace: options.Namespace,
 		Callback: func(args config.OnLoadArgs) (result config.OnLoadResult) {
+			if impl.tracer != nil {
+				defer impl.tracer.Begin("plugin", "onLoad", map[string]string{"plugin": impl.plugin.Name, "path": args.Path.Text})()
+			}
 			response, err := callback(OnLoadArgs{
 				Path:       args.Path.Text,
 				Namespace:  args.Path.Namespace,
 				PluginData: args.PluginData,
 			})
 			result.PluginName = response.PluginName
+			if impl.stats != nil {
+				atomic.AddInt32(&impl.stats.loadMatches, 1)
+				if err == nil && response.Contents != nil {
+					atomic.AddInt32(&impl.stats.loadHandled, 1)
+				}
+			}
 
 			if err != nil {
 				result.ThrownError = err
@@ -1615,7 +2688,45 @@ func (impl *pluginImpl) OnLoad(options OnLoadOptions, callback func(OnLoadArgs)
 	})
 }
 
-func loadPlugins(fs fs.FS, log logger.Log, plugins []Plugin) (results []config.Plugin) {
+// The result passed to "OnEnd" callbacks only has the errors, warnings, and
+// output files. The rest of the build result isn't available yet.
+func (impl *pluginImpl) OnEnd(callback func(result BuildResult)) {
+	impl.plugin.OnEnd = append(impl.plugin.OnEnd, config.OnEnd{
+		Name: impl.plugin.Name,
+		Callback: func(args config.OnEndArgs) {
+			outputFiles := make([]OutputFile, len(args.OutputFiles))
+			for i, file := range args.OutputFiles {
+				outputFiles[i] = OutputFile{Path: file.AbsPath, Contents: file.Contents}
+			}
+			callback(BuildResult{
+				Errors:      convertMessagesToPublic(logger.Error, args.Msgs),
+				Warnings:    convertMessagesToPublic(logger.Warning, args.Msgs),
+				OutputFiles: outputFiles,
+			})
+		},
+	})
+}
+
+func (impl *pluginImpl) AddEntryPoint(path string) {
+	impl.entryPoints = append(impl.entryPoints, path)
+}
+
+func validateWatchPaths(log logger.Log, fs fs.FS, relPaths []string, pathKind string) (absPaths []string) {
+	for _, relPath := range relPaths {
+		if absPath := validatePath(log, fs, relPath, pathKind); absPath != "" {
+			absPaths = append(absPaths, absPath)
+		}
+	}
+	return
+}
+
+func loadPlugins(
+	fs fs.FS,
+	log logger.Log,
+	plugins []Plugin,
+	collectMetrics bool,
+	tracer *trace.Tracer,
+) (results []config.Plugin, stats []*pluginStats, entryPoints []string) {
 	for i, item := range plugins {
 		if item.Name == "" {
 			log.AddError(nil, logger.Loc{}, fmt.Sprintf("Plugin at index %d is missing a name", i))
@@ -1626,10 +2737,16 @@ func loadPlugins(fs fs.FS, log logger.Log, plugins []Plugin) (results []config.P
 			fs:     fs,
 			log:    log,
 			plugin: config.Plugin{Name: item.Name},
+			tracer: tracer,
+		}
+		if collectMetrics {
+			impl.stats = &pluginStats{name: item.Name}
+			stats = append(stats, impl.stats)
 		}
 
 		item.Setup(impl)
 		results = append(results, impl.plugin)
+		entryPoints = append(entryPoints, impl.entryPoints...)
 	}
 	return
 }
@@ -1645,16 +2762,41 @@ type apiHandler struct {
 	onRequest        func(ServeOnRequestArgs)
 	rebuild          func() BuildResult
 	currentBuild     *runningBuild
+	lastGoodResult   *BuildResult
 	fs               fs.FS
 }
 
 type runningBuild struct {
 	waitGroup sync.WaitGroup
 	result    BuildResult
+	isDone    bool
+}
+
+// The first build will just build normally. Later builds are incremental and
+// reuse the parsed files that haven't changed.
+func newAPIHandler(serveOptions ServeOptions, buildOptions BuildOptions, outdirPathPrefix string, realFS fs.FS) *apiHandler {
+	var handler *apiHandler
+	handler = &apiHandler{
+		onRequest:        serveOptions.OnRequest,
+		outdirPathPrefix: outdirPathPrefix,
+		servedir:         serveOptions.Servedir,
+		rebuild: func() BuildResult {
+			build := buildImpl(buildOptions)
+			if handler.options == nil {
+				handler.options = &build.options
+			}
+			return build.result
+		},
+		fs: realFS,
+	}
+	return handler
 }
 
+// The request that starts a build waits for it to finish. Other requests
+// don't wait for the build in progress if there's a result of a previous
+// successful build to serve instead.
 func (h *apiHandler) build() BuildResult {
-	build := func() *runningBuild {
+	build, lastGoodResult := func() (*runningBuild, *BuildResult) {
 		h.mutex.Lock()
 		defer h.mutex.Unlock()
 		if h.currentBuild == nil {
@@ -1667,6 +2809,12 @@ func (h *apiHandler) build() BuildResult {
 				result := h.rebuild()
 				h.rebuild = result.Rebuild
 				build.result = result
+				h.mutex.Lock()
+				build.isDone = true
+				if len(result.Errors) == 0 {
+					h.lastGoodResult = &build.result
+				}
+				h.mutex.Unlock()
 				build.waitGroup.Done()
 
 				// Build results stay valid for a little bit afterward since a page
@@ -1677,9 +2825,16 @@ func (h *apiHandler) build() BuildResult {
 				defer h.mutex.Unlock()
 				h.currentBuild = nil
 			}()
+			return build, nil
 		}
-		return h.currentBuild
+		if !h.currentBuild.isDone {
+			return h.currentBuild, h.lastGoodResult
+		}
+		return h.currentBuild, nil
 	}()
+	if lastGoodResult != nil {
+		return *lastGoodResult
+	}
 	build.waitGroup.Wait()
 	return build.result
 }
@@ -2127,21 +3282,7 @@ func serveImpl(serveOptions ServeOptions, buildOptions BuildOptions) (ServeResul
 		}
 	}
 
-	// The first build will just build normally
-	var handler *apiHandler
-	handler = &apiHandler{
-		onRequest:        serveOptions.OnRequest,
-		outdirPathPrefix: outdirPathPrefix,
-		servedir:         serveOptions.Servedir,
-		rebuild: func() BuildResult {
-			build := buildImpl(buildOptions)
-			if handler.options == nil {
-				handler.options = &build.options
-			}
-			return build.result
-		},
-		fs: realFS,
-	}
+	handler := newAPIHandler(serveOptions, buildOptions, outdirPathPrefix, realFS)
 
 	// Start the server
 	server := &http.Server{Addr: addr, Handler: handler}
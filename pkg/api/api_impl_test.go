@@ -0,0 +1,2292 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanw/esbuild/internal/cache"
+	"github.com/evanw/esbuild/internal/config"
+	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/js_ast"
+	"github.com/evanw/esbuild/internal/logger"
+	"github.com/evanw/esbuild/internal/sourcemap"
+)
+
+func assertLog(t *testing.T, msgs []logger.Msg, expected string) {
+	t.Helper()
+	text := ""
+	for _, msg := range msgs {
+		text += msg.String(logger.OutputOptions{}, logger.TerminalInfo{})
+	}
+	if text != expected {
+		t.Fatalf("\n%s\n!=\n%s", text, expected)
+	}
+}
+
+// This writes the files to a new temporary directory, which is removed when
+// the test ends, and returns the path of the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		file := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func expectAMDConfigLog(t *testing.T, files map[string]string, file string, expected string) {
+	t.Helper()
+	log := logger.NewDeferLog()
+	validateAMDConfig(log, fs.MockFS(files), file)
+	assertLog(t, log.Done(), expected)
+}
+
+func TestValidateAMDConfigValid(t *testing.T) {
+	expectAMDConfigLog(t, map[string]string{
+		"/amdconfig.json": `{
+			"baseUrl": "/src",
+			"paths": {
+				"lib": "vendor/lib",
+				"jquery": "vendor/jquery",
+				"external": "empty:"
+			}
+		}`,
+		"/src/vendor/lib/foo.js": ``,
+		"/src/vendor/jquery.js":  ``,
+	}, "/amdconfig.json", "")
+}
+
+func TestValidateAMDConfigMultipleProblems(t *testing.T) {
+	expectAMDConfigLog(t, map[string]string{
+		"/amdconfig.json": `{
+			"baseUrl": "/src",
+			"paths": {
+				"lib": "vendor/lib",
+				"missing": "vendor/missing"
+			},
+			"map": {
+				"*": { "foo": 1 }
+			},
+			"namespace": false,
+			"plugins": {
+				"text": []
+			}
+		}`,
+		"/src/vendor/lib/foo.js": ``,
+	}, "/amdconfig.json", `/amdconfig.json: error: the key "missing" in "paths" points to "src/vendor/missing", which does not exist
+/amdconfig.json: error: the key "foo" in "map" below "*" does not point to a string
+/amdconfig.json: error: "namespace" does not point to a string
+/amdconfig.json: error: the key "text" in "plugins" does not point to an object
+`)
+}
+
+func TestValidateAMDConfigPackages(t *testing.T) {
+	expectAMDConfigLog(t, map[string]string{
+		"/amdconfig.json": `{
+			"baseUrl": "/src",
+			"packages": [
+				"foo",
+				{ "name": "bar", "location": "vendor/bar", "main": "index.js" },
+				{ "name": "baz", "location": "vendor/baz" },
+				{ "name": "qux", "location": "vendor/qux", "main": "lib/qux" }
+			]
+		}`,
+		"/src/foo/main.js":         ``,
+		"/src/vendor/bar/index.js": ``,
+		"/src/vendor/qux/main.js":  ``,
+	}, "/amdconfig.json", `/amdconfig.json: error: the package "baz" in "packages" points to "src/vendor/baz", which does not exist
+/amdconfig.json: error: the main module of the package "qux" in "packages" points to "src/vendor/qux/lib/qux.js", which does not exist
+`)
+}
+
+func TestParseAMDConfigMultipleErrors(t *testing.T) {
+	files := map[string]string{
+		"/amdconfig.json": `{
+			"baseUrl": 1,
+			"paths": {
+				"lib": "vendor/lib"
+			},
+			"map": [],
+			"plugins": {
+				"text": {
+					"appendFileExtension": "yes"
+				}
+			}
+		}`,
+	}
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	var amd config.AMDOptions
+	amd.Init("/")
+	if parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/amdconfig.json", &amd) {
+		t.Fatal("Expected the AMD config to be invalid")
+	}
+	if amd.Parse {
+		t.Fatal("Expected an invalid AMD config not to be enabled")
+	}
+	assertLog(t, log.Done(), `/amdconfig.json: error: "baseUrl" does not point to a string
+/amdconfig.json: error: "map" does not point to an object
+/amdconfig.json: error: the key "appendFileExtension" in "text" below "plugins" does not point to a boolean
+`)
+}
+
+func TestParseAMDConfigDepsAndCallback(t *testing.T) {
+	files := map[string]string{
+		"/valid.json":   `{ "deps": ["app", "main"], "callback": "function (app) { app.start() }" }`,
+		"/module.json":  `{ "deps": ["app"], "callback": "functions/init" }`,
+		"/invalid.json": `{ "deps": ["app", 1], "callback": [] }`,
+	}
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	var amd config.AMDOptions
+	amd.Init("/")
+	if !parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/valid.json", &amd) {
+		t.Fatal("Expected the AMD config to be valid")
+	}
+	if len(amd.Deps) != 2 || amd.Deps[0] != "app" || amd.Deps[1] != "main" || !amd.CallbackIsFunction {
+		t.Fatalf("Unexpected deps %v and callback %q", amd.Deps, amd.Callback)
+	}
+
+	// A module name starting with "function" is not the source of a function
+	amd.Init("/")
+	if !parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/module.json", &amd) {
+		t.Fatal("Expected the AMD config to be valid")
+	}
+	if amd.Callback != "functions/init" || amd.CallbackIsFunction {
+		t.Fatalf("Unexpected callback %q, which is a function: %v", amd.Callback, amd.CallbackIsFunction)
+	}
+	amd.Init("/")
+	parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/invalid.json", &amd)
+	assertLog(t, log.Done(), `/invalid.json: error: "deps" does not point to an array with strings only
+/invalid.json: error: "callback" does not point to a string
+`)
+}
+
+func TestParseAMDConfigUrlArgs(t *testing.T) {
+	expected := map[string]bool{
+		`v=1`:                                 false,
+		`v=function1`:                         false,
+		`v=1&a=>b`:                            false,
+		`function (id, url) { return "v=1" }`: true,
+		`(id, url) => "v=1" // cache busting`: true,
+		`function () {}, function () {}`:      false,
+	}
+	for urlArgs, isFunction := range expected {
+		contents, _ := json.Marshal(map[string]string{"urlArgs": urlArgs})
+		files := map[string]string{"/amdconfig.json": string(contents)}
+		log := logger.NewDeferLog()
+		caches := cache.MakeCacheSet()
+		var amd config.AMDOptions
+		amd.Init("/")
+		if !parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/amdconfig.json", &amd) {
+			t.Fatalf("Expected the AMD config with %q to be valid", urlArgs)
+		}
+		if amd.UrlArgs != urlArgs || amd.UrlArgsIsFunction != isFunction {
+			t.Fatalf("Unexpected urlArgs %q, which is a function: %v", amd.UrlArgs, amd.UrlArgsIsFunction)
+		}
+	}
+}
+
+func TestParseAMDConfigsMerge(t *testing.T) {
+	files := map[string]string{
+		"/base.json": `{
+			"baseUrl": "/src",
+			"paths": { "lib": "vendor/lib", "jquery": "vendor/jquery" },
+			"namespace": "app",
+			"plugins": { "tpl": { "fileExtensions": [".tpl"] } }
+		}`,
+		"/override.json": `{
+			"paths": { "jquery": "vendor/jquery-3" },
+			"namespace": "app",
+			"plugins": { "md": { "fileExtensions": [".md"] } }
+		}`,
+		"/conflict.json": `{ "namespace": "other" }`,
+	}
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	var amd config.AMDOptions
+	amd.Init("/")
+	if !parseAMDConfigs(log, fs.MockFS(files), &caches.JSONCache, []string{"/base.json", "/override.json"}, &amd) {
+		t.Fatal("Expected the AMD configs to be valid")
+	}
+	if len(amd.Paths) != 2 || amd.Paths["lib"] != "vendor/lib" || amd.Paths["jquery"] != "vendor/jquery-3" {
+		t.Fatalf("Unexpected paths: %v", amd.Paths)
+	}
+	if len(amd.Plugins) != 2 || amd.Plugins["tpl"] == nil || amd.Plugins["md"] == nil ||
+		!amd.KnownFileExtensions[".tpl"] || !amd.KnownFileExtensions[".md"] || amd.KnownFileExtensions[".json"] {
+		t.Fatalf("Unexpected plugins %v and extensions %v", amd.Plugins, amd.KnownFileExtensions)
+	}
+
+	parseAMDConfigs(log, fs.MockFS(files), &caches.JSONCache, []string{"/conflict.json"}, &amd)
+	assertLog(t, log.Done(), `/conflict.json: error: "namespace" "other" conflicts with "app" from another AMD config
+`)
+}
+
+func TestParseAMDConfigInvalidReplacementPattern(t *testing.T) {
+	files := map[string]string{
+		"/amdconfig.json": `{
+			"plugins": {
+				"tpl": {
+					"loadScript": { "replacementPattern": "([", "replacementValue": "$1" }
+				}
+			}
+		}`,
+	}
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	var amd config.AMDOptions
+	amd.Init("/")
+	if parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/amdconfig.json", &amd) {
+		t.Fatal("Expected the AMD config to be invalid")
+	}
+	assertLog(t, log.Done(), `/amdconfig.json: error: the key "loadScript.replacementPattern" in "tpl" below "plugins" is not a valid regular expression: error parsing regexp: missing closing ]: `+"`[`"+`
+`)
+}
+
+func TestParseAMDConfigShim(t *testing.T) {
+	files := map[string]string{
+		"/valid.json": `{
+			"shim": {
+				"backbone": { "deps": ["underscore", "jquery"], "exports": "Backbone" },
+				"jquery.ui": ["jquery"]
+			}
+		}`,
+		"/invalid.json": `{ "shim": { "a": { "deps": [1], "exports": [] }, "b": true } }`,
+	}
+	log := logger.NewDeferLog()
+	caches := cache.MakeCacheSet()
+	var amd config.AMDOptions
+	amd.Init("/")
+	if !parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/valid.json", &amd) {
+		t.Fatal("Expected the AMD config to be valid")
+	}
+	if shim := amd.Shim["backbone"]; len(shim.Deps) != 2 || shim.Deps[1] != "jquery" || shim.Exports != "Backbone" {
+		t.Fatalf("Unexpected shim of backbone: %v", shim)
+	}
+	if shim := amd.Shim["jquery.ui"]; len(shim.Deps) != 1 || shim.Deps[0] != "jquery" || shim.Exports != "" {
+		t.Fatalf("Unexpected shim of jquery.ui: %v", shim)
+	}
+	amd.Init("/")
+	parseAMDConfig(log, fs.MockFS(files), &caches.JSONCache, "/invalid.json", &amd)
+	assertLog(t, log.Done(), `/invalid.json: error: the dependencies of "a" below "shim" are not an array with strings only
+/invalid.json: error: the key "exports" in "a" below "shim" does not point to a string
+/invalid.json: error: the key "b" in "shim" does not point to an object or an array
+`)
+}
+
+func TestValidateExternalsWildcards(t *testing.T) {
+	log := logger.NewDeferLog()
+	result := validateExternals(log, fs.MockFS(map[string]string{}), []string{"foo*", "*bar", "a*b", "@scope/*", "x*y*z"})
+	assertLog(t, log.Done(), "error: External path \"x*y*z\" cannot have more than one \"*\" wildcard\n")
+	expected := []config.WildcardPattern{
+		{Prefix: "foo"},
+		{Suffix: "bar"},
+		{Prefix: "a", Suffix: "b"},
+		{Prefix: "@scope/"},
+	}
+	if len(result.Patterns) != len(expected) {
+		t.Fatalf("Unexpected patterns: %v", result.Patterns)
+	}
+	for i, pattern := range result.Patterns {
+		if pattern != expected[i] {
+			t.Fatalf("Unexpected patterns: %v", result.Patterns)
+		}
+	}
+	if len(result.NodeModules) != 0 || len(result.AbsPaths) != 0 {
+		t.Fatalf("Unexpected paths: %v %v", result.NodeModules, result.AbsPaths)
+	}
+}
+
+func TestBuildSortOutputFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"b.js":      "import {shared} from './shared'\nimport logo from './logo.png'\nexport let b = [shared, logo]\n",
+		"a.js":      "import {shared} from './shared'\nexport let a = shared\n",
+		"shared.js": "export let shared = 123\n",
+		"logo.png":  "PNG",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints:     []string{path.Join(dir, "b.js"), path.Join(dir, "a.js")},
+		Outdir:          path.Join(dir, "out"),
+		Bundle:          true,
+		Splitting:       true,
+		Format:          FormatESModule,
+		Sourcemap:       SourceMapExternal,
+		Loader:          map[string]Loader{".png": LoaderFile},
+		Metafile:        path.Join(dir, "out", "meta.json"),
+		SortOutputFiles: true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	var names []string
+	for _, file := range result.OutputFiles {
+		name := path.Base(file.Path)
+		if strings.HasPrefix(name, "chunk.") {
+			name = "chunk" + name[strings.IndexByte(name[len("chunk."):], '.')+len("chunk."):]
+		} else if strings.HasPrefix(name, "logo.") {
+			name = "logo.png"
+		}
+		names = append(names, name)
+	}
+	expected := "b.js, a.js, b.js.map, a.js.map, chunk.js, chunk.js.map, logo.png, meta.json"
+	if text := strings.Join(names, ", "); text != expected {
+		t.Fatalf("\n%s\n!=\n%s", text, expected)
+	}
+}
+
+func TestAnalyseCharset(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "export let π = 3.14\n",
+	})
+
+	for charset, expected := range map[Charset]string{
+		CharsetDefault: `"charset": "ascii"`,
+		CharsetASCII:   `"charset": "ascii"`,
+		CharsetUTF8:    `"charset": "utf8"`,
+	} {
+		result := Analyse(AnalyseOptions{
+			EntryPoints: []string{path.Join(dir, "entry.js")},
+			Bundle:      true,
+			Charset:     charset,
+			Pretty:      true,
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if !strings.Contains(string(result.Metadata), expected) {
+			t.Fatalf("Missing %s in:\n%s", expected, result.Metadata)
+		}
+	}
+}
+
+func TestBuildDeepOutputPaths(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "export let a = 1\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Outfile:     path.Join(dir, "out", "js", "deep", "entry.js"),
+		Metafile:    path.Join(dir, "out", "meta", "deep", "meta.json"),
+		Bundle:      true,
+		Write:       true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	for _, file := range []string{"out/js/deep/entry.js", "out/meta/deep/meta.json"} {
+		if _, err := os.Stat(path.Join(dir, file)); err != nil {
+			t.Fatalf("Missing output file: %s", err.Error())
+		}
+	}
+}
+
+func TestBuildMetrics(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {a} from './a'\nconsole.log(a)\n",
+		"a.js":     "export let a = 1\n",
+	})
+
+	options := BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Outfile:     path.Join(dir, "out.js"),
+		Bundle:      true,
+	}
+	result := Build(options)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Metrics != nil {
+		t.Fatal("Unexpected metrics without \"CollectMetrics\"")
+	}
+
+	options.CollectMetrics = true
+	result = Build(options)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Metrics == nil {
+		t.Fatal("Missing metrics")
+	}
+	if result.Metrics.FilesParsed != 2 {
+		t.Fatalf("Unexpected count of parsed files: %d", result.Metrics.FilesParsed)
+	}
+	if result.Metrics.ScanTime <= 0 || result.Metrics.CompileTime <= 0 {
+		t.Fatalf("Unexpected durations: %+v", *result.Metrics)
+	}
+}
+
+func TestBuildPluginMetrics(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {a} from './a'\nimport {b} from 'virtual:b'\nconsole.log(a, b)\n",
+		"a.js":     "export let a = 1\n",
+	})
+
+	options := BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Bundle:      true,
+		Plugins: []Plugin{{
+			Name: "virtual",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `^virtual:`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: args.Path, Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					contents := "export let b = 2"
+					return OnLoadResult{Contents: &contents}, nil
+				})
+			},
+		}, {
+			Name: "passive",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `\.js$`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{}, nil
+				})
+			},
+		}},
+	}
+	result := Build(options)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Metrics != nil {
+		t.Fatal("Unexpected metrics without \"CollectMetrics\"")
+	}
+
+	// The counts are collected again for each build
+	options.CollectMetrics = true
+	options.Incremental = true
+	result = Build(options)
+	for i := 0; i < 2; i++ {
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if result.Metrics == nil {
+			t.Fatal("Missing metrics")
+		}
+		expected := []PluginMetrics{
+			{Name: "virtual", ResolveMatches: 1, ResolveHandled: 1, LoadMatches: 1, LoadHandled: 1},
+			{Name: "passive", ResolveMatches: 1},
+		}
+		if fmt.Sprintf("%+v", result.Metrics.Plugins) != fmt.Sprintf("%+v", expected) {
+			t.Fatalf("Unexpected plugin metrics: %+v", result.Metrics.Plugins)
+		}
+		result = result.Rebuild()
+	}
+}
+
+func TestBuildPluginEntryPoint(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js":    "console.log('entry')\n",
+		"manifest.js": "export let files = ['entry.js']\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Bundle:      true,
+		Outdir:      path.Join(dir, "out"),
+		Plugins: []Plugin{{
+			Name: "worker",
+			Setup: func(build PluginBuild) {
+				build.AddEntryPoint("virtual:worker")
+				build.OnResolve(OnResolveOptions{Filter: `^virtual:`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: args.Path, Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					contents := "import {files} from './manifest'\nconsole.log(files)\n"
+					return OnLoadResult{Contents: &contents, ResolveDir: dir}, nil
+				})
+			},
+		}},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(result.OutputFiles) != 2 {
+		t.Fatalf("Expected 2 output files, got %d", len(result.OutputFiles))
+	}
+	if !strings.Contains(string(result.OutputFiles[1].Contents), "var files = [\"entry.js\"]") {
+		t.Fatalf("Unexpected worker output: %s", result.OutputFiles[1].Contents)
+	}
+}
+
+func TestBuildTrace(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {a} from './a'\nimport {b} from 'virtual:b'\nconsole.log(a, b)\n",
+		"a.js":     "export let a = 1\n",
+	})
+
+	tracePath := path.Join(dir, "trace.json")
+	result := Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Bundle:      true,
+		Outdir:      path.Join(dir, "out"),
+		Trace:       tracePath,
+		Plugins: []Plugin{{
+			Name: "virtual",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `^virtual:`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: args.Path, Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					contents := "export let b = 2"
+					return OnLoadResult{Contents: &contents}, nil
+				})
+			},
+		}},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	contents, err := ioutil.ReadFile(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []struct {
+			Name string            `json:"name"`
+			Ph   string            `json:"ph"`
+			Args map[string]string `json:"args"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(contents, &trace); err != nil {
+		t.Fatalf("Invalid trace JSON: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, event := range trace.TraceEvents {
+		if event.Ph != "X" {
+			t.Fatalf("Unexpected event phase: %q", event.Ph)
+		}
+		counts[event.Name]++
+	}
+	for _, name := range []string{"resolver", "scan", "compile", "link", "print", "onResolve", "onLoad"} {
+		if counts[name] == 0 {
+			t.Fatalf("Missing span %q in %s", name, contents)
+		}
+	}
+	if counts["parse"] != 3 {
+		t.Fatalf("Expected a parse span for each of the 3 files, got %d", counts["parse"])
+	}
+}
+
+func TestBuildIncrementalRebuild(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {value} from './dep'\nconsole.log(value)\n",
+		"dep.js":   "export let value = 1\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		Incremental:   true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Rebuild == nil {
+		t.Fatalf("Missing the rebuild function")
+	}
+	expectOutput := func(result BuildResult, expected string) {
+		t.Helper()
+		if len(result.OutputFiles) != 1 || !strings.Contains(string(result.OutputFiles[0].Contents), expected) {
+			t.Fatalf("Missing %q in output files: %v", expected, result.OutputFiles)
+		}
+	}
+	expectOutput(result, "var value = 1;")
+
+	// Only the changed file has to be parsed again
+	if err := ioutil.WriteFile(path.Join(dir, "dep.js"), []byte("export let value = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt := result.Rebuild()
+	if len(rebuilt.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", rebuilt.Errors)
+	}
+	expectOutput(rebuilt, "var value = 2;")
+	expectOutput(rebuilt, "console.log(value);")
+}
+
+func TestBuildIncrementalRebuildNewFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {value} from './dep'\nconsole.log(value)\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		Incremental:   true,
+		LogLevel:      LogLevelSilent,
+	})
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Text, "Could not resolve") {
+		t.Fatalf("Expected an unresolved import: %v", result.Errors)
+	}
+
+	// The directory was read by the first build, but the rebuild finds the file
+	if err := ioutil.WriteFile(path.Join(dir, "dep.js"), []byte("export let value = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt := result.Rebuild()
+	if len(rebuilt.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", rebuilt.Errors)
+	}
+	if len(rebuilt.OutputFiles) != 1 || !strings.Contains(string(rebuilt.OutputFiles[0].Contents), "var value = 1;") {
+		t.Fatalf("Missing the new file in output files: %v", rebuilt.OutputFiles)
+	}
+}
+
+func TestBuildMetadata(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "console.log(1)\n",
+	})
+
+	build := func(write bool) BuildResult {
+		t.Helper()
+		result := Build(BuildOptions{
+			EntryPoints:   []string{"entry.js"},
+			AbsWorkingDir: dir,
+			Outdir:        "out",
+			Metafile:      "out/meta.json",
+			Write:         write,
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if !strings.Contains(string(result.Metadata), `"entry.js"`) {
+			t.Fatalf("Unexpected metadata: %s", result.Metadata)
+		}
+		return result
+	}
+
+	// The metadata is returned without writing it to disk
+	build(false)
+	if _, err := os.Stat(path.Join(dir, "out", "meta.json")); !os.IsNotExist(err) {
+		t.Fatalf("Unexpected metafile: %v", err)
+	}
+
+	// The metadata is returned and written to disk too
+	result := build(true)
+	if contents, err := ioutil.ReadFile(path.Join(dir, "out", "meta.json")); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != string(result.Metadata) {
+		t.Fatalf("\n%s\n!=\n%s", contents, result.Metadata)
+	}
+
+	// The metafile is compact unless it should be indented
+	if strings.Contains(string(result.Metadata), "\n  ") {
+		t.Fatalf("Unexpected indentation: %s", result.Metadata)
+	}
+	result = Build(BuildOptions{
+		EntryPoints:    []string{"entry.js"},
+		AbsWorkingDir:  dir,
+		Outdir:         "out",
+		Metafile:       "out/meta.json",
+		MetafilePretty: true,
+	})
+	if !strings.Contains(string(result.Metadata), "{\n  \"inputs\": {\n    \"entry.js\": {") {
+		t.Fatalf("Missing indentation: %s", result.Metadata)
+	}
+
+	// There is no metadata without a metafile
+	result = Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Outdir:        "out",
+	})
+	if result.Metadata != nil {
+		t.Fatalf("Unexpected metadata: %s", result.Metadata)
+	}
+}
+
+func TestBuildProcessShim(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "if (process.platform === 'win32') console.log('windows')\nelse console.log('other')\nconsole.log(process.arch)\n",
+	})
+
+	build := func(shim *ProcessShim, define map[string]string) string {
+		t.Helper()
+		result := Build(BuildOptions{
+			EntryPoints:   []string{"entry.js"},
+			AbsWorkingDir: dir,
+			Bundle:        true,
+			Platform:      PlatformNode,
+			MinifySyntax:  true,
+			Define:        define,
+			ProcessShim:   shim,
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		return string(result.OutputFiles[0].Contents)
+	}
+
+	// The branch for the other platform is eliminated
+	if code := build(&ProcessShim{Platform: "linux", Arch: "arm64"}, nil); code != "// entry.js\nconsole.log(\"other\");\nconsole.log(\"arm64\");\n" {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+
+	// Nothing is replaced without the shim
+	if code := build(nil, nil); !strings.Contains(code, "process.platform") {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+
+	// An explicit define takes precedence and the host architecture is the default
+	define := map[string]string{"process.platform": "\"win32\""}
+	if code := build(&ProcessShim{}, define); strings.Contains(code, "process.") || !strings.Contains(code, "windows") {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+	if _, ok := define["process.arch"]; ok {
+		t.Fatal("The define map must not be modified")
+	}
+}
+
+func TestBuildGlobEntryPoints(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/a.ts":             "export let x = 1\n",
+		"src/b.js":             "export let x = 1\n",
+		"src/nested/c.ts":      "export let x = 1\n",
+		"src/nested/deep/d.ts": "export let x = 1\n",
+	})
+
+	expectOutputs := func(options BuildOptions, expected ...string) {
+		t.Helper()
+		options.Outdir = path.Join(dir, "out")
+		result := Build(options)
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		var outputs []string
+		for _, file := range result.OutputFiles {
+			rel := strings.TrimPrefix(file.Path, options.Outdir+"/")
+			outputs = append(outputs, rel)
+		}
+		if strings.Join(outputs, " ") != strings.Join(expected, " ") {
+			t.Fatalf("Unexpected outputs: %v", outputs)
+		}
+	}
+	expectOutputs(BuildOptions{
+		EntryPoints:   []string{"src/**/*.ts"},
+		AbsWorkingDir: dir,
+	}, "a.js", "nested/c.js", "nested/deep/d.js")
+	expectOutputs(BuildOptions{
+		EntryPoints: []string{"*.ts", "nested/*.ts"},
+		GlobRoot:    path.Join(dir, "src"),
+	}, "a.js", "nested/c.js")
+
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"src/*.tsx"},
+		AbsWorkingDir: dir,
+		Outdir:        path.Join(dir, "out"),
+	})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "No files match the entry point pattern: src/*.tsx" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestTransformInject(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"buffer-shim.js": "export let Buffer = { from: (value) => value }\n",
+	})
+
+	result := Transform("console.log(Buffer.from('text'))\n", TransformOptions{
+		Inject: []string{path.Join(dir, "buffer-shim.js")},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	expected := "var Buffer = {from: (value) => value};\nconsole.log(Buffer.from(\"text\"));\n"
+	if text := string(result.Code); text != expected {
+		t.Fatalf("\n%s\n!=\n%s", text, expected)
+	}
+
+	result = Transform("console.log(Buffer)\n", TransformOptions{
+		Inject: []string{path.Join(dir, "missing.js")},
+	})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Injected file not found: "+path.Join(dir, "missing.js") {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestTransformPlugins(t *testing.T) {
+	var loadedPath, loadedNamespace string
+	result := Transform("console.log(MACRO_ANSWER)\n", TransformOptions{
+		Sourcefile: "input.js",
+		Plugins: []Plugin{{
+			Name: "macros",
+			Setup: func(build PluginBuild) {
+				build.OnLoad(OnLoadOptions{Filter: `.*`}, func(args OnLoadArgs) (OnLoadResult, error) {
+					return OnLoadResult{}, fmt.Errorf("Unexpected load of %s", args.Path)
+				})
+				build.OnLoad(OnLoadOptions{Filter: `\.js$`, Namespace: "stdin"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					loadedPath, loadedNamespace = args.Path, args.Namespace
+					contents := strings.ReplaceAll(args.PluginData.(string), "MACRO_ANSWER", "42")
+					return OnLoadResult{Contents: &contents}, nil
+				})
+			},
+		}},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if loadedPath != "input.js" || loadedNamespace != "stdin" {
+		t.Fatalf("Unexpected path: %s:%s", loadedNamespace, loadedPath)
+	}
+	if text := string(result.Code); text != "console.log(42);\n" {
+		t.Fatalf("Unexpected output: %s", text)
+	}
+}
+
+func TestTransformStats(t *testing.T) {
+	input := "var add = (a, b) => a + b\n"
+	result := Transform(input, TransformOptions{Target: ES5, Stats: true})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	stats := result.Stats
+	if stats == nil {
+		t.Fatal("Missing stats")
+	}
+	if stats.InputBytes != len(input) || stats.OutputBytes != len(result.Code) {
+		t.Fatalf("Unexpected sizes: %d %d", stats.InputBytes, stats.OutputBytes)
+	}
+	if strings.Join(stats.Lowered, ",") != "arrow" {
+		t.Fatalf("Unexpected lowered features: %v", stats.Lowered)
+	}
+
+	result = Transform(input, TransformOptions{Stats: true})
+	if result.Stats == nil || len(result.Stats.Lowered) != 0 {
+		t.Fatalf("Unexpected stats: %v", result.Stats)
+	}
+	if result = Transform(input, TransformOptions{Target: ES5}); result.Stats != nil {
+		t.Fatalf("Unexpected stats: %v", result.Stats)
+	}
+}
+
+func TestTransformLogOverride(t *testing.T) {
+	input := "if (x === NaN) y({ a: 1, a: 2 })\n"
+	result := Transform(input, TransformOptions{})
+	if len(result.Errors) != 0 || len(result.Warnings) != 2 {
+		t.Fatalf("Unexpected messages: %v %v", result.Errors, result.Warnings)
+	}
+
+	result = Transform(input, TransformOptions{
+		LogOverride: map[string]LogLevel{
+			"equals-nan":           LogLevelError,
+			"duplicate-object-key": LogLevelSilent,
+		},
+	})
+	if len(result.Warnings) != 0 {
+		t.Fatalf("Unexpected warnings: %v", result.Warnings)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Comparison with NaN using the \"===\" operator here is always false" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	// Informational messages are neither errors nor warnings
+	result = Transform(input, TransformOptions{
+		LogOverride: map[string]LogLevel{
+			"equals-nan":           LogLevelInfo,
+			"duplicate-object-key": LogLevelInfo,
+		},
+	})
+	if len(result.Errors) != 0 || len(result.Warnings) != 0 {
+		t.Fatalf("Unexpected messages: %v %v", result.Errors, result.Warnings)
+	}
+}
+
+func TestTransformDefineIdentifiers(t *testing.T) {
+	// Substituted identifiers are not substituted again
+	result := Transform("f(a, b, c)\n", TransformOptions{
+		Define: map[string]string{"a": "b", "b": "c"},
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if code := string(result.Code); code != "f(b, c, c);\n" {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+
+	// A cycle is reported once
+	result = Transform("f(a, b, c)\n", TransformOptions{
+		Define: map[string]string{"a": "b", "b": "a", "c": "a"},
+	})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Cycle in define substitutions: a -> b -> a" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestTransformDefineObjects(t *testing.T) {
+	result := Transform("f(CONFIG, CONFIG.b)\n", TransformOptions{
+		Define: map[string]string{"CONFIG": `{"a": 1, "b": [2, "x\u00e9", null], "c": {"d": true}}`},
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	expected := "f({a: 1, b: [2, \"x\\xE9\", null], c: {d: true}}, {a: 1, b: [2, \"x\\xE9\", null], c: {d: true}}.b);\n"
+	if code := string(result.Code); code != expected {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+
+	// Every substitution gets its own copy of the value
+	defines := validateDefines(logger.NewDeferLog(), map[string]string{"CONFIG": `{"a": [1]}`}, nil)
+	define := defines.IdentifierDefines["CONFIG"].DefineFunc
+	first := define(config.DefineArgs{}).(*js_ast.EObject)
+	second := define(config.DefineArgs{}).(*js_ast.EObject)
+	if first == second || first.Properties[0].Value.Data == second.Properties[0].Value.Data {
+		t.Fatalf("The substituted values are shared")
+	}
+
+	// The "__proto__" key must not change the prototype of the object
+	result = Transform("f(CONFIG)\n", TransformOptions{
+		Define: map[string]string{"CONFIG": `{"__proto__": {"a": 1}}`},
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	expected = "f({[\"__proto__\"]: {a: 1}});\n"
+	if code := string(result.Code); code != expected {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+}
+
+// Returns the names of the mappings that point to that name in the sources
+func namesInSourceMap(t *testing.T, text string) map[string]bool {
+	t.Helper()
+	var sourceMap struct {
+		SourcesContent []string
+		Mappings       string
+		Names          []string
+	}
+	if err := json.Unmarshal([]byte(text), &sourceMap); err != nil {
+		t.Fatal(err)
+	}
+	used := make(map[string]bool)
+	var state [5]int
+	for _, line := range strings.Split(sourceMap.Mappings, ";") {
+		state[0] = 0
+		for _, segment := range strings.Split(line, ",") {
+			fields := 0
+			for i := 0; i < len(segment); fields++ {
+				value, next := sourcemap.DecodeVLQ([]byte(segment), i)
+				state[fields] += value
+				i = next
+			}
+			if fields < 5 {
+				continue
+			}
+			if state[4] < 0 || state[4] >= len(sourceMap.Names) {
+				t.Fatalf("Invalid name index %d in mappings: %s", state[4], sourceMap.Mappings)
+			}
+			name := sourceMap.Names[state[4]]
+			original := strings.Split(sourceMap.SourcesContent[state[1]], "\n")[state[2]][state[3]:]
+			if strings.HasPrefix(original, name) {
+				used[name] = true
+			}
+		}
+	}
+	return used
+}
+
+func TestTransformSourceMapNames(t *testing.T) {
+	result := Transform("export function sum(first, second) {\n  return first + second\n}\n", TransformOptions{
+		Format:            FormatCommonJS,
+		MinifyIdentifiers: true,
+		Sourcemap:         SourceMapExternal,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	used := namesInSourceMap(t, string(result.Map))
+	if !used["first"] || !used["second"] {
+		t.Fatalf("Missing the parameter names in the source map: %s", result.Map)
+	}
+}
+
+func TestBuildSourceMapNames(t *testing.T) {
+	files := map[string]string{
+		"entry.js": "import {twice} from './twice'\nfunction print(value) {\n  console.log(twice(value))\n}\nprint(1)\n",
+		"twice.js": "export function twice(number) {\n  let result = number * 2\n  return result\n}\n",
+	}
+	dir := writeFiles(t, files)
+
+	// The names of both files are in the source map joined from their chunks
+	result := Build(BuildOptions{
+		EntryPoints:       []string{"entry.js"},
+		AbsWorkingDir:     dir,
+		Outfile:           "out.js",
+		Bundle:            true,
+		MinifyIdentifiers: true,
+		Sourcemap:         SourceMapExternal,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	var sourceMap string
+	for _, file := range result.OutputFiles {
+		if strings.HasSuffix(file.Path, ".map") {
+			sourceMap = string(file.Contents)
+		}
+	}
+	used := namesInSourceMap(t, sourceMap)
+	for _, name := range []string{"print", "value", "twice", "number", "result"} {
+		if !used[name] {
+			t.Fatalf("Missing the name %q in the source map: %s", name, sourceMap)
+		}
+	}
+}
+
+func TestTransformPreserveJSX(t *testing.T) {
+	result := Transform("let x = <Foo bar={baz}>text</Foo>\n", TransformOptions{
+		Loader:  LoaderJSX,
+		JSXMode: JSXModePreserve,
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if code := string(result.Code); code != "let x = <Foo bar={baz}>text</Foo>;\n" {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+
+	result = Transform("<div/>\n", TransformOptions{
+		Loader:       LoaderJSX,
+		JSXMode:      JSXModePreserve,
+		MinifySyntax: true,
+	})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Cannot preserve JSX when minifying syntax" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestTransformInferredLoader(t *testing.T) {
+	result := Transform("let x: number = 1\n", TransformOptions{
+		Sourcefile: "src/file.ts",
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Loader != LoaderTS {
+		t.Fatalf("Unexpected loader: %v", result.Loader)
+	}
+	if code := string(result.Code); code != "let x = 1;\n" {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+
+	// An explicit loader takes precedence and JavaScript is the fallback
+	if result := Transform("", TransformOptions{Sourcefile: "src/file.ts", Loader: LoaderTSX}); result.Loader != LoaderTSX {
+		t.Fatalf("Unexpected loader: %v", result.Loader)
+	}
+	if result := Transform("", TransformOptions{Sourcefile: "src/file.vue"}); result.Loader != LoaderJS {
+		t.Fatalf("Unexpected loader: %v", result.Loader)
+	}
+	if result := Transform("", TransformOptions{}); result.Loader != LoaderJS {
+		t.Fatalf("Unexpected loader: %v", result.Loader)
+	}
+	if result := Transform("{a: 1}", TransformOptions{Sourcefile: "config.json5"}); result.Loader != LoaderJSON5 {
+		t.Fatalf("Unexpected loader: %v", result.Loader)
+	}
+}
+
+func TestTransformModule(t *testing.T) {
+	for input, isModule := range map[string]bool{
+		"console.log(1)\n":                    false,
+		"module.exports = 1\n":                false,
+		"export let x = 1\n":                  true,
+		"import x from 'x'\nconsole.log(x)\n": true,
+	} {
+		result := Transform(input, TransformOptions{})
+		if len(result.Errors) != 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if result.Module != isModule {
+			t.Fatalf("Unexpected module for %q: %v", input, result.Module)
+		}
+	}
+
+	// Type-only imports make a module too, even though they are removed
+	result := Transform("import {T} from 't'\nlet x: T\n", TransformOptions{Loader: LoaderTS})
+	if !result.Module || string(result.Code) != "let x;\n" {
+		t.Fatalf("Unexpected result: %v %q", result.Module, result.Code)
+	}
+}
+
+func TestTransformOperaAndSamsungTargets(t *testing.T) {
+	expectCode := func(engine Engine, expected string) {
+		t.Helper()
+		result := Transform("x = a ?? b\n", TransformOptions{Engines: []Engine{engine}})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if text := string(result.Code); text != expected {
+			t.Fatalf("\n%s\n!=\n%s", text, expected)
+		}
+	}
+
+	// The nullish coalescing operator is supported since Chromium 80
+	lowered := "x = a != null ? a : b;\n"
+	expectCode(Engine{Name: EngineOpera, Version: "66"}, lowered)
+	expectCode(Engine{Name: EngineOpera, Version: "67"}, "x = a ?? b;\n")
+	expectCode(Engine{Name: EngineSamsung, Version: "12"}, lowered)
+	expectCode(Engine{Name: EngineSamsung, Version: "13"}, "x = a ?? b;\n")
+}
+
+func TestTransformDenoAndHermesTargets(t *testing.T) {
+	expectCode := func(engine Engine, input string, expected string) {
+		t.Helper()
+		result := Transform(input, TransformOptions{Engines: []Engine{engine}})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if text := string(result.Code); text != expected {
+			t.Fatalf("\n%s\n!=\n%s", text, expected)
+		}
+	}
+
+	// Logical assignment is supported since Chromium 85 (Deno 1.2) and isn't
+	// known to be supported by Hermes
+	expectCode(Engine{Name: EngineDeno, Version: "1.0"}, "a ||= b\n", "a || (a = b);\n")
+	expectCode(Engine{Name: EngineDeno, Version: "1.2"}, "a ||= b\n", "a ||= b;\n")
+	expectCode(Engine{Name: EngineHermes, Version: "0.70"}, "a ||= b\n", "a || (a = b);\n")
+	expectCode(Engine{Name: EngineHermes, Version: "0.70"}, "x = a ?? b\n", "x = a ?? b;\n")
+	expectCode(Engine{Name: EngineHermes, Version: "0.6"}, "x = a ?? b\n", "x = a != null ? a : b;\n")
+}
+
+func TestFeaturesForTarget(t *testing.T) {
+	contains := func(names []string, name string) bool {
+		for _, item := range names {
+			if item == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	features, err := FeaturesForTarget(ES2017, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(features.UnsupportedJS, "object-rest-spread") || contains(features.UnsupportedJS, "async-await") {
+		t.Fatalf("Unexpected features: %v", features.UnsupportedJS)
+	}
+
+	features, err = FeaturesForTarget(ESNext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features.UnsupportedJS) != 0 || len(features.UnsupportedCSS) != 0 {
+		t.Fatalf("Unexpected features: %v %v", features.UnsupportedJS, features.UnsupportedCSS)
+	}
+
+	features, err = FeaturesForTarget(ESNext, []Engine{{Name: EngineChrome, Version: "60"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(features.UnsupportedJS, "optional-chain") || !contains(features.UnsupportedCSS, "hex-rgba") {
+		t.Fatalf("Unexpected features: %v %v", features.UnsupportedJS, features.UnsupportedCSS)
+	}
+
+	_, err = FeaturesForTarget(ESNext, []Engine{{Name: EngineChrome, Version: "latest"}})
+	if err == nil || err.Error() != `Invalid version: "latest"` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestAnalyseDeepMetafile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "export let a = 1\n",
+	})
+
+	result := Analyse(AnalyseOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Metafile:    path.Join(dir, "out", "deep", "meta.json"),
+		Bundle:      true,
+		Write:       true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if _, err := os.Stat(path.Join(dir, "out", "deep", "meta.json")); err != nil {
+		t.Fatalf("Missing metafile: %s", err.Error())
+	}
+
+	// A file in place of a directory cannot be replaced
+	if err := ioutil.WriteFile(path.Join(dir, "file"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = Analyse(AnalyseOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Metafile:    path.Join(dir, "file", "deep", "meta.json"),
+		Bundle:      true,
+		Write:       true,
+	})
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].Text, "Failed to create output directory: ") {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestNodePaths(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/shared/index.js": "export let shared = 1\n",
+		"entry.js":            "import {shared} from 'shared'\nconsole.log(shared)\n",
+	})
+
+	buildResult := Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Bundle:      true,
+		NodePaths:   []string{path.Join(dir, "lib")},
+	})
+	if len(buildResult.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", buildResult.Errors)
+	}
+	if !strings.Contains(string(buildResult.OutputFiles[0].Contents), "var shared = 1") {
+		t.Fatalf("Unexpected output: %s", buildResult.OutputFiles[0].Contents)
+	}
+
+	analyseResult := Analyse(AnalyseOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Bundle:      true,
+		NodePaths:   []string{path.Join(dir, "lib")},
+	})
+	if len(analyseResult.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", analyseResult.Errors)
+	}
+}
+
+// The metadata is compact by default and indented to be readable and to
+// produce clean diffs on request
+func TestAnalysePrettyMetadata(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import './dep'\n",
+		"dep.js":   "export let a = 1\n",
+	})
+
+	analyse := func(pretty bool) string {
+		t.Helper()
+		result := Analyse(AnalyseOptions{
+			EntryPoints:   []string{"entry.js"},
+			AbsWorkingDir: dir,
+			Bundle:        true,
+			Pretty:        pretty,
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		return string(result.Metadata)
+	}
+
+	expected := `{"inputs":{"entry.js":{"bytes":15,"imports":[{"path":"dep.js","kind":"import-statement","original":"./dep"}]},"dep.js":{"bytes":17,"imports":[]}},"charset":"ascii"}
+`
+	if text := analyse(false); text != expected {
+		t.Fatalf("\n%s\n!=\n%s", text, expected)
+	}
+
+	expected = `{
+  "inputs": {
+    "entry.js": {
+      "bytes": 15,
+      "imports": [
+        {
+          "path": "dep.js",
+          "kind": "import-statement",
+          "original": "./dep"
+        }
+      ]
+    },
+    "dep.js": {
+      "bytes": 17,
+      "imports": []
+    }
+  },
+  "charset": "ascii"
+}
+`
+	if text := analyse(true); text != expected {
+		t.Fatalf("\n%s\n!=\n%s", text, expected)
+	}
+}
+
+func TestAnalyseIncludeHashes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import \"./dep\"\n",
+		"dep.js":   "export let a = 1\n",
+	})
+
+	options := AnalyseOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		IncludeHashes: true,
+		Pretty:        true,
+	}
+	result := Analyse(options)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	for _, expected := range []string{
+		`"hash": "730cb6b5097ca9c7325825fc8c6ac412128e33fc",`,
+		`"hash": "ccf064509b735856acdf7238bd6141bbc4f2cffe",`,
+	} {
+		if !strings.Contains(string(result.Metadata), expected) {
+			t.Fatalf("Missing %s in:\n%s", expected, result.Metadata)
+		}
+	}
+
+	// The hashes depend only on the contents of the input files
+	if again := Analyse(options); string(again.Metadata) != string(result.Metadata) {
+		t.Fatalf("\n%s\n!=\n%s", again.Metadata, result.Metadata)
+	}
+}
+
+func TestAnalyseIncludeDefineStats(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import \"./dep\"\nif (DEBUG) console.log(process.env.MODE)\n",
+		"dep.js":   "export let a = DEBUG\n",
+	})
+
+	result := Analyse(AnalyseOptions{
+		EntryPoints:        []string{"entry.js"},
+		AbsWorkingDir:      dir,
+		Bundle:             true,
+		IncludeDefineStats: true,
+		Pretty:             true,
+		Define: map[string]string{
+			"DEBUG":            "false",
+			"process.env.MODE": "\"production\"",
+			"DEBUGG":           "true",
+		},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	expected := "  \"defines\": {\n    \"DEBUG\": 2,\n    \"DEBUGG\": 0,\n    \"process.env.MODE\": 1\n  },\n"
+	if !strings.Contains(string(result.Metadata), expected) {
+		t.Fatalf("Missing %s in:\n%s", expected, result.Metadata)
+	}
+}
+
+func TestBuildAllowOverwrite(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "console.log(123)\n",
+	})
+	entry := path.Join(dir, "entry.js")
+
+	// The output directory is the same as the source directory
+	result := Build(BuildOptions{
+		EntryPoints: []string{entry},
+		Outdir:      dir,
+	})
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].Text, "Refusing to overwrite input file") {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	result = Build(BuildOptions{
+		EntryPoints:    []string{entry},
+		Outdir:         dir,
+		AllowOverwrite: true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(result.OutputFiles) != 1 || result.OutputFiles[0].Path != entry {
+		t.Fatalf("Unexpected output files: %v", result.OutputFiles)
+	}
+}
+
+func TestBuildLegalCommentsExternal(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "/*! Copyright notice */\nconsole.log(123)\n",
+	})
+	entry := path.Join(dir, "entry.js")
+
+	// The legal comments are written next to the output file
+	result := Build(BuildOptions{
+		EntryPoints:   []string{entry},
+		Outdir:        path.Join(dir, "out"),
+		LegalComments: LegalCommentsExternal,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	contents := make(map[string]string)
+	for _, file := range result.OutputFiles {
+		contents[file.Path] = string(file.Contents)
+	}
+	if js := contents[path.Join(dir, "out", "entry.js")]; js != "console.log(123);\n" {
+		t.Fatalf("Unexpected output file: %s", js)
+	}
+	if legal := contents[path.Join(dir, "out", "entry.js.LEGAL.txt")]; legal != "/*! Copyright notice */\n" {
+		t.Fatalf("Unexpected legal comments: %s", legal)
+	}
+
+	// There is no output file to write the legal comments next to
+	transform := Transform("/*! Copyright notice */\n", TransformOptions{LegalComments: LegalCommentsExternal})
+	if len(transform.Errors) != 1 || transform.Errors[0].Text != "Cannot transform with linked or external legal comments" {
+		t.Fatalf("Unexpected errors: %v", transform.Errors)
+	}
+}
+
+func TestBuildAmbiguousExtension(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import './util'\n",
+		"util.js":  "console.log('js')\n",
+		"util.ts":  "console.log('ts')\n",
+	})
+
+	// The message is only reported if it's enabled
+	options := BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		LogLevel:      LogLevelSilent,
+	}
+	if result := Build(options); len(result.Errors) > 0 || len(result.Warnings) > 0 {
+		t.Fatalf("Unexpected messages: %v %v", result.Errors, result.Warnings)
+	}
+	options.LogOverride = map[string]LogLevel{"ambiguous-extension": LogLevelWarning}
+	if result := Build(options); len(result.Errors) > 0 || len(result.Warnings) != 1 ||
+		result.Warnings[0].Text != `The path "util" matches multiple files ("util.ts", "util.js"), using "util.ts"` {
+		t.Fatalf("Unexpected messages: %v %v", result.Errors, result.Warnings)
+	}
+}
+
+func TestServeRebuildReusesParsedFiles(t *testing.T) {
+	files := map[string]string{
+		"entry.js": "import {value} from './dep'\nconsole.log(value)\n",
+		"dep.js":   "export let value = 1\n",
+	}
+	dir := writeFiles(t, files)
+
+	realFS, err := fs.RealFS(fs.RealFSOptions{AbsWorkingDir: dir, DoNotCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newAPIHandler(ServeOptions{}, BuildOptions{
+		EntryPoints:    []string{"entry.js"},
+		AbsWorkingDir:  dir,
+		Outdir:         path.Join(dir, "out"),
+		Bundle:         true,
+		Incremental:    true,
+		CollectMetrics: true,
+	}, "", realFS)
+
+	result := handler.build()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Metrics.FilesReparsed == 0 {
+		t.Fatalf("The first build parsed no files")
+	}
+
+	// Wait until the result of the first build expires, so that the next
+	// request starts a new build, which reuses all parsed files
+	time.Sleep(300 * time.Millisecond)
+	result = handler.build()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result.Metrics.FilesParsed != 2 || result.Metrics.FilesReparsed != 0 {
+		t.Fatalf("Unexpected parsed files: %+v", *result.Metrics)
+	}
+}
+
+func TestMissingTsconfig(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "console.log(1)\n",
+	})
+
+	expected := "Cannot find tsconfig path: tsconfig.missing.json"
+	buildResult := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Tsconfig:      "tsconfig.missing.json",
+	})
+	if len(buildResult.Errors) != 1 || buildResult.Errors[0].Text != expected {
+		t.Fatalf("Unexpected errors: %v", buildResult.Errors)
+	}
+	analyseResult := Analyse(AnalyseOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Tsconfig:      "tsconfig.missing.json",
+	})
+	if len(analyseResult.Errors) != 1 || analyseResult.Errors[0].Text != expected {
+		t.Fatalf("Unexpected errors: %v", analyseResult.Errors)
+	}
+}
+
+func TestBuildUnusedExternals(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import 'react/jsx-runtime'\nimport './vendor.js'\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		Platform:      PlatformNode,
+		External:      []string{"react", "lodahs", "./vendor.js", "./legacy.js"},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	expected := []string{
+		`The external "legacy.js" is not imported by any file`,
+		`The external "lodahs" is not imported by any file`,
+	}
+	if len(result.Warnings) != len(expected) {
+		t.Fatalf("Unexpected warnings: %v", result.Warnings)
+	}
+	for i, warning := range result.Warnings {
+		if warning.Text != expected[i] {
+			t.Fatalf("Unexpected warnings: %v", result.Warnings)
+		}
+	}
+}
+
+func TestBuildMissingInject(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "console.log(Buffer)\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		Inject:        []string{"buffer-shim.js"},
+	})
+	expected := "Injected file not found: buffer-shim.js"
+	if len(result.Errors) != 1 || result.Errors[0].Text != expected {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestBuildStdinMissingResolveDir(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"dep.js": "export let value = 1\n",
+	})
+
+	stdin := StdinOptions{Contents: "import {value} from './dep'\nconsole.log(value)\n", ResolveDir: "src"}
+	result := Build(BuildOptions{
+		Stdin:         &stdin,
+		AbsWorkingDir: dir,
+		Bundle:        true,
+	})
+	expected := "stdin resolve directory does not exist: src"
+	if len(result.Errors) != 1 || result.Errors[0].Text != expected {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	stdin.ResolveDir = "."
+	result = Build(BuildOptions{
+		Stdin:         &stdin,
+		AbsWorkingDir: dir,
+		Bundle:        true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestBuildHashbang(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"cli.js":  "#!/usr/bin/env node\nimport {code} from './code'\nprocess.exit(code)\n",
+		"code.js": "#!/usr/bin/env other\nexport let code = 0\n",
+	})
+
+	outfile := path.Join(dir, "out", "cli.js")
+	result := Build(BuildOptions{
+		EntryPoints:       []string{path.Join(dir, "cli.js")},
+		Outfile:           outfile,
+		Bundle:            true,
+		Platform:          PlatformNode,
+		MinifyWhitespace:  true,
+		MinifyIdentifiers: true,
+		MinifySyntax:      true,
+		Write:             true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	contents, err := ioutil.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(contents), "\n")
+	if lines[0] != "#!/usr/bin/env node" {
+		t.Fatalf("Unexpected first line: %q", lines[0])
+	}
+	if strings.Contains(lines[1], "#!") {
+		t.Fatalf("Unexpected hashbang of an imported file: %q", lines[1])
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(outfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Fatalf("Expected an executable file, got mode %v", info.Mode())
+		}
+	}
+}
+
+func TestBuildOutputMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("File modes are not supported on Windows")
+	}
+	dir := writeFiles(t, map[string]string{
+		"launcher.js": "console.log('launch')\n",
+		"cli.js":      "#!/usr/bin/env node\nconsole.log('cli')\n",
+	})
+
+	build := func(entryPoint string, mode uint32) os.FileMode {
+		t.Helper()
+		outfile := path.Join(dir, "out", entryPoint)
+		result := Build(BuildOptions{
+			EntryPoints: []string{path.Join(dir, entryPoint)},
+			Outfile:     outfile,
+			Sourcemap:   SourceMapExternal,
+			OutputMode:  mode,
+			Write:       true,
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if info, err := os.Stat(outfile + ".map"); err != nil || info.Mode().Perm()&0111 != 0 {
+			t.Fatalf("Unexpected source map mode: %v", info.Mode())
+		}
+		info, err := os.Stat(outfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+
+	// Force an output executable without a hashbang
+	if mode := build("launcher.js", 0755); mode != 0755 {
+		t.Fatalf("Expected mode 0755, got %o", mode)
+	}
+
+	// Overwrite an executable output with a hashbang as not executable
+	if mode := build("cli.js", 0); mode&0100 == 0 {
+		t.Fatalf("Expected an executable mode, got %o", mode)
+	}
+	if mode := build("cli.js", 0644); mode != 0644 {
+		t.Fatalf("Expected mode 0644, got %o", mode)
+	}
+
+	result := Build(BuildOptions{EntryPoints: []string{path.Join(dir, "cli.js")}, OutputMode: 01755})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Invalid output mode: 1755" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestPluginResolveLoader(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js":    "import data from './data.custom'\nconsole.log(data.answer)\n",
+		"data.custom": "{\"answer\": 42}\n",
+	})
+
+	result := Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "entry.js")},
+		Bundle:      true,
+		Plugins: []Plugin{{
+			Name: "custom",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `\.custom$`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: path.Join(args.ResolveDir, args.Path), Loader: LoaderJSON}, nil
+				})
+			},
+		}},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(result.OutputFiles) != 1 || !strings.Contains(string(result.OutputFiles[0].Contents), "var answer = 42;") {
+		t.Fatalf("Unexpected output files: %v", result.OutputFiles)
+	}
+}
+
+func TestPluginEntryPointOutputPathCollision(t *testing.T) {
+	dir := t.TempDir()
+
+	// Modules outside of the "file" namespace are written to the output
+	// directory using just their base name
+	result := Build(BuildOptions{
+		EntryPoints: []string{"a/index.ts", "b/index.ts"},
+		Outdir:      dir,
+		Plugins: []Plugin{{
+			Name: "virtual",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `index\.ts$`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: args.Path, Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					contents := fmt.Sprintf("console.log(%q)\n", args.Path)
+					return OnLoadResult{Contents: &contents, Loader: LoaderTS}, nil
+				})
+			},
+		}},
+	})
+	expected := "The entry points virtual:a/index.ts and virtual:b/index.ts would both be written to index.js"
+	if len(result.Errors) != 1 || result.Errors[0].Text != expected {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(result.OutputFiles) != 0 {
+		t.Fatalf("Unexpected output files: %v", result.OutputFiles)
+	}
+}
+
+func TestPluginOnStartAndOnEnd(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import './missing'\n",
+	})
+	entry := path.Join(dir, "entry.js")
+
+	var events []string
+	var ended BuildResult
+	result := Build(BuildOptions{
+		EntryPoints: []string{entry},
+		Outdir:      path.Join(dir, "out"),
+		Bundle:      true,
+		Plugins: []Plugin{{
+			Name: "lifecycle",
+			Setup: func(build PluginBuild) {
+				build.OnStart(func() {
+					events = append(events, "start")
+				})
+				build.OnResolve(OnResolveOptions{Filter: `missing$`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					events = append(events, "resolve")
+					return OnResolveResult{Path: "missing", Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					contents := "console.log('loaded')\n"
+					return OnLoadResult{Contents: &contents}, nil
+				})
+				build.OnEnd(func(result BuildResult) {
+					events = append(events, "end")
+					ended = result
+				})
+			},
+		}},
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if strings.Join(events, ",") != "start,resolve,end" {
+		t.Fatalf("Unexpected events: %v", events)
+	}
+	if len(ended.OutputFiles) != 1 || ended.OutputFiles[0].Path != path.Join(dir, "out", "entry.js") ||
+		!strings.Contains(string(ended.OutputFiles[0].Contents), "loaded") {
+		t.Fatalf("Unexpected output files: %v", ended.OutputFiles)
+	}
+
+	// The "OnEnd" callbacks also see the errors of a failed build
+	result = Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "other.js")},
+		Outdir:      path.Join(dir, "out"),
+		Plugins: []Plugin{{
+			Name: "lifecycle",
+			Setup: func(build PluginBuild) {
+				build.OnEnd(func(result BuildResult) {
+					ended = result
+				})
+			},
+		}},
+	})
+	if len(result.Errors) != 1 || len(ended.Errors) != 1 || ended.Errors[0].Text != result.Errors[0].Text {
+		t.Fatalf("Unexpected errors: %v", ended.Errors)
+	}
+}
+
+func TestPluginVirtualModuleSourcesContent(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {value} from 'config'\nconsole.log(value)\n",
+	})
+	entry := path.Join(dir, "entry.js")
+
+	// The source map contains the contents from the plugin before the transform
+	contents := "export let value: number = 1\n"
+	result := Build(BuildOptions{
+		EntryPoints: []string{entry},
+		Outfile:     path.Join(dir, "out.js"),
+		Bundle:      true,
+		Sourcemap:   SourceMapExternal,
+		Plugins: []Plugin{{
+			Name: "config",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `^config$`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: "config.ts", Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					return OnLoadResult{Contents: &contents, Loader: LoaderTS}, nil
+				})
+			},
+		}},
+	})
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	var sourceMap struct {
+		Sources        []string
+		SourcesContent []string
+	}
+	for _, file := range result.OutputFiles {
+		if strings.HasSuffix(file.Path, ".map") {
+			if err := json.Unmarshal(file.Contents, &sourceMap); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i, source := range sourceMap.Sources {
+		if source == "virtual:config.ts" {
+			if sourceMap.SourcesContent[i] != contents {
+				t.Fatalf("Unexpected contents of %s: %q", source, sourceMap.SourcesContent[i])
+			}
+			return
+		}
+	}
+	t.Fatalf("Missing the virtual module in the sources: %v", sourceMap.Sources)
+}
+
+func TestPluginOnResolveWatchFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js":      "import {value} from 'lib'\nconsole.log(value)\n",
+		"a.js":          "export let value = 'a'\n",
+		"b.js":          "export let value = 'b'\n",
+		"manifest.json": "a.js",
+	})
+
+	// The plugin resolves "lib" using the file named in the manifest
+	manifest := path.Join(dir, "manifest.json")
+	internal := buildImpl(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		Incremental:   true,
+		Watch:         &WatchMode{},
+		Plugins: []Plugin{{
+			Name: "manifest",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `^lib$`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					target, err := ioutil.ReadFile(manifest)
+					if err != nil {
+						return OnResolveResult{}, err
+					}
+					return OnResolveResult{Path: path.Join(dir, string(target)), WatchFiles: []string{manifest}}, nil
+				})
+			},
+		}},
+	})
+	result := internal.result
+	result.Stop()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	expectOutput := func(result BuildResult, expected string) {
+		t.Helper()
+		if len(result.OutputFiles) != 1 || !strings.Contains(string(result.OutputFiles[0].Contents), expected) {
+			t.Fatalf("Missing %q in output files: %v", expected, result.OutputFiles)
+		}
+	}
+	expectOutput(result, `var value = "a";`)
+
+	// Changing the manifest is detected by the watcher and resolves "lib" again
+	isChanged := internal.watchData.Paths[manifest]
+	if isChanged == nil {
+		t.Fatalf("The manifest is not watched")
+	}
+	if err := ioutil.WriteFile(manifest, []byte("b.js"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !isChanged() {
+		t.Fatalf("The change of the manifest was not detected")
+	}
+	rebuilt := result.Rebuild()
+	if len(rebuilt.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", rebuilt.Errors)
+	}
+	expectOutput(rebuilt, `var value = "b";`)
+}
+
+func TestWatchOnRebuild(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "import {value} from './dep'\nconsole.log(value)\n",
+		"dep.js":   "export let value = 'old'\n",
+	})
+
+	rebuilds := make(chan BuildResult, 1)
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		LogLevel:      LogLevelSilent,
+		Watch: &WatchMode{
+			OnRebuild: func(result BuildResult) {
+				select {
+				case rebuilds <- result:
+				default:
+				}
+			},
+		},
+	})
+	defer result.Stop()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	// Changing the dependency rebuilds and passes the new output to the callback
+	if err := ioutil.WriteFile(path.Join(dir, "dep.js"), []byte("export let value = 'new'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case rebuilt := <-rebuilds:
+		if len(rebuilt.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", rebuilt.Errors)
+		}
+		if len(rebuilt.OutputFiles) != 1 || !strings.Contains(string(rebuilt.OutputFiles[0].Contents), `var value = "new";`) {
+			t.Fatalf("Missing the new value in output files: %v", rebuilt.OutputFiles)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("The callback was not called after a change of the dependency")
+	}
+}
+
+func TestBuildInvalidPathTemplates(t *testing.T) {
+	for _, test := range []struct {
+		options  BuildOptions
+		expected string
+	}{
+		{BuildOptions{ChunkNames: "../chunks/[name]-[hash]"}, "Invalid chunk names template: \"../chunks/[name]-[hash]\" (must not contain \"..\")"},
+		{BuildOptions{ChunkNames: "[hash]/[name]"}, "Invalid chunk names template: \"[hash]/[name]\" (\"[hash]\" must be in the file name)"},
+		{BuildOptions{AssetNames: "assets/../[name]"}, "Invalid asset names template: \"assets/../[name]\" (must not contain \"..\")"},
+		{BuildOptions{AssetNames: "/assets/[name]"}, "Invalid asset names template: \"/assets/[name]\" (must be a relative path)"},
+	} {
+		test.options.Stdin = &StdinOptions{Contents: ""}
+		test.options.LogLevel = LogLevelSilent
+		result := Build(test.options)
+		if len(result.Errors) != 1 || result.Errors[0].Text != test.expected {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+	}
+}
+
+func TestBuildCancel(t *testing.T) {
+	// Each virtual module imports the next one, so the build would go on
+	// forever if it weren't cancelled while loading the third module
+	cancel := make(chan struct{})
+	loaded := 0
+	options := BuildOptions{
+		EntryPoints: []string{"virtual:0"},
+		Outfile:     "out.js",
+		Bundle:      true,
+		LogLevel:    LogLevelSilent,
+		Cancel:      cancel,
+		Plugins: []Plugin{{
+			Name: "endless",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `^virtual:`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					return OnResolveResult{Path: args.Path, Namespace: "virtual"}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					loaded++
+					if loaded == 3 {
+						close(cancel)
+					}
+					contents := fmt.Sprintf("import 'virtual:%d'", loaded)
+					return OnLoadResult{Contents: &contents}, nil
+				})
+			},
+		}},
+	}
+
+	goroutines := runtime.NumGoroutine()
+	result := Build(options)
+	if !result.Cancelled {
+		t.Fatal("The build was not cancelled")
+	}
+	if len(result.Errors) > 0 || len(result.OutputFiles) > 0 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if loaded != 3 {
+		t.Fatalf("Unexpected count of loaded modules: %d", loaded)
+	}
+
+	// All goroutines started by the build should finish
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i == 100 {
+			t.Fatalf("Leaked goroutines: %d", runtime.NumGoroutine()-goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBuildCancelRebuild(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"entry.js": "console.log(1)\n",
+	})
+
+	cancel := make(chan struct{})
+	close(cancel)
+	result := Build(BuildOptions{
+		EntryPoints:   []string{"entry.js"},
+		AbsWorkingDir: dir,
+		Incremental:   true,
+		LogLevel:      LogLevelSilent,
+		Cancel:        cancel,
+	})
+	if !result.Cancelled || result.Rebuild == nil || result.RebuildWithCancel == nil {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	// The closed channel of the first build does not cancel the rebuilds
+	rebuilt := result.Rebuild()
+	if rebuilt.Cancelled || len(rebuilt.OutputFiles) != 1 {
+		t.Fatalf("Unexpected rebuild: %+v", rebuilt)
+	}
+
+	// Every rebuild can be cancelled by its own channel
+	rebuilt = result.RebuildWithCancel(cancel)
+	if !rebuilt.Cancelled || len(rebuilt.OutputFiles) != 0 {
+		t.Fatalf("Unexpected rebuild: %+v", rebuilt)
+	}
+	rebuilt = result.RebuildWithCancel(make(chan struct{}))
+	if rebuilt.Cancelled || len(rebuilt.OutputFiles) != 1 {
+		t.Fatalf("Unexpected rebuild: %+v", rebuilt)
+	}
+}
+
+func TestBuildEntryNamesHash(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/app.js": "console.log('app')\n",
+	})
+	entry := path.Join(dir, "src", "app.js")
+
+	build := func() string {
+		result := Build(BuildOptions{
+			EntryPoints: []string{entry},
+			Outdir:      path.Join(dir, "out"),
+			Outbase:     dir,
+			EntryNames:  "[dir]/[name]-[hash]",
+			Metafile:    path.Join(dir, "meta.json"),
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		if len(result.OutputFiles) != 2 {
+			t.Fatalf("Unexpected output files: %v", result.OutputFiles)
+		}
+		outPath := result.OutputFiles[0].Path
+		if !strings.HasPrefix(outPath, path.Join(dir, "out", "src", "app-")) || !strings.HasSuffix(outPath, ".js") {
+			t.Fatalf("Unexpected output path: %s", outPath)
+		}
+		relPath := outPath[len(dir)+1:]
+		if !strings.Contains(string(result.Metadata), relPath) {
+			t.Fatalf("Missing %s in the metadata:\n%s", relPath, result.Metadata)
+		}
+		return outPath
+	}
+
+	// Identical input produces identical names
+	first := build()
+	if second := build(); first != second {
+		t.Fatalf("Unexpected different paths: %s != %s", first, second)
+	}
+
+	// Changed input produces a different name
+	if err := ioutil.WriteFile(entry, []byte("console.log('changed')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if third := build(); first == third {
+		t.Fatalf("Unexpected same path: %s", third)
+	}
+}
+
+func TestBuildEntryNamesHashDependencies(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app.js":  "import './app.css'\nconsole.log(import('./page.js'))\n",
+		"app.css": "body { color: red }\n",
+		"page.js": "console.log('page')\n",
+	})
+
+	build := func() map[string]string {
+		result := Build(BuildOptions{
+			EntryPoints: []string{path.Join(dir, "app.js"), path.Join(dir, "page.js")},
+			Outdir:      path.Join(dir, "out"),
+			Bundle:      true,
+			Splitting:   true,
+			Format:      FormatESModule,
+			EntryNames:  "[name]-[hash]",
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+		names := make(map[string]string)
+		for _, outputFile := range result.OutputFiles {
+			base := path.Base(outputFile.Path)
+			names[base[:strings.IndexByte(base, '-')]+path.Ext(base)] = base
+		}
+		if len(names) != 3 {
+			t.Fatalf("Unexpected output files: %v", names)
+		}
+		return names
+	}
+
+	// The CSS file is hashed by its own contents
+	first := build()
+	if jsHash, cssHash := strings.TrimSuffix(first["app.js"], ".js"), strings.TrimSuffix(first["app.css"], ".css"); jsHash == cssHash {
+		t.Fatalf("Unexpected same hash: %s and %s", first["app.js"], first["app.css"])
+	}
+
+	// Changing an imported entry point changes the name of its importer
+	if err := ioutil.WriteFile(path.Join(dir, "page.js"), []byte("console.log('changed')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := build()
+	if first["page.js"] == second["page.js"] || first["app.js"] == second["app.js"] {
+		t.Fatalf("Unexpected same paths: %v and %v", first, second)
+	}
+	if first["app.css"] != second["app.css"] {
+		t.Fatalf("Unexpected different paths: %s and %s", first["app.css"], second["app.css"])
+	}
+}
+
+func TestBuildMultipleFormats(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"index.js": "export let answer = 42\nexport let url = import.meta.url\n",
+	})
+
+	outdir := path.Join(dir, "out")
+	metafile := path.Join(outdir, "meta.json")
+	result := Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "index.js")},
+		Bundle:      true,
+		Formats:     []Format{FormatESModule, FormatCommonJS},
+		Outdir:      outdir,
+		Metafile:    metafile,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(result.OutputFiles) != 3 {
+		t.Fatalf("Expected 3 output files, got %d", len(result.OutputFiles))
+	}
+	esm, cjs, meta := result.OutputFiles[0], result.OutputFiles[1], result.OutputFiles[2]
+	if esm.Path != path.Join(outdir, "index.mjs") || !strings.Contains(string(esm.Contents), "export {") ||
+		!strings.Contains(string(esm.Contents), "import.meta.url") {
+		t.Fatalf("Unexpected ESM output %s: %s", esm.Path, esm.Contents)
+	}
+	if cjs.Path != path.Join(outdir, "index.cjs") || !strings.Contains(string(cjs.Contents), "__export(exports, {") ||
+		strings.Contains(string(cjs.Contents), "import.meta") {
+		t.Fatalf("Unexpected CJS output %s: %s", cjs.Path, cjs.Contents)
+	}
+	if meta.Path != metafile || !strings.Contains(string(meta.Contents), "/out/index.mjs\"") ||
+		!strings.Contains(string(meta.Contents), "/out/index.cjs\"") {
+		t.Fatalf("Unexpected metafile %s: %s", meta.Path, meta.Contents)
+	}
+
+	result = Build(BuildOptions{
+		EntryPoints: []string{path.Join(dir, "index.js")},
+		Bundle:      true,
+		Formats:     []Format{FormatESModule, FormatIIFE},
+		Outdir:      outdir,
+	})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Multiple formats currently only work with the \"esm\" and \"cjs\" formats" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestBuildGeneratePackageExports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/index.ts": "export let answer: number = 42\n",
+		"src/cli.js":   "console.log('cli')\n",
+	})
+
+	result := Build(BuildOptions{
+		AbsWorkingDir:          dir,
+		EntryPoints:            []string{"src/index.ts", "src/cli.js"},
+		Bundle:                 true,
+		Formats:                []Format{FormatESModule, FormatCommonJS},
+		Outdir:                 "dist",
+		GeneratePackageExports: true,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	exports := result.OutputFiles[len(result.OutputFiles)-1]
+	if exports.Path != path.Join(dir, "dist", "package-exports.json") {
+		t.Fatalf("Unexpected path: %s", exports.Path)
+	}
+	expected := `{
+  "exports": {
+    ".": {
+      "types": "./dist/index.d.ts",
+      "import": "./dist/index.mjs",
+      "require": "./dist/index.cjs"
+    },
+    "./cli": {
+      "import": "./dist/cli.mjs",
+      "require": "./dist/cli.cjs"
+    }
+  }
+}
+`
+	if string(exports.Contents) != expected {
+		t.Fatalf("Unexpected exports:\n%s", exports.Contents)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(exports.Contents, &parsed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildPluginImportAttributes(t *testing.T) {
+	var with map[string]string
+	result := Build(BuildOptions{
+		Stdin: &StdinOptions{
+			Contents: "import data from 'virtual:data' with { type: 'json' }\nconsole.log(data)\n",
+		},
+		Bundle: true,
+		Plugins: []Plugin{{
+			Name: "virtual",
+			Setup: func(build PluginBuild) {
+				build.OnResolve(OnResolveOptions{Filter: `^virtual:`}, func(args OnResolveArgs) (OnResolveResult, error) {
+					with = args.With
+					return OnResolveResult{Path: args.Path, Namespace: "virtual", PluginData: args.With["type"]}, nil
+				})
+				build.OnLoad(OnLoadOptions{Filter: `.*`, Namespace: "virtual"}, func(args OnLoadArgs) (OnLoadResult, error) {
+					contents := `{"answer": 42}`
+					loader := LoaderJS
+					if args.PluginData == "json" {
+						loader = LoaderJSON
+					}
+					return OnLoadResult{Contents: &contents, Loader: loader}, nil
+				})
+			},
+		}},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(with) != 1 || with["type"] != "json" {
+		t.Fatalf("Unexpected import attributes: %v", with)
+	}
+	if !strings.Contains(string(result.OutputFiles[0].Contents), "var answer = 42;") {
+		t.Fatalf("Unexpected output: %s", result.OutputFiles[0].Contents)
+	}
+}
@@ -46,6 +46,9 @@ func Run(osArgs []string) int {
 //
 func ParseBuildOptions(osArgs []string) (options api.BuildOptions, err error) {
 	options = newBuildOptions()
+	if err = applyConfigFlags(osArgs, &options); err != nil {
+		return
+	}
 	err = parseOptionsImpl(osArgs, &options, nil, nil)
 	return
 }
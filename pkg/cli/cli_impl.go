@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,7 +13,11 @@ import (
 
 	"github.com/evanw/esbuild/internal/cli_helpers"
 	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/js_ast"
+	"github.com/evanw/esbuild/internal/js_lexer"
+	"github.com/evanw/esbuild/internal/js_parser"
 	"github.com/evanw/esbuild/internal/logger"
+	"github.com/evanw/esbuild/internal/watcher"
 	"github.com/evanw/esbuild/pkg/api"
 )
 
@@ -46,13 +51,39 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 		case arg == "--bundle" && buildOpts != nil:
 			buildOpts.Bundle = true
 
-		case arg == "--analyse" && analyseOpts != nil:
+		case strings.HasPrefix(arg, "--bundle=") && analyseOpts == nil:
+			value, err := parseBoolFlag(arg, "--bundle")
+			if err != nil {
+				return err
+			}
+			if buildOpts != nil {
+				buildOpts.Bundle = value
+			}
+
+		case isAnalyseFlag(arg) && analyseOpts != nil:
 			analyseOpts.Bundle = true
 			analyse = true
 
 		case arg == "--preserve-symlinks" && buildOpts != nil:
 			buildOpts.PreserveSymlinks = true
 
+		case strings.HasPrefix(arg, "--chmod=") && buildOpts != nil:
+			value := arg[len("--chmod="):]
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || mode&^0777 != 0 {
+				return fmt.Errorf("Invalid chmod: %q", value)
+			}
+			buildOpts.OutputMode = uint32(mode)
+
+		case arg == "--report-type-elision" && buildOpts != nil:
+			buildOpts.ReportTypeElision = true
+
+		case arg == "--allow-overwrite" && buildOpts != nil:
+			buildOpts.AllowOverwrite = true
+
+		case arg == "--wasm-module" && buildOpts != nil:
+			buildOpts.WasmModule = true
+
 		case arg == "--splitting":
 			if buildOpts != nil {
 				buildOpts.Splitting = true
@@ -63,44 +94,65 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 		case arg == "--watch" && buildOpts != nil:
 			buildOpts.Watch = &api.WatchMode{}
 
-		case arg == "--minify":
+		case arg == "--metrics" && buildOpts != nil:
+			buildOpts.CollectMetrics = true
+
+		case isBoolFlag(arg, "--minify"):
+			value, err := parseBoolFlag(arg, "--minify")
+			if err != nil {
+				return err
+			}
 			if buildOpts != nil {
-				buildOpts.MinifySyntax = true
-				buildOpts.MinifyWhitespace = true
-				buildOpts.MinifyIdentifiers = true
+				buildOpts.MinifySyntax = value
+				buildOpts.MinifyWhitespace = value
+				buildOpts.MinifyIdentifiers = value
 			} else if transformOpts != nil {
-				transformOpts.MinifySyntax = true
-				transformOpts.MinifyWhitespace = true
-				transformOpts.MinifyIdentifiers = true
+				transformOpts.MinifySyntax = value
+				transformOpts.MinifyWhitespace = value
+				transformOpts.MinifyIdentifiers = value
 			}
 
-		case arg == "--minify-syntax":
+		case isBoolFlag(arg, "--minify-syntax"):
+			value, err := parseBoolFlag(arg, "--minify-syntax")
+			if err != nil {
+				return err
+			}
 			if buildOpts != nil {
-				buildOpts.MinifySyntax = true
+				buildOpts.MinifySyntax = value
 			} else if transformOpts != nil {
-				transformOpts.MinifySyntax = true
+				transformOpts.MinifySyntax = value
 			}
 
-		case arg == "--minify-whitespace":
+		case isBoolFlag(arg, "--minify-whitespace"):
+			value, err := parseBoolFlag(arg, "--minify-whitespace")
+			if err != nil {
+				return err
+			}
 			if buildOpts != nil {
-				buildOpts.MinifyWhitespace = true
+				buildOpts.MinifyWhitespace = value
 			} else if transformOpts != nil {
-				transformOpts.MinifyWhitespace = true
+				transformOpts.MinifyWhitespace = value
 			}
 
-		case arg == "--minify-identifiers":
+		case isBoolFlag(arg, "--minify-identifiers"):
+			value, err := parseBoolFlag(arg, "--minify-identifiers")
+			if err != nil {
+				return err
+			}
 			if buildOpts != nil {
-				buildOpts.MinifyIdentifiers = true
+				buildOpts.MinifyIdentifiers = value
 			} else if transformOpts != nil {
-				transformOpts.MinifyIdentifiers = true
+				transformOpts.MinifyIdentifiers = value
 			}
 
 		case strings.HasPrefix(arg, "--charset="):
 			var value *api.Charset
 			if buildOpts != nil {
 				value = &buildOpts.Charset
-			} else {
+			} else if transformOpts != nil {
 				value = &transformOpts.Charset
+			} else {
+				value = &analyseOpts.Charset
 			}
 			name := arg[len("--charset="):]
 			switch name {
@@ -112,6 +164,48 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				return fmt.Errorf("Invalid charset value: %q (valid: ascii, utf8)", name)
 			}
 
+		case strings.HasPrefix(arg, "--comments=") && (buildOpts != nil || transformOpts != nil):
+			var value *api.Comments
+			if buildOpts != nil {
+				value = &buildOpts.Comments
+			} else {
+				value = &transformOpts.Comments
+			}
+			name := arg[len("--comments="):]
+			switch name {
+			case "all":
+				*value = api.CommentsAll
+			case "none":
+				*value = api.CommentsNone
+			case "legal":
+				*value = api.CommentsLegal
+			default:
+				return fmt.Errorf("Invalid comments value: %q (valid: all, none, legal)", name)
+			}
+
+		case strings.HasPrefix(arg, "--legal-comments=") && (buildOpts != nil || transformOpts != nil):
+			var value *api.LegalComments
+			if buildOpts != nil {
+				value = &buildOpts.LegalComments
+			} else {
+				value = &transformOpts.LegalComments
+			}
+			name := arg[len("--legal-comments="):]
+			switch name {
+			case "none":
+				*value = api.LegalCommentsNone
+			case "inline":
+				*value = api.LegalCommentsInline
+			case "eof":
+				*value = api.LegalCommentsEndOfFile
+			case "linked":
+				*value = api.LegalCommentsLinked
+			case "external":
+				*value = api.LegalCommentsExternal
+			default:
+				return fmt.Errorf("Invalid legal comments value: %q (valid: none, inline, eof, linked, external)", name)
+			}
+
 		case strings.HasPrefix(arg, "--tree-shaking="):
 			var value *api.TreeShaking
 			if buildOpts != nil {
@@ -134,14 +228,29 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				transformOpts.AvoidTDZ = true
 			}
 
-		case arg == "--keep-names":
+		case isBoolFlag(arg, "--keep-names"):
+			value, err := parseBoolFlag(arg, "--keep-names")
+			if err != nil {
+				return err
+			}
 			if buildOpts != nil {
-				buildOpts.KeepNames = true
-			} else {
-				transformOpts.KeepNames = true
+				buildOpts.KeepNames = value
+			} else if transformOpts != nil {
+				transformOpts.KeepNames = value
+			}
+
+		case isBoolFlag(arg, "--mangle-keyframes"):
+			value, err := parseBoolFlag(arg, "--mangle-keyframes")
+			if err != nil {
+				return err
+			}
+			if buildOpts != nil {
+				buildOpts.MangleKeyframes = value
+			} else if transformOpts != nil {
+				transformOpts.MangleKeyframes = value
 			}
 
-		case arg == "--sourcemap":
+		case arg == "--sourcemap" || arg == "--sourcemap=true":
 			if buildOpts != nil {
 				buildOpts.Sourcemap = api.SourceMapLinked
 			} else if transformOpts != nil {
@@ -153,6 +262,8 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 			value := arg[len("--sourcemap="):]
 			var sourcemap api.SourceMap
 			switch value {
+			case "false":
+				sourcemap = api.SourceMapNone
 			case "inline":
 				sourcemap = api.SourceMapInline
 			case "external":
@@ -160,7 +271,7 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 			case "both":
 				sourcemap = api.SourceMapInlineAndExternal
 			default:
-				return fmt.Errorf("Invalid sourcemap: %q (valid: inline, external, both)", value)
+				return fmt.Errorf("Invalid sourcemap: %q (valid: true, false, inline, external, both)", value)
 			}
 			if buildOpts != nil {
 				buildOpts.Sourcemap = sourcemap
@@ -208,6 +319,13 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.ResolveExtensions = strings.Split(arg[len("--resolve-extensions="):], ",")
 			}
 
+		case strings.HasPrefix(arg, "--conditions=") && transformOpts == nil:
+			if buildOpts != nil {
+				buildOpts.Conditions = strings.Split(arg[len("--conditions="):], ",")
+			} else {
+				analyseOpts.Conditions = strings.Split(arg[len("--conditions="):], ",")
+			}
+
 		case strings.HasPrefix(arg, "--main-fields="):
 			if buildOpts != nil {
 				buildOpts.MainFields = strings.Split(arg[len("--main-fields="):], ",")
@@ -215,6 +333,23 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.MainFields = strings.Split(arg[len("--main-fields="):], ",")
 			}
 
+		case strings.HasPrefix(arg, "--entry-names=") && buildOpts != nil:
+			buildOpts.EntryNames = arg[len("--entry-names="):]
+
+		case strings.HasPrefix(arg, "--chunk-names=") && buildOpts != nil:
+			buildOpts.ChunkNames = arg[len("--chunk-names="):]
+
+		case strings.HasPrefix(arg, "--asset-names=") && buildOpts != nil:
+			buildOpts.AssetNames = arg[len("--asset-names="):]
+
+		case strings.HasPrefix(arg, "--asset-inline-limit=") && buildOpts != nil:
+			value := arg[len("--asset-inline-limit="):]
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				return fmt.Errorf("Invalid asset inline limit: %q", value)
+			}
+			buildOpts.AssetInlineLimit = limit
+
 		case strings.HasPrefix(arg, "--public-path=") && buildOpts != nil:
 			buildOpts.PublicPath = arg[len("--public-path="):]
 
@@ -234,12 +369,54 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.Metafile = arg[len("--metafile="):]
 			}
 
+		case isBoolFlag(arg, "--metafile-pretty") && transformOpts == nil:
+			value, err := parseBoolFlag(arg, "--metafile-pretty")
+			if err != nil {
+				return err
+			}
+			if buildOpts != nil {
+				buildOpts.MetafilePretty = value
+			} else {
+				analyseOpts.Pretty = value
+			}
+
+		case strings.HasPrefix(arg, "--trace=") && buildOpts != nil:
+			buildOpts.Trace = arg[len("--trace="):]
+
+		case arg == "--package-exports" && buildOpts != nil:
+			buildOpts.GeneratePackageExports = true
+
+		case arg == "--polyfills" && buildOpts != nil:
+			buildOpts.Polyfills = true
+
+		case arg == "--check-dev-dependencies" && buildOpts != nil:
+			buildOpts.CheckDevDependencies = true
+
+		case strings.HasPrefix(arg, "--restrict-imports=") && buildOpts != nil:
+			buildOpts.RestrictImports = strings.Split(arg[len("--restrict-imports="):], ",")
+
+		case arg == "--include-hashes" && transformOpts == nil:
+			if buildOpts != nil {
+				buildOpts.IncludeHashes = true
+			} else {
+				analyseOpts.IncludeHashes = true
+			}
+
+		case arg == "--include-define-stats" && analyseOpts != nil:
+			analyseOpts.IncludeDefineStats = true
+
+		case strings.HasPrefix(arg, "--config=") && buildOpts != nil:
+			// The config file has already been applied by "applyConfigFlags"
+
 		case strings.HasPrefix(arg, "--outfile=") && buildOpts != nil:
 			buildOpts.Outfile = arg[len("--outfile="):]
 
 		case strings.HasPrefix(arg, "--outdir=") && buildOpts != nil:
 			buildOpts.Outdir = arg[len("--outdir="):]
 
+		case strings.HasPrefix(arg, "--glob-root=") && buildOpts != nil:
+			buildOpts.GlobRoot = arg[len("--glob-root="):]
+
 		case strings.HasPrefix(arg, "--outbase=") && buildOpts != nil:
 			buildOpts.Outbase = arg[len("--outbase="):]
 
@@ -251,15 +428,28 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 			}
 
 		case strings.HasPrefix(arg, "--amdconfig="):
+			// The flag can be repeated to merge more AMD configs into the first one
+			value := arg[len("--amdconfig="):]
 			if buildOpts != nil {
-				buildOpts.AMDConfig = arg[len("--amdconfig="):]
+				if buildOpts.AMDConfig == "" {
+					buildOpts.AMDConfig = value
+				} else {
+					buildOpts.AMDConfigs = append(buildOpts.AMDConfigs, value)
+				}
 			} else {
-				analyseOpts.AMDConfig = arg[len("--amdconfig="):]
+				if analyseOpts.AMDConfig == "" {
+					analyseOpts.AMDConfig = value
+				} else {
+					analyseOpts.AMDConfigs = append(analyseOpts.AMDConfigs, value)
+				}
 			}
 
 		case strings.HasPrefix(arg, "--tsconfig-raw=") && transformOpts != nil:
 			transformOpts.TsconfigRaw = arg[len("--tsconfig-raw="):]
 
+		case arg == "--isolated-modules" && transformOpts != nil:
+			transformOpts.IsolatedModules = true
+
 		case strings.HasPrefix(arg, "--define:"):
 			value := arg[len("--define:"):]
 			equals := strings.IndexByte(value, '=')
@@ -274,6 +464,14 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.Define[value[:equals]] = value[equals+1:]
 			}
 
+		case strings.HasPrefix(arg, "--drop:") && (buildOpts != nil || transformOpts != nil):
+			value := arg[len("--drop:"):]
+			if buildOpts != nil {
+				buildOpts.Drop = append(buildOpts.Drop, value)
+			} else {
+				transformOpts.Drop = append(transformOpts.Drop, value)
+			}
+
 		case strings.HasPrefix(arg, "--pure:"):
 			value := arg[len("--pure:"):]
 			if buildOpts != nil {
@@ -307,8 +505,8 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 			if err != nil {
 				return err
 			}
-			if loader == api.LoaderFile {
-				return fmt.Errorf("Cannot transform using the \"file\" loader")
+			if loader == api.LoaderFile || loader == api.LoaderAsset {
+				return fmt.Errorf("Cannot transform using the %q loader", value)
 			}
 			if buildOpts != nil {
 				if buildOpts.Stdin == nil {
@@ -351,6 +549,20 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 			}
 			buildOpts.OutExtensions[value[:equals]] = value[equals+1:]
 
+		case arg == "--auto-extension" && buildOpts != nil:
+			buildOpts.AutoExtension = true
+
+		case strings.HasPrefix(arg, "--global-external:") && buildOpts != nil:
+			value := arg[len("--global-external:"):]
+			equals := strings.IndexByte(value, '=')
+			if equals == -1 {
+				return fmt.Errorf("Missing \"=\": %q", value)
+			}
+			if buildOpts.GlobalExternals == nil {
+				buildOpts.GlobalExternals = make(map[string]string)
+			}
+			buildOpts.GlobalExternals[value[:equals]] = value[equals+1:]
+
 		case strings.HasPrefix(arg, "--platform="):
 			value := arg[len("--platform="):]
 			switch value {
@@ -378,35 +590,67 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 
 		case strings.HasPrefix(arg, "--format="):
 			value := arg[len("--format="):]
-			switch value {
-			case "iife":
-				if buildOpts != nil {
-					buildOpts.Format = api.FormatIIFE
-				} else {
-					transformOpts.Format = api.FormatIIFE
-				}
-			case "cjs":
-				if buildOpts != nil {
-					buildOpts.Format = api.FormatCommonJS
-				} else {
-					transformOpts.Format = api.FormatCommonJS
-				}
-			case "umd":
-				if buildOpts != nil {
-					buildOpts.Format = api.FormatUMD
-				} else {
-					transformOpts.Format = api.FormatUMD
-				}
-			case "esm":
-				if buildOpts != nil {
-					buildOpts.Format = api.FormatESModule
-				} else {
-					transformOpts.Format = api.FormatESModule
+			if buildOpts != nil && strings.ContainsRune(value, ',') {
+				// Multiple formats are built from the same scan, like "esm,cjs"
+				buildOpts.Format = api.FormatDefault
+				buildOpts.Formats = nil
+				for _, part := range strings.Split(value, ",") {
+					format, err := parseFormat(part)
+					if err != nil {
+						return err
+					}
+					buildOpts.Formats = append(buildOpts.Formats, format)
 				}
-			default:
-				return fmt.Errorf("Invalid format: %q (valid: iife, cjs, umd, esm)", value)
+				break
+			}
+			format, err := parseFormat(value)
+			if err != nil {
+				return err
+			}
+			if buildOpts != nil {
+				buildOpts.Formats = nil
+				buildOpts.Format = format
+			} else {
+				transformOpts.Format = format
 			}
 
+		case strings.HasPrefix(arg, "--entry-format:") && buildOpts != nil:
+			value := arg[len("--entry-format:"):]
+			equals := strings.LastIndexByte(value, '=')
+			if equals == -1 {
+				return fmt.Errorf("Missing \"=\": %q", value)
+			}
+			format, err := parseFormat(value[equals+1:])
+			if err != nil {
+				return err
+			}
+			if buildOpts.EntryPointFormats == nil {
+				buildOpts.EntryPointFormats = make(map[string]api.Format)
+			}
+			buildOpts.EntryPointFormats[value[:equals]] = format
+
+		case strings.HasPrefix(arg, "--entry-banner:") && buildOpts != nil:
+			value := arg[len("--entry-banner:"):]
+			equals := strings.IndexByte(value, '=')
+			if equals == -1 {
+				return fmt.Errorf("Missing \"=\": %q", value)
+			}
+			if buildOpts.EntryPointBanners == nil {
+				buildOpts.EntryPointBanners = make(map[string]string)
+			}
+			buildOpts.EntryPointBanners[value[:equals]] = value[equals+1:]
+
+		case strings.HasPrefix(arg, "--entry-footer:") && buildOpts != nil:
+			value := arg[len("--entry-footer:"):]
+			equals := strings.IndexByte(value, '=')
+			if equals == -1 {
+				return fmt.Errorf("Missing \"=\": %q", value)
+			}
+			if buildOpts.EntryPointFooters == nil {
+				buildOpts.EntryPointFooters = make(map[string]string)
+			}
+			buildOpts.EntryPointFooters[value[:equals]] = value[equals+1:]
+
 		case strings.HasPrefix(arg, "--external:"):
 			if buildOpts != nil {
 				buildOpts.External = append(buildOpts.External, arg[len("--external:"):])
@@ -414,8 +658,47 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.External = append(analyseOpts.External, arg[len("--external:"):])
 			}
 
-		case strings.HasPrefix(arg, "--inject:") && buildOpts != nil:
-			buildOpts.Inject = append(buildOpts.Inject, arg[len("--inject:"):])
+		case strings.HasPrefix(arg, "--no-side-effects:") && buildOpts != nil:
+			buildOpts.NoSideEffects = append(buildOpts.NoSideEffects, arg[len("--no-side-effects:"):])
+
+		case strings.HasPrefix(arg, "--external-file=") && transformOpts == nil:
+			realFS, err := fs.RealFS(fs.RealFSOptions{})
+			if err != nil {
+				return err
+			}
+			externals, err := readExternalFile(realFS, arg[len("--external-file="):])
+			if err != nil {
+				return err
+			}
+			if buildOpts != nil {
+				buildOpts.External = append(buildOpts.External, externals...)
+			} else {
+				analyseOpts.External = append(analyseOpts.External, externals...)
+			}
+
+		case strings.HasPrefix(arg, "--inject:") && analyseOpts == nil:
+			if buildOpts != nil {
+				buildOpts.Inject = append(buildOpts.Inject, arg[len("--inject:"):])
+			} else {
+				transformOpts.Inject = append(transformOpts.Inject, arg[len("--inject:"):])
+			}
+
+		case strings.HasPrefix(arg, "--jsx=") && analyseOpts == nil:
+			var value *api.JSXMode
+			if buildOpts != nil {
+				value = &buildOpts.JSXMode
+			} else {
+				value = &transformOpts.JSXMode
+			}
+			name := arg[len("--jsx="):]
+			switch name {
+			case "transform":
+				*value = api.JSXModeTransform
+			case "preserve":
+				*value = api.JSXModePreserve
+			default:
+				return fmt.Errorf("Invalid JSX mode: %q (valid: transform, preserve)", name)
+			}
 
 		case strings.HasPrefix(arg, "--jsx-factory="):
 			value := arg[len("--jsx-factory="):]
@@ -437,22 +720,38 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.JSXFragment = value
 			}
 
-		case strings.HasPrefix(arg, "--banner="):
-			value := arg[len("--banner="):]
+		case strings.HasPrefix(arg, "--banner=") || strings.HasPrefix(arg, "--banner:js="):
+			value := arg[strings.IndexByte(arg, '=')+1:]
 			if buildOpts != nil {
 				buildOpts.Banner = value
 			} else {
 				transformOpts.Banner = value
 			}
 
-		case strings.HasPrefix(arg, "--footer="):
-			value := arg[len("--footer="):]
+		case strings.HasPrefix(arg, "--banner:css="):
+			value := arg[len("--banner:css="):]
+			if buildOpts != nil {
+				buildOpts.BannerCSS = value
+			} else {
+				transformOpts.BannerCSS = value
+			}
+
+		case strings.HasPrefix(arg, "--footer=") || strings.HasPrefix(arg, "--footer:js="):
+			value := arg[strings.IndexByte(arg, '=')+1:]
 			if buildOpts != nil {
 				buildOpts.Footer = value
 			} else {
 				transformOpts.Footer = value
 			}
 
+		case strings.HasPrefix(arg, "--footer:css="):
+			value := arg[len("--footer:css="):]
+			if buildOpts != nil {
+				buildOpts.FooterCSS = value
+			} else {
+				transformOpts.FooterCSS = value
+			}
+
 		case strings.HasPrefix(arg, "--error-limit="):
 			value := arg[len("--error-limit="):]
 			limit, err := strconv.Atoi(value)
@@ -511,6 +810,38 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 				analyseOpts.LogLevel = logLevel
 			}
 
+		case strings.HasPrefix(arg, "--log-override:"):
+			value := arg[len("--log-override:"):]
+			equals := strings.IndexByte(value, '=')
+			if equals == -1 {
+				return fmt.Errorf("Missing \"=\": %q", value)
+			}
+			var logLevel api.LogLevel
+			switch value[equals+1:] {
+			case "info":
+				logLevel = api.LogLevelInfo
+			case "warning":
+				logLevel = api.LogLevelWarning
+			case "error":
+				logLevel = api.LogLevelError
+			case "silent":
+				logLevel = api.LogLevelSilent
+			default:
+				return fmt.Errorf("Invalid log override level: %q (valid: info, warning, error, silent)", arg)
+			}
+			var logOverride *map[string]api.LogLevel
+			if buildOpts != nil {
+				logOverride = &buildOpts.LogOverride
+			} else if transformOpts != nil {
+				logOverride = &transformOpts.LogOverride
+			} else {
+				logOverride = &analyseOpts.LogOverride
+			}
+			if *logOverride == nil {
+				*logOverride = make(map[string]api.LogLevel)
+			}
+			(*logOverride)[value[:equals]] = logLevel
+
 		case strings.HasPrefix(arg, "'--"):
 			return fmt.Errorf("Unexpected single quote character before flag (use \\\" to escape double quotes): %s", arg)
 
@@ -548,6 +879,43 @@ func parseOptionsImpl(osArgs []string, buildOpts *api.BuildOptions, transformOpt
 	return nil
 }
 
+// Boolean flags can be passed either alone, which turns them on, or with an
+// explicit value, so that a flag passed earlier can be turned off again
+func isBoolFlag(arg string, flag string) bool {
+	return arg == flag || strings.HasPrefix(arg, flag+"=")
+}
+
+func parseBoolFlag(arg string, flag string) (bool, error) {
+	if arg == flag {
+		return true, nil
+	}
+	switch value := arg[len(flag)+1:]; value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("Invalid %s value: %q (valid: false, true)", flag[2:], value)
+	}
+}
+
+func parseFormat(value string) (api.Format, error) {
+	switch value {
+	case "iife":
+		return api.FormatIIFE, nil
+	case "cjs":
+		return api.FormatCommonJS, nil
+	case "umd":
+		return api.FormatUMD, nil
+	case "system":
+		return api.FormatSystemJS, nil
+	case "esm":
+		return api.FormatESModule, nil
+	default:
+		return api.FormatDefault, fmt.Errorf("Invalid format: %q (valid: iife, cjs, umd, system, esm)", value)
+	}
+}
+
 func parseTargets(targets []string) (target api.Target, engines []api.Engine, err error) {
 	validTargets := map[string]api.Target{
 		"esnext": api.ESNext,
@@ -568,6 +936,10 @@ func parseTargets(targets []string) (target api.Target, engines []api.Engine, er
 		"edge":    api.EngineEdge,
 		"node":    api.EngineNode,
 		"ios":     api.EngineIOS,
+		"opera":   api.EngineOpera,
+		"samsung": api.EngineSamsung,
+		"deno":    api.EngineDeno,
+		"hermes":  api.EngineHermes,
 	}
 
 outer:
@@ -599,37 +971,263 @@ outer:
 	return
 }
 
+func applyConfigFlags(osArgs []string, buildOpts *api.BuildOptions) error {
+	for _, arg := range osArgs {
+		if strings.HasPrefix(arg, "--config=") {
+			realFS, err := fs.RealFS(fs.RealFSOptions{})
+			if err != nil {
+				return err
+			}
+			if err := applyConfigFile(realFS, arg[len("--config="):], buildOpts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The externals file lists one module per line like the "--external:" flag.
+// Blank lines and lines starting with "#" are ignored.
+func readExternalFile(fs fs.FS, path string) ([]string, error) {
+	absPath := path
+	if !fs.IsAbs(absPath) {
+		absPath = fs.Join(fs.Cwd(), path)
+	}
+	contents, err := fs.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read from externals file %q: %s", path, err.Error())
+	}
+	var externals []string
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			externals = append(externals, line)
+		}
+	}
+	return externals, nil
+}
+
+// The configuration file holds an object with a subset of the build options.
+// They are applied before the command-line flags, so that the flags can still
+// override them. Lists and maps from the file are extended by the flags.
+func applyConfigFile(fs fs.FS, path string, buildOpts *api.BuildOptions) error {
+	absPath := path
+	if !fs.IsAbs(absPath) {
+		absPath = fs.Join(fs.Cwd(), path)
+	}
+	contents, err := fs.ReadFile(absPath)
+	if err != nil {
+		return fmt.Errorf("Could not read from config file %q: %s", path, err.Error())
+	}
+	source := logger.Source{
+		KeyPath:    logger.Path{Text: absPath, Namespace: "file"},
+		PrettyPath: path,
+		Contents:   contents,
+	}
+
+	log := logger.NewDeferLog()
+	json, ok := js_parser.ParseJSON(log, source, js_parser.JSONOptions{
+		AllowComments:       true,
+		AllowTrailingCommas: true,
+	})
+	if !ok {
+		for _, msg := range log.Done() {
+			if msg.Kind == logger.Error {
+				return configError(msg.Data.Location, msg.Data.Text)
+			}
+		}
+		return fmt.Errorf("Could not parse config file %q", path)
+	}
+	obj, ok := json.Data.(*js_ast.EObject)
+	if !ok {
+		return configError(logger.LocationOrNil(&source, logger.Range{Loc: json.Loc}), "The config file must contain an object")
+	}
+
+	for _, prop := range obj.Properties {
+		key, _ := configString(prop.Key)
+		value := *prop.Value
+		location := logger.LocationOrNil(&source, logger.Range{Loc: value.Loc})
+
+		switch key {
+		case "bundle":
+			bundle, ok := value.Data.(*js_ast.EBoolean)
+			if !ok {
+				return configError(location, "\"bundle\" must be a boolean")
+			}
+			buildOpts.Bundle = bundle.Value
+
+		case "define":
+			entries, ok := configStringMap(value)
+			if !ok {
+				return configError(location, "\"define\" must be an object with string values")
+			}
+			for key, value := range entries {
+				buildOpts.Define[key] = value
+			}
+
+		case "entryPoints":
+			entryPoints, ok := configStringArray(value)
+			if !ok {
+				return configError(location, "\"entryPoints\" must be an array of strings")
+			}
+			buildOpts.EntryPoints = append(buildOpts.EntryPoints, entryPoints...)
+
+		case "external":
+			external, ok := configStringArray(value)
+			if !ok {
+				return configError(location, "\"external\" must be an array of strings")
+			}
+			buildOpts.External = append(buildOpts.External, external...)
+
+		case "format":
+			text, ok := configString(value)
+			if !ok {
+				return configError(location, "\"format\" must be a string")
+			}
+			format, err := parseFormat(text)
+			if err != nil {
+				return configError(location, err.Error())
+			}
+			buildOpts.Format = format
+
+		case "loader":
+			entries, ok := configStringMap(value)
+			if !ok {
+				return configError(location, "\"loader\" must be an object with string values")
+			}
+			for ext, text := range entries {
+				loader, err := cli_helpers.ParseLoader(text)
+				if err != nil {
+					return configError(location, err.Error())
+				}
+				buildOpts.Loader[ext] = loader
+			}
+
+		case "outdir":
+			outdir, ok := configString(value)
+			if !ok {
+				return configError(location, "\"outdir\" must be a string")
+			}
+			buildOpts.Outdir = outdir
+
+		case "target":
+			targets, ok := configStringArray(value)
+			if !ok {
+				if text, isString := configString(value); isString {
+					targets, ok = []string{text}, true
+				}
+			}
+			if !ok {
+				return configError(location, "\"target\" must be a string or an array of strings")
+			}
+			target, engines, err := parseTargets(targets)
+			if err != nil {
+				return configError(location, err.Error())
+			}
+			buildOpts.Target = target
+			buildOpts.Engines = engines
+
+		default:
+			return configError(logger.LocationOrNil(&source, logger.Range{Loc: prop.Key.Loc}), fmt.Sprintf(
+				"Unknown option %q (valid: bundle, define, entryPoints, external, format, loader, outdir, target)", key))
+		}
+	}
+	return nil
+}
+
+func configError(location *logger.MsgLocation, text string) error {
+	if location == nil {
+		return fmt.Errorf("%s", text)
+	}
+	return fmt.Errorf("%s:%d:%d: %s", location.File, location.Line, location.Column, text)
+}
+
+func configString(json js_ast.Expr) (string, bool) {
+	if value, ok := json.Data.(*js_ast.EString); ok {
+		return js_lexer.UTF16ToString(value.Value), true
+	}
+	return "", false
+}
+
+func configStringArray(json js_ast.Expr) ([]string, bool) {
+	array, ok := json.Data.(*js_ast.EArray)
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, len(array.Items))
+	for i, item := range array.Items {
+		if result[i], ok = configString(item); !ok {
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+func configStringMap(json js_ast.Expr) (map[string]string, bool) {
+	obj, ok := json.Data.(*js_ast.EObject)
+	if !ok {
+		return nil, false
+	}
+	result := make(map[string]string, len(obj.Properties))
+	for _, prop := range obj.Properties {
+		key, _ := configString(prop.Key)
+		value, ok := configString(*prop.Value)
+		if !ok {
+			return nil, false
+		}
+		result[key] = value
+	}
+	return result, true
+}
+
 // This returns either BuildOptions, TransformOptions, or an error
+// Both the British and the American spelling are accepted, because upstream
+// esbuild uses the latter
+func isAnalyseFlag(arg string) bool {
+	return arg == "--analyse" || arg == "--analyze"
+}
+
 func parseOptionsForRun(osArgs []string) (*api.BuildOptions, *api.TransformOptions, *api.AnalyseOptions, error) {
-	// If there's an entry point or we're bundling, then we're building
 	// If there's the --analyse flag set, then we're analysing
 	for _, arg := range osArgs {
-		if !strings.HasPrefix(arg, "-") || arg == "--bundle" {
-			options := newBuildOptions()
+		if isAnalyseFlag(arg) {
+			options := newAnalyseOptions()
 
 			// Apply defaults appropriate for the CLI
 			options.ErrorLimit = 10
 			options.LogLevel = api.LogLevelInfo
 			options.Write = true
 
-			err := parseOptionsImpl(osArgs, &options, nil, nil)
+			err := parseOptionsImpl(osArgs, nil, nil, &options)
 			if err != nil {
 				return nil, nil, nil, err
 			}
-			return &options, nil, nil, nil
-		} else if !strings.HasPrefix(arg, "-") || arg == "--analyse" {
-			options := newAnalyseOptions()
+			return nil, nil, &options, nil
+		}
+	}
+
+	// If there's an entry point, a config file or we're bundling, then we're
+	// building. Only "--bundle=false" does not force building, so that it can
+	// always be passed.
+	for _, arg := range osArgs {
+		if !strings.HasPrefix(arg, "-") || arg == "--bundle" || arg == "--bundle=true" || strings.HasPrefix(arg, "--config=") {
+			options := newBuildOptions()
 
 			// Apply defaults appropriate for the CLI
 			options.ErrorLimit = 10
 			options.LogLevel = api.LogLevelInfo
 			options.Write = true
 
-			err := parseOptionsImpl(osArgs, nil, nil, &options)
+			// Apply the config file first, so that the flags override it
+			if err := applyConfigFlags(osArgs, &options); err != nil {
+				return nil, nil, nil, err
+			}
+
+			err := parseOptionsImpl(osArgs, &options, nil, nil)
 			if err != nil {
 				return nil, nil, nil, err
 			}
-			return nil, nil, &options, nil
+			return &options, nil, nil, nil
 		}
 	}
 
@@ -665,6 +1263,16 @@ func runImpl(osArgs []string) int {
 			return 0
 		}
 
+		// Special-case validating the AMD config
+		if arg == "--amd-validate" {
+			return amdValidateImpl(osArgs)
+		}
+
+		// Special-case transforming a file given by its path
+		if arg == "--transform" {
+			return transformFileImpl(osArgs)
+		}
+
 		// Filter out the "--summary" flag
 		if arg == "--summary" {
 			shouldPrintSummary = true
@@ -738,6 +1346,11 @@ func runImpl(osArgs []string) int {
 			printSummary(osArgs, result.OutputFiles, start)
 		}
 
+		// Print the durations of the build phases to stderr
+		if result.Metrics != nil {
+			printMetrics(osArgs, *result.Metrics)
+		}
+
 	case transformOptions != nil:
 		// Read the input from stdin
 		bytes, err := ioutil.ReadAll(os.Stdin)
@@ -773,7 +1386,7 @@ func runImpl(osArgs []string) int {
 					// On Windows, NODE_PATH is delimited by semicolons instead of colons
 					separator = ";"
 				}
-				buildOptions.NodePaths = strings.Split(value, separator)
+				analyseOptions.NodePaths = strings.Split(value, separator)
 				break
 			}
 		}
@@ -816,6 +1429,19 @@ func runImpl(osArgs []string) int {
 	return 0
 }
 
+func printMetrics(osArgs []string, metrics api.BuildMetrics) {
+	logger.PrintText(os.Stderr, logger.LevelInfo, osArgs, func(colors logger.Colors) string {
+		return fmt.Sprintf("\n  %sResolver:%s %s\n  %sScan:%s     %s (%d files)\n  %sCompile:%s  %s\n\n",
+			colors.Dim, colors.Default, formatDuration(metrics.ResolverTime),
+			colors.Dim, colors.Default, formatDuration(metrics.ScanTime), metrics.FilesParsed,
+			colors.Dim, colors.Default, formatDuration(metrics.CompileTime))
+	})
+}
+
+func formatDuration(duration time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(duration.Microseconds())/1000)
+}
+
 func printSummary(osArgs []string, outputFiles []api.OutputFile, start time.Time) {
 	var table logger.SummaryTable = make([]logger.SummaryTableEntry, len(outputFiles))
 
@@ -933,3 +1559,226 @@ func serveImpl(osArgs []string) error {
 	})
 	return result.Wait()
 }
+
+func amdValidateImpl(osArgs []string) int {
+	// Filter out the flag that brought us here
+	filteredArgs := make([]string, 0, len(osArgs))
+	for _, arg := range osArgs {
+		if arg != "--amd-validate" {
+			filteredArgs = append(filteredArgs, arg)
+		}
+	}
+
+	options := newBuildOptions()
+
+	// Apply defaults appropriate for the CLI
+	options.ErrorLimit = 10
+	options.LogLevel = api.LogLevelInfo
+
+	if err := parseOptionsImpl(filteredArgs, &options, nil, nil); err != nil {
+		logger.PrintErrorToStderr(filteredArgs, err.Error())
+		return 1
+	}
+	if options.AMDConfig == "" {
+		logger.PrintErrorToStderr(filteredArgs, "Must use \"--amdconfig\" with \"--amd-validate\"")
+		return 1
+	}
+
+	// Resolve relative paths in the AMD config like the build does
+	cwd, err := os.Getwd()
+	if err != nil {
+		logger.PrintErrorToStderr(filteredArgs, err.Error())
+		return 1
+	}
+
+	result := api.ValidateAMDConfig(api.AMDConfigOptions{
+		Color:         options.Color,
+		ErrorLimit:    options.ErrorLimit,
+		LogLevel:      options.LogLevel,
+		AbsWorkingDir: cwd,
+		AMDConfig:     options.AMDConfig,
+	})
+
+	// Print a summary to stderr
+	logger.PrintText(os.Stderr, logger.LevelInfo, filteredArgs, func(colors logger.Colors) string {
+		if len(result.Errors) > 0 {
+			problems := "problems"
+			if len(result.Errors) == 1 {
+				problems = "problem"
+			}
+			return fmt.Sprintf("%sFound %d %s in the AMD config %q%s\n",
+				colors.Red, len(result.Errors), problems, options.AMDConfig, colors.Default)
+		}
+		return fmt.Sprintf("%sThe AMD config %q is valid%s\n", colors.Green, options.AMDConfig, colors.Default)
+	})
+
+	if len(result.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func transformFileImpl(osArgs []string) int {
+	shouldPrintSummary := false
+	shouldWatch := false
+	outfile := ""
+	start := time.Now()
+
+	// Filter out the flag that brought us here and the file path
+	var paths []string
+	filteredArgs := make([]string, 0, len(osArgs))
+	for _, arg := range osArgs {
+		switch {
+		case arg == "--transform":
+		case arg == "--summary":
+			shouldPrintSummary = true
+		case arg == "--watch":
+			shouldWatch = true
+		case strings.HasPrefix(arg, "--outfile="):
+			outfile = arg[len("--outfile="):]
+		case !strings.HasPrefix(arg, "-"):
+			paths = append(paths, arg)
+		default:
+			filteredArgs = append(filteredArgs, arg)
+		}
+	}
+	if len(paths) != 1 {
+		logger.PrintErrorToStderr(osArgs, "Must provide exactly one file with \"--transform\"")
+		return 1
+	}
+
+	options := newTransformOptions()
+
+	// Apply defaults appropriate for the CLI
+	options.ErrorLimit = 10
+	options.LogLevel = api.LogLevelInfo
+
+	if err := parseOptionsImpl(filteredArgs, nil, &options, nil); err != nil {
+		logger.PrintErrorToStderr(osArgs, err.Error())
+		return 1
+	}
+	if options.Sourcemap != api.SourceMapNone && options.Sourcemap != api.SourceMapInline {
+		logger.PrintErrorToStderr(osArgs, "Must use \"inline\" source map when transforming a file")
+		return 1
+	}
+
+	// Write the output to stdout or to the output file
+	writeResult := func(result api.TransformResult, err error) bool {
+		if err != nil {
+			logger.PrintErrorToStderr(osArgs, err.Error())
+			return false
+		}
+		if len(result.Errors) > 0 {
+			return false
+		}
+		if outfile == "" {
+			os.Stdout.Write(result.Code)
+		} else if err := os.MkdirAll(filepath.Dir(outfile), 0755); err != nil {
+			logger.PrintErrorToStderr(osArgs, fmt.Sprintf(
+				"Failed to create output directory: %s", err.Error()))
+			return false
+		} else if err := ioutil.WriteFile(outfile, result.Code, 0644); err != nil {
+			logger.PrintErrorToStderr(osArgs, fmt.Sprintf(
+				"Failed to write to output file: %s", err.Error()))
+			return false
+		}
+		return true
+	}
+
+	// Do not exit if we're in watch mode. Errors are reported, but they do not
+	// stop watching, so that the file can be fixed.
+	if shouldWatch {
+		logLevel := logger.LevelSilent
+		if options.LogLevel == api.LogLevelInfo {
+			logLevel = logger.LevelInfo
+		}
+		useColor := logger.ColorIfTerminal
+		switch options.Color {
+		case api.ColorNever:
+			useColor = logger.ColorNever
+		case api.ColorAlways:
+			useColor = logger.ColorAlways
+		}
+		watchTransformFile(paths[0], options, logLevel, useColor, func(result api.TransformResult, err error) {
+			writeResult(result, err)
+		})
+		<-make(chan bool)
+	}
+
+	realFS, err := fs.RealFS(fs.RealFSOptions{})
+	if err != nil {
+		logger.PrintErrorToStderr(osArgs, err.Error())
+		return 1
+	}
+
+	// Run the transform and stop if there were errors
+	result, err := transformFile(realFS, paths[0], options)
+	if !writeResult(result, err) {
+		return 1
+	}
+
+	// Print a summary to stderr
+	if shouldPrintSummary {
+		printSummary(osArgs, nil, start)
+	}
+	return 0
+}
+
+// This transforms the file and then transforms it again whenever it changes.
+// The callback receives the result of every run.
+func watchTransformFile(
+	path string,
+	options api.TransformOptions,
+	logLevel logger.LogLevel,
+	useColor logger.UseColor,
+	onResult func(api.TransformResult, error),
+) *watcher.Watcher {
+	var realFS fs.FS
+	run := func() fs.WatchData {
+		var err error
+		realFS, err = fs.RealFS(fs.RealFSOptions{WantWatchData: true})
+		if err != nil {
+			onResult(api.TransformResult{}, err)
+			return fs.WatchData{}
+		}
+		onResult(transformFile(realFS, path, options))
+		return realFS.WatchData()
+	}
+
+	w := &watcher.Watcher{
+		Name: "transform",
+		PrettyPath: func(absPath string) string {
+			if relPath, ok := realFS.Rel(realFS.Cwd(), absPath); ok {
+				return relPath
+			}
+			return absPath
+		},
+		Rerun: run,
+	}
+	w.SetWatchData(run())
+	w.Start(logLevel, useColor)
+	return w
+}
+
+// This reads the file like it was piped to stdin. The loader is inferred from
+// the file extension and the file path is used as the source file name in
+// source maps, unless they are set explicitly.
+func transformFile(fs fs.FS, path string, options api.TransformOptions) (api.TransformResult, error) {
+	absPath := path
+	if !fs.IsAbs(absPath) {
+		absPath = fs.Join(fs.Cwd(), path)
+	}
+	contents, err := fs.ReadFile(absPath)
+	if err != nil {
+		return api.TransformResult{}, fmt.Errorf("Could not read from file %q: %s", path, err.Error())
+	}
+
+	if options.Loader == api.LoaderNone {
+		options.Loader = api.LoaderForFile(path)
+	}
+	if options.Sourcefile == "" {
+		options.Sourcefile = path
+	}
+
+	return api.Transform(contents, options), nil
+}
@@ -0,0 +1,578 @@
+package cli
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanw/esbuild/internal/fs"
+	"github.com/evanw/esbuild/internal/logger"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+func TestTransformFileWithInlineSourceMap(t *testing.T) {
+	mockFS := fs.MockFS(map[string]string{
+		"/src/file.ts": "let x: number = 1\nexport {x}\n",
+	})
+	options := newTransformOptions()
+	options.Sourcemap = api.SourceMapInline
+
+	result, err := transformFile(mockFS, "src/file.ts", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	const prefix = "//# sourceMappingURL=data:application/json;base64,"
+	code := string(result.Code)
+	index := strings.Index(code, prefix)
+	if index < 0 {
+		t.Fatalf("Missing inline source map:\n%s", code)
+	}
+	if expected := "let x = 1;\nexport {x};\n"; code[:index] != expected {
+		t.Fatalf("\n%s\n!=\n%s", code[:index], expected)
+	}
+	sourceMap, err := base64.StdEncoding.DecodeString(strings.TrimSpace(code[index+len(prefix):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(sourceMap), `"sources": ["src/file.ts"]`) {
+		t.Fatalf("Unexpected source map:\n%s", sourceMap)
+	}
+}
+
+func TestTransformFileMissing(t *testing.T) {
+	_, err := transformFile(fs.MockFS(map[string]string{}), "missing.ts", newTransformOptions())
+	if err == nil || !strings.HasPrefix(err.Error(), `Could not read from file "missing.ts"`) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestWatchTransformFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"file.ts": "let x: number = 1\n",
+	})
+	file := path.Join(dir, "file.ts")
+
+	results := make(chan string, 10)
+	w := watchTransformFile(file, newTransformOptions(), logger.LevelSilent, logger.ColorNever,
+		func(result api.TransformResult, err error) {
+			if err != nil {
+				results <- err.Error()
+			} else {
+				results <- string(result.Code)
+			}
+		})
+	defer w.Stop()
+
+	expectResult := func(expected string) {
+		t.Helper()
+		select {
+		case code := <-results:
+			if code != expected {
+				t.Fatalf("\n%s\n!=\n%s", code, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("The transform did not run again")
+		}
+	}
+	expectResult("let x = 1;\n")
+
+	// A syntax error is reported, but the file is still watched
+	if err := ioutil.WriteFile(file, []byte("let x: number = \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectResult("")
+
+	if err := ioutil.WriteFile(file, []byte("let y: string = '2'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectResult("let y = \"2\";\n")
+}
+
+func TestParseEntryPointFormats(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"lib.js", "cli.js", "--bundle", "--format=esm", "--entry-format:cli.js=cjs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.EntryPointFormats) != 1 || options.EntryPointFormats["cli.js"] != api.FormatCommonJS {
+		t.Fatalf("Unexpected entry point formats: %v", options.EntryPointFormats)
+	}
+
+	_, err = ParseBuildOptions([]string{"cli.js", "--entry-format:cli.js=amd"})
+	if err == nil || err.Error() != `Invalid format: "amd" (valid: iife, cjs, umd, system, esm)` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseAnalyseCharset(t *testing.T) {
+	options, err := ParseAnalyseOptions([]string{"--analyse", "entry.js", "--charset=utf8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Charset != api.CharsetUTF8 {
+		t.Fatalf("Unexpected charset: %v", options.Charset)
+	}
+}
+
+func TestParseAnalyseSpellings(t *testing.T) {
+	for _, flag := range []string{"--analyse", "--analyze"} {
+		for _, args := range [][]string{{flag, "entry.js"}, {"entry.js", flag}} {
+			buildOptions, transformOptions, analyseOptions, err := parseOptionsForRun(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buildOptions != nil || transformOptions != nil || analyseOptions == nil {
+				t.Fatalf("Expected an analyse run for %v", args)
+			}
+			if len(analyseOptions.EntryPoints) != 1 || analyseOptions.EntryPoints[0] != "entry.js" {
+				t.Fatalf("Unexpected entry points: %v", analyseOptions.EntryPoints)
+			}
+		}
+	}
+}
+
+func TestParseBundleValue(t *testing.T) {
+	buildOptions, _, _, err := parseOptionsForRun([]string{"entry.js", "--bundle", "--bundle=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buildOptions == nil || buildOptions.Bundle {
+		t.Fatalf("Expected a build without bundling")
+	}
+
+	buildOptions, _, _, err = parseOptionsForRun([]string{"--bundle=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buildOptions == nil || !buildOptions.Bundle {
+		t.Fatalf("Expected a build with bundling")
+	}
+
+	buildOptions, transformOptions, _, err := parseOptionsForRun([]string{"--bundle=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buildOptions != nil || transformOptions == nil {
+		t.Fatalf("Expected a transform")
+	}
+
+	_, err = ParseBuildOptions([]string{"entry.js", "--bundle=yes"})
+	if err == nil || err.Error() != `Invalid bundle value: "yes" (valid: false, true)` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseOperaAndSamsungTargets(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"entry.js", "--target=opera76,samsung14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []api.Engine{
+		{Name: api.EngineOpera, Version: "76"},
+		{Name: api.EngineSamsung, Version: "14"},
+	}
+	if len(options.Engines) != 2 || options.Engines[0] != expected[0] || options.Engines[1] != expected[1] {
+		t.Fatalf("Unexpected engines: %v", options.Engines)
+	}
+}
+
+func TestParseDenoAndHermesTargets(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"entry.js", "--target=deno1.10,hermes0.70"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []api.Engine{
+		{Name: api.EngineDeno, Version: "1.10"},
+		{Name: api.EngineHermes, Version: "0.70"},
+	}
+	if len(options.Engines) != 2 || options.Engines[0] != expected[0] || options.Engines[1] != expected[1] {
+		t.Fatalf("Unexpected engines: %v", options.Engines)
+	}
+}
+
+func TestParseBoolFlagValues(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"entry.js", "--minify", "--minify=false", "--keep-names", "--keep-names=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.MinifySyntax || options.MinifyWhitespace || options.MinifyIdentifiers || options.KeepNames {
+		t.Fatalf("Expected minification and keeping names to be off")
+	}
+
+	options, err = ParseBuildOptions([]string{"entry.js", "--minify", "--minify-syntax=false", "--sourcemap", "--sourcemap=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.MinifySyntax || !options.MinifyWhitespace || !options.MinifyIdentifiers {
+		t.Fatalf("Expected only the syntax minification to be off")
+	}
+	if options.Sourcemap != api.SourceMapNone {
+		t.Fatalf("Expected no source map")
+	}
+
+	transformOptions, err := ParseTransformOptions([]string{"--minify-whitespace=false", "--minify-whitespace=true", "--sourcemap=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !transformOptions.MinifyWhitespace || transformOptions.Sourcemap != api.SourceMapInline {
+		t.Fatalf("Expected whitespace minification and an inline source map")
+	}
+
+	_, err = ParseBuildOptions([]string{"entry.js", "--minify=1"})
+	if err == nil || err.Error() != `Invalid minify value: "1" (valid: false, true)` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"entry.js", "--metrics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.CollectMetrics {
+		t.Fatal("Expected metrics to be collected")
+	}
+}
+
+func TestTransformFileDeepOutfile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"file.ts": "let x: number = 1\n",
+	})
+	file := path.Join(dir, "file.ts")
+
+	outfile := path.Join(dir, "out", "deep", "file.js")
+	if code := Run([]string{"--transform", file, "--outfile=" + outfile, "--log-level=silent"}); code != 0 {
+		t.Fatalf("Unexpected exit code: %d", code)
+	}
+	if code, err := ioutil.ReadFile(outfile); err != nil {
+		t.Fatal(err)
+	} else if string(code) != "let x = 1;\n" {
+		t.Fatalf("Unexpected output: %s", code)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	mockFS := fs.MockFS(map[string]string{
+		"/esbuild.json": `{
+			// Comments and trailing commas are allowed
+			"entryPoints": ["src/a.js", "src/b.js"],
+			"outdir": "dist",
+			"bundle": true,
+			"format": "esm",
+			"define": { "DEBUG": "false" },
+			"loader": { ".svg": "text" },
+			"external": ["fs"],
+			"target": ["es2018", "node12"],
+		}`,
+		"/unknown.json": `{
+			"bundle": true,
+			"minify": true
+		}`,
+		"/invalid.json": `{ "format": "amd" }`,
+	})
+
+	options := newBuildOptions()
+	if err := applyConfigFile(mockFS, "esbuild.json", &options); err != nil {
+		t.Fatal(err)
+	}
+	if len(options.EntryPoints) != 2 || options.EntryPoints[0] != "src/a.js" || options.EntryPoints[1] != "src/b.js" {
+		t.Fatalf("Unexpected entry points: %v", options.EntryPoints)
+	}
+	if options.Outdir != "dist" || !options.Bundle || options.Format != api.FormatESModule {
+		t.Fatalf("Unexpected options: %v %v %v", options.Outdir, options.Bundle, options.Format)
+	}
+	if options.Define["DEBUG"] != "false" || options.Loader[".svg"] != api.LoaderText {
+		t.Fatalf("Unexpected maps: %v %v", options.Define, options.Loader)
+	}
+	if len(options.External) != 1 || options.External[0] != "fs" {
+		t.Fatalf("Unexpected externals: %v", options.External)
+	}
+	if options.Target != api.ES2018 || len(options.Engines) != 1 || options.Engines[0] != (api.Engine{Name: api.EngineNode, Version: "12"}) {
+		t.Fatalf("Unexpected target: %v %v", options.Target, options.Engines)
+	}
+
+	options = newBuildOptions()
+	err := applyConfigFile(mockFS, "unknown.json", &options)
+	if err == nil || err.Error() != `unknown.json:3:3: Unknown option "minify" (valid: bundle, define, entryPoints, external, format, loader, outdir, target)` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	options = newBuildOptions()
+	err = applyConfigFile(mockFS, "invalid.json", &options)
+	if err == nil || err.Error() != `invalid.json:1:12: Invalid format: "amd" (valid: iife, cjs, umd, system, esm)` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	options = newBuildOptions()
+	err = applyConfigFile(mockFS, "missing.json", &options)
+	if err == nil || !strings.HasPrefix(err.Error(), `Could not read from config file "missing.json"`) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseConfigFlag(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"esbuild.json": `{ "entryPoints": ["entry.js"], "outdir": "dist", "format": "cjs" }`,
+	})
+	file := path.Join(dir, "esbuild.json")
+
+	// The config file alone is enough to start a build and flags override it
+	buildOptions, _, _, err := parseOptionsForRun([]string{"--format=esm", "--config=" + file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buildOptions == nil {
+		t.Fatalf("Expected a build")
+	}
+	if len(buildOptions.EntryPoints) != 1 || buildOptions.Outdir != "dist" || buildOptions.Format != api.FormatESModule {
+		t.Fatalf("Unexpected options: %v %v %v", buildOptions.EntryPoints, buildOptions.Outdir, buildOptions.Format)
+	}
+}
+
+func TestParseLogOverride(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"entry.js",
+		"--log-override:equals-nan=error", "--log-override:duplicate-object-key=silent",
+		"--log-override:impossible-typeof=info"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.LogOverride) != 3 ||
+		options.LogOverride["equals-nan"] != api.LogLevelError ||
+		options.LogOverride["duplicate-object-key"] != api.LogLevelSilent ||
+		options.LogOverride["impossible-typeof"] != api.LogLevelInfo {
+		t.Fatalf("Unexpected log overrides: %v", options.LogOverride)
+	}
+
+	if _, err := ParseBuildOptions([]string{"entry.js", "--log-override:equals-nan=verbose"}); err == nil ||
+		err.Error() != `Invalid log override level: "--log-override:equals-nan=verbose" (valid: info, warning, error, silent)` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestTransformLogOverride(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"file.js": "if (x === NaN) y({ a: 1, a: 2 })\n",
+	})
+	file := path.Join(dir, "file.js")
+
+	outfile := path.Join(dir, "out.js")
+	if code := Run([]string{"--transform", file, "--outfile=" + outfile, "--log-level=silent"}); code != 0 {
+		t.Fatalf("Unexpected exit code: %d", code)
+	}
+	if code := Run([]string{"--transform", file, "--outfile=" + outfile, "--log-level=silent",
+		"--log-override:equals-nan=error", "--log-override:duplicate-object-key=silent"}); code != 1 {
+		t.Fatalf("Unexpected exit code: %d", code)
+	}
+}
+
+func TestTransformDefineCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"file.js": "console.log(a, b)\n",
+	})
+	file := path.Join(dir, "file.js")
+
+	outfile := path.Join(dir, "out.js")
+	if code := Run([]string{"--transform", file, "--outfile=" + outfile, "--log-level=silent",
+		"--define:a=b", "--define:b=a"}); code != 1 {
+		t.Fatalf("Unexpected exit code: %d", code)
+	}
+}
+
+func TestAnalyseNodePath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/shared/index.js": "export default 1\n",
+		"entry.js":            "import shared from 'shared'\nconsole.log(shared)\n",
+	})
+	entry := path.Join(dir, "entry.js")
+
+	old, ok := os.LookupEnv("NODE_PATH")
+	os.Setenv("NODE_PATH", path.Join(dir, "lib"))
+	defer func() {
+		if ok {
+			os.Setenv("NODE_PATH", old)
+		} else {
+			os.Unsetenv("NODE_PATH")
+		}
+	}()
+
+	if code := Run([]string{"--analyse", entry, "--log-level=silent"}); code != 0 {
+		t.Fatalf("Unexpected exit code: %d", code)
+	}
+}
+
+func TestParseConditions(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"entry.js", "--conditions=worker,development"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Conditions) != 2 || options.Conditions[0] != "worker" || options.Conditions[1] != "development" {
+		t.Fatalf("Unexpected conditions: %v", options.Conditions)
+	}
+}
+
+func TestParseConditionsTransform(t *testing.T) {
+	if _, err := ParseTransformOptions([]string{"--conditions=worker"}); err == nil {
+		t.Fatal("Expected an error for conditions in the transform mode")
+	}
+}
+
+func TestParseJSXMode(t *testing.T) {
+	options, err := ParseTransformOptions([]string{"--jsx=preserve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.JSXMode != api.JSXModePreserve {
+		t.Fatalf("Unexpected JSX mode: %v", options.JSXMode)
+	}
+
+	if _, err := ParseBuildOptions([]string{"entry.jsx", "--jsx=keep"}); err == nil ||
+		err.Error() != "Invalid JSX mode: \"keep\" (valid: transform, preserve)" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseDrop(t *testing.T) {
+	options, err := ParseTransformOptions([]string{"--drop:console.log", "--drop:debugger"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Drop) != 2 || options.Drop[0] != "console.log" || options.Drop[1] != "debugger" {
+		t.Fatalf("Unexpected drop: %v", options.Drop)
+	}
+
+	result := api.Transform("console.log(1); console.error(2)", options)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if code := string(result.Code); code != "console.error(2);\n" {
+		t.Fatalf("Unexpected code: %q", code)
+	}
+
+	result = api.Transform("", api.TransformOptions{Drop: []string{"window.alert"}})
+	if len(result.Errors) != 1 || result.Errors[0].Text != "Invalid drop value: \"window.alert\" (valid: console, console.METHOD, debugger)" {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestParseChmod(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"--chmod=755"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.OutputMode != 0755 {
+		t.Fatalf("Unexpected output mode: %o", options.OutputMode)
+	}
+
+	for _, value := range []string{"rwx", "1755", "9"} {
+		if _, err := ParseBuildOptions([]string{"--chmod=" + value}); err == nil || err.Error() != "Invalid chmod: \""+value+"\"" {
+			t.Fatalf("Unexpected error for %q: %v", value, err)
+		}
+	}
+}
+
+func TestParseEntryBanner(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"--entry-banner:worker.js=/* a=b */", "--entry-footer:worker.js=// end"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.EntryPointBanners["worker.js"] != "/* a=b */" || options.EntryPointFooters["worker.js"] != "// end" {
+		t.Fatalf("Unexpected banners and footers: %v %v", options.EntryPointBanners, options.EntryPointFooters)
+	}
+
+	if _, err := ParseBuildOptions([]string{"--entry-banner:worker.js"}); err == nil || err.Error() != "Missing \"=\": \"worker.js\"" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseMultipleFormats(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"--format=esm", "--format=esm,cjs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Format != api.FormatDefault || len(options.Formats) != 2 ||
+		options.Formats[0] != api.FormatESModule || options.Formats[1] != api.FormatCommonJS {
+		t.Fatalf("Unexpected formats: %v %v", options.Format, options.Formats)
+	}
+
+	if _, err := ParseTransformOptions([]string{"--format=esm,cjs"}); err == nil {
+		t.Fatal("Expected an error for multiple formats in a transform")
+	}
+}
+
+func TestParseMultipleAMDConfigs(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"--amdconfig=base.json", "--amdconfig=a.json", "--amdconfig=b.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.AMDConfig != "base.json" || len(options.AMDConfigs) != 2 ||
+		options.AMDConfigs[0] != "a.json" || options.AMDConfigs[1] != "b.json" {
+		t.Fatalf("Unexpected AMD configs: %q %v", options.AMDConfig, options.AMDConfigs)
+	}
+}
+
+func TestParseExternalFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"externals.txt": "# Libraries\nreact\n\n  @scope/*  \r\n/abs/path.js\n",
+	})
+	file := path.Join(dir, "externals.txt")
+
+	options, err := ParseBuildOptions([]string{"--external:lodash", "--external-file=" + file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(options.External, " ") != "lodash react @scope/* /abs/path.js" {
+		t.Fatalf("Unexpected externals: %v", options.External)
+	}
+
+	if _, err := ParseBuildOptions([]string{"--external-file=" + path.Join(dir, "missing.txt")}); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
+
+func TestParseAssetInlineLimit(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"--asset-inline-limit=8192", "--loader:.png=asset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.AssetInlineLimit != 8192 || options.Loader[".png"] != api.LoaderAsset {
+		t.Fatalf("Unexpected options: %d %v", options.AssetInlineLimit, options.Loader)
+	}
+
+	if _, err := ParseBuildOptions([]string{"--asset-inline-limit=-1"}); err == nil || err.Error() != "Invalid asset inline limit: \"-1\"" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseNoSideEffects(t *testing.T) {
+	options, err := ParseBuildOptions([]string{"--no-side-effects:lodash", "--no-side-effects:./src/polyfill.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(options.NoSideEffects, " ") != "lodash ./src/polyfill.js" {
+		t.Fatalf("Unexpected modules: %v", options.NoSideEffects)
+	}
+}
+
+// This writes the files to a new temporary directory, which is removed when
+// the test ends, and returns the path of the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		file := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
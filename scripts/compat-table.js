@@ -76,12 +76,16 @@ const features = {
 const versions = {}
 const engines = [
   'chrome',
+  'deno',
   'edge',
   'es',
   'firefox',
+  'hermes',
   'ios',
   'node',
+  'opera',
   'safari',
+  'samsung',
 ]
 
 function mergeVersions(target, res) {
@@ -183,11 +187,99 @@ for (const feature in features) {
   }
 }
 
+// Opera and Samsung Internet are based on Chromium, so their versions are
+// derived from the Chrome version that each feature was first supported in.
+// Opera 15 was the first release based on Chromium (Chromium 28) and Samsung
+// Internet publishes the Chromium version of each release.
+const samsungChromiumVersions = [
+  [[1], 18],
+  [[1, 5], 28],
+  [[2], 34],
+  [[3], 38],
+  [[4], 44],
+  [[5], 51],
+  [[6, 2], 56],
+  [[7, 2], 59],
+  [[8, 2], 63],
+  [[9, 2], 67],
+  [[10, 1], 71],
+  [[11, 1], 75],
+  [[12], 79],
+  [[13], 83],
+  [[14], 87],
+  [[15], 90],
+]
+
+// Deno is based on V8, so its versions are derived from the Chromium version
+// with the same V8 version. Deno 1.0 shipped with V8 8.4 (Chromium 84).
+const denoChromiumVersions = [
+  [[1, 0], 84],
+  [[1, 2], 85],
+  [[1, 3], 86],
+  [[1, 5], 87],
+  [[1, 6], 88],
+  [[1, 7], 89],
+  [[1, 9], 90],
+  [[1, 10], 91],
+  [[1, 12], 92],
+  [[1, 13], 93],
+  [[1, 14], 94],
+]
+
+for (const target in versions) {
+  const map = versions[target]
+  if (map.chrome) {
+    const chrome = map.chrome[0]
+    map.opera = [Math.max(chrome - 13, 15)]
+    const samsung = samsungChromiumVersions.find(([, chromium]) => chromium >= chrome)
+    if (samsung) map.samsung = samsung[0]
+    const deno = denoChromiumVersions.find(([, chromium]) => chromium >= chrome)
+    if (deno) map.deno = deno[0]
+  }
+}
+
+// Hermes isn't in the compatibility table and doesn't follow any browser, so
+// this conservatively lists only the features that Hermes 0.7 (the first
+// release for both Android and iOS) is known to support. Everything else is
+// considered unsupported and is lowered or reported as an error.
+const hermesFeatures = [
+  'ArraySpread',
+  'Arrow',
+  'Const',
+  'DefaultArgument',
+  'Destructuring',
+  'ExponentOperator',
+  'ForOf',
+  'Generator',
+  'Let',
+  'NestedRestBinding',
+  'NewTarget',
+  'NullishCoalescing',
+  'ObjectAccessors',
+  'ObjectExtensions',
+  'ObjectRestSpread',
+  'OptionalCatchBinding',
+  'OptionalChain',
+  'RestArgument',
+  'TemplateLiteral',
+  'UnicodeEscapes',
+]
+
+for (const target of hermesFeatures) {
+  versions[target].hermes = [0, 7]
+}
+
 function upper(text) {
   if (text === 'es' || text === 'ios') return text.toUpperCase()
   return text[0].toUpperCase() + text.slice(1)
 }
 
+function kebab(text) {
+  return text.replace(/[A-Z]/g, (c, i) => (i ? '-' : '') + c.toLowerCase())
+}
+
+const maxFeatureNameLength = Object.keys(versions).reduce((a, b) => Math.max(a, kebab(b).length), 0)
+
 function writeInnerMap(obj) {
   const keys = Object.keys(obj).sort()
   const maxLength = keys.reduce((a, b) => Math.max(a, b.length + 1), 0)
@@ -216,6 +308,10 @@ func (features JSFeature) Has(feature JSFeature) bool {
 \treturn (features & feature) != 0
 }
 
+var StringToJSFeature = map[string]JSFeature{
+${Object.keys(versions).sort().map(x => `\t"${kebab(x)}": ${' '.repeat(maxFeatureNameLength - kebab(x).length)}${x},`).join('\n')}
+}
+
 var jsTable = map[JSFeature]map[Engine][]int{
 ${Object.keys(versions).sort().map(x => `\t${x}: ${writeInnerMap(versions[x])},`).join('\n')}
 }
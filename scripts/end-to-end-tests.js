@@ -2293,6 +2293,30 @@
     }, { async: true }),
   )
 
+  // Code splitting into CommonJS keeps the imports from other chunks live
+  for (const minify of [[], ['--minify']]) {
+    tests.push(test(['a.js', 'b.js', '--outdir=out', '--splitting', '--format=cjs', '--bundle'].concat(minify), {
+      'a.js': `
+        import {foo, bump} from './shared'
+        bump()
+        export let a = foo
+      `,
+      'b.js': `
+        import {foo} from './shared'
+        export let b = () => foo
+      `,
+      'shared.js': `
+        export let foo = 1
+        export function bump() { foo++ }
+      `,
+      'node.js': `
+        const {a} = require('./out/a.js')
+        const {b} = require('./out/b.js')
+        if (a !== 2 || b() !== 2) throw 'fail'
+      `,
+    }))
+  }
+
   // Test the binary loader
   for (const length of [0, 1, 2, 3, 4, 5, 6, 7, 8, 256]) {
     const code = `
@@ -2407,6 +2431,34 @@
     }),
   )
 
+  // Test building several formats from one scan
+  tests.push(
+    test(['--bundle', 'in.js', '--outdir=out', '--format=esm,cjs'], {
+      'in.js': `
+        export let url = import.meta.url
+        export let load = path => import(path)
+      `,
+      'node.js': `
+        const assert = require('assert')
+        const cjs = require('./out/in.cjs')
+        assert.strictEqual(cjs.url, undefined)
+        exports.async = async () => {
+          assert.strictEqual(typeof (await cjs.load('assert')).strictEqual, 'function')
+          const esm = await import('./out/in.mjs')
+          assert.strictEqual(esm.url, require('url').pathToFileURL(require('path').join(__dirname, 'out', 'in.mjs')).href)
+        }
+      `,
+    }, {
+      async: true,
+      expectedStderr: ` > in.js: warning: This dynamic import will not be bundled because the argument is not a string literal
+    3 │         export let load = path => import(path)
+      ╵                                   ~~~~~~
+
+1 warning
+`,
+    }),
+  )
+
   // Test writing to stdout
   tests.push(
     // These should succeed
@@ -2461,13 +2513,14 @@
       const hasUMD = args.includes('--format=umd')
       const hasCJS = args.includes('--format=cjs')
       const hasESM = args.includes('--format=esm')
-      const formats = hasIIFE ? ['iife'] : hasUMD ? ['umd'] : hasESM ? ['esm'] : hasCJS || !hasBundle ? ['cjs'] : ['cjs', 'esm']
+      const hasFormats = args.some(arg => arg.startsWith('--format=') && arg.includes(','))
+      const formats = hasIIFE ? ['iife'] : hasUMD ? ['umd'] : hasESM ? ['esm'] : hasCJS || hasFormats || !hasBundle ? ['cjs'] : ['cjs', 'esm']
       const expectedStderr = options && options.expectedStderr || '';
 
       // If the test doesn't specify a format, test both formats
       for (const format of formats) {
         const formatArg = `--format=${format}`
-        const modifiedArgs = !hasBundle || args.includes(formatArg) ? args : args.concat(formatArg)
+        const modifiedArgs = !hasBundle || hasFormats || args.includes(formatArg) ? args : args.concat(formatArg)
         const thisTestDir = path.join(testDir, '' + testCount++)
 
         try {